@@ -143,6 +143,7 @@ func New(ctx context.Context, cfg config.OAuthConfig) (http.Handler, error) {
 	mux.HandleFunc("GET /info", func(w http.ResponseWriter, r *http.Request) {
 		type AuthInfoDTO struct {
 			LoggedIn bool   `json:"active"`
+			ID       string `json:"id,omitempty"`
 			Username string `json:"username,omitempty"`
 		}
 
@@ -151,6 +152,7 @@ func New(ctx context.Context, cfg config.OAuthConfig) (http.Handler, error) {
 		dto := AuthInfoDTO{}
 		if p != nil {
 			dto.LoggedIn = true
+			dto.ID = p.ID
 			dto.Username = p.Name
 		}
 
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/halimath/d20-tools/config"
+	"github.com/halimath/d20-tools/encounter"
+	"github.com/halimath/d20-tools/infra/shelf"
+)
+
+// runImportBestiary implements the import-bestiary command which imports
+// SRD or Open5e monster files into the bestiary of a user.
+func runImportBestiary(args []string) int {
+	flags := flag.NewFlagSet("import-bestiary", flag.ContinueOnError)
+	userID := flags.String("user", "", "id of the user to import the kinds for")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: d20-tools import-bestiary -user <id> <file>...")
+		fmt.Fprintln(flags.Output(), "The server using the database must be stopped while importing.")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *userID == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+		return 1
+	}
+
+	shlf, err := shelf.OpenFile(cfg.GridDBPath)
+	if errors.Is(err, shelf.ErrLocked) {
+		fmt.Fprintf(os.Stderr, "%s is in use: stop the server before importing\n", cfg.GridDBPath)
+		return 3
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "db configuration error: %v\n", err)
+		return 3
+	}
+	defer shlf.Close()
+
+	srv := encounter.NewService(encounter.NewRepository(shlf))
+
+	exitCode := 0
+	for _, filename := range flags.Args() {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			exitCode = 1
+			continue
+		}
+
+		result, mapped, err := srv.ImportBestiaryForUser(*userID, data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			exitCode = 1
+			continue
+		}
+
+		fmt.Printf("%s: %d created, %d updated\n", filename, len(result.Created), len(result.Updated))
+		for _, mk := range mapped {
+			switch {
+			case mk.Err != nil:
+				fmt.Printf("  %s: skipped: %v\n", mk.Name, mk.Err)
+			case len(mk.Unmapped) > 0:
+				fmt.Printf("  %s: unmapped %s\n", mk.Name, strings.Join(mk.Unmapped, ", "))
+			}
+		}
+	}
+
+	return exitCode
+}
@@ -2,10 +2,14 @@ package config
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/sethvargo/go-envconfig"
 )
 
+var ErrInvalidConfig = errors.New("invalid config")
+
 type OAuthConfig struct {
 	ProviderURL  string `env:"PROVIDER_URL"`
 	ClientID     string `env:"CLIENT_ID"`
@@ -18,6 +22,8 @@ type Config struct {
 
 	GridDBPath string `env:"GRID_DB_PATH, default=grid.db"`
 
+	GridRevisionLimit int `env:"GRID_REVISION_LIMIT, default=50"`
+
 	DevMode bool `env:"DEV_MODE"`
 
 	OAuth OAuthConfig
@@ -26,6 +32,13 @@ type Config struct {
 func New() (Config, error) {
 	ctx := context.Background()
 	var cfg Config
-	err := envconfig.Process(ctx, &cfg)
-	return cfg, err
+	if err := envconfig.Process(ctx, &cfg); err != nil {
+		return cfg, err
+	}
+
+	if cfg.GridRevisionLimit < 1 {
+		return cfg, fmt.Errorf("%w: GRID_REVISION_LIMIT must be at least 1: %d", ErrInvalidConfig, cfg.GridRevisionLimit)
+	}
+
+	return cfg, nil
 }
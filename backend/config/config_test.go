@@ -19,8 +19,9 @@ func TestNew(t *testing.T) {
 	expect.That(t,
 		is.NoError(err),
 		is.DeepEqualTo(cfg, Config{
-			HTTPPort:   9090,
-			GridDBPath: "some/path",
+			HTTPPort:          9090,
+			GridDBPath:        "some/path",
+			GridRevisionLimit: 50,
 			OAuth: OAuthConfig{
 				ProviderURL:  "providerURL",
 				ClientID:     "clientID",
@@ -29,3 +30,10 @@ func TestNew(t *testing.T) {
 		}),
 	)
 }
+
+func TestNew_invalidRevisionLimit(t *testing.T) {
+	t.Setenv("GRID_REVISION_LIMIT", "0")
+
+	_, err := New()
+	expect.That(t, is.Error(err, ErrInvalidConfig))
+}
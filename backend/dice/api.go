@@ -0,0 +1,168 @@
+package dice
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/halimath/d20-tools/infra/jsonbody"
+	"github.com/halimath/httputils/response"
+	"github.com/halimath/kvlog"
+)
+
+type (
+	RollRequestDTO struct {
+		Expression string `json:"expression"`
+	}
+
+	DieDTO struct {
+		Value    int  `json:"value"`
+		Kept     bool `json:"kept"`
+		Exploded bool `json:"exploded,omitempty"`
+		Rerolled bool `json:"rerolled,omitempty"`
+	}
+
+	TermResultDTO struct {
+		Expression string   `json:"expression"`
+		Negative   bool     `json:"negative,omitempty"`
+		Dice       []DieDTO `json:"dice,omitempty"`
+		Value      int      `json:"value"`
+	}
+
+	ProbabilityDTO struct {
+		Value int     `json:"value"`
+		P     float64 `json:"p"`
+	}
+
+	StatsDTO struct {
+		Expression string           `json:"expression"`
+		Min        int              `json:"min"`
+		Max        int              `json:"max"`
+		Mean       float64          `json:"mean"`
+		StdDev     float64          `json:"stdDev"`
+		PMF        []ProbabilityDTO `json:"pmf"`
+		CDF        []ProbabilityDTO `json:"cdf"`
+		DC         *int             `json:"dc,omitempty"`
+		// AtLeast is the probability of meeting or beating DC.
+		AtLeast *float64 `json:"atLeast,omitempty"`
+	}
+
+	ResultDTO struct {
+		Expression string          `json:"expression"`
+		Terms      []TermResultDTO `json:"terms"`
+		Total      int             `json:"total"`
+	}
+)
+
+// Handler creates a http.Handler rolling dice using src. The handler expects
+// to be mounted below /api.
+func Handler(src Source) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /roll", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+
+		dto, err := jsonbody.Read[RollRequestDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		expr, err := Parse(dto.Expression)
+		if err != nil {
+			handleError(w, r, err, "failed to parse dice expression")
+			return
+		}
+
+		result := expr.Roll(src)
+		logger.Logs("rolled dice", kvlog.WithKV("expression", expr.String()), kvlog.WithKV("total", result.Total))
+
+		response.JSON(w, r, ToResultDTO(result))
+	})
+
+	mux.HandleFunc("GET /roll/stats", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		q := r.URL.Query()
+
+		expr, err := Parse(q.Get("expr"))
+		if err != nil {
+			handleError(w, r, err, "failed to parse dice expression")
+			return
+		}
+
+		logger.Logs("computing dice statistics", kvlog.WithKV("expression", expr.String()))
+
+		d, err := expr.Distribution()
+		if err != nil {
+			handleError(w, r, err, "failed to compute distribution")
+			return
+		}
+
+		dto := StatsDTO{
+			Expression: expr.String(),
+			Min:        d.Min(),
+			Max:        d.Max(),
+			Mean:       d.Mean(),
+			StdDev:     d.StdDev(),
+			PMF:        toProbabilityDTOs(d.PMF()),
+			CDF:        toProbabilityDTOs(d.CDF()),
+		}
+
+		if q.Has("dc") {
+			dc, err := strconv.Atoi(q.Get("dc"))
+			if err != nil {
+				http.Error(w, "invalid dc", http.StatusBadRequest)
+				return
+			}
+			atLeast := d.AtLeast(dc)
+			dto.DC, dto.AtLeast = &dc, &atLeast
+		}
+
+		response.JSON(w, r, dto)
+	})
+
+	return mux
+}
+
+func handleError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, ErrInvalidExpression), errors.Is(err, ErrNoDistribution):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		kvlog.FromContext(r.Context()).Logs(msg, kvlog.WithErr(err))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func toProbabilityDTOs(ps []Probability) []ProbabilityDTO {
+	dtos := make([]ProbabilityDTO, len(ps))
+	for i, p := range ps {
+		dtos[i] = ProbabilityDTO(p)
+	}
+	return dtos
+}
+
+// ToResultDTO converts r into its DTO.
+func ToResultDTO(r Result) ResultDTO {
+	dto := ResultDTO{
+		Expression: r.Expression.String(),
+		Terms:      make([]TermResultDTO, len(r.Terms)),
+		Total:      r.Total,
+	}
+
+	for i, t := range r.Terms {
+		dto.Terms[i] = TermResultDTO{
+			Expression: t.Term.String(),
+			Negative:   t.Term.Negative,
+			Value:      t.Value,
+		}
+
+		if len(t.Dice) > 0 {
+			dto.Terms[i].Dice = make([]DieDTO, len(t.Dice))
+			for j, d := range t.Dice {
+				dto.Terms[i].Dice[j] = DieDTO(d)
+			}
+		}
+	}
+
+	return dto
+}
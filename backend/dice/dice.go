@@ -0,0 +1,287 @@
+// Package dice implements a dice expression language and a roller for it.
+//
+// An expression is a sum of terms. Every term is either a constant or a roll
+// of dice, such as 4d6kh3, 1d20adv, 3d6!, 2d6r1, 4dF or d%. See Parse for the
+// full grammar. Rolling an expression produces a Result which contains every
+// single die rolled, including dropped, rerolled and exploded dice.
+// Expression.Distribution computes the exact probability distribution of an
+// expression's total.
+package dice
+
+import (
+	"cmp"
+	"crypto/rand"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Source produces the random numbers used to roll dice.
+type Source interface {
+	// Intn returns a uniformly distributed number in [0, n).
+	Intn(n int) int
+}
+
+// CryptoSource is a Source using crypto/rand.
+var CryptoSource Source = cryptoSource{}
+
+type cryptoSource struct{}
+
+func (cryptoSource) Intn(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		// crypto/rand's Reader never returns an error
+		panic(err)
+	}
+	return int(v.Int64())
+}
+
+// SelectMode defines which of a term's dice are kept.
+type SelectMode int
+
+const (
+	// SelectAll keeps all dice.
+	SelectAll SelectMode = iota
+	// KeepHighest keeps the N highest dice.
+	KeepHighest
+	// KeepLowest keeps the N lowest dice.
+	KeepLowest
+	// DropHighest drops the N highest dice.
+	DropHighest
+	// DropLowest drops the N lowest dice.
+	DropLowest
+)
+
+var selectModeSuffixes = map[SelectMode]string{
+	KeepHighest: "kh",
+	KeepLowest:  "kl",
+	DropHighest: "dh",
+	DropLowest:  "dl",
+}
+
+// Selection selects the dice of a term counting towards its value.
+type Selection struct {
+	Mode SelectMode
+	N    int
+}
+
+// FudgeSides is the number of sides of a fudge die showing -1, 0 or 1.
+const FudgeSides = 3
+
+// Term is a single summand of an expression. A term with a Count of zero is a
+// constant.
+type Term struct {
+	// Negative marks terms which are subtracted.
+	Negative bool
+
+	// Constant is the value of a constant term.
+	Constant int
+
+	// Count is the number of dice to roll.
+	Count int
+	// Sides is the number of sides of every die. Fudge dice have FudgeSides
+	// sides.
+	Sides int
+	// Fudge marks fudge dice showing -1, 0 or 1.
+	Fudge bool
+	// Select selects the dice counting towards the term's value.
+	Select Selection
+	// Explode rolls an additional die whenever a die shows its maximum.
+	Explode bool
+	// Reroll rerolls dice showing Reroll or less once. Zero disables rerolls.
+	Reroll int
+}
+
+// IsConstant reports whether t is a constant term.
+func (t Term) IsConstant() bool {
+	return t.Count == 0
+}
+
+// Min returns the lowest value a single die of t shows.
+func (t Term) Min() int {
+	if t.Fudge {
+		return -1
+	}
+	return 1
+}
+
+// Max returns the highest value a single die of t shows.
+func (t Term) Max() int {
+	if t.Fudge {
+		return 1
+	}
+	return t.Sides
+}
+
+// String returns the canonical notation of t without its sign.
+func (t Term) String() string {
+	if t.IsConstant() {
+		return strconv.Itoa(t.Constant)
+	}
+
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(t.Count))
+	b.WriteByte('d')
+	if t.Fudge {
+		b.WriteByte('F')
+	} else {
+		b.WriteString(strconv.Itoa(t.Sides))
+	}
+	if t.Reroll > 0 {
+		b.WriteByte('r')
+		b.WriteString(strconv.Itoa(t.Reroll))
+	}
+	if t.Explode {
+		b.WriteByte('!')
+	}
+	if t.Select.Mode != SelectAll {
+		b.WriteString(selectModeSuffixes[t.Select.Mode])
+		b.WriteString(strconv.Itoa(t.Select.N))
+	}
+	return b.String()
+}
+
+// Expression is a parsed dice expression.
+type Expression struct {
+	Terms []Term
+}
+
+// String returns the canonical notation of e.
+func (e Expression) String() string {
+	var b strings.Builder
+	for i, t := range e.Terms {
+		switch {
+		case t.Negative:
+			b.WriteByte('-')
+		case i > 0:
+			b.WriteByte('+')
+		}
+		b.WriteString(t.String())
+	}
+	return b.String()
+}
+
+// Die is a single die rolled.
+type Die struct {
+	// Value is the number shown by the die.
+	Value int
+	// Kept reports whether the die counts towards its term's value.
+	Kept bool
+	// Exploded marks dice rolled because another die exploded.
+	Exploded bool
+	// Rerolled marks dice which have been rerolled. They never count towards
+	// the term's value; the reroll follows them directly.
+	Rerolled bool
+}
+
+// TermResult is the result of rolling a single term.
+type TermResult struct {
+	Term Term
+	// Dice contains all dice rolled in order. It is empty for constants.
+	Dice []Die
+	// Value is the term's contribution to the total including its sign.
+	Value int
+}
+
+// Result is the result of rolling an expression.
+type Result struct {
+	Expression Expression
+	Terms      []TermResult
+	Total      int
+}
+
+// maxExplosions limits the number of additional dice rolled for a single
+// term due to exploding dice.
+const maxExplosions = 100
+
+// Roll rolls all dice of e using src.
+func (e Expression) Roll(src Source) Result {
+	r := Result{
+		Expression: e,
+		Terms:      make([]TermResult, len(e.Terms)),
+	}
+
+	for i, t := range e.Terms {
+		r.Terms[i] = t.roll(src)
+		r.Total += r.Terms[i].Value
+	}
+
+	return r
+}
+
+func (t Term) roll(src Source) TermResult {
+	r := TermResult{Term: t}
+
+	if t.IsConstant() {
+		r.Value = t.Constant
+	} else {
+		rollDie := func() int { return t.Min() + src.Intn(t.Sides) }
+
+		explosions := 0
+		for range t.Count {
+			exploded := false
+			for {
+				v := rollDie()
+				if t.Reroll > 0 && v <= t.Reroll {
+					r.Dice = append(r.Dice, Die{Value: v, Exploded: exploded, Rerolled: true})
+					v = rollDie()
+				}
+				r.Dice = append(r.Dice, Die{Value: v, Exploded: exploded})
+
+				if !t.Explode || v != t.Max() || explosions == maxExplosions {
+					break
+				}
+				explosions++
+				exploded = true
+			}
+		}
+
+		t.Select.apply(r.Dice)
+
+		for _, d := range r.Dice {
+			if d.Kept {
+				r.Value += d.Value
+			}
+		}
+	}
+
+	if t.Negative {
+		r.Value = -r.Value
+	}
+
+	return r
+}
+
+// apply marks the dice selected by s as kept. Rerolled dice are never kept.
+func (s Selection) apply(dice []Die) {
+	var pool []int
+	for i := range dice {
+		if !dice[i].Rerolled {
+			pool = append(pool, i)
+		}
+	}
+
+	// Sort the pool from highest to lowest. The stable sort keeps dice with
+	// equal values in the order they have been rolled.
+	slices.SortStableFunc(pool, func(a, b int) int {
+		return cmp.Compare(dice[b].Value, dice[a].Value)
+	})
+
+	from, to := 0, len(pool)
+	n := min(s.N, len(pool))
+	switch s.Mode {
+	case KeepHighest:
+		to = n
+	case KeepLowest:
+		from = len(pool) - n
+	case DropHighest:
+		from = n
+	case DropLowest:
+		to = len(pool) - n
+	}
+
+	for _, i := range pool[from:to] {
+		dice[i].Kept = true
+	}
+}
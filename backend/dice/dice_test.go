@@ -0,0 +1,185 @@
+package dice
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+// sequence is a Source returning predefined values in order.
+type sequence []int
+
+func (s *sequence) Intn(n int) int {
+	v := (*s)[0]
+	*s = (*s)[1:]
+	return v % n
+}
+
+func roll(t *testing.T, expr string, values ...int) Result {
+	src := sequence(values)
+	r := MustParse(expr).Roll(&src)
+	expect.That(t, is.SliceOfLen(src, 0))
+	return r
+}
+
+func TestRoll(t *testing.T) {
+	r := roll(t, "2d6+3", 0, 5)
+
+	expect.That(t,
+		is.EqualTo(r.Total, 10),
+		is.SliceOfLen(r.Terms, 2),
+		is.DeepEqualTo(r.Terms[0].Dice, []Die{{Value: 1, Kept: true}, {Value: 6, Kept: true}}),
+		is.EqualTo(r.Terms[1].Value, 3),
+	)
+}
+
+func TestRoll_negative(t *testing.T) {
+	r := roll(t, "-1d4+1", 3)
+
+	expect.That(t,
+		is.EqualTo(r.Terms[0].Value, -4),
+		is.EqualTo(r.Total, -3),
+	)
+}
+
+func TestRoll_keepAndDrop(t *testing.T) {
+	tests := map[string]struct {
+		kept  []bool
+		total int
+	}{
+		"4d6kh3": {[]bool{true, false, true, true}, 14},
+		"4d6kl1": {[]bool{false, true, false, false}, 2},
+		"4d6dh1": {[]bool{true, true, false, true}, 10},
+		"4d6dl2": {[]bool{true, false, true, false}, 10},
+	}
+
+	for expr, want := range tests {
+		t.Run(expr, func(t *testing.T) {
+			// Rolls 4, 2, 6 and 4. Of dice showing equal values, the die rolled
+			// first ranks higher.
+			r := roll(t, expr, 3, 1, 5, 3)
+
+			kept := make([]bool, len(r.Terms[0].Dice))
+			for i, d := range r.Terms[0].Dice {
+				kept[i] = d.Kept
+			}
+
+			expect.That(t,
+				is.DeepEqualTo(kept, want.kept),
+				is.EqualTo(r.Total, want.total),
+			)
+		})
+	}
+}
+
+func TestRoll_advantage(t *testing.T) {
+	expect.That(t,
+		is.EqualTo(roll(t, "d20adv+2", 4, 16).Total, 19),
+		is.EqualTo(roll(t, "d20dis+2", 4, 16).Total, 7),
+	)
+}
+
+func TestRoll_explode(t *testing.T) {
+	r := roll(t, "2d6!", 5, 5, 2, 0)
+
+	expect.That(t,
+		is.DeepEqualTo(r.Terms[0].Dice, []Die{
+			{Value: 6, Kept: true},
+			{Value: 6, Kept: true, Exploded: true},
+			{Value: 3, Kept: true, Exploded: true},
+			{Value: 1, Kept: true},
+		}),
+		is.EqualTo(r.Total, 16),
+	)
+}
+
+func TestRoll_explodeLimit(t *testing.T) {
+	values := make([]int, maxExplosions+1)
+	for i := range values {
+		values[i] = 1
+	}
+
+	r := roll(t, "1d2!", values...)
+
+	expect.That(t,
+		is.SliceOfLen(r.Terms[0].Dice, maxExplosions+1),
+		is.EqualTo(r.Total, 2*(maxExplosions+1)),
+	)
+}
+
+func TestRoll_reroll(t *testing.T) {
+	r := roll(t, "2d6r2", 1, 0, 4)
+
+	expect.That(t,
+		is.DeepEqualTo(r.Terms[0].Dice, []Die{
+			{Value: 2, Rerolled: true},
+			{Value: 1, Kept: true},
+			{Value: 5, Kept: true},
+		}),
+		is.EqualTo(r.Total, 6),
+	)
+}
+
+func TestRoll_fudge(t *testing.T) {
+	r := roll(t, "4dF", 0, 1, 2, 2)
+
+	expect.That(t, is.EqualTo(r.Total, 1))
+}
+
+func TestRoll_percentile(t *testing.T) {
+	r := roll(t, "d%", 99)
+
+	expect.That(t, is.EqualTo(r.Total, 100))
+}
+
+func TestCryptoSource(t *testing.T) {
+	for range 100 {
+		v := MustParse("1d6").Roll(CryptoSource).Total
+		expect.That(t, is.EqualTo(v >= 1 && v <= 6, true))
+	}
+}
+
+func TestCommit(t *testing.T) {
+	expect.That(t,
+		is.EqualTo(Commit(make([]byte, SeedSize)), "66687aadf862bd776c8fc18b8e9f8e20089714856ee233b3902a591d0d5f2925"),
+	)
+}
+
+func TestSeededSource(t *testing.T) {
+	seed := make([]byte, SeedSize)
+	expr := MustParse("10d20")
+
+	values := func(r Result) []int {
+		var v []int
+		for _, d := range r.Terms[0].Dice {
+			v = append(v, d.Value)
+		}
+		return v
+	}
+
+	a := values(expr.Roll(NewSeededSource(seed, "1:nonce")))
+	b := values(expr.Roll(NewSeededSource(seed, "1:nonce")))
+	c := values(expr.Roll(NewSeededSource(seed, "2:nonce")))
+
+	expect.That(t,
+		is.DeepEqualTo(a, b),
+		is.EqualTo(slices.Equal(a, c), false),
+		// Pins the derivation documented for SeededSource.
+		is.DeepEqualTo(a, []int{10, 11, 12, 2, 2, 1, 4, 9, 8, 15}),
+	)
+}
+
+func TestRecord(t *testing.T) {
+	r := roll(t, "4d6kh3+2", 0, 5, 2, 3)
+
+	loaded, err := NewRecord(r).Result()
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(loaded, r),
+	)
+
+	_, err = Record{Expression: "1d6+2", Terms: []TermRecord{{Value: 3}}}.Result()
+	expect.That(t, is.EqualTo(err != nil, true))
+}
@@ -0,0 +1,263 @@
+package dice
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidExpression is returned when parsing a malformed dice expression.
+var ErrInvalidExpression = errors.New("invalid dice expression")
+
+// Limits enforced when parsing expressions.
+const (
+	maxTerms    = 20
+	maxCount    = 100
+	maxSides    = 1000
+	maxConstant = 100000
+)
+
+// Parse parses a dice expression. Whitespace is ignored and letters are case
+// insensitive. The grammar is
+//
+//	expression = [ "+" | "-" ] term { ( "+" | "-" ) term }
+//	term       = number | [ number ] ( "d" | "w" ) sides { modifier }
+//	sides      = number | "%" | "F"
+//	modifier   = ( "kh" | "k" | "kl" | "dh" | "dl" ) number
+//	           | "r" number
+//	           | "!"
+//	           | "adv" | "dis"
+//
+// The sides d% denote a percentile die (d100) and dF a fudge die showing -1, 0
+// or 1. The modifiers keep or drop the highest or lowest dice, reroll dice
+// showing the given number or less once, explode dice showing their maximum
+// and roll with advantage or disadvantage, which doubles the dice rolled and
+// keeps the highest or lowest half.
+func Parse(s string) (Expression, error) {
+	p := parser{s: strings.ToLower(strings.Join(strings.Fields(s), ""))}
+
+	var e Expression
+
+	for {
+		negative := false
+		if p.accept("-") {
+			negative = true
+		} else if !p.accept("+") && len(e.Terms) > 0 {
+			return Expression{}, p.errorf("expected + or -")
+		}
+
+		t, err := p.term()
+		if err != nil {
+			return Expression{}, err
+		}
+		t.Negative = negative
+
+		e.Terms = append(e.Terms, t)
+		if len(e.Terms) > maxTerms {
+			return Expression{}, p.errorf("too many terms; at most %d are allowed", maxTerms)
+		}
+
+		if p.done() {
+			return e, nil
+		}
+	}
+}
+
+// MustParse is like Parse but panics if s is invalid.
+func MustParse(s string) Expression {
+	e, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at position %d", ErrInvalidExpression, fmt.Sprintf(format, args...), p.pos)
+}
+
+// accept consumes prefix if the remaining input starts with it.
+func (p *parser) accept(prefix string) bool {
+	if strings.HasPrefix(p.s[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+// number consumes a decimal number. ok is false if the remaining input does
+// not start with a digit.
+func (p *parser) number() (n int, ok bool, err error) {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, false, nil
+	}
+
+	n, err = strconv.Atoi(p.s[start:p.pos])
+	if err != nil || n > maxConstant {
+		p.pos = start
+		return 0, false, p.errorf("number too large")
+	}
+	return n, true, nil
+}
+
+func (p *parser) requireNumber() (int, error) {
+	n, ok, err := p.number()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, p.errorf("expected number")
+	}
+	return n, nil
+}
+
+func (p *parser) term() (Term, error) {
+	var t Term
+
+	n, hasCount, err := p.number()
+	if err != nil {
+		return t, err
+	}
+
+	if !p.accept("d") && !p.accept("w") {
+		if !hasCount {
+			return t, p.errorf("expected number or dice")
+		}
+		t.Constant = n
+		return t, nil
+	}
+
+	t.Count = 1
+	if hasCount {
+		if n < 1 || n > maxCount {
+			return t, p.errorf("number of dice must be between 1 and %d", maxCount)
+		}
+		t.Count = n
+	}
+
+	switch {
+	case p.accept("%"):
+		t.Sides = 100
+	case p.accept("f"):
+		t.Sides = FudgeSides
+		t.Fudge = true
+	default:
+		sides, err := p.requireNumber()
+		if err != nil {
+			return t, err
+		}
+		if sides < 2 || sides > maxSides {
+			return t, p.errorf("dice must have between 2 and %d sides", maxSides)
+		}
+		t.Sides = sides
+	}
+
+	return t, p.modifiers(&t)
+}
+
+func (p *parser) modifiers(t *Term) error {
+	for !p.done() && p.s[p.pos] != '+' && p.s[p.pos] != '-' {
+		switch {
+		case p.accept("!"):
+			if t.Explode {
+				return p.errorf("duplicate explode modifier")
+			}
+			t.Explode = true
+
+		case p.accept("r"):
+			if t.Fudge {
+				return p.errorf("fudge dice cannot be rerolled")
+			}
+			if t.Reroll > 0 {
+				return p.errorf("duplicate reroll modifier")
+			}
+			n, err := p.requireNumber()
+			if err != nil {
+				return err
+			}
+			if n < 1 || n >= t.Sides {
+				return p.errorf("reroll threshold must be between 1 and %d", t.Sides-1)
+			}
+			t.Reroll = n
+
+		case p.accept("adv"):
+			if err := p.advantage(t, KeepHighest); err != nil {
+				return err
+			}
+
+		case p.accept("dis"):
+			if err := p.advantage(t, KeepLowest); err != nil {
+				return err
+			}
+
+		default:
+			mode, ok := p.selectMode()
+			if !ok {
+				return p.errorf("unknown modifier")
+			}
+			if t.Select.Mode != SelectAll {
+				return p.errorf("duplicate keep or drop modifier")
+			}
+			n, err := p.requireNumber()
+			if err != nil {
+				return err
+			}
+
+			maxN := t.Count
+			if mode == DropHighest || mode == DropLowest {
+				maxN = t.Count - 1
+			}
+			if n < 1 || n > maxN {
+				return p.errorf("number of dice to keep or drop must be between 1 and %d", maxN)
+			}
+			t.Select = Selection{Mode: mode, N: n}
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) selectMode() (SelectMode, bool) {
+	switch {
+	case p.accept("kh"):
+		return KeepHighest, true
+	case p.accept("kl"):
+		return KeepLowest, true
+	case p.accept("k"):
+		return KeepHighest, true
+	case p.accept("dh"):
+		return DropHighest, true
+	case p.accept("dl"):
+		return DropLowest, true
+	}
+	return SelectAll, false
+}
+
+// advantage doubles the number of dice of t and keeps the better half as
+// defined by mode.
+func (p *parser) advantage(t *Term, mode SelectMode) error {
+	if t.Select.Mode != SelectAll {
+		return p.errorf("duplicate keep or drop modifier")
+	}
+	if 2*t.Count > maxCount {
+		return p.errorf("number of dice must be between 1 and %d", maxCount)
+	}
+
+	t.Select = Selection{Mode: mode, N: t.Count}
+	t.Count *= 2
+	return nil
+}
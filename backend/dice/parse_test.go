@@ -0,0 +1,118 @@
+package dice
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string][]Term{
+		"d20":     {{Count: 1, Sides: 20}},
+		"2W6 + 3": {{Count: 2, Sides: 6}, {Constant: 3}},
+		"-1d4+1":  {{Negative: true, Count: 1, Sides: 4}, {Constant: 1}},
+		"4d6kh3":  {{Count: 4, Sides: 6, Select: Selection{Mode: KeepHighest, N: 3}}},
+		"4d6k3":   {{Count: 4, Sides: 6, Select: Selection{Mode: KeepHighest, N: 3}}},
+		"4d6dl1":  {{Count: 4, Sides: 6, Select: Selection{Mode: DropLowest, N: 1}}},
+		"d20adv":  {{Count: 2, Sides: 20, Select: Selection{Mode: KeepHighest, N: 1}}},
+		"2d20dis": {{Count: 4, Sides: 20, Select: Selection{Mode: KeepLowest, N: 2}}},
+		"3d6r1!":  {{Count: 3, Sides: 6, Reroll: 1, Explode: true}},
+		"d%":      {{Count: 1, Sides: 100}},
+		"4dF":     {{Count: 4, Sides: FudgeSides, Fudge: true}},
+	}
+
+	for in, want := range tests {
+		t.Run(in, func(t *testing.T) {
+			e, err := Parse(in)
+			expect.That(t,
+				is.NoError(err),
+				is.DeepEqualTo(e.Terms, want),
+			)
+		})
+	}
+}
+
+func TestParse_invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"1d6+",
+		"+",
+		"d",
+		"d1",
+		"0d6",
+		"2d1001",
+		"4d6kh5",
+		"4d6dl4",
+		"4d6kh0",
+		"101d6",
+		"51d6adv",
+		"100001",
+		"99999999999999999999",
+		"4dFr1",
+		"1d6r6",
+		"1d6!!",
+		"1d6r1r2",
+		"4d6kh3kl1",
+		"4d6kh3adv",
+		"1d6x",
+		strings.Repeat("+1", maxTerms+1),
+	}
+
+	for _, in := range tests {
+		t.Run(in, func(t *testing.T) {
+			_, err := Parse(in)
+			expect.That(t, is.Error(err, ErrInvalidExpression))
+		})
+	}
+}
+
+func TestParse_limits(t *testing.T) {
+	tests := []string{
+		"100d6",
+		"50d6adv",
+		"1d1000",
+		"2d2",
+		"100000",
+		"4d6kh4",
+		"4d6dl3",
+		"1d6r5",
+		strings.Repeat("+1", maxTerms),
+	}
+
+	for _, in := range tests {
+		t.Run(in, func(t *testing.T) {
+			_, err := Parse(in)
+			expect.That(t, is.NoError(err))
+		})
+	}
+}
+
+func TestExpression_String(t *testing.T) {
+	tests := map[string]string{
+		"2d6+3":        "2d6+3",
+		" -1D4 - 2 ":   "-1d4-2",
+		"d20":          "1d20",
+		"4d6k3":        "4d6kh3",
+		"d20adv":       "2d20kh1",
+		"3d6!r2":       "3d6r2!",
+		"d%":           "1d100",
+		"4dF+2d8dl1-3": "4dF+2d8dl1-3",
+	}
+
+	for in, want := range tests {
+		t.Run(in, func(t *testing.T) {
+			e, err := Parse(in)
+			expect.That(t, expect.FailNow(is.NoError(err)))
+
+			s := e.String()
+			reparsed, err := Parse(s)
+			expect.That(t,
+				is.EqualTo(s, want),
+				is.NoError(err),
+				is.DeepEqualTo(reparsed, e),
+			)
+		})
+	}
+}
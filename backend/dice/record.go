@@ -0,0 +1,66 @@
+package dice
+
+import "fmt"
+
+// Record is the persistent form of a Result. It stores the expression as
+// text, so a Record can be marshalled to JSON and converted back using
+// Result.
+type Record struct {
+	Expression string       `json:"expression"`
+	Terms      []TermRecord `json:"terms"`
+	Total      int          `json:"total"`
+}
+
+// TermRecord is the persistent form of a TermResult.
+type TermRecord struct {
+	Dice  []DieRecord `json:"dice,omitempty"`
+	Value int         `json:"value"`
+}
+
+// DieRecord is the persistent form of a Die.
+type DieRecord struct {
+	Value    int  `json:"v"`
+	Kept     bool `json:"k,omitempty"`
+	Exploded bool `json:"x,omitempty"`
+	Rerolled bool `json:"r,omitempty"`
+}
+
+// NewRecord creates the Record for res.
+func NewRecord(res Result) Record {
+	r := Record{
+		Expression: res.Expression.String(),
+		Terms:      make([]TermRecord, len(res.Terms)),
+		Total:      res.Total,
+	}
+	for i, t := range res.Terms {
+		r.Terms[i].Value = t.Value
+		for _, d := range t.Dice {
+			r.Terms[i].Dice = append(r.Terms[i].Dice, DieRecord(d))
+		}
+	}
+	return r
+}
+
+// Result parses the recorded expression and returns the recorded Result.
+func (r Record) Result() (Result, error) {
+	expr, err := Parse(r.Expression)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(expr.Terms) != len(r.Terms) {
+		return Result{}, fmt.Errorf("expected %d terms but got %d", len(expr.Terms), len(r.Terms))
+	}
+
+	res := Result{
+		Expression: expr,
+		Terms:      make([]TermResult, len(r.Terms)),
+		Total:      r.Total,
+	}
+	for i, t := range r.Terms {
+		res.Terms[i] = TermResult{Term: expr.Terms[i], Value: t.Value}
+		for _, d := range t.Dice {
+			res.Terms[i].Dice = append(res.Terms[i].Dice, Die(d))
+		}
+	}
+	return res, nil
+}
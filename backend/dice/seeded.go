@@ -0,0 +1,67 @@
+package dice
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+)
+
+// SeedSize is the size of seeds in bytes.
+const SeedSize = 32
+
+// Commit returns the commitment to seed: the hex encoded SHA-256 hash of
+// seed. Publishing the commitment before rolling binds the roller to seed
+// without disclosing it.
+func Commit(seed []byte) string {
+	h := sha256.Sum256(seed)
+	return hex.EncodeToString(h[:])
+}
+
+// SeededSource is a deterministic Source deriving all numbers from a seed and
+// a message. Anyone knowing seed and message can re-derive all numbers:
+//
+// The source produces a stream of blocks, where block i (starting with 0) is
+// HMAC-SHA256 keyed with seed over message followed by i encoded as an 8 byte
+// big endian integer. Every call to Intn(n) reads the next 8 bytes of the
+// stream as a big endian uint64 v. If v is lower than the greatest multiple of
+// n not exceeding 2^64-1, the result is v mod n. Otherwise v is rejected and
+// the next 8 bytes are read.
+type SeededSource struct {
+	seed    []byte
+	message []byte
+	block   uint64
+	buf     []byte
+}
+
+// NewSeededSource creates a SeededSource for seed and message.
+func NewSeededSource(seed []byte, message string) *SeededSource {
+	return &SeededSource{
+		seed:    seed,
+		message: []byte(message),
+	}
+}
+
+func (s *SeededSource) next() uint64 {
+	if len(s.buf) < 8 {
+		h := hmac.New(sha256.New, s.seed)
+		h.Write(s.message)
+		h.Write(binary.BigEndian.AppendUint64(nil, s.block))
+		s.block++
+		s.buf = h.Sum(s.buf[:0])
+	}
+
+	v := binary.BigEndian.Uint64(s.buf)
+	s.buf = s.buf[8:]
+	return v
+}
+
+func (s *SeededSource) Intn(n int) int {
+	limit := math.MaxUint64 - math.MaxUint64%uint64(n)
+	for {
+		if v := s.next(); v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package dice
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// ErrNoDistribution is returned when the distribution of an expression cannot
+// be computed.
+var ErrNoDistribution = errors.New("distribution cannot be computed")
+
+const (
+	// maxDistributionWork limits the number of elementary operations spent on
+	// computing the distribution of an expression.
+	maxDistributionWork = 50_000_000
+
+	// explosionThreshold is the probability below which chains of exploding
+	// dice are truncated.
+	explosionThreshold = 1e-12
+)
+
+// Distribution is the discrete probability distribution of an expression's
+// total.
+type Distribution struct {
+	min int
+	p   []float64
+}
+
+// Probability is the probability of a single value.
+type Probability struct {
+	Value int
+	P     float64
+}
+
+// constant returns the distribution of the constant v.
+func constant(v int) Distribution {
+	return Distribution{min: v, p: []float64{1}}
+}
+
+// Min returns the lowest possible value.
+func (d Distribution) Min() int { return d.min }
+
+// Max returns the highest possible value.
+func (d Distribution) Max() int { return d.min + len(d.p) - 1 }
+
+// P returns the probability of v.
+func (d Distribution) P(v int) float64 {
+	if v < d.min || v > d.Max() {
+		return 0
+	}
+	return d.p[v-d.min]
+}
+
+// AtLeast returns the probability of a value of v or higher.
+func (d Distribution) AtLeast(v int) float64 {
+	var p float64
+	for i := max(v-d.min, 0); i < len(d.p); i++ {
+		p += d.p[i]
+	}
+	return min(p, 1)
+}
+
+// Mean returns the expected value.
+func (d Distribution) Mean() float64 {
+	var m float64
+	for i, p := range d.p {
+		m += float64(d.min+i) * p
+	}
+	return m
+}
+
+// StdDev returns the standard deviation.
+func (d Distribution) StdDev() float64 {
+	mean := d.Mean()
+	var v float64
+	for i, p := range d.p {
+		x := float64(d.min+i) - mean
+		v += x * x * p
+	}
+	return math.Sqrt(v)
+}
+
+// PMF returns the probability of every value from Min to Max.
+func (d Distribution) PMF() []Probability {
+	pmf := make([]Probability, len(d.p))
+	for i, p := range d.p {
+		pmf[i] = Probability{Value: d.min + i, P: p}
+	}
+	return pmf
+}
+
+// CDF returns the probability of every value from Min to Max or lower.
+func (d Distribution) CDF() []Probability {
+	cdf := make([]Probability, len(d.p))
+	var sum float64
+	for i, p := range d.p {
+		sum += p
+		cdf[i] = Probability{Value: d.min + i, P: min(sum, 1)}
+	}
+	return cdf
+}
+
+// negate returns the distribution of -X.
+func (d Distribution) negate() Distribution {
+	p := slices.Clone(d.p)
+	slices.Reverse(p)
+	return Distribution{min: -d.Max(), p: p}
+}
+
+// add returns the distribution of the sum of the independent variables
+// distributed according to d and o.
+func (d Distribution) add(o Distribution) Distribution {
+	p := make([]float64, len(d.p)+len(o.p)-1)
+	for i, a := range d.p {
+		if a == 0 {
+			continue
+		}
+		for j, b := range o.p {
+			p[i+j] += a * b
+		}
+	}
+	return Distribution{min: d.min + o.min, p: p}.trim()
+}
+
+// trim removes values with a probability of zero from both ends.
+func (d Distribution) trim() Distribution {
+	from, to := 0, len(d.p)
+	for from < to-1 && d.p[from] == 0 {
+		from++
+	}
+	for to > from+1 && d.p[to-1] == 0 {
+		to--
+	}
+	return Distribution{min: d.min + from, p: d.p[from:to]}
+}
+
+// Distribution computes the exact distribution of e's total. Chains of
+// exploding dice are truncated once their probability drops below 1e-12.
+// Distributions of exploding dice combined with keep or drop modifiers are
+// not supported.
+func (e Expression) Distribution() (Distribution, error) {
+	if e.work() > maxDistributionWork {
+		return Distribution{}, fmt.Errorf("%w: %s is too complex", ErrNoDistribution, e)
+	}
+
+	d := constant(0)
+	for _, t := range e.Terms {
+		td, err := t.distribution()
+		if err != nil {
+			return Distribution{}, err
+		}
+		if t.Negative {
+			td = td.negate()
+		}
+		d = d.add(td)
+	}
+	return d, nil
+}
+
+func (t Term) distribution() (Distribution, error) {
+	if t.IsConstant() {
+		return constant(t.Constant), nil
+	}
+
+	die := t.dieDistribution()
+
+	if t.Select.Mode == SelectAll {
+		d := die
+		for range t.Count - 1 {
+			d = d.add(die)
+		}
+		return d, nil
+	}
+
+	if t.Explode {
+		return Distribution{}, fmt.Errorf("%w: exploding dice cannot be combined with keep or drop", ErrNoDistribution)
+	}
+
+	keep, highest := t.kept()
+	return keepDistribution(die, t.Count, keep, highest), nil
+}
+
+// kept returns the number of dice of t kept by its keep or drop modifier and
+// whether the highest ones are kept.
+func (t Term) kept() (keep int, highest bool) {
+	switch t.Select.Mode {
+	case KeepLowest:
+		return t.Select.N, false
+	case DropHighest:
+		return t.Count - t.Select.N, false
+	case DropLowest:
+		return t.Count - t.Select.N, true
+	default:
+		return t.Select.N, true
+	}
+}
+
+// work estimates the number of elementary operations spent on computing the
+// distribution of e. Besides the work for every term, adding a term's
+// distribution costs the number of values of the sum so far times the number
+// of values of the term.
+func (e Expression) work() int {
+	total, values := 0, 1
+	for _, t := range e.Terms {
+		w, v := t.work()
+		total += w + values*v
+		values += v - 1
+	}
+	return total
+}
+
+// work estimates the number of elementary operations spent on computing the
+// distribution of t and returns the number of values t may take.
+func (t Term) work() (work, values int) {
+	if t.IsConstant() {
+		return 0, 1
+	}
+
+	faces := len(t.dieDistribution().p)
+
+	if t.Select.Mode == SelectAll {
+		// Every convolution costs at most the size of the sum times the size
+		// of a single die.
+		return t.Count * t.Count * faces * faces / 2, t.Count*(faces-1) + 1
+	}
+
+	keep, _ := t.kept()
+	return faces * t.Count * t.Count * (keep*faces + 1), keep*(faces-1) + 1
+}
+
+// dieDistribution returns the distribution of a single die of t including
+// rerolls and explosions.
+func (t Term) dieDistribution() Distribution {
+	p := make([]float64, t.Sides)
+	s := float64(t.Sides)
+	for i := range p {
+		v := t.Min() + i
+		if v > t.Reroll || t.Reroll == 0 {
+			p[i] = 1 / s
+		}
+		// Rerolled dice show any value.
+		p[i] += float64(t.Reroll) / s / s
+	}
+	d := Distribution{min: t.Min(), p: p}
+
+	if !t.Explode {
+		return d
+	}
+
+	// A die showing its maximum explodes into another die which is added to
+	// the maximum. Chains are unrolled from the last explosion to the first
+	// one.
+	pMax := p[len(p)-1]
+	depth := min(maxExplosions, int(math.Ceil(math.Log(explosionThreshold)/math.Log(pMax))))
+
+	nonMax := Distribution{min: d.min, p: slices.Clone(p)}
+	nonMax.p[len(p)-1] = 0
+
+	chain := d
+	for range depth {
+		exploded := Distribution{min: chain.min + t.Max(), p: make([]float64, len(chain.p))}
+		for i, v := range chain.p {
+			exploded.p[i] = v * pMax
+		}
+		chain = nonMax.sum(exploded)
+	}
+
+	return chain
+}
+
+// sum returns the pointwise sum of the probabilities of d and o.
+func (d Distribution) sum(o Distribution) Distribution {
+	lo := min(d.min, o.min)
+	hi := max(d.Max(), o.Max())
+	p := make([]float64, hi-lo+1)
+	for i, v := range d.p {
+		p[d.min-lo+i] += v
+	}
+	for i, v := range o.p {
+		p[o.min-lo+i] += v
+	}
+	return Distribution{min: lo, p: p}.trim()
+}
+
+// keepDistribution returns the distribution of the sum of the keep highest
+// (or lowest) of n dice distributed according to die.
+//
+// The faces are processed from the best to the worst one. For every face the
+// number of dice showing it is chosen, while tracking the number of dice
+// assigned so far and the sum of the kept ones. Dice are kept as long as less
+// than keep dice have been assigned before.
+func keepDistribution(die Distribution, n, keep int, highest bool) Distribution {
+	faces := die.PMF()
+	if highest {
+		slices.Reverse(faces)
+	}
+
+	lo := min(0, keep*die.Min())
+	hi := max(0, keep*die.Max())
+	sums := hi - lo + 1
+
+	binomial := binomials(n)
+
+	// dp[i][s] is the probability of having assigned i dice with the kept
+	// ones summing up to lo+s.
+	dp := make([][]float64, n+1)
+	for i := range dp {
+		dp[i] = make([]float64, sums)
+	}
+	dp[0][-lo] = 1
+
+	for _, f := range faces {
+		next := make([][]float64, n+1)
+		for i := range next {
+			next[i] = make([]float64, sums)
+		}
+
+		for i := 0; i <= n; i++ {
+			for s, p := range dp[i] {
+				if p == 0 {
+					continue
+				}
+
+				pc := p
+				for c := 0; c <= n-i; c++ {
+					if c > 0 {
+						pc *= f.P
+						if pc == 0 {
+							break
+						}
+					}
+					kept := min(c, max(0, keep-i))
+					next[i+c][s+kept*f.Value] += pc * binomial[n-i][c]
+				}
+			}
+		}
+
+		dp = next
+	}
+
+	return Distribution{min: lo, p: dp[n]}.trim()
+}
+
+// binomials returns Pascal's triangle up to n.
+func binomials(n int) [][]float64 {
+	b := make([][]float64, n+1)
+	for i := range b {
+		b[i] = make([]float64, i+1)
+		b[i][0], b[i][i] = 1, 1
+		for j := 1; j < i; j++ {
+			b[i][j] = b[i-1][j-1] + b[i-1][j]
+		}
+	}
+	return b
+}
@@ -0,0 +1,100 @@
+package dice
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func distribution(t *testing.T, expr string) Distribution {
+	d, err := MustParse(expr).Distribution()
+	expect.That(t, expect.FailNow(is.NoError(err)))
+	return d
+}
+
+func approx(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+func TestDistribution(t *testing.T) {
+	tests := []struct {
+		expr     string
+		min, max int
+		mean     float64
+	}{
+		{"1d6", 1, 6, 3.5},
+		{"2d6+3", 5, 15, 10},
+		{"1d4-1d4", -3, 3, 0},
+		{"4d6kh3", 3, 18, 15869.0 / 1296},
+		{"4d6dl1", 3, 18, 15869.0 / 1296},
+		{"d20adv", 1, 20, 13.825},
+		{"d20dis", 1, 20, 7.175},
+		{"2d20kl1", 1, 20, 7.175},
+		{"3d6dh2", 1, 6, 441.0 / 216},
+		{"2d6r2", 2, 12, 25.0 / 3},
+		{"4dF", -4, 4, 0},
+		{"d%", 1, 100, 50.5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			d := distribution(t, test.expr)
+			cdf := d.CDF()
+
+			expect.That(t,
+				is.EqualTo(d.Min(), test.min),
+				is.EqualTo(d.Max(), test.max),
+				is.EqualTo(approx(d.Mean(), test.mean), true),
+				is.EqualTo(approx(cdf[len(cdf)-1].P, 1), true),
+				is.EqualTo(approx(d.AtLeast(d.Min()), 1), true),
+			)
+		})
+	}
+}
+
+func TestDistribution_probabilities(t *testing.T) {
+	d6 := distribution(t, "1d6")
+	twoD6 := distribution(t, "2d6")
+	adv := distribution(t, "d20adv+5")
+	fudge := distribution(t, "4dF")
+
+	expect.That(t,
+		is.EqualTo(approx(d6.StdDev(), math.Sqrt(35.0/12)), true),
+		is.EqualTo(approx(twoD6.P(7), 6.0/36), true),
+		is.EqualTo(approx(twoD6.P(13), 0), true),
+		is.EqualTo(approx(adv.P(25), 39.0/400), true),
+		// Meeting DC 20 requires a 15 or higher on the d20.
+		is.EqualTo(approx(adv.AtLeast(20), 1-0.7*0.7), true),
+		is.EqualTo(approx(fudge.P(0), 19.0/81), true),
+	)
+}
+
+func TestDistribution_explode(t *testing.T) {
+	d := distribution(t, "1d6!")
+
+	expect.That(t,
+		is.EqualTo(d.Min(), 1),
+		is.EqualTo(approx(d.Mean(), 4.2), true),
+		is.EqualTo(approx(d.P(6), 0), true),
+		is.EqualTo(approx(d.P(8), 1.0/36), true),
+		is.EqualTo(math.Abs(d.CDF()[len(d.p)-1].P-1) < 1e-11, true),
+	)
+}
+
+func TestDistribution_unsupported(t *testing.T) {
+	for _, expr := range []string{
+		"3d6!kh2",
+		"100d1000",
+		"100d1000kh50",
+		"7d1000" + strings.Repeat("+7d1000", maxTerms-1),
+		"100d100" + strings.Repeat("+100d100", maxTerms-1),
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := MustParse(expr).Distribution()
+			expect.That(t, is.Error(err, ErrNoDistribution))
+		})
+	}
+}
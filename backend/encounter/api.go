@@ -0,0 +1,809 @@
+package encounter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/halimath/d20-tools/auth"
+	"github.com/halimath/d20-tools/infra/jsonbody"
+	"github.com/halimath/httputils/response"
+	"github.com/halimath/kvlog"
+)
+
+type (
+	SavingThrowsDTO struct {
+		Str int `json:"str"`
+		Dex int `json:"dex"`
+		Con int `json:"con"`
+		Int int `json:"int"`
+		Wis int `json:"wis"`
+		Cha int `json:"cha"`
+	}
+
+	DamageDTO struct {
+		Label  string `json:"label"`
+		Damage string `json:"damage"`
+	}
+
+	AttackDTO struct {
+		Label  string      `json:"label"`
+		Mod    int         `json:"mod"`
+		Damage []DamageDTO `json:"damage"`
+	}
+
+	KindDTO struct {
+		ID            string          `json:"id,omitempty"`
+		Label         string          `json:"label"`
+		Speed         int             `json:"speed"`
+		AC            int             `json:"ac"`
+		ChallengeRate *float64        `json:"challengeRate,omitempty"`
+		XP            *int            `json:"xp,omitempty"`
+		HitDie        string          `json:"hitDie"`
+		SavingThrows  SavingThrowsDTO `json:"savingThrows"`
+		Attacks       []AttackDTO     `json:"attacks"`
+		Tags          []string        `json:"tags,omitempty"`
+	}
+
+	IniDTO struct {
+		DieResult int `json:"dieResult"`
+		Modifier  int `json:"modifier"`
+	}
+
+	// CharacterDTO is either a player character with a static initiative
+	// value or a non player character referring to a kind.
+	CharacterDTO struct {
+		Type       CharacterType
+		Label      string
+		Ini        IniDTO
+		Kind       string
+		HP         int
+		CHP        int
+		Conditions []string
+	}
+
+	EncounterDTO struct {
+		ID           string         `json:"id,omitempty"`
+		Label        string         `json:"label"`
+		LastModified string         `json:"lastModified,omitempty"`
+		Characters   []CharacterDTO `json:"characters"`
+		// Publication is the token granting access to the player view. It
+		// is ignored when creating or updating encounters.
+		Publication string `json:"publication,omitempty"`
+	}
+
+	// ImportDTO contains the kinds and characters as stored by the encounters
+	// tool in the browser's local storage.
+	ImportDTO struct {
+		Label      string         `json:"label,omitempty"`
+		Kinds      []KindDTO      `json:"kinds"`
+		Characters []CharacterDTO `json:"characters"`
+	}
+
+	ImportResultDTO struct {
+		Created   []string      `json:"created"`
+		Updated   []string      `json:"updated"`
+		Encounter *EncounterDTO `json:"encounter,omitempty"`
+	}
+
+	MappedKindDTO struct {
+		Name     string   `json:"name"`
+		Unmapped []string `json:"unmapped,omitempty"`
+		Error    string   `json:"error,omitempty"`
+	}
+
+	BestiaryImportDTO struct {
+		Created  []string        `json:"created"`
+		Updated  []string        `json:"updated"`
+		Monsters []MappedKindDTO `json:"monsters"`
+	}
+
+	StatBlockDTO struct {
+		Text string `json:"text"`
+	}
+
+	ParsedKindDTO struct {
+		Kind     KindDTO  `json:"kind"`
+		Warnings []string `json:"warnings"`
+	}
+
+	KindCountDTO struct {
+		ID    string `json:"id"`
+		Count int    `json:"count"`
+	}
+
+	DifficultyRequestDTO struct {
+		// Party contains the levels of the characters.
+		Party []int          `json:"party"`
+		Kinds []KindCountDTO `json:"kinds"`
+	}
+
+	ThresholdsDTO struct {
+		Easy   int `json:"easy"`
+		Medium int `json:"medium"`
+		Hard   int `json:"hard"`
+		Deadly int `json:"deadly"`
+	}
+
+	RatingDTO struct {
+		Thresholds ThresholdsDTO `json:"thresholds"`
+		Monsters   int           `json:"monsters"`
+		XP         int           `json:"xp"`
+		Multiplier float64       `json:"multiplier"`
+		AdjustedXP int           `json:"adjustedXP"`
+		Difficulty Difficulty    `json:"difficulty"`
+	}
+
+	GenerateRequestDTO struct {
+		Label string `json:"label,omitempty"`
+		// Party contains the levels of the characters.
+		Party       []int      `json:"party"`
+		Difficulty  Difficulty `json:"difficulty"`
+		Tags        []string   `json:"tags,omitempty"`
+		Environment string     `json:"environment,omitempty"`
+		GridID      string     `json:"gridId,omitempty"`
+	}
+
+	PlacementDTO struct {
+		Label string `json:"label"`
+		Col   int    `json:"col"`
+		Row   int    `json:"row"`
+	}
+
+	GeneratedDTO struct {
+		Encounter  EncounterDTO   `json:"encounter"`
+		Rating     RatingDTO      `json:"rating"`
+		Placements []PlacementDTO `json:"placements,omitempty"`
+	}
+
+	PublicationDTO struct {
+		Token string `json:"token"`
+	}
+
+	PublicCharacterDTO struct {
+		Type       CharacterType `json:"type"`
+		Label      string        `json:"label"`
+		Health     HealthBand    `json:"health,omitempty"`
+		Conditions []string      `json:"conditions,omitempty"`
+	}
+
+	PlayerViewDTO struct {
+		Label      string               `json:"label"`
+		Characters []PublicCharacterDTO `json:"characters"`
+	}
+)
+
+// publishedPath is the path prefix of the player views of published
+// encounters which may be read without authentication.
+const publishedPath = "/encounters/published/"
+
+// maxBestiarySize is the maximum size of a bestiary file accepted for import.
+const maxBestiarySize = 16 << 20
+
+type pcJSON struct {
+	Type       CharacterType `json:"type"`
+	Label      string        `json:"label"`
+	Ini        int           `json:"ini"`
+	Conditions []string      `json:"conditions,omitempty"`
+}
+
+type npcJSON struct {
+	Type       CharacterType `json:"type"`
+	Label      string        `json:"label"`
+	Ini        IniDTO        `json:"ini"`
+	Kind       string        `json:"kind"`
+	HP         int           `json:"hp"`
+	CHP        int           `json:"chp"`
+	Conditions []string      `json:"conditions,omitempty"`
+}
+
+func (c CharacterDTO) MarshalJSON() ([]byte, error) {
+	if c.Type == TypePC {
+		return json.Marshal(pcJSON{Type: c.Type, Label: c.Label, Ini: c.Ini.DieResult, Conditions: c.Conditions})
+	}
+
+	return json.Marshal(npcJSON(c))
+}
+
+func (c *CharacterDTO) UnmarshalJSON(data []byte) error {
+	var probe struct {
+		Type CharacterType `json:"type"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+
+	if probe.Type == TypePC {
+		var pc pcJSON
+		if err := json.Unmarshal(data, &pc); err != nil {
+			return err
+		}
+		*c = CharacterDTO{Type: pc.Type, Label: pc.Label, Ini: IniDTO{DieResult: pc.Ini}, Conditions: pc.Conditions}
+		return nil
+	}
+
+	var npc npcJSON
+	if err := json.Unmarshal(data, &npc); err != nil {
+		return err
+	}
+	*c = CharacterDTO(npc)
+	return nil
+}
+
+// Handler creates a http.Handler serving the kinds and encounters of the
+// authenticated principal.
+func Handler(srv *EncounterService) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /kinds", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		logger.Logs("listing kinds for user")
+
+		kinds, err := srv.ListKinds(r.Context())
+		if err != nil {
+			handleServiceError(w, r, err, "failed to list kinds")
+			return
+		}
+
+		dtos := make([]KindDTO, len(kinds))
+		for i, k := range kinds {
+			dtos[i] = toKindDTO(k)
+		}
+
+		response.JSON(w, r, dtos)
+	})
+
+	mux.HandleFunc("POST /kinds", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+
+		dto, err := jsonbody.Read[KindDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		logger.Logs("creating kind", kvlog.WithKV("label", dto.Label))
+
+		k, err := srv.CreateKind(r.Context(), fromKindDTO(dto))
+		if err != nil {
+			handleServiceError(w, r, err, "failed to create kind")
+			return
+		}
+
+		response.JSON(w, r, toKindDTO(k), response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("POST /kinds/import", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+
+		data, ok := readBestiary(w, r)
+		if !ok {
+			return
+		}
+
+		logger.Logs("importing bestiary", kvlog.WithKV("size", len(data)))
+
+		result, mapped, err := srv.ImportBestiary(r.Context(), data)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to import bestiary")
+			return
+		}
+
+		dto := BestiaryImportDTO{
+			Created:  result.Created,
+			Updated:  result.Updated,
+			Monsters: make([]MappedKindDTO, len(mapped)),
+		}
+		for i, mk := range mapped {
+			dto.Monsters[i] = MappedKindDTO{Name: mk.Name, Unmapped: mk.Unmapped}
+			if mk.Err != nil {
+				dto.Monsters[i].Error = mk.Err.Error()
+			}
+		}
+
+		response.JSON(w, r, dto)
+	})
+
+	mux.HandleFunc("POST /kinds/parse", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+
+		dto, err := jsonbody.Read[StatBlockDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		k, warnings := ParseStatBlock(dto.Text)
+		logger.Logs("parsed stat block", kvlog.WithKV("label", k.Label), kvlog.WithKV("warnings", len(warnings)))
+
+		if warnings == nil {
+			warnings = []string{}
+		}
+
+		response.JSON(w, r, ParsedKindDTO{Kind: toKindDTO(k), Warnings: warnings})
+	})
+
+	mux.HandleFunc("GET /kinds/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("loading kind", kvlog.WithKV("id", id))
+
+		k, err := srv.LoadKind(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to load kind")
+			return
+		}
+
+		response.JSON(w, r, toKindDTO(k))
+	})
+
+	mux.HandleFunc("PUT /kinds/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		dto, err := jsonbody.Read[KindDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		logger.Logs("updating kind", kvlog.WithKV("id", id))
+
+		k, err := srv.UpdateKind(r.Context(), id, fromKindDTO(dto))
+		if err != nil {
+			handleServiceError(w, r, err, "failed to update kind")
+			return
+		}
+
+		response.JSON(w, r, toKindDTO(k))
+	})
+
+	mux.HandleFunc("DELETE /kinds/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("deleting kind", kvlog.WithKV("id", id))
+
+		if err := srv.DeleteKind(r.Context(), id); err != nil {
+			handleServiceError(w, r, err, "failed to delete kind")
+			return
+		}
+
+		response.NoContent(w, r)
+	})
+
+	mux.HandleFunc("GET /encounters", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		logger.Logs("listing encounters for user")
+
+		encounters, err := srv.ListEncounters(r.Context())
+		if err != nil {
+			handleServiceError(w, r, err, "failed to list encounters")
+			return
+		}
+
+		dtos := make([]EncounterDTO, len(encounters))
+		for i, e := range encounters {
+			dtos[i] = toEncounterDTO(e)
+		}
+
+		response.JSON(w, r, dtos)
+	})
+
+	mux.HandleFunc("POST /encounters", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+
+		dto, err := jsonbody.Read[EncounterDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		logger.Logs("creating encounter", kvlog.WithKV("label", dto.Label))
+
+		e, err := srv.CreateEncounter(r.Context(), fromEncounterDTO(dto))
+		if err != nil {
+			handleServiceError(w, r, err, "failed to create encounter")
+			return
+		}
+
+		response.JSON(w, r, toEncounterDTO(e), response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("POST /encounters/import", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+
+		dto, err := jsonbody.Read[ImportDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		logger.Logs("importing encounter", kvlog.WithKV("kinds", len(dto.Kinds)), kvlog.WithKV("characters", len(dto.Characters)))
+
+		kinds := make([]Kind, len(dto.Kinds))
+		for i, k := range dto.Kinds {
+			kinds[i] = fromKindDTO(k)
+		}
+
+		characters := make([]Character, len(dto.Characters))
+		for i, c := range dto.Characters {
+			characters[i] = fromCharacterDTO(c)
+		}
+
+		result, err := srv.Import(r.Context(), kinds, dto.Label, characters)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to import encounter")
+			return
+		}
+
+		resultDTO := ImportResultDTO{
+			Created: result.Created,
+			Updated: result.Updated,
+		}
+		if result.Encounter.ID() != "" {
+			e := toEncounterDTO(result.Encounter)
+			resultDTO.Encounter = &e
+		}
+
+		response.JSON(w, r, resultDTO, response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("POST /encounters/difficulty", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+
+		dto, err := jsonbody.Read[DifficultyRequestDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		logger.Logs("rating encounter", kvlog.WithKV("party", len(dto.Party)), kvlog.WithKV("kinds", len(dto.Kinds)))
+
+		kinds := make([]KindCount, len(dto.Kinds))
+		for i, kc := range dto.Kinds {
+			kinds[i] = KindCount(kc)
+		}
+
+		rating, err := srv.RateEncounter(r.Context(), dto.Party, kinds)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to rate encounter")
+			return
+		}
+
+		response.JSON(w, r, toRatingDTO(rating))
+	})
+
+	mux.HandleFunc("POST /encounters/generate", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+
+		dto, err := jsonbody.Read[GenerateRequestDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		logger.Logs("generating encounter", kvlog.WithKV("party", len(dto.Party)), kvlog.WithKV("difficulty", dto.Difficulty))
+
+		generated, err := srv.Generate(r.Context(), GenerateOptions(dto))
+		if err != nil {
+			handleServiceError(w, r, err, "failed to generate encounter")
+			return
+		}
+
+		resultDTO := GeneratedDTO{
+			Encounter: toEncounterDTO(generated.Encounter),
+			Rating:    toRatingDTO(generated.Rating),
+		}
+		for _, p := range generated.Placements {
+			resultDTO.Placements = append(resultDTO.Placements, PlacementDTO(p))
+		}
+
+		response.JSON(w, r, resultDTO, response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("POST /encounters/{id}/publication", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("publishing encounter", kvlog.WithKV("id", id))
+
+		token, err := srv.Publish(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to publish encounter")
+			return
+		}
+
+		response.JSON(w, r, PublicationDTO{Token: token}, response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("DELETE /encounters/{id}/publication", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("unpublishing encounter", kvlog.WithKV("id", id))
+
+		if err := srv.Unpublish(r.Context(), id); err != nil {
+			handleServiceError(w, r, err, "failed to unpublish encounter")
+			return
+		}
+
+		response.NoContent(w, r)
+	})
+
+	mux.HandleFunc("GET /encounters/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("loading encounter", kvlog.WithKV("id", id))
+
+		e, err := srv.LoadEncounter(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to load encounter")
+			return
+		}
+
+		response.JSON(w, r, toEncounterDTO(e))
+	})
+
+	mux.HandleFunc("PUT /encounters/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		dto, err := jsonbody.Read[EncounterDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		logger.Logs("updating encounter", kvlog.WithKV("id", id))
+
+		e, err := srv.UpdateEncounter(r.Context(), id, fromEncounterDTO(dto))
+		if err != nil {
+			handleServiceError(w, r, err, "failed to update encounter")
+			return
+		}
+
+		response.JSON(w, r, toEncounterDTO(e))
+	})
+
+	mux.HandleFunc("DELETE /encounters/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("deleting encounter", kvlog.WithKV("id", id))
+
+		if err := srv.DeleteEncounter(r.Context(), id); err != nil {
+			handleServiceError(w, r, err, "failed to delete encounter")
+			return
+		}
+
+		response.NoContent(w, r)
+	})
+
+	// Published encounters are accessed by players using the publication
+	// token only. They are served by a separate mux which forwards all other
+	// requests to the authenticated one.
+	public := http.NewServeMux()
+
+	public.HandleFunc("GET "+publishedPath+"{token}", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		logger.Logs("loading published encounter")
+
+		view, err := srv.LoadPlayerView(r.PathValue("token"))
+		if err != nil {
+			handleServiceError(w, r, err, "failed to load published encounter")
+			return
+		}
+
+		response.JSON(w, r, toPlayerViewDTO(view))
+	})
+
+	public.HandleFunc("GET "+publishedPath+"{token}/subscribe", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		logger.Logs("subscribing to published encounter")
+
+		sup, err := srv.SubscribePlayerView(r.Context(), r.PathValue("token"))
+		if err != nil {
+			handleServiceError(w, r, err, "failed to subscribe to published encounter")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		for view := range sup.C() {
+			data, err := json.Marshal(toPlayerViewDTO(view))
+			if err != nil {
+				logger.Logs("failed to marshal player view", kvlog.WithErr(err))
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			fmt.Fprintf(w, "data: %s\n\n", string(data))
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	public.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	}))
+
+	return public
+}
+
+func handleServiceError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, ErrForbidden):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, ErrAlreadyExists), errors.Is(err, ErrKindInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrInvalidKind), errors.Is(err, ErrInvalidEncounter), errors.Is(err, ErrInvalidBestiary),
+		errors.Is(err, ErrInvalidParty):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrNoEncounterFound):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		kvlog.FromContext(r.Context()).Logs(msg, kvlog.WithKV("id", r.PathValue("id")), kvlog.WithErr(err))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// readBestiary reads a bestiary file either uploaded as multipart form field
+// file or sent as the request's JSON body. If the file cannot be read, an
+// error response is sent and ok is false.
+func readBestiary(w http.ResponseWriter, r *http.Request) (data []byte, ok bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBestiarySize)
+
+	contentType := r.Header.Get("Content-Type")
+
+	switch {
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			kvlog.FromContext(r.Context()).Logs("failed to read uploaded bestiary", kvlog.WithErr(err))
+			http.Error(w, "missing file", http.StatusBadRequest)
+			return nil, false
+		}
+		defer f.Close()
+
+		data, err = io.ReadAll(f)
+		if err != nil {
+			http.Error(w, "failed to read file", http.StatusBadRequest)
+			return nil, false
+		}
+
+	case strings.HasPrefix(contentType, "application/json"):
+		var err error
+		data, err = io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return nil, false
+		}
+
+	default:
+		http.Error(w, "not a JSON request", http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+
+	return data, true
+}
+
+func toKindDTO(k Kind) KindDTO {
+	dto := KindDTO{
+		ID:            k.ID(),
+		Label:         k.Label,
+		Speed:         k.Speed,
+		AC:            k.AC,
+		ChallengeRate: &k.ChallengeRate,
+		XP:            &k.XP,
+		HitDie:        k.HitDie,
+		SavingThrows:  SavingThrowsDTO(k.SavingThrows),
+		Attacks:       make([]AttackDTO, len(k.Attacks)),
+		Tags:          k.Tags,
+	}
+	for i, a := range k.Attacks {
+		dto.Attacks[i] = AttackDTO{Label: a.Label, Mod: a.Mod, Damage: make([]DamageDTO, len(a.Damage))}
+		for j, d := range a.Damage {
+			dto.Attacks[i].Damage[j] = DamageDTO(d)
+		}
+	}
+	return dto
+}
+
+func fromKindDTO(dto KindDTO) Kind {
+	k := Kind{
+		Label:         dto.Label,
+		Speed:         dto.Speed,
+		AC:            dto.AC,
+		ChallengeRate: DefaultChallengeRate,
+		XP:            DefaultXP,
+		HitDie:        dto.HitDie,
+		SavingThrows:  SavingThrows(dto.SavingThrows),
+		Attacks:       make([]Attack, len(dto.Attacks)),
+		Tags:          normalizeTags(dto.Tags),
+	}
+	if dto.ChallengeRate != nil {
+		k.ChallengeRate = *dto.ChallengeRate
+	}
+	if dto.XP != nil {
+		k.XP = *dto.XP
+	}
+	for i, a := range dto.Attacks {
+		k.Attacks[i] = Attack{Label: a.Label, Mod: a.Mod, Damage: make([]Damage, len(a.Damage))}
+		for j, d := range a.Damage {
+			k.Attacks[i].Damage[j] = Damage(d)
+		}
+	}
+	return k
+}
+
+func toCharacterDTO(c Character) CharacterDTO {
+	return CharacterDTO{
+		Type:       c.Type,
+		Label:      c.Label,
+		Ini:        IniDTO(c.Initiative),
+		Kind:       c.Kind,
+		HP:         c.HitPoints,
+		CHP:        c.CurrentHitPoints,
+		Conditions: c.Conditions,
+	}
+}
+
+func fromCharacterDTO(dto CharacterDTO) Character {
+	return Character{
+		Type:             dto.Type,
+		Label:            dto.Label,
+		Initiative:       Initiative(dto.Ini),
+		Kind:             dto.Kind,
+		HitPoints:        dto.HP,
+		CurrentHitPoints: dto.CHP,
+		Conditions:       dto.Conditions,
+	}
+}
+
+func toEncounterDTO(e Encounter) EncounterDTO {
+	dto := EncounterDTO{
+		ID:           e.ID(),
+		Label:        e.Label,
+		LastModified: e.LastModified.Format(time.RFC3339),
+		Characters:   make([]CharacterDTO, len(e.Characters)),
+		Publication:  e.Publication(),
+	}
+	for i, c := range e.Characters {
+		dto.Characters[i] = toCharacterDTO(c)
+	}
+	return dto
+}
+
+func fromEncounterDTO(dto EncounterDTO) Encounter {
+	e := Encounter{
+		Label:      dto.Label,
+		Characters: make([]Character, len(dto.Characters)),
+	}
+	for i, c := range dto.Characters {
+		e.Characters[i] = fromCharacterDTO(c)
+	}
+	return e
+}
+
+func toRatingDTO(r Rating) RatingDTO {
+	return RatingDTO{
+		Thresholds: ThresholdsDTO(r.Thresholds),
+		Monsters:   r.Monsters,
+		XP:         r.XP,
+		Multiplier: r.Multiplier,
+		AdjustedXP: r.AdjustedXP,
+		Difficulty: r.Difficulty,
+	}
+}
+
+func toPlayerViewDTO(v PlayerView) PlayerViewDTO {
+	dto := PlayerViewDTO{
+		Label:      v.Label,
+		Characters: make([]PublicCharacterDTO, len(v.Characters)),
+	}
+	for i, c := range v.Characters {
+		dto.Characters[i] = PublicCharacterDTO(c)
+	}
+	return dto
+}
@@ -0,0 +1,69 @@
+package encounter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestCharacterDTO_JSON(t *testing.T) {
+	in := `[{"type":"pc","label":"Tordek","ini":14},{"type":"npc","label":"Goblin 1","ini":{"dieResult":12,"modifier":2},"kind":"Goblin","hp":7,"chp":0,"conditions":["prone"]}]`
+
+	var dtos []CharacterDTO
+	expect.That(t,
+		expect.FailNow(is.NoError(json.Unmarshal([]byte(in), &dtos))),
+		is.DeepEqualTo(dtos, []CharacterDTO{
+			{Type: TypePC, Label: "Tordek", Ini: IniDTO{DieResult: 14}},
+			{Type: TypeNPC, Label: "Goblin 1", Ini: IniDTO{DieResult: 12, Modifier: 2}, Kind: "Goblin", HP: 7, Conditions: []string{"prone"}},
+		}),
+	)
+
+	out, err := json.Marshal(dtos)
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(string(out), in),
+	)
+}
+
+func TestFromKindDTO_defaults(t *testing.T) {
+	var dto KindDTO
+	expect.That(t, expect.FailNow(is.NoError(json.Unmarshal([]byte(`{"label":"Goblin","speed":30,"ac":15,"hitDie":"2d6","savingThrows":{"str":-1,"dex":2,"con":0,"int":0,"wis":-1,"cha":-1},"attacks":[]}`), &dto))))
+
+	k := fromKindDTO(dto)
+	expect.That(t,
+		is.EqualTo(k.ChallengeRate, DefaultChallengeRate),
+		is.EqualTo(k.XP, DefaultXP),
+		is.EqualTo(k.SavingThrows, SavingThrows{Str: -1, Dex: 2, Wis: -1, Cha: -1}),
+	)
+}
+
+func TestHandler_unauthenticated(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	h := Handler(NewService(NewRepository(s)))
+
+	tests := map[string]struct {
+		method, path string
+		want         int
+	}{
+		"list":               {http.MethodGet, "/encounters", http.StatusUnauthorized},
+		"publish":            {http.MethodPost, "/encounters/published/publication", http.StatusUnauthorized},
+		"unpublish":          {http.MethodDelete, "/encounters/published/publication", http.StatusUnauthorized},
+		"publishedView":      {http.MethodGet, "/encounters/published/unknown", http.StatusNotFound},
+		"publishedSubscribe": {http.MethodGet, "/encounters/published/unknown/subscribe", http.StatusNotFound},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+			expect.That(t, is.EqualTo(w.Code, test.want))
+		})
+	}
+}
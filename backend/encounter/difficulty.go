@@ -0,0 +1,205 @@
+package encounter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidParty is returned when rating an encounter for an invalid party.
+var ErrInvalidParty = errors.New("invalid party")
+
+// maxKindCount is the maximum number of creatures of a single kind accepted
+// when rating an encounter.
+const maxKindCount = 1000
+
+// Difficulty rates an encounter.
+type Difficulty string
+
+const (
+	Trivial Difficulty = "trivial"
+	Easy    Difficulty = "easy"
+	Medium  Difficulty = "medium"
+	Hard    Difficulty = "hard"
+	Deadly  Difficulty = "deadly"
+)
+
+// Thresholds contains the XP thresholds of the difficulties.
+type Thresholds struct {
+	Easy, Medium, Hard, Deadly int
+}
+
+func (t Thresholds) add(o Thresholds) Thresholds {
+	return Thresholds{
+		Easy:   t.Easy + o.Easy,
+		Medium: t.Medium + o.Medium,
+		Hard:   t.Hard + o.Hard,
+		Deadly: t.Deadly + o.Deadly,
+	}
+}
+
+// Rate returns the difficulty of an encounter worth adjustedXP.
+func (t Thresholds) Rate(adjustedXP int) Difficulty {
+	switch {
+	case adjustedXP >= t.Deadly:
+		return Deadly
+	case adjustedXP >= t.Hard:
+		return Hard
+	case adjustedXP >= t.Medium:
+		return Medium
+	case adjustedXP >= t.Easy:
+		return Easy
+	default:
+		return Trivial
+	}
+}
+
+// levelThresholds contains the XP thresholds of a single character indexed
+// by character level - 1.
+var levelThresholds = [20]Thresholds{
+	{25, 50, 75, 100},
+	{50, 100, 150, 200},
+	{75, 150, 225, 400},
+	{125, 250, 375, 500},
+	{250, 500, 750, 1100},
+	{300, 600, 900, 1400},
+	{350, 750, 1100, 1700},
+	{450, 900, 1400, 2100},
+	{550, 1100, 1600, 2400},
+	{600, 1200, 1900, 2800},
+	{800, 1600, 2400, 3600},
+	{1000, 2000, 3000, 4500},
+	{1100, 2200, 3400, 5100},
+	{1250, 2500, 3800, 5700},
+	{1400, 2800, 4300, 6400},
+	{1600, 3200, 4800, 7200},
+	{2000, 3900, 5900, 8800},
+	{2100, 4200, 6300, 9500},
+	{2400, 4900, 7300, 10900},
+	{2800, 5700, 8500, 12700},
+}
+
+// PartyThresholds returns the XP thresholds of a party given the levels of
+// its characters.
+func PartyThresholds(levels []int) (Thresholds, error) {
+	if len(levels) == 0 {
+		return Thresholds{}, fmt.Errorf("%w: no characters", ErrInvalidParty)
+	}
+
+	var t Thresholds
+	for _, l := range levels {
+		if l < 1 || l > len(levelThresholds) {
+			return Thresholds{}, fmt.Errorf("%w: invalid level: %d", ErrInvalidParty, l)
+		}
+		t = t.add(levelThresholds[l-1])
+	}
+	return t, nil
+}
+
+// multipliers lists the encounter multipliers. Parties of less than three
+// characters use the next higher and parties of six or more characters the
+// next lower multiplier.
+var multipliers = []float64{0.5, 1, 1.5, 2, 2.5, 3, 4, 5}
+
+// Multiplier returns the multiplier applied to the XP of an encounter with
+// the given number of monsters fought by a party of partySize characters.
+func Multiplier(monsters, partySize int) float64 {
+	var i int
+	switch {
+	case monsters <= 1:
+		i = 1
+	case monsters == 2:
+		i = 2
+	case monsters <= 6:
+		i = 3
+	case monsters <= 10:
+		i = 4
+	case monsters <= 14:
+		i = 5
+	default:
+		i = 6
+	}
+
+	switch {
+	case partySize < 3:
+		i++
+	case partySize >= 6:
+		i--
+	}
+
+	return multipliers[i]
+}
+
+// Rating is the difficulty rating of an encounter.
+type Rating struct {
+	Thresholds Thresholds
+	// Monsters is the number of monsters.
+	Monsters int
+	// XP is the sum of the monsters' XP.
+	XP         int
+	Multiplier float64
+	// AdjustedXP is the XP multiplied by Multiplier which determines the
+	// difficulty.
+	AdjustedXP int
+	Difficulty Difficulty
+}
+
+// RateEncounter rates an encounter with monsters worth the given XP each
+// fought by a party of characters with the given levels.
+func RateEncounter(levels []int, xp []int) (Rating, error) {
+	thresholds, err := PartyThresholds(levels)
+	if err != nil {
+		return Rating{}, err
+	}
+
+	r := Rating{
+		Thresholds: thresholds,
+		Monsters:   len(xp),
+		Multiplier: Multiplier(len(xp), len(levels)),
+	}
+	for _, x := range xp {
+		r.XP += x
+	}
+
+	r.AdjustedXP = int(float64(r.XP) * r.Multiplier)
+	r.Difficulty = thresholds.Rate(r.AdjustedXP)
+
+	return r, nil
+}
+
+// KindCount is a number of creatures of the kind identified by ID.
+type KindCount struct {
+	ID    string
+	Count int
+}
+
+// RateEncounter rates an encounter with the given kinds from the bestiary of
+// the principal found in ctx fought by a party of characters with the given
+// levels.
+func (svc *EncounterService) RateEncounter(ctx context.Context, levels []int, kinds []KindCount) (Rating, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return Rating{}, err
+	}
+
+	var xp []int
+	for _, kc := range kinds {
+		if kc.Count < 1 || kc.Count > maxKindCount {
+			return Rating{}, fmt.Errorf("%w: invalid count for kind %s: %d", ErrInvalidKind, kc.ID, kc.Count)
+		}
+
+		k, err := svc.repo.LoadKind(ownerID, kc.ID)
+		if errors.Is(err, ErrNotFound) {
+			return Rating{}, fmt.Errorf("%w: kind not found: %s", ErrInvalidKind, kc.ID)
+		}
+		if err != nil {
+			return Rating{}, err
+		}
+
+		for range kc.Count {
+			xp = append(xp, k.XP)
+		}
+	}
+
+	return RateEncounter(levels, xp)
+}
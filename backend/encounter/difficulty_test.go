@@ -0,0 +1,113 @@
+package encounter
+
+import (
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestPartyThresholds(t *testing.T) {
+	thresholds, err := PartyThresholds([]int{3, 3, 3, 4})
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(thresholds, Thresholds{Easy: 350, Medium: 700, Hard: 1050, Deadly: 1700}),
+	)
+
+	_, err = PartyThresholds(nil)
+	expect.That(t, is.Error(err, ErrInvalidParty))
+
+	_, err = PartyThresholds([]int{1, 21})
+	expect.That(t, is.Error(err, ErrInvalidParty))
+}
+
+func TestMultiplier(t *testing.T) {
+	tests := []struct {
+		monsters, partySize int
+		want                float64
+	}{
+		{1, 4, 1},
+		{2, 4, 1.5},
+		{3, 4, 2},
+		{6, 4, 2},
+		{7, 4, 2.5},
+		{11, 4, 3},
+		{15, 4, 4},
+		{1, 2, 1.5},
+		{15, 2, 5},
+		{1, 6, 0.5},
+		{4, 7, 1.5},
+	}
+
+	for _, test := range tests {
+		expect.That(t, is.EqualTo(Multiplier(test.monsters, test.partySize), test.want))
+	}
+}
+
+func TestRateEncounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []int
+		xp     []int
+		want   Rating
+	}{
+		{
+			name:   "no monsters",
+			levels: []int{1, 1, 1, 1},
+			want: Rating{
+				Thresholds: Thresholds{100, 200, 300, 400},
+				Multiplier: 1,
+				Difficulty: Trivial,
+			},
+		},
+		{
+			name:   "goblin ambush",
+			levels: []int{3, 3, 3, 3},
+			xp:     []int{50, 50, 50, 50},
+			want: Rating{
+				Thresholds: Thresholds{300, 600, 900, 1600},
+				Monsters:   4,
+				XP:         200,
+				Multiplier: 2,
+				AdjustedXP: 400,
+				Difficulty: Easy,
+			},
+		},
+		{
+			name:   "ogre and goblins against a small party",
+			levels: []int{2, 2},
+			xp:     []int{450, 50, 50},
+			want: Rating{
+				Thresholds: Thresholds{100, 200, 300, 400},
+				Monsters:   3,
+				XP:         550,
+				Multiplier: 2.5,
+				AdjustedXP: 1375,
+				Difficulty: Deadly,
+			},
+		},
+		{
+			name:   "two orcs",
+			levels: []int{1, 1, 1, 1},
+			xp:     []int{100, 100},
+			want: Rating{
+				Thresholds: Thresholds{100, 200, 300, 400},
+				Monsters:   2,
+				XP:         200,
+				Multiplier: 1.5,
+				AdjustedXP: 300,
+				Difficulty: Hard,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := RateEncounter(test.levels, test.xp)
+			expect.That(t,
+				is.NoError(err),
+				is.EqualTo(got, test.want),
+			)
+		})
+	}
+}
@@ -0,0 +1,636 @@
+// Package encounter implements the bestiary of kinds and the encounters of a
+// user. Kinds describe the statistics shared by all non player characters of
+// the same kind, while encounters list the characters taking part in a fight.
+package encounter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/halimath/d20-tools/auth"
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/grid"
+	"github.com/halimath/d20-tools/infra/random"
+)
+
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrForbidden        = errors.New("forbidden")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrInvalidKind      = errors.New("invalid kind")
+	ErrInvalidEncounter = errors.New("invalid encounter")
+
+	// ErrKindInUse is returned when deleting a kind referenced by an
+	// encounter.
+	ErrKindInUse = errors.New("kind in use")
+)
+
+// SavingThrows contains the saving throw modifiers of a kind.
+type SavingThrows struct {
+	Str, Dex, Con, Int, Wis, Cha int
+}
+
+// Damage is a single damage roll of an attack.
+type Damage struct {
+	Label string
+	// Damage is the dice expression rolled.
+	Damage string
+}
+
+// Attack is an attack performed by a kind.
+type Attack struct {
+	Label string
+	// Mod is the attack roll's modifier.
+	Mod    int
+	Damage []Damage
+}
+
+// Default values applied to kinds lacking a challenge rate or XP as stored
+// by earlier versions of the encounters tool.
+const (
+	DefaultChallengeRate = 1
+	DefaultXP            = 200
+)
+
+// Kind describes a kind of non player characters.
+type Kind struct {
+	id      string
+	ownerID string
+
+	Label         string
+	Speed         int
+	AC            int
+	ChallengeRate float64
+	XP            int
+	// HitDie is the dice expression rolled for hit points.
+	HitDie       string
+	SavingThrows SavingThrows
+	Attacks      []Attack
+	// Tags classify the kind, i.e. by creature type or environment.
+	Tags []string
+}
+
+func (k Kind) ID() string { return k.id }
+
+// HasTags reports whether k is tagged with all of tags ignoring case.
+func (k Kind) HasTags(tags ...string) bool {
+	for _, t := range tags {
+		if !slices.Contains(k.Tags, strings.ToLower(strings.TrimSpace(t))) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeTags converts tags to lower case and removes empty and duplicate
+// tags.
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !slices.Contains(normalized, t) {
+			normalized = append(normalized, t)
+		}
+	}
+	return normalized
+}
+
+func (k Kind) validate() error {
+	if strings.TrimSpace(k.Label) == "" {
+		return fmt.Errorf("%w: missing label", ErrInvalidKind)
+	}
+
+	if _, err := dice.Parse(k.HitDie); err != nil {
+		return fmt.Errorf("%w: hit die: %w", ErrInvalidKind, err)
+	}
+
+	for _, a := range k.Attacks {
+		for _, d := range a.Damage {
+			if _, err := dice.Parse(d.Damage); err != nil {
+				return fmt.Errorf("%w: attack %s: %w", ErrInvalidKind, a.Label, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CharacterType distinguishes player and non player characters.
+type CharacterType string
+
+const (
+	TypePC  CharacterType = "pc"
+	TypeNPC CharacterType = "npc"
+)
+
+// Initiative is a character's initiative. Player characters use a static
+// value stored as DieResult.
+type Initiative struct {
+	DieResult int
+	Modifier  int
+}
+
+// Value returns the total initiative.
+func (i Initiative) Value() int {
+	return i.DieResult + i.Modifier
+}
+
+// Character is a character taking part in an encounter.
+type Character struct {
+	Type       CharacterType
+	Label      string
+	Initiative Initiative
+	// Kind is the label of a non player character's kind.
+	Kind             string
+	HitPoints        int
+	CurrentHitPoints int
+	// Conditions lists the conditions affecting the character, i.e. prone.
+	Conditions []string
+}
+
+// Encounter is a list of characters taking part in a fight.
+type Encounter struct {
+	id      string
+	ownerID string
+	// publication is the token granting access to the encounter's player
+	// view. It is empty unless the encounter has been published.
+	publication string
+
+	Label        string
+	LastModified time.Time
+	Characters   []Character
+}
+
+func (e Encounter) ID() string { return e.id }
+
+// Publication returns the token granting access to the player view of a
+// published encounter or an empty string.
+func (e Encounter) Publication() string { return e.publication }
+
+// validate makes sure all characters of e are valid and all non player
+// characters refer to one of kinds.
+func (e Encounter) validate(kinds []Kind) error {
+	if strings.TrimSpace(e.Label) == "" {
+		return fmt.Errorf("%w: missing label", ErrInvalidEncounter)
+	}
+
+	for _, c := range e.Characters {
+		switch c.Type {
+		case TypePC:
+		case TypeNPC:
+			if !slices.ContainsFunc(kinds, func(k Kind) bool { return k.Label == c.Kind }) {
+				return fmt.Errorf("%w: %s: kind not found: %s", ErrInvalidEncounter, c.Label, c.Kind)
+			}
+		default:
+			return fmt.Errorf("%w: %s: invalid character type %q", ErrInvalidEncounter, c.Label, c.Type)
+		}
+	}
+
+	return nil
+}
+
+// --
+
+type EncounterService struct {
+	repo *Repository
+	// mu serializes modifications of a user's kinds and encounters to keep
+	// kind labels unique and references to kinds intact.
+	mu sync.Mutex
+	// dice is the source used to roll dice.
+	dice dice.Source
+	// grids is used to place tokens for generated encounters. It is nil if
+	// not configured using WithGridService.
+	grids Grids
+}
+
+// Grids defines the operations of grid.GridService used to place tokens for
+// generated encounters on grids.
+type Grids interface {
+	LoadForEditing(ctx context.Context, id string) (grid.Grid, error)
+	Patch(ctx context.Context, id string, ops []grid.Operation) (grid.Grid, error)
+}
+
+// ServiceOption defines a functional option for configuring an
+// EncounterService.
+type ServiceOption func(*EncounterService)
+
+// WithGridService configures the grid service used to place tokens for
+// generated encounters on grids.
+func WithGridService(grids Grids) ServiceOption {
+	return func(svc *EncounterService) {
+		svc.grids = grids
+	}
+}
+
+func NewService(r *Repository, opts ...ServiceOption) *EncounterService {
+	svc := &EncounterService{
+		repo: r,
+		dice: dice.CryptoSource,
+	}
+
+	for _, opt := range opts {
+		opt(svc)
+	}
+
+	return svc
+}
+
+func ownerFromContext(ctx context.Context) (string, error) {
+	principal := auth.FromContext(ctx)
+	if principal == nil {
+		return "", ErrForbidden
+	}
+	return principal.ID, nil
+}
+
+// ListKinds lists all kinds of the principal found in ctx ordered by label.
+func (svc *EncounterService) ListKinds(ctx context.Context) ([]Kind, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds, err := svc.repo.ListKinds(ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(kinds, func(a, b Kind) int { return strings.Compare(a.Label, b.Label) })
+	return kinds, nil
+}
+
+// LoadKind loads the kind identified by id.
+func (svc *EncounterService) LoadKind(ctx context.Context, id string) (Kind, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return Kind{}, err
+	}
+
+	return svc.repo.LoadKind(ownerID, id)
+}
+
+// CreateKind adds k to the bestiary of the principal found in ctx. Labels of
+// kinds must be unique.
+func (svc *EncounterService) CreateKind(ctx context.Context, k Kind) (Kind, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return Kind{}, err
+	}
+
+	if err := k.validate(); err != nil {
+		return Kind{}, err
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	return svc.createKind(ownerID, k)
+}
+
+func (svc *EncounterService) createKind(ownerID string, k Kind) (Kind, error) {
+	if _, err := svc.repo.findKind(ownerID, k.Label); err == nil {
+		return Kind{}, fmt.Errorf("%w: kind %s", ErrAlreadyExists, k.Label)
+	} else if !errors.Is(err, ErrNotFound) {
+		return Kind{}, err
+	}
+
+	k.ownerID = ownerID
+	k.id = random.ID(16)
+
+	return k, svc.repo.CreateKind(k)
+}
+
+// UpdateKind replaces the kind identified by id with k. If the label
+// changes, all non player characters of the kind are updated accordingly.
+func (svc *EncounterService) UpdateKind(ctx context.Context, id string, k Kind) (Kind, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return Kind{}, err
+	}
+
+	if err := k.validate(); err != nil {
+		return Kind{}, err
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	original, err := svc.repo.LoadKind(ownerID, id)
+	if err != nil {
+		return Kind{}, err
+	}
+
+	k.ownerID = ownerID
+	k.id = id
+
+	if k.Label == original.Label {
+		return k, svc.repo.UpdateKind(k)
+	}
+
+	if other, err := svc.repo.findKind(ownerID, k.Label); err == nil && other.id != id {
+		return Kind{}, fmt.Errorf("%w: kind %s", ErrAlreadyExists, k.Label)
+	} else if err != nil && !errors.Is(err, ErrNotFound) {
+		return Kind{}, err
+	}
+
+	if err := svc.repo.UpdateKind(k); err != nil {
+		return Kind{}, err
+	}
+
+	encounters, err := svc.repo.ListEncounters(ownerID)
+	if err != nil {
+		return Kind{}, err
+	}
+
+	for _, e := range encounters {
+		changed := false
+		for i, c := range e.Characters {
+			if c.Type == TypeNPC && c.Kind == original.Label {
+				e.Characters[i].Kind = k.Label
+				changed = true
+			}
+		}
+
+		if changed {
+			if err := svc.repo.UpdateEncounter(e); err != nil {
+				return Kind{}, err
+			}
+		}
+	}
+
+	return k, nil
+}
+
+// DeleteKind deletes the kind identified by id. Kinds referenced by
+// encounters cannot be deleted.
+func (svc *EncounterService) DeleteKind(ctx context.Context, id string) error {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	k, err := svc.repo.LoadKind(ownerID, id)
+	if err != nil {
+		return err
+	}
+
+	encounters, err := svc.repo.ListEncounters(ownerID)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range encounters {
+		if slices.ContainsFunc(e.Characters, func(c Character) bool { return c.Type == TypeNPC && c.Kind == k.Label }) {
+			return fmt.Errorf("%w: kind %s is used by encounter %s", ErrKindInUse, k.Label, e.Label)
+		}
+	}
+
+	return svc.repo.DeleteKind(ownerID, id)
+}
+
+// ListEncounters lists all encounters of the principal found in ctx ordered
+// by label.
+func (svc *EncounterService) ListEncounters(ctx context.Context) ([]Encounter, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	encounters, err := svc.repo.ListEncounters(ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(encounters, func(a, b Encounter) int { return strings.Compare(a.Label, b.Label) })
+	return encounters, nil
+}
+
+// LoadEncounter loads the encounter identified by id.
+func (svc *EncounterService) LoadEncounter(ctx context.Context, id string) (Encounter, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return Encounter{}, err
+	}
+
+	return svc.repo.LoadEncounter(ownerID, id)
+}
+
+// CreateEncounter creates a new encounter owned by the principal found in
+// ctx.
+func (svc *EncounterService) CreateEncounter(ctx context.Context, e Encounter) (Encounter, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return Encounter{}, err
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	return svc.createEncounter(ownerID, e)
+}
+
+func (svc *EncounterService) createEncounter(ownerID string, e Encounter) (Encounter, error) {
+	kinds, err := svc.repo.ListKinds(ownerID)
+	if err != nil {
+		return Encounter{}, err
+	}
+
+	if err := e.validate(kinds); err != nil {
+		return Encounter{}, err
+	}
+
+	e.ownerID = ownerID
+	e.id = random.ID(16)
+	e.LastModified = time.Now()
+
+	return e, svc.repo.CreateEncounter(e)
+}
+
+// UpdateEncounter replaces the encounter identified by id with e.
+func (svc *EncounterService) UpdateEncounter(ctx context.Context, id string, e Encounter) (Encounter, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return Encounter{}, err
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	original, err := svc.repo.LoadEncounter(ownerID, id)
+	if err != nil {
+		return Encounter{}, err
+	}
+
+	kinds, err := svc.repo.ListKinds(ownerID)
+	if err != nil {
+		return Encounter{}, err
+	}
+
+	if err := e.validate(kinds); err != nil {
+		return Encounter{}, err
+	}
+
+	e.ownerID = ownerID
+	e.id = id
+	e.publication = original.publication
+	e.LastModified = time.Now()
+
+	return e, svc.repo.UpdateEncounter(e)
+}
+
+// DeleteEncounter deletes the encounter identified by id.
+func (svc *EncounterService) DeleteEncounter(ctx context.Context, id string) error {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	e, err := svc.repo.LoadEncounter(ownerID, id)
+	if err != nil {
+		return err
+	}
+
+	if e.publication != "" {
+		if err := svc.repo.DeletePublication(e.publication); err != nil {
+			return err
+		}
+	}
+
+	return svc.repo.DeleteEncounter(ownerID, id)
+}
+
+// DefaultImportLabel is the label of encounters imported without a label.
+const DefaultImportLabel = "Imported encounter"
+
+// ImportResult summarizes an import.
+type ImportResult struct {
+	// Created and Updated list the labels of kinds created or updated.
+	Created, Updated []string
+	// Encounter is the encounter created from the imported characters. It
+	// is empty if no characters have been imported.
+	Encounter Encounter
+}
+
+// Import imports kinds and characters as stored by the encounters tool in
+// the browser's local storage. Kinds are matched by label: existing kinds
+// are updated while unknown ones are created. If characters are given, they
+// are stored as a new encounter labeled label or DefaultImportLabel if label
+// is empty.
+func (svc *EncounterService) Import(ctx context.Context, kinds []Kind, label string, characters []Character) (ImportResult, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	for _, k := range kinds {
+		if err := k.validate(); err != nil {
+			return ImportResult{}, fmt.Errorf("%s: %w", k.Label, err)
+		}
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	result, err := svc.importKinds(ownerID, kinds)
+	if err != nil {
+		return result, err
+	}
+
+	if len(characters) > 0 {
+		if strings.TrimSpace(label) == "" {
+			label = DefaultImportLabel
+		}
+
+		result.Encounter, err = svc.createEncounter(ownerID, Encounter{Label: label, Characters: characters})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// importKinds creates or updates kinds matching them by label.
+func (svc *EncounterService) importKinds(ownerID string, kinds []Kind) (ImportResult, error) {
+	var result ImportResult
+
+	for _, k := range kinds {
+		existing, err := svc.repo.findKind(ownerID, k.Label)
+		if errors.Is(err, ErrNotFound) {
+			if _, err := svc.createKind(ownerID, k); err != nil {
+				return result, err
+			}
+			result.Created = append(result.Created, k.Label)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		k.ownerID = ownerID
+		k.id = existing.id
+		if err := svc.repo.UpdateKind(k); err != nil {
+			return result, err
+		}
+		result.Updated = append(result.Updated, k.Label)
+	}
+
+	return result, nil
+}
+
+// ImportBestiary imports the monsters of an SRD or Open5e bestiary file (see
+// ParseBestiary) into the bestiary of the principal found in ctx. Monsters
+// are matched by name so importing a file again updates the kinds instead of
+// creating duplicates. Monsters that cannot be mapped are skipped and
+// reported with an error.
+func (svc *EncounterService) ImportBestiary(ctx context.Context, data []byte) (ImportResult, []MappedKind, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return ImportResult{}, nil, err
+	}
+
+	return svc.ImportBestiaryForUser(ownerID, data)
+}
+
+// ImportBestiaryForUser works like ImportBestiary but imports the kinds for
+// the user identified by ownerID. It is meant for command line tools running
+// without a session.
+func (svc *EncounterService) ImportBestiaryForUser(ownerID string, data []byte) (ImportResult, []MappedKind, error) {
+	mapped, err := ParseBestiary(data)
+	if err != nil {
+		return ImportResult{}, nil, err
+	}
+
+	var kinds []Kind
+	for i, mk := range mapped {
+		if mk.Err != nil {
+			continue
+		}
+
+		if err := mk.Kind.validate(); err != nil {
+			mapped[i].Err = err
+			continue
+		}
+
+		// Files may list the same monster more than once. The last one wins.
+		if j := slices.IndexFunc(kinds, func(k Kind) bool { return k.Label == mk.Kind.Label }); j >= 0 {
+			kinds[j] = mk.Kind
+			continue
+		}
+		kinds = append(kinds, mk.Kind)
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	result, err := svc.importKinds(ownerID, kinds)
+	return result, mapped, err
+}
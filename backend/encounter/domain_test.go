@@ -0,0 +1,65 @@
+package encounter
+
+import (
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func goblin() Kind {
+	return Kind{
+		Label:         "Goblin",
+		Speed:         30,
+		AC:            15,
+		ChallengeRate: 0.25,
+		XP:            50,
+		HitDie:        "2d6",
+		SavingThrows:  SavingThrows{Str: -1, Dex: 2},
+		Attacks: []Attack{
+			{Label: "Scimitar", Mod: 4, Damage: []Damage{{Label: "slashing", Damage: "1d6+2"}}},
+		},
+	}
+}
+
+func TestKind_validate(t *testing.T) {
+	k := goblin()
+	expect.That(t, is.NoError(k.validate()))
+
+	k.Label = " "
+	expect.That(t, is.Error(k.validate(), ErrInvalidKind))
+
+	k = goblin()
+	k.HitDie = "2x6"
+	expect.That(t, is.Error(k.validate(), ErrInvalidKind))
+
+	k = goblin()
+	k.Attacks[0].Damage[0].Damage = "d"
+	expect.That(t, is.Error(k.validate(), ErrInvalidKind))
+}
+
+func TestEncounter_validate(t *testing.T) {
+	kinds := []Kind{goblin()}
+
+	e := Encounter{
+		Label: "Ambush",
+		Characters: []Character{
+			{Type: TypePC, Label: "Tordek", Initiative: Initiative{DieResult: 14}},
+			{Type: TypeNPC, Label: "Goblin 1", Kind: "Goblin", Initiative: Initiative{DieResult: 12, Modifier: 2}, HitPoints: 7, CurrentHitPoints: 7},
+		},
+	}
+	expect.That(t,
+		is.NoError(e.validate(kinds)),
+		is.EqualTo(e.Characters[1].Initiative.Value(), 14),
+	)
+
+	e.Characters[1].Kind = "Orc"
+	expect.That(t, is.Error(e.validate(kinds), ErrInvalidEncounter))
+
+	e.Characters[1] = Character{Type: "monster", Label: "Goblin 1"}
+	expect.That(t, is.Error(e.validate(kinds), ErrInvalidEncounter))
+
+	e.Characters = nil
+	e.Label = ""
+	expect.That(t, is.Error(e.validate(kinds), ErrInvalidEncounter))
+}
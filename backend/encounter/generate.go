@@ -0,0 +1,325 @@
+package encounter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/grid"
+)
+
+// ErrNoEncounterFound is returned when no combination of kinds matches the
+// requested difficulty.
+var ErrNoEncounterFound = errors.New("no encounter found")
+
+const (
+	// maxGeneratedMonsters is the maximum number of monsters in a generated
+	// encounter.
+	maxGeneratedMonsters = 20
+	// generateAttempts is the number of random combinations tried before
+	// giving up.
+	generateAttempts = 100
+)
+
+// tokenSymbols lists the symbols used for tokens of generated encounters.
+// All monsters of the same kind share a symbol.
+var tokenSymbols = []grid.TokenSymbol{
+	grid.SymbolCircle, grid.SymbolTriangleUp, grid.SymbolTriangleDown,
+	grid.SymbolSquare, grid.SymbolDiamond, grid.SymbolStar,
+}
+
+// GenerateOptions configure the generation of a random encounter.
+type GenerateOptions struct {
+	Label string
+	// Party contains the levels of the characters.
+	Party      []int
+	Difficulty Difficulty
+	// Tags restricts the kinds to those tagged with all tags.
+	Tags []string
+	// Environment restricts the kinds to those tagged with the environment.
+	Environment string
+	// GridID optionally identifies a grid to place tokens for the monsters
+	// on.
+	GridID string
+}
+
+// Placement is the cell a monster's token has been placed on.
+type Placement struct {
+	Label    string
+	Col, Row int
+}
+
+// Generated is a randomly generated encounter.
+type Generated struct {
+	Encounter  Encounter
+	Rating     Rating
+	Placements []Placement
+}
+
+// xpRange returns the range of adjusted XP [lower, upper) matching
+// difficulty d.
+func (t Thresholds) xpRange(d Difficulty) (lower, upper int, ok bool) {
+	switch d {
+	case Easy:
+		return t.Easy, t.Medium, true
+	case Medium:
+		return t.Medium, t.Hard, true
+	case Hard:
+		return t.Hard, t.Deadly, true
+	case Deadly:
+		return t.Deadly, 2 * t.Deadly, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// Generate assembles a random encounter of the requested difficulty from
+// the bestiary of the principal found in ctx. Hit points and initiative of
+// all monsters are rolled and the encounter is stored. If a grid is given,
+// a token is placed for each monster on the first free cells of the grid.
+// Placing the tokens fails if the grid does not have enough free cells or
+// the principal may not edit the grid. The encounter is not stored if
+// placing the tokens fails.
+func (svc *EncounterService) Generate(ctx context.Context, opts GenerateOptions) (Generated, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return Generated{}, err
+	}
+
+	return svc.generate(ctx, ownerID, opts)
+}
+
+func (svc *EncounterService) generate(ctx context.Context, ownerID string, opts GenerateOptions) (Generated, error) {
+	thresholds, err := PartyThresholds(opts.Party)
+	if err != nil {
+		return Generated{}, err
+	}
+
+	lower, upper, ok := thresholds.xpRange(opts.Difficulty)
+	if !ok {
+		return Generated{}, fmt.Errorf("%w: invalid difficulty %q", ErrInvalidParty, opts.Difficulty)
+	}
+
+	if opts.GridID != "" && svc.grids == nil {
+		return Generated{}, fmt.Errorf("%w: placing tokens on grids is not supported", ErrInvalidEncounter)
+	}
+
+	tags := slices.Clone(opts.Tags)
+	if opts.Environment != "" {
+		tags = append(tags, opts.Environment)
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	kinds, err := svc.repo.ListKinds(ownerID)
+	if err != nil {
+		return Generated{}, err
+	}
+
+	var candidates []Kind
+	for _, k := range kinds {
+		if k.XP > 0 && k.HasTags(tags...) {
+			candidates = append(candidates, k)
+		}
+	}
+
+	monsters, err := pickMonsters(svc.dice, candidates, len(opts.Party), lower, upper)
+	if err != nil {
+		return Generated{}, err
+	}
+
+	xp := make([]int, len(monsters))
+	for i, k := range monsters {
+		xp[i] = k.XP
+	}
+
+	var result Generated
+	if result.Rating, err = RateEncounter(opts.Party, xp); err != nil {
+		return Generated{}, err
+	}
+
+	var ops []grid.Operation
+	if opts.GridID != "" {
+		if ops, err = svc.planTokens(ctx, opts.GridID, monsters); err != nil {
+			return Generated{}, err
+		}
+	}
+
+	label := opts.Label
+	if strings.TrimSpace(label) == "" {
+		label = fmt.Sprintf("Random %s encounter", opts.Difficulty)
+	}
+
+	result.Encounter, err = svc.createEncounter(ownerID, Encounter{
+		Label:      label,
+		Characters: svc.rollMonsters(monsters),
+	})
+	if err != nil {
+		return Generated{}, err
+	}
+
+	if len(ops) > 0 {
+		if _, err := svc.grids.Patch(ctx, opts.GridID, ops); err != nil {
+			// Don't leave an encounter behind whose tokens are missing.
+			if delErr := svc.repo.DeleteEncounter(ownerID, result.Encounter.id); delErr != nil {
+				return Generated{}, errors.Join(gridError(err), delErr)
+			}
+			return Generated{}, gridError(err)
+		}
+
+		for i, op := range ops {
+			result.Placements = append(result.Placements, Placement{
+				Label: result.Encounter.Characters[i].Label,
+				Col:   op.Col,
+				Row:   op.Row,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// pickMonsters randomly picks kinds until the adjusted XP for a party of
+// partySize characters lies within [lower, upper).
+func pickMonsters(src dice.Source, kinds []Kind, partySize, lower, upper int) ([]Kind, error) {
+	adjustedXP := func(monsters []Kind) int {
+		xp := 0
+		for _, k := range monsters {
+			xp += k.XP
+		}
+		return int(float64(xp) * Multiplier(len(monsters), partySize))
+	}
+
+	for range generateAttempts {
+		var monsters []Kind
+
+		for len(monsters) < maxGeneratedMonsters {
+			var fitting []Kind
+			for _, k := range kinds {
+				if adjustedXP(append(monsters, k)) < upper {
+					fitting = append(fitting, k)
+				}
+			}
+			if len(fitting) == 0 {
+				break
+			}
+
+			monsters = append(monsters, fitting[src.Intn(len(fitting))])
+
+			// Once the encounter is difficult enough, stop adding monsters
+			// by chance to vary the size of the encounters.
+			if adjustedXP(monsters) >= lower && src.Intn(2) == 0 {
+				break
+			}
+		}
+
+		if xp := adjustedXP(monsters); xp >= lower && xp < upper {
+			return monsters, nil
+		}
+	}
+
+	return nil, ErrNoEncounterFound
+}
+
+// rollMonsters creates a non player character for each of monsters rolling
+// hit points and initiative. Monsters of the same kind are numbered.
+func (svc *EncounterService) rollMonsters(monsters []Kind) []Character {
+	counts := map[string]int{}
+	for _, k := range monsters {
+		counts[k.Label]++
+	}
+
+	numbers := map[string]int{}
+	characters := make([]Character, len(monsters))
+
+	for i, k := range monsters {
+		label := k.Label
+		if counts[k.Label] > 1 {
+			numbers[k.Label]++
+			label = fmt.Sprintf("%s %d", k.Label, numbers[k.Label])
+		}
+
+		hp := 1
+		if expr, err := dice.Parse(k.HitDie); err == nil {
+			hp = max(1, expr.Roll(svc.dice).Total)
+		}
+
+		characters[i] = Character{
+			Type:  TypeNPC,
+			Label: label,
+			Initiative: Initiative{
+				DieResult: svc.dice.Intn(20) + 1,
+				Modifier:  k.SavingThrows.Dex,
+			},
+			Kind:             k.Label,
+			HitPoints:        hp,
+			CurrentHitPoints: hp,
+		}
+	}
+
+	return characters
+}
+
+// planTokens returns the operations placing a token for each of monsters on
+// the first free cells of the grid identified by gridID. It fails if the
+// principal may not edit the grid.
+func (svc *EncounterService) planTokens(ctx context.Context, gridID string, monsters []Kind) ([]grid.Operation, error) {
+	g, err := svc.grids.LoadForEditing(ctx, gridID)
+	if err != nil {
+		return nil, gridError(err)
+	}
+
+	l, err := grid.ParseLayout(g.Descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := map[string]grid.TokenSymbol{}
+	ops := make([]grid.Operation, 0, len(monsters))
+
+	for row := 0; row < l.Rows && len(ops) < len(monsters); row++ {
+		for col := 0; col < l.Cols && len(ops) < len(monsters); col++ {
+			if l.TokenAt(col, row) != nil {
+				continue
+			}
+
+			k := monsters[len(ops)]
+			symbol, ok := symbols[k.Label]
+			if !ok {
+				symbol = tokenSymbols[len(symbols)%len(tokenSymbols)]
+				symbols[k.Label] = symbol
+			}
+
+			ops = append(ops, grid.Operation{
+				Type:   grid.OpPlaceToken,
+				Col:    col,
+				Row:    row,
+				Symbol: symbol,
+				Color:  grid.ColorRed,
+			})
+		}
+	}
+
+	if len(ops) < len(monsters) {
+		return nil, fmt.Errorf("%w: not enough free cells on grid %s", ErrInvalidEncounter, gridID)
+	}
+
+	return ops, nil
+}
+
+// gridError maps errors returned by the grid service to the errors of this
+// package.
+func gridError(err error) error {
+	switch {
+	case errors.Is(err, grid.ErrNotFound):
+		return fmt.Errorf("%w: grid not found", ErrInvalidEncounter)
+	case errors.Is(err, grid.ErrForbidden):
+		return ErrForbidden
+	default:
+		return err
+	}
+}
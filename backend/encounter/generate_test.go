@@ -0,0 +1,209 @@
+package encounter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/grid"
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func seededSource(n int) dice.Source {
+	return dice.NewSeededSource(make([]byte, dice.SeedSize), fmt.Sprintf("generate:%d", n))
+}
+
+func bestiary() []Kind {
+	return []Kind{
+		{Label: "Goblin", XP: 50, HitDie: "2d6", SavingThrows: SavingThrows{Dex: 2}},
+		{Label: "Orc", XP: 100, HitDie: "2d8+6", SavingThrows: SavingThrows{Dex: 1}},
+		{Label: "Ogre", XP: 450, HitDie: "7d10+21", SavingThrows: SavingThrows{Dex: -1}},
+	}
+}
+
+func TestPickMonsters(t *testing.T) {
+	party := []int{3, 3, 3, 3}
+	thresholds, _ := PartyThresholds(party)
+
+	for _, d := range []Difficulty{Easy, Medium, Hard, Deadly} {
+		lower, upper, ok := thresholds.xpRange(d)
+		expect.That(t, expect.FailNow(is.EqualTo(ok, true)))
+
+		for n := range 20 {
+			monsters, err := pickMonsters(seededSource(n), bestiary(), len(party), lower, upper)
+			expect.That(t, expect.FailNow(is.NoError(err)))
+
+			xp := make([]int, len(monsters))
+			for i, k := range monsters {
+				xp[i] = k.XP
+			}
+
+			rating, err := RateEncounter(party, xp)
+			expect.That(t,
+				is.NoError(err),
+				is.EqualTo(rating.Difficulty, d),
+			)
+		}
+	}
+}
+
+func TestPickMonsters_noEncounterFound(t *testing.T) {
+	// A single ogre is too much for an easy encounter of a first level party
+	// and there are no other kinds.
+	_, err := pickMonsters(seededSource(0), bestiary()[2:], 4, 100, 200)
+	expect.That(t, is.Error(err, ErrNoEncounterFound))
+
+	_, err = pickMonsters(seededSource(0), nil, 4, 100, 200)
+	expect.That(t, is.Error(err, ErrNoEncounterFound))
+}
+
+func TestThresholds_xpRange(t *testing.T) {
+	thresholds := Thresholds{Easy: 100, Medium: 200, Hard: 300, Deadly: 400}
+
+	lower, upper, ok := thresholds.xpRange(Deadly)
+	expect.That(t,
+		is.EqualTo(ok, true),
+		is.EqualTo(lower, 400),
+		is.EqualTo(upper, 800),
+	)
+
+	_, _, ok = thresholds.xpRange(Trivial)
+	expect.That(t, is.EqualTo(ok, false))
+}
+
+func TestEncounterService_rollMonsters(t *testing.T) {
+	svc := &EncounterService{dice: seededSource(0)}
+	kinds := bestiary()
+
+	characters := svc.rollMonsters([]Kind{kinds[0], kinds[2], kinds[0]})
+	expect.That(t, expect.FailNow(is.SliceOfLen(characters, 3)))
+
+	for i, want := range []struct{ label, kind string }{{"Goblin 1", "Goblin"}, {"Ogre", "Ogre"}, {"Goblin 2", "Goblin"}} {
+		c := characters[i]
+		expect.That(t,
+			is.EqualTo(c.Type, TypeNPC),
+			is.EqualTo(c.Label, want.label),
+			is.EqualTo(c.Kind, want.kind),
+			is.EqualTo(c.HitPoints, c.CurrentHitPoints),
+		)
+
+		if c.Initiative.DieResult < 1 || c.Initiative.DieResult > 20 {
+			t.Errorf("initiative out of range: %d", c.Initiative.DieResult)
+		}
+	}
+
+	expect.That(t,
+		is.EqualTo(characters[1].Initiative.Modifier, -1),
+	)
+
+	if hp := characters[1].HitPoints; hp < 28 || hp > 91 {
+		t.Errorf("ogre hit points out of range: %d", hp)
+	}
+}
+
+type fakeGrids struct {
+	grid     grid.Grid
+	loadErr  error
+	patchErr error
+	patched  []grid.Operation
+}
+
+func (f *fakeGrids) LoadForEditing(ctx context.Context, id string) (grid.Grid, error) {
+	return f.grid, f.loadErr
+}
+
+func (f *fakeGrids) Patch(ctx context.Context, id string, ops []grid.Operation) (grid.Grid, error) {
+	if f.patchErr != nil {
+		return grid.Grid{}, f.patchErr
+	}
+	f.patched = ops
+	return f.grid, nil
+}
+
+func TestEncounterService_generate(t *testing.T) {
+	opts := GenerateOptions{Party: []int{3, 3, 3, 3}, Difficulty: Medium}
+
+	tests := map[string]struct {
+		gridID string
+		grids  fakeGrids
+		want   error
+	}{
+		"withoutGrid": {},
+		"withGrid": {
+			gridID: "owner:grid",
+			grids:  fakeGrids{grid: grid.Grid{Values: grid.Values{Descriptor: "3x3:-9:kr1-8:-18"}}},
+		},
+		"forbidden": {
+			gridID: "owner:grid",
+			grids:  fakeGrids{loadErr: grid.ErrForbidden},
+			want:   ErrForbidden,
+		},
+		"patchFails": {
+			gridID: "owner:grid",
+			grids:  fakeGrids{grid: grid.Grid{Values: grid.Values{Descriptor: "3x3:-9:kr1-8:-18"}}, patchErr: grid.ErrConflict},
+			want:   grid.ErrConflict,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := shelf.Open(nil)
+			defer s.Close()
+
+			repo := NewRepository(s)
+			svc := NewService(repo, WithGridService(&test.grids))
+			svc.dice = seededSource(0)
+
+			_, err := svc.importKinds("owner", bestiary())
+			expect.That(t, expect.FailNow(is.NoError(err)))
+
+			opts := opts
+			opts.GridID = test.gridID
+			generated, err := svc.generate(context.Background(), "owner", opts)
+
+			encounters, listErr := repo.ListEncounters("owner")
+			expect.That(t, expect.FailNow(is.NoError(listErr)))
+
+			if test.want != nil {
+				expect.That(t,
+					is.Error(err, test.want),
+					is.SliceOfLen(encounters, 0),
+				)
+				return
+			}
+
+			expect.That(t,
+				is.NoError(err),
+				is.SliceOfLen(encounters, 1),
+				is.EqualTo(generated.Rating.Difficulty, Medium),
+			)
+
+			if test.gridID == "" {
+				expect.That(t, is.SliceOfLen(generated.Placements, 0))
+				return
+			}
+
+			expect.That(t,
+				is.SliceOfLen(generated.Placements, len(generated.Encounter.Characters)),
+				is.SliceOfLen(test.grids.patched, len(generated.Encounter.Characters)),
+				is.EqualTo(generated.Placements[0].Label, generated.Encounter.Characters[0].Label),
+				// The first cell is occupied.
+				is.EqualTo(generated.Placements[0].Col, 1),
+			)
+		})
+	}
+}
+
+func TestKind_HasTags(t *testing.T) {
+	k := Kind{Tags: normalizeTags([]string{"Humanoid", " forest ", "", "humanoid"})}
+
+	expect.That(t,
+		is.DeepEqualTo(k.Tags, []string{"humanoid", "forest"}),
+		is.EqualTo(k.HasTags(), true),
+		is.EqualTo(k.HasTags("Forest", "humanoid"), true),
+		is.EqualTo(k.HasTags("forest", "swamp"), false),
+	)
+}
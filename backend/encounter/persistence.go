@@ -0,0 +1,398 @@
+package encounter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/kvlog"
+)
+
+type Repository struct {
+	s *shelf.Shelf
+}
+
+func NewRepository(s *shelf.Shelf) *Repository {
+	return &Repository{s: s}
+}
+
+type kindDBO struct {
+	Label         string          `json:"label"`
+	Speed         int             `json:"speed"`
+	AC            int             `json:"ac"`
+	ChallengeRate float64         `json:"challenge_rate"`
+	XP            int             `json:"xp"`
+	HitDie        string          `json:"hit_die"`
+	SavingThrows  savingThrowsDBO `json:"saving_throws"`
+	Attacks       []attackDBO     `json:"attacks,omitempty"`
+	Tags          []string        `json:"tags,omitempty"`
+}
+
+type savingThrowsDBO struct {
+	Str int `json:"str"`
+	Dex int `json:"dex"`
+	Con int `json:"con"`
+	Int int `json:"int"`
+	Wis int `json:"wis"`
+	Cha int `json:"cha"`
+}
+
+type attackDBO struct {
+	Label  string      `json:"label"`
+	Mod    int         `json:"mod"`
+	Damage []damageDBO `json:"damage,omitempty"`
+}
+
+type damageDBO struct {
+	Label  string `json:"label"`
+	Damage string `json:"damage"`
+}
+
+type encounterDBO struct {
+	Label        string         `json:"label"`
+	Publication  string         `json:"publication,omitempty"`
+	LastModified int64          `json:"last_modified"`
+	Characters   []characterDBO `json:"characters,omitempty"`
+}
+
+type characterDBO struct {
+	Type             CharacterType `json:"type"`
+	Label            string        `json:"label"`
+	DieResult        int           `json:"die_result"`
+	Modifier         int           `json:"modifier,omitempty"`
+	Kind             string        `json:"kind,omitempty"`
+	HitPoints        int           `json:"hp,omitempty"`
+	CurrentHitPoints int           `json:"chp,omitempty"`
+	Conditions       []string      `json:"conditions,omitempty"`
+}
+
+type publicationDBO struct {
+	OwnerID     string `json:"owner_id"`
+	EncounterID string `json:"encounter_id"`
+}
+
+func kindsKey(ownerID string) []byte {
+	return []byte("user/" + ownerID + "/kind/")
+}
+
+func kindKey(ownerID, id string) []byte {
+	return append(kindsKey(ownerID), id...)
+}
+
+func encountersKey(ownerID string) []byte {
+	return []byte("user/" + ownerID + "/encounter/")
+}
+
+func encounterKey(ownerID, id string) []byte {
+	return append(encountersKey(ownerID), id...)
+}
+
+func publicationKey(token string) []byte {
+	return []byte("publication/encounter/" + token)
+}
+
+func (r *Repository) CreateKind(k Kind) error {
+	err := shelf.InsertJSON(r.s, kindKey(k.ownerID, k.id), marshalKind(k))
+	if errors.Is(err, shelf.ErrConflict) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (r *Repository) UpdateKind(k Kind) error {
+	err := shelf.UpdateJSON(r.s, kindKey(k.ownerID, k.id), marshalKind(k))
+	if errors.Is(err, shelf.ErrNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *Repository) LoadKind(ownerID, id string) (Kind, error) {
+	var d kindDBO
+	ok, err := shelf.GetJSON(r.s, kindKey(ownerID, id), &d)
+	if err != nil {
+		return Kind{}, err
+	}
+	if !ok {
+		return Kind{}, ErrNotFound
+	}
+
+	k := Kind{
+		id:            id,
+		ownerID:       ownerID,
+		Label:         d.Label,
+		Speed:         d.Speed,
+		AC:            d.AC,
+		ChallengeRate: d.ChallengeRate,
+		XP:            d.XP,
+		HitDie:        d.HitDie,
+		SavingThrows:  SavingThrows(d.SavingThrows),
+		Attacks:       make([]Attack, len(d.Attacks)),
+		Tags:          d.Tags,
+	}
+	for i, a := range d.Attacks {
+		k.Attacks[i] = Attack{Label: a.Label, Mod: a.Mod, Damage: make([]Damage, len(a.Damage))}
+		for j, dmg := range a.Damage {
+			k.Attacks[i].Damage[j] = Damage(dmg)
+		}
+	}
+
+	return k, nil
+}
+
+func (r *Repository) ListKinds(ownerID string) ([]Kind, error) {
+	ids := shelf.KeySuffixes(r.s, kindsKey(ownerID))
+
+	kinds := make([]Kind, 0, len(ids))
+	for _, id := range ids {
+		k, err := r.LoadKind(ownerID, id)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, k)
+	}
+
+	return kinds, nil
+}
+
+// findKind loads the kind labeled label.
+func (r *Repository) findKind(ownerID, label string) (Kind, error) {
+	kinds, err := r.ListKinds(ownerID)
+	if err != nil {
+		return Kind{}, err
+	}
+
+	for _, k := range kinds {
+		if k.Label == label {
+			return k, nil
+		}
+	}
+
+	return Kind{}, ErrNotFound
+}
+
+func (r *Repository) DeleteKind(ownerID, id string) error {
+	return r.s.Delete(kindKey(ownerID, id))
+}
+
+func (r *Repository) CreateEncounter(e Encounter) error {
+	err := shelf.InsertJSON(r.s, encounterKey(e.ownerID, e.id), marshalEncounter(e))
+	if errors.Is(err, shelf.ErrConflict) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (r *Repository) UpdateEncounter(e Encounter) error {
+	err := shelf.UpdateJSON(r.s, encounterKey(e.ownerID, e.id), marshalEncounter(e))
+	if errors.Is(err, shelf.ErrNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *Repository) LoadEncounter(ownerID, id string) (Encounter, error) {
+	data, ok := r.s.Get(encounterKey(ownerID, id))
+	if !ok {
+		return Encounter{}, ErrNotFound
+	}
+
+	return unmarshalEncounter(ownerID, id, data)
+}
+
+func unmarshalEncounter(ownerID, id string, data []byte) (Encounter, error) {
+	var d encounterDBO
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Encounter{}, err
+	}
+
+	e := Encounter{
+		id:           id,
+		ownerID:      ownerID,
+		publication:  d.Publication,
+		Label:        d.Label,
+		LastModified: time.Unix(d.LastModified, 0),
+		Characters:   make([]Character, len(d.Characters)),
+	}
+	for i, c := range d.Characters {
+		e.Characters[i] = Character{
+			Type:             c.Type,
+			Label:            c.Label,
+			Initiative:       Initiative{DieResult: c.DieResult, Modifier: c.Modifier},
+			Kind:             c.Kind,
+			HitPoints:        c.HitPoints,
+			CurrentHitPoints: c.CurrentHitPoints,
+			Conditions:       c.Conditions,
+		}
+	}
+
+	return e, nil
+}
+
+func (r *Repository) ListEncounters(ownerID string) ([]Encounter, error) {
+	ids := shelf.KeySuffixes(r.s, encountersKey(ownerID))
+
+	encounters := make([]Encounter, 0, len(ids))
+	for _, id := range ids {
+		e, err := r.LoadEncounter(ownerID, id)
+		if err != nil {
+			return nil, err
+		}
+		encounters = append(encounters, e)
+	}
+
+	return encounters, nil
+}
+
+func (r *Repository) DeleteEncounter(ownerID, id string) error {
+	return r.s.Delete(encounterKey(ownerID, id))
+}
+
+// SavePublication stores the token publishing the encounter identified by
+// ownerID and id.
+func (r *Repository) SavePublication(token, ownerID, id string) error {
+	return shelf.PutJSON(r.s, publicationKey(token), publicationDBO{OwnerID: ownerID, EncounterID: id})
+}
+
+// LoadPublication returns the owner and id of the encounter published with
+// token.
+func (r *Repository) LoadPublication(token string) (ownerID, id string, err error) {
+	var d publicationDBO
+	ok, err := shelf.GetJSON(r.s, publicationKey(token), &d)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", ErrNotFound
+	}
+
+	return d.OwnerID, d.EncounterID, nil
+}
+
+func (r *Repository) DeletePublication(token string) error {
+	return r.s.Delete(publicationKey(token))
+}
+
+// Subscribe subscribes to changes of an encounter. The current version of
+// the encounter and every following one is passed to transform and the
+// result is sent to the subscriber. The subscription ends when ctx is done,
+// the encounter is deleted or transform returns false.
+func (r *Repository) Subscribe(ctx context.Context, ownerID, id string, transform func(Encounter) (PlayerView, bool)) *Subscription {
+	logger := kvlog.FromContext(ctx)
+
+	key := encounterKey(ownerID, id)
+	shelfSup := r.s.Subscribe(key)
+
+	sup := &Subscription{
+		s: shelfSup,
+		c: make(chan PlayerView, 4),
+	}
+
+	// send transforms data and sends the result to the subscriber. It
+	// reports whether the subscription continues.
+	send := func(data []byte) bool {
+		e, err := unmarshalEncounter(ownerID, id, data)
+		if err != nil {
+			logger.Logs("invalid encounter data received from subscription",
+				kvlog.WithKV("ownerID", ownerID),
+				kvlog.WithKV("encounterID", id),
+				kvlog.WithErr(err),
+			)
+			return true
+		}
+
+		view, ok := transform(e)
+		if !ok {
+			return false
+		}
+
+		select {
+		case sup.c <- view:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer close(sup.c)
+
+		// The current version is loaded after subscribing, so no change
+		// gets lost in between.
+		data, ok := r.s.Get(key)
+		if !ok || !send(data) {
+			sup.Cancel()
+			return
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				sup.Cancel()
+				return
+
+			case evt, ok := <-shelfSup.C():
+				if !ok {
+					return
+				}
+
+				if !bytes.Equal(evt.Key, key) {
+					continue
+				}
+
+				if evt.Type == shelf.Deleted || !send(evt.Data) {
+					sup.Cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return sup
+}
+
+func marshalKind(k Kind) kindDBO {
+	d := kindDBO{
+		Label:         k.Label,
+		Speed:         k.Speed,
+		AC:            k.AC,
+		ChallengeRate: k.ChallengeRate,
+		XP:            k.XP,
+		HitDie:        k.HitDie,
+		SavingThrows:  savingThrowsDBO(k.SavingThrows),
+		Attacks:       make([]attackDBO, len(k.Attacks)),
+		Tags:          k.Tags,
+	}
+	for i, a := range k.Attacks {
+		d.Attacks[i] = attackDBO{Label: a.Label, Mod: a.Mod, Damage: make([]damageDBO, len(a.Damage))}
+		for j, dmg := range a.Damage {
+			d.Attacks[i].Damage[j] = damageDBO(dmg)
+		}
+	}
+	return d
+}
+
+func marshalEncounter(e Encounter) encounterDBO {
+	d := encounterDBO{
+		Label:        e.Label,
+		Publication:  e.publication,
+		LastModified: e.LastModified.Unix(),
+		Characters:   make([]characterDBO, len(e.Characters)),
+	}
+	for i, c := range e.Characters {
+		d.Characters[i] = characterDBO{
+			Type:             c.Type,
+			Label:            c.Label,
+			DieResult:        c.Initiative.DieResult,
+			Modifier:         c.Initiative.Modifier,
+			Kind:             c.Kind,
+			HitPoints:        c.HitPoints,
+			CurrentHitPoints: c.CurrentHitPoints,
+			Conditions:       c.Conditions,
+		}
+	}
+	return d
+}
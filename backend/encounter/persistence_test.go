@@ -0,0 +1,78 @@
+package encounter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestRepository(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	k := goblin()
+	k.ownerID = "owner"
+	k.id = "goblin"
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.CreateKind(k))),
+		is.Error(repo.CreateKind(k), ErrAlreadyExists),
+	)
+
+	loadedKind, err := repo.LoadKind("owner", "goblin")
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(loadedKind, k),
+	)
+
+	found, err := repo.findKind("owner", "Goblin")
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(found.ID(), "goblin"),
+	)
+
+	_, err = repo.findKind("owner", "Orc")
+	expect.That(t, is.Error(err, ErrNotFound))
+
+	e := Encounter{
+		id:           "ambush",
+		ownerID:      "owner",
+		Label:        "Ambush",
+		LastModified: time.Unix(1700000000, 0),
+		Characters: []Character{
+			{Type: TypePC, Label: "Tordek", Initiative: Initiative{DieResult: 14}},
+			{Type: TypeNPC, Label: "Goblin 1", Kind: "Goblin", Initiative: Initiative{DieResult: 12, Modifier: 2}, HitPoints: 7, CurrentHitPoints: 3},
+		},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.CreateEncounter(e))))
+
+	loaded, err := repo.LoadEncounter("owner", "ambush")
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(loaded, e),
+	)
+
+	encounters, err := repo.ListEncounters("owner")
+	expect.That(t,
+		is.NoError(err),
+		is.SliceOfLen(encounters, 1),
+	)
+
+	kinds, err := repo.ListKinds("other")
+	expect.That(t,
+		is.NoError(err),
+		is.SliceOfLen(kinds, 0),
+	)
+
+	expect.That(t,
+		is.NoError(repo.DeleteKind("owner", "goblin")),
+		is.NoError(repo.DeleteEncounter("owner", "ambush")),
+	)
+
+	_, err = repo.LoadEncounter("owner", "ambush")
+	expect.That(t, is.Error(err, ErrNotFound))
+}
@@ -0,0 +1,221 @@
+package encounter
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/halimath/d20-tools/infra/random"
+	"github.com/halimath/d20-tools/infra/shelf"
+)
+
+// HealthBand describes the state of a non player character's hit points
+// without revealing the exact numbers.
+type HealthBand string
+
+const (
+	HealthUnhurt   HealthBand = "unhurt"
+	HealthHurt     HealthBand = "hurt"
+	HealthBloodied HealthBand = "bloodied"
+	HealthDown     HealthBand = "down"
+)
+
+// Health returns the health band of a non player character. The band is
+// empty for player characters and characters without hit points.
+func (c Character) Health() HealthBand {
+	if c.Type != TypeNPC || c.HitPoints <= 0 {
+		return ""
+	}
+
+	switch {
+	case c.CurrentHitPoints <= 0:
+		return HealthDown
+	case 2*c.CurrentHitPoints <= c.HitPoints:
+		return HealthBloodied
+	case c.CurrentHitPoints < c.HitPoints:
+		return HealthHurt
+	default:
+		return HealthUnhurt
+	}
+}
+
+// PublicCharacter is a character as shown to players.
+type PublicCharacter struct {
+	Type       CharacterType
+	Label      string
+	Health     HealthBand
+	Conditions []string
+}
+
+// PlayerView is an encounter as shown to players. It contains the
+// characters in turn order but omits all data reserved for the game master,
+// such as the kinds, initiative values and exact hit points.
+type PlayerView struct {
+	Label      string
+	Characters []PublicCharacter
+}
+
+// compareTurnOrder orders characters by initiative, breaking ties by
+// modifier, players before non players and label.
+func compareTurnOrder(a, b Character) int {
+	if c := cmp.Compare(b.Initiative.Value(), a.Initiative.Value()); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(b.Initiative.Modifier, a.Initiative.Modifier); c != 0 {
+		return c
+	}
+	if a.Type != b.Type {
+		if a.Type == TypePC {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.Label, b.Label)
+}
+
+// PlayerView returns the view of e shown to players.
+func (e Encounter) PlayerView() PlayerView {
+	characters := slices.Clone(e.Characters)
+	slices.SortStableFunc(characters, compareTurnOrder)
+
+	v := PlayerView{
+		Label:      e.Label,
+		Characters: make([]PublicCharacter, len(characters)),
+	}
+	for i, c := range characters {
+		v.Characters[i] = PublicCharacter{
+			Type:       c.Type,
+			Label:      c.Label,
+			Health:     c.Health(),
+			Conditions: c.Conditions,
+		}
+	}
+	return v
+}
+
+// Publish publishes the encounter identified by id. It returns the token
+// granting access to the encounter's player view. Publishing an encounter
+// again returns the same token.
+func (svc *EncounterService) Publish(ctx context.Context, id string) (string, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	e, err := svc.repo.LoadEncounter(ownerID, id)
+	if err != nil {
+		return "", err
+	}
+
+	if e.publication != "" {
+		return e.publication, nil
+	}
+
+	e.publication = generatePublicationToken()
+	if err := svc.repo.SavePublication(e.publication, ownerID, id); err != nil {
+		return "", err
+	}
+
+	return e.publication, svc.repo.UpdateEncounter(e)
+}
+
+// Unpublish revokes the publication of the encounter identified by id. All
+// subscriptions to the player view end.
+func (svc *EncounterService) Unpublish(ctx context.Context, id string) error {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	e, err := svc.repo.LoadEncounter(ownerID, id)
+	if err != nil {
+		return err
+	}
+
+	if e.publication == "" {
+		return nil
+	}
+
+	if err := svc.repo.DeletePublication(e.publication); err != nil {
+		return err
+	}
+
+	e.publication = ""
+	return svc.repo.UpdateEncounter(e)
+}
+
+// loadPublished loads the encounter published with token.
+func (svc *EncounterService) loadPublished(token string) (Encounter, error) {
+	ownerID, id, err := svc.repo.LoadPublication(token)
+	if err != nil {
+		return Encounter{}, err
+	}
+
+	e, err := svc.repo.LoadEncounter(ownerID, id)
+	if err != nil {
+		return Encounter{}, err
+	}
+
+	if e.publication != token {
+		return Encounter{}, ErrNotFound
+	}
+
+	return e, nil
+}
+
+// LoadPlayerView loads the player view of the encounter published with
+// token. No authentication is required.
+func (svc *EncounterService) LoadPlayerView(token string) (PlayerView, error) {
+	e, err := svc.loadPublished(token)
+	if err != nil {
+		return PlayerView{}, err
+	}
+
+	return e.PlayerView(), nil
+}
+
+type Subscription struct {
+	s          *shelf.Subscription
+	c          chan PlayerView
+	cancelOnce sync.Once
+}
+
+func (s *Subscription) Cancel() {
+	s.cancelOnce.Do(s.s.Cancel)
+}
+
+func (s *Subscription) C() <-chan PlayerView {
+	return s.c
+}
+
+// SubscribePlayerView subscribes to the player view of the encounter
+// published with token. The current player view is sent right away. The
+// subscription ends when ctx is done or the encounter is unpublished or
+// deleted.
+func (svc *EncounterService) SubscribePlayerView(ctx context.Context, token string) (*Subscription, error) {
+	e, err := svc.loadPublished(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.repo.Subscribe(ctx, e.ownerID, e.id, func(e Encounter) (PlayerView, bool) {
+		if e.publication != token {
+			return PlayerView{}, false
+		}
+		return e.PlayerView(), true
+	}), nil
+}
+
+// generatePublicationToken returns a URL-safe, cryptographically secure
+// random token.
+func generatePublicationToken() string {
+	return random.Token(24)
+}
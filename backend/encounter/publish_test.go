@@ -0,0 +1,179 @@
+package encounter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestCharacter_Health(t *testing.T) {
+	tests := []struct {
+		c    Character
+		want HealthBand
+	}{
+		{Character{Type: TypePC, Label: "Tordek"}, ""},
+		{Character{Type: TypeNPC, HitPoints: 10, CurrentHitPoints: 10}, HealthUnhurt},
+		{Character{Type: TypeNPC, HitPoints: 10, CurrentHitPoints: 6}, HealthHurt},
+		{Character{Type: TypeNPC, HitPoints: 10, CurrentHitPoints: 5}, HealthBloodied},
+		{Character{Type: TypeNPC, HitPoints: 7, CurrentHitPoints: 4}, HealthHurt},
+		{Character{Type: TypeNPC, HitPoints: 10, CurrentHitPoints: 0}, HealthDown},
+		{Character{Type: TypeNPC, HitPoints: 10, CurrentHitPoints: -3}, HealthDown},
+	}
+
+	for _, test := range tests {
+		expect.That(t, is.EqualTo(test.c.Health(), test.want))
+	}
+}
+
+func ambush() Encounter {
+	return Encounter{
+		id:          "ambush",
+		ownerID:     "owner",
+		publication: "token",
+		Label:       "Ambush",
+		Characters: []Character{
+			{Type: TypeNPC, Label: "Goblin 1", Kind: "Goblin", Initiative: Initiative{DieResult: 10, Modifier: 2}, HitPoints: 7, CurrentHitPoints: 3, Conditions: []string{"prone"}},
+			{Type: TypePC, Label: "Tordek", Initiative: Initiative{DieResult: 12}},
+			{Type: TypeNPC, Label: "Goblin 2", Kind: "Goblin", Initiative: Initiative{DieResult: 16, Modifier: 2}, HitPoints: 7, CurrentHitPoints: 7},
+			{Type: TypePC, Label: "Mialee", Initiative: Initiative{DieResult: 18}},
+		},
+	}
+}
+
+func TestEncounter_PlayerView(t *testing.T) {
+	expect.That(t,
+		is.DeepEqualTo(ambush().PlayerView(), PlayerView{
+			Label: "Ambush",
+			Characters: []PublicCharacter{
+				{Type: TypeNPC, Label: "Goblin 2", Health: HealthUnhurt},
+				{Type: TypePC, Label: "Mialee"},
+				{Type: TypeNPC, Label: "Goblin 1", Health: HealthBloodied, Conditions: []string{"prone"}},
+				{Type: TypePC, Label: "Tordek"},
+			},
+		}),
+	)
+}
+
+func TestEncounterService_LoadPlayerView(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+	srv := NewService(repo)
+
+	e := ambush()
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.CreateEncounter(e))),
+		expect.FailNow(is.NoError(repo.SavePublication("token", "owner", "ambush"))),
+	)
+
+	view, err := srv.LoadPlayerView("token")
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(view, e.PlayerView()),
+	)
+
+	_, err = srv.LoadPlayerView("unknown")
+	expect.That(t, is.Error(err, ErrNotFound))
+
+	// A stale publication must not grant access after the encounter has been
+	// published again with a different token.
+	e.publication = "other"
+	expect.That(t, expect.FailNow(is.NoError(repo.UpdateEncounter(e))))
+
+	_, err = srv.LoadPlayerView("token")
+	expect.That(t, is.Error(err, ErrNotFound))
+}
+
+func TestEncounterService_SubscribePlayerView(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+	srv := NewService(repo)
+
+	e := ambush()
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.CreateEncounter(e))),
+		expect.FailNow(is.NoError(repo.SavePublication("token", "owner", "ambush"))),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sup, err := srv.SubscribePlayerView(ctx, "token")
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	expect.That(t, is.DeepEqualTo(receive(t, sup), e.PlayerView()))
+
+	e.Characters[0].CurrentHitPoints = 0
+	expect.That(t, expect.FailNow(is.NoError(repo.UpdateEncounter(e))))
+
+	view := receive(t, sup)
+	expect.That(t, is.EqualTo(view.Characters[2].Health, HealthDown))
+
+	// Unpublishing ends the subscription.
+	e.publication = ""
+	expect.That(t, expect.FailNow(is.NoError(repo.UpdateEncounter(e))))
+
+	select {
+	case _, ok := <-sup.C():
+		expect.That(t, is.EqualTo(ok, false))
+	case <-time.After(time.Second):
+		t.Fatal("subscription has not been closed")
+	}
+}
+
+func TestEncounterService_SubscribePlayerView_cancelled(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+	srv := NewService(repo)
+
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.CreateEncounter(ambush()))),
+		expect.FailNow(is.NoError(repo.SavePublication("token", "owner", "ambush"))),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for range 100 {
+		sup, err := srv.SubscribePlayerView(ctx, "token")
+		expect.That(t, expect.FailNow(is.NoError(err)))
+
+		closed := make(chan struct{})
+		go func() {
+			for range sup.C() {
+			}
+			close(closed)
+		}()
+
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatal("subscription has not been closed")
+		}
+	}
+}
+
+func receive(t *testing.T, sup *Subscription) PlayerView {
+	t.Helper()
+
+	select {
+	case view, ok := <-sup.C():
+		if !ok {
+			t.Fatal("subscription has been closed")
+		}
+		return view
+	case <-time.After(time.Second):
+		t.Fatal("no player view received")
+	}
+
+	return PlayerView{}
+}
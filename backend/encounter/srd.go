@@ -0,0 +1,423 @@
+package encounter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/halimath/d20-tools/dice"
+)
+
+// ErrInvalidBestiary is returned when a bestiary file cannot be read.
+var ErrInvalidBestiary = errors.New("invalid bestiary")
+
+// MappedKind is the result of mapping a single monster of a bestiary file to
+// a Kind.
+type MappedKind struct {
+	// Name is the monster's name as found in the file.
+	Name string
+	Kind Kind
+	// Unmapped lists the fields that could not be mapped. Kinds use default
+	// values for these fields.
+	Unmapped []string
+	// Err is set when the monster could not be mapped at all.
+	Err error
+}
+
+// srdMonster is a monster as found in the JSON files of the 5e SRD API and
+// Open5e. Fields differing between both formats are decoded lazily.
+type srdMonster struct {
+	Name            string          `json:"name"`
+	Type            string          `json:"type"`
+	Environments    []string        `json:"environments"`
+	ArmorClass      json.RawMessage `json:"armor_class"`
+	HitDice         string          `json:"hit_dice"`
+	HitPointsRoll   string          `json:"hit_points_roll"`
+	Speed           json.RawMessage `json:"speed"`
+	ChallengeRating json.RawMessage `json:"challenge_rating"`
+	CR              *float64        `json:"cr"`
+	XP              *int            `json:"xp"`
+
+	Strength     *int `json:"strength"`
+	Dexterity    *int `json:"dexterity"`
+	Constitution *int `json:"constitution"`
+	Intelligence *int `json:"intelligence"`
+	Wisdom       *int `json:"wisdom"`
+	Charisma     *int `json:"charisma"`
+
+	StrengthSave     *int `json:"strength_save"`
+	DexteritySave    *int `json:"dexterity_save"`
+	ConstitutionSave *int `json:"constitution_save"`
+	IntelligenceSave *int `json:"intelligence_save"`
+	WisdomSave       *int `json:"wisdom_save"`
+	CharismaSave     *int `json:"charisma_save"`
+
+	Proficiencies []struct {
+		Value       int `json:"value"`
+		Proficiency struct {
+			Index string `json:"index"`
+		} `json:"proficiency"`
+	} `json:"proficiencies"`
+
+	Actions []srdAction `json:"actions"`
+}
+
+type srdAction struct {
+	Name        string `json:"name"`
+	Desc        string `json:"desc"`
+	AttackBonus *int   `json:"attack_bonus"`
+	DamageDice  string `json:"damage_dice"`
+	DamageBonus int    `json:"damage_bonus"`
+	Damage      []struct {
+		DamageType struct {
+			Name string `json:"name"`
+		} `json:"damage_type"`
+		DamageDice string `json:"damage_dice"`
+	} `json:"damage"`
+}
+
+// ParseBestiary maps the monsters contained in data to kinds. data is either
+// a single monster, an array of monsters or an Open5e result page with
+// monsters stored in results. Both the 5e SRD API and the Open5e formats are
+// supported.
+func ParseBestiary(data []byte) ([]MappedKind, error) {
+	var monsters []srdMonster
+
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) > 0 && data[0] == '[':
+		if err := json.Unmarshal(data, &monsters); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBestiary, err)
+		}
+	case len(data) > 0 && data[0] == '{':
+		var page struct {
+			Results []srdMonster `json:"results"`
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBestiary, err)
+		}
+
+		if page.Results != nil {
+			monsters = page.Results
+			break
+		}
+
+		var m srdMonster
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidBestiary, err)
+		}
+		monsters = []srdMonster{m}
+	default:
+		return nil, fmt.Errorf("%w: expected a JSON object or array", ErrInvalidBestiary)
+	}
+
+	result := make([]MappedKind, len(monsters))
+	for i, m := range monsters {
+		result[i] = m.mapKind()
+	}
+	return result, nil
+}
+
+func (m srdMonster) mapKind() MappedKind {
+	mk := MappedKind{
+		Name: m.Name,
+		Kind: Kind{
+			Label:         strings.TrimSpace(m.Name),
+			ChallengeRate: DefaultChallengeRate,
+			XP:            DefaultXP,
+		},
+	}
+
+	unmapped := func(field string) {
+		mk.Unmapped = append(mk.Unmapped, field)
+	}
+
+	if mk.Kind.Label == "" {
+		mk.Err = fmt.Errorf("%w: missing name", ErrInvalidKind)
+		return mk
+	}
+
+	hitDie := m.HitPointsRoll
+	if hitDie == "" {
+		hitDie = m.HitDice
+	}
+	expr, err := dice.Parse(strings.Join(strings.Fields(hitDie), ""))
+	if err != nil {
+		mk.Err = fmt.Errorf("%w: hit dice: %w", ErrInvalidKind, err)
+		return mk
+	}
+	if m.HitPointsRoll == "" && m.Constitution != nil {
+		// Open5e only lists the hit dice without the hit points granted by
+		// Constitution.
+		expr = addHitPointBonus(expr, AbilityModifier(*m.Constitution))
+	}
+	mk.Kind.HitDie = expr.String()
+
+	if ac, ok := decodeArmorClass(m.ArmorClass); ok {
+		mk.Kind.AC = ac
+	} else {
+		unmapped("armor_class")
+	}
+
+	if speed, ok := decodeSpeed(m.Speed); ok {
+		mk.Kind.Speed = speed
+	} else {
+		unmapped("speed")
+	}
+
+	cr, ok := decodeChallengeRating(m.ChallengeRating)
+	if !ok && m.CR != nil {
+		cr, ok = *m.CR, true
+	}
+	if ok {
+		mk.Kind.ChallengeRate = cr
+	} else {
+		unmapped("challenge_rating")
+	}
+
+	if m.XP != nil {
+		mk.Kind.XP = *m.XP
+	} else if xp, ok := XPForChallengeRate(mk.Kind.ChallengeRate); ok {
+		mk.Kind.XP = xp
+	} else {
+		unmapped("xp")
+	}
+
+	saves := []struct {
+		name  string
+		score *int
+		save  *int
+		dst   *int
+	}{
+		{"str", m.Strength, m.StrengthSave, &mk.Kind.SavingThrows.Str},
+		{"dex", m.Dexterity, m.DexteritySave, &mk.Kind.SavingThrows.Dex},
+		{"con", m.Constitution, m.ConstitutionSave, &mk.Kind.SavingThrows.Con},
+		{"int", m.Intelligence, m.IntelligenceSave, &mk.Kind.SavingThrows.Int},
+		{"wis", m.Wisdom, m.WisdomSave, &mk.Kind.SavingThrows.Wis},
+		{"cha", m.Charisma, m.CharismaSave, &mk.Kind.SavingThrows.Cha},
+	}
+	for _, s := range saves {
+		switch {
+		case s.save != nil:
+			*s.dst = *s.save
+		case m.proficientSave(s.name) != nil:
+			*s.dst = *m.proficientSave(s.name)
+		case s.score != nil:
+			*s.dst = AbilityModifier(*s.score)
+		default:
+			unmapped("saving_throws." + s.name)
+		}
+	}
+
+	mk.Kind.Tags = normalizeTags(append([]string{m.Type}, m.Environments...))
+
+	for _, a := range m.Actions {
+		attack, ok := a.mapAttack()
+		if !ok {
+			unmapped("actions." + a.Name)
+			continue
+		}
+		mk.Kind.Attacks = append(mk.Kind.Attacks, attack)
+	}
+
+	return mk
+}
+
+// addHitPointBonus adds mod hit points per hit die to expr. Expressions
+// already containing a constant are returned unchanged.
+func addHitPointBonus(expr dice.Expression, mod int) dice.Expression {
+	count := 0
+	for _, t := range expr.Terms {
+		if t.IsConstant() {
+			return expr
+		}
+		if !t.Negative {
+			count += t.Count
+		}
+	}
+
+	bonus := mod * count
+	if bonus == 0 {
+		return expr
+	}
+
+	term := dice.Term{Constant: bonus}
+	if bonus < 0 {
+		term = dice.Term{Constant: -bonus, Negative: true}
+	}
+	expr.Terms = append(slices.Clone(expr.Terms), term)
+	return expr
+}
+
+// proficientSave returns the saving throw bonus listed in the proficiencies
+// of the 5e SRD API format, i.e. saving-throw-dex.
+func (m srdMonster) proficientSave(ability string) *int {
+	for _, p := range m.Proficiencies {
+		if p.Proficiency.Index == "saving-throw-"+ability {
+			return &p.Value
+		}
+	}
+	return nil
+}
+
+func (a srdAction) mapAttack() (Attack, bool) {
+	if a.AttackBonus == nil {
+		return Attack{}, false
+	}
+
+	attack := Attack{
+		Label: a.Name,
+		Mod:   *a.AttackBonus,
+	}
+
+	for _, d := range a.Damage {
+		expr := strings.Join(strings.Fields(d.DamageDice), "")
+		if _, err := dice.Parse(expr); err != nil {
+			continue
+		}
+		attack.Damage = append(attack.Damage, Damage{Label: strings.ToLower(d.DamageType.Name), Damage: expr})
+	}
+
+	if len(attack.Damage) == 0 {
+		attack.Damage = parseDamage(a.Desc)
+	}
+
+	if len(attack.Damage) == 0 && a.DamageDice != "" {
+		expr := strings.Join(strings.Fields(a.DamageDice), "")
+		if a.DamageBonus != 0 {
+			expr += fmt.Sprintf("%+d", a.DamageBonus)
+		}
+		if _, err := dice.Parse(expr); err == nil {
+			attack.Damage = append(attack.Damage, Damage{Label: "damage", Damage: expr})
+		}
+	}
+
+	return attack, len(attack.Damage) > 0
+}
+
+var damagePattern = regexp.MustCompile(`(?i)\(\s*(\d+\s*d\s*\d+(?:\s*[+-]\s*\d+)?)\s*\)\s+([a-z]+)\s+damage`)
+
+// parseDamage extracts all damage rolls written like "7 (1d8 + 3) slashing
+// damage" from the description of an attack.
+func parseDamage(desc string) []Damage {
+	var damage []Damage
+	for _, match := range damagePattern.FindAllStringSubmatch(desc, -1) {
+		damage = append(damage, Damage{
+			Label:  strings.ToLower(match[2]),
+			Damage: strings.Join(strings.Fields(match[1]), ""),
+		})
+	}
+	return damage
+}
+
+// AbilityModifier returns the modifier of an ability score.
+func AbilityModifier(score int) int {
+	if score < 10 {
+		return (score - 11) / 2
+	}
+	return (score - 10) / 2
+}
+
+// leadingInt parses the integer s starts with, i.e. 30 for "30 ft.".
+func leadingInt(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(s[:end])
+	return n, err == nil
+}
+
+// decodeInt decodes a JSON number or a string starting with a number.
+func decodeInt(data json.RawMessage) (int, bool) {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		return n, true
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return leadingInt(s)
+	}
+
+	return 0, false
+}
+
+// decodeArmorClass decodes either a plain number (Open5e) or a list of armor
+// class values (5e SRD API), in which case the first value is used.
+func decodeArmorClass(data json.RawMessage) (int, bool) {
+	if ac, ok := decodeInt(data); ok {
+		return ac, true
+	}
+
+	var values []struct {
+		Value int `json:"value"`
+	}
+	if err := json.Unmarshal(data, &values); err == nil && len(values) > 0 {
+		return values[0].Value, true
+	}
+
+	return 0, false
+}
+
+// decodeSpeed decodes the walking speed either given as a number or a string
+// or as an object of movement modes.
+func decodeSpeed(data json.RawMessage) (int, bool) {
+	if speed, ok := decodeInt(data); ok {
+		return speed, true
+	}
+
+	var modes map[string]json.RawMessage
+	if err := json.Unmarshal(data, &modes); err != nil {
+		return 0, false
+	}
+
+	walk, ok := modes["walk"]
+	if !ok {
+		return 0, false
+	}
+	return decodeInt(walk)
+}
+
+// decodeChallengeRating decodes a challenge rating given as a number or as a
+// string such as "1/4".
+func decodeChallengeRating(data json.RawMessage) (float64, bool) {
+	var cr float64
+	if err := json.Unmarshal(data, &cr); err == nil {
+		return cr, true
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return 0, false
+	}
+
+	return ParseChallengeRating(s)
+}
+
+// ParseChallengeRating parses a challenge rating written as a number or a
+// fraction such as "1/4".
+func ParseChallengeRating(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, err := strconv.Atoi(strings.TrimSpace(num))
+		if err != nil {
+			return 0, false
+		}
+		d, err := strconv.Atoi(strings.TrimSpace(den))
+		if err != nil || d == 0 {
+			return 0, false
+		}
+		return float64(n) / float64(d), true
+	}
+
+	cr, err := strconv.ParseFloat(s, 64)
+	return cr, err == nil
+}
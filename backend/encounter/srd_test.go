@@ -0,0 +1,219 @@
+package encounter
+
+import (
+	"testing"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+const open5eGoblin = `{
+	"slug": "goblin",
+	"name": "Goblin",
+	"type": "Humanoid",
+	"environments": ["Forest", "Hill"],
+	"armor_class": 15,
+	"armor_desc": "leather armor, shield",
+	"hit_points": 7,
+	"hit_dice": "2d6",
+	"speed": {"walk": 30},
+	"strength": 8,
+	"dexterity": 14,
+	"constitution": 10,
+	"intelligence": 10,
+	"wisdom": 8,
+	"charisma": 8,
+	"strength_save": null,
+	"dexterity_save": null,
+	"constitution_save": null,
+	"intelligence_save": null,
+	"wisdom_save": null,
+	"charisma_save": null,
+	"challenge_rating": "1/4",
+	"cr": 0.25,
+	"actions": [
+		{
+			"name": "Scimitar",
+			"desc": "Melee Weapon Attack: +4 to hit, reach 5 ft., one target. Hit: 5 (1d6 + 2) slashing damage.",
+			"attack_bonus": 4,
+			"damage_dice": "1d6",
+			"damage_bonus": 2
+		},
+		{
+			"name": "Shortbow",
+			"desc": "Ranged Weapon Attack: +4 to hit, range 80/320 ft., one target. Hit: 5 (1d6 + 2) piercing damage.",
+			"attack_bonus": 4,
+			"damage_dice": "1d6",
+			"damage_bonus": 2
+		}
+	]
+}`
+
+const srdAPIOgre = `{
+	"index": "ogre",
+	"name": "Ogre",
+	"armor_class": [{"type": "armor", "value": 11}],
+	"hit_points": 59,
+	"hit_dice": "7d10",
+	"hit_points_roll": "7d10+21",
+	"speed": {"walk": "40 ft."},
+	"strength": 19,
+	"dexterity": 8,
+	"constitution": 16,
+	"intelligence": 5,
+	"wisdom": 7,
+	"charisma": 7,
+	"proficiencies": [
+		{"value": 5, "proficiency": {"index": "saving-throw-con", "name": "Saving Throw: CON"}}
+	],
+	"challenge_rating": 2,
+	"xp": 450,
+	"actions": [
+		{
+			"name": "Greatclub",
+			"desc": "Melee Weapon Attack: +6 to hit, reach 5 ft., one target. Hit: 13 (2d8 + 4) bludgeoning damage.",
+			"attack_bonus": 6,
+			"damage": [{"damage_type": {"index": "bludgeoning", "name": "Bludgeoning"}, "damage_dice": "2d8+4"}]
+		},
+		{
+			"name": "Frightful Presence",
+			"desc": "Each creature of the ogre's choice must succeed on a DC 10 Wisdom saving throw."
+		}
+	]
+}`
+
+func TestParseBestiary_open5e(t *testing.T) {
+	mapped, err := ParseBestiary([]byte(`{"count": 1, "results": [` + open5eGoblin + `]}`))
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		expect.FailNow(is.SliceOfLen(mapped, 1)),
+		is.NoError(mapped[0].Err),
+		is.SliceOfLen(mapped[0].Unmapped, 0),
+		is.DeepEqualTo(mapped[0].Kind, Kind{
+			Label:         "Goblin",
+			Speed:         30,
+			AC:            15,
+			ChallengeRate: 0.25,
+			XP:            50,
+			HitDie:        "2d6",
+			SavingThrows:  SavingThrows{Str: -1, Dex: 2, Con: 0, Int: 0, Wis: -1, Cha: -1},
+			Attacks: []Attack{
+				{Label: "Scimitar", Mod: 4, Damage: []Damage{{Label: "slashing", Damage: "1d6+2"}}},
+				{Label: "Shortbow", Mod: 4, Damage: []Damage{{Label: "piercing", Damage: "1d6+2"}}},
+			},
+			Tags: []string{"humanoid", "forest", "hill"},
+		}),
+	)
+}
+
+func TestParseBestiary_open5eHitDice(t *testing.T) {
+	mapped, err := ParseBestiary([]byte(`[
+		{"name": "Zombie", "hit_dice": "3d8", "constitution": 16},
+		{"name": "Wisp", "hit_dice": "9d4", "constitution": 7},
+		{"name": "Blob", "hit_dice": "2d10 + 5", "constitution": 18}
+	]`))
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		expect.FailNow(is.SliceOfLen(mapped, 3)),
+		is.EqualTo(mapped[0].Kind.HitDie, "3d8+9"),
+		is.EqualTo(mapped[1].Kind.HitDie, "9d4-18"),
+		is.EqualTo(mapped[2].Kind.HitDie, "2d10+5"),
+	)
+}
+
+func TestParseBestiary_srdAPI(t *testing.T) {
+	mapped, err := ParseBestiary([]byte(`[` + srdAPIOgre + `]`))
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		expect.FailNow(is.SliceOfLen(mapped, 1)),
+		is.NoError(mapped[0].Err),
+		is.DeepEqualTo(mapped[0].Unmapped, []string{"actions.Frightful Presence"}),
+		is.DeepEqualTo(mapped[0].Kind, Kind{
+			Label:         "Ogre",
+			Speed:         40,
+			AC:            11,
+			ChallengeRate: 2,
+			XP:            450,
+			HitDie:        "7d10+21",
+			SavingThrows:  SavingThrows{Str: 4, Dex: -1, Con: 5, Int: -3, Wis: -2, Cha: -2},
+			Attacks: []Attack{
+				{Label: "Greatclub", Mod: 6, Damage: []Damage{{Label: "bludgeoning", Damage: "2d8+4"}}},
+			},
+		}),
+	)
+}
+
+func TestParseBestiary_unmapped(t *testing.T) {
+	mapped, err := ParseBestiary([]byte(`[{"name": "Blob", "hit_dice": "3d8"}, {"name": "Broken", "hit_dice": "many"}]`))
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		expect.FailNow(is.SliceOfLen(mapped, 2)),
+		is.NoError(mapped[0].Err),
+		is.DeepEqualTo(mapped[0].Unmapped, []string{
+			"armor_class", "speed", "challenge_rating",
+			"saving_throws.str", "saving_throws.dex", "saving_throws.con",
+			"saving_throws.int", "saving_throws.wis", "saving_throws.cha",
+		}),
+		is.EqualTo(mapped[0].Kind.XP, DefaultXP),
+		is.Error(mapped[1].Err, ErrInvalidKind),
+	)
+
+	_, err = ParseBestiary([]byte(`"goblin"`))
+	expect.That(t, is.Error(err, ErrInvalidBestiary))
+}
+
+func TestParseChallengeRating(t *testing.T) {
+	tests := map[string]float64{
+		"0":   0,
+		"1/8": 0.125,
+		"1/2": 0.5,
+		"17":  17,
+	}
+
+	for in, want := range tests {
+		got, ok := ParseChallengeRating(in)
+		expect.That(t,
+			is.EqualTo(ok, true),
+			is.EqualTo(got, want),
+		)
+	}
+
+	_, ok := ParseChallengeRating("1/0")
+	expect.That(t, is.EqualTo(ok, false))
+}
+
+func TestAbilityModifier(t *testing.T) {
+	tests := map[int]int{1: -5, 3: -4, 8: -1, 9: -1, 10: 0, 11: 0, 15: 2, 30: 10}
+
+	for score, want := range tests {
+		expect.That(t, is.EqualTo(AbilityModifier(score), want))
+	}
+}
+
+func TestEncounterService_ImportBestiaryForUser(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	srv := NewService(NewRepository(s))
+
+	result, _, err := srv.ImportBestiaryForUser("owner", []byte(`[`+open5eGoblin+`,`+srdAPIOgre+`]`))
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(result.Created, []string{"Goblin", "Ogre"}),
+		is.SliceOfLen(result.Updated, 0),
+	)
+
+	result, _, err = srv.ImportBestiaryForUser("owner", []byte(open5eGoblin))
+	expect.That(t,
+		is.NoError(err),
+		is.SliceOfLen(result.Created, 0),
+		is.DeepEqualTo(result.Updated, []string{"Goblin"}),
+	)
+
+	kinds, err := srv.repo.ListKinds("owner")
+	expect.That(t,
+		is.NoError(err),
+		is.SliceOfLen(kinds, 2),
+	)
+}
@@ -0,0 +1,209 @@
+package encounter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/halimath/d20-tools/dice"
+)
+
+var (
+	armorClassPattern      = regexp.MustCompile(`(?i)^(?:armor class|AC)\s+(\d+)`)
+	hitPointsPattern       = regexp.MustCompile(`(?i)^(?:hit points|HP)\s+(\d+)\s*\(([^)]+)\)`)
+	speedPattern           = regexp.MustCompile(`(?i)^speed\s+(\d+)\s*ft`)
+	savingThrowsPattern    = regexp.MustCompile(`(?i)^saving throws\s+(.+)$`)
+	savingThrowPattern     = regexp.MustCompile(`(?i)\b(str|dex|con|int|wis|cha)\s*([+-]\d+)`)
+	challengePattern       = regexp.MustCompile(`(?i)^(?:challenge|CR)\s+(\d+(?:/\d+)?)`)
+	xpPattern              = regexp.MustCompile(`(?i)([\d,]+)\s*XP|XP\s*([\d,]+)`)
+	abilityLinePattern     = regexp.MustCompile(`^(?:(?:STR|DEX|CON|INT|WIS|CHA)\b\s*|\d+\s*\(\s*[+-]?\d+\s*\)\s*)+$`)
+	abilityLabelPattern    = regexp.MustCompile(`\b(STR|DEX|CON|INT|WIS|CHA)\b`)
+	abilityScorePattern    = regexp.MustCompile(`(\d+)\s*\(\s*([+-]?\d+)\s*\)`)
+	sectionPattern         = regexp.MustCompile(`(?i)^(?:actions|bonus actions|reactions|legendary actions|traits)$`)
+	creatureTypePattern    = regexp.MustCompile(`(?i)^(?:tiny|small|medium|large|huge|gargantuan)\b`)
+	attackPattern          = regexp.MustCompile(`(?i)^(.+?)\.\s+(?:melee or ranged|melee|ranged)\s+(?:weapon\s+|spell\s+)?attack(?:\s+roll)?:\s*([+-]\d+)(?:\s+to hit)?.*?\bhit:\s*(.*)$`)
+	alternativeDamageSplit = regexp.MustCompile(`,?\s+or\s+`)
+)
+
+// ParseStatBlock parses a stat block given as plain text as found in rule
+// books and adventure modules. It returns the kind described by the stat
+// block as well as warnings describing missing fields and lines that could
+// not be recognized. Saving throws not listed explicitly default to the
+// ability modifiers.
+func ParseStatBlock(text string) (Kind, []string) {
+	k := Kind{
+		ChallengeRate: DefaultChallengeRate,
+		XP:            DefaultXP,
+	}
+	var warnings []string
+
+	warn := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	lines := statBlockLines(text)
+	if len(lines) == 0 {
+		return k, []string{"missing name"}
+	}
+
+	k.Label = lines[0]
+	lines = lines[1:]
+
+	var abilities strings.Builder
+	var saves string
+	found := map[string]bool{}
+
+	for _, line := range lines {
+		if m := armorClassPattern.FindStringSubmatch(line); m != nil {
+			k.AC, _ = strconv.Atoi(m[1])
+			found["armor class"] = true
+			continue
+		}
+
+		if m := hitPointsPattern.FindStringSubmatch(line); m != nil {
+			hitDie := strings.Join(strings.Fields(m[2]), "")
+			if _, err := dice.Parse(hitDie); err != nil {
+				warn("invalid hit dice: %s", m[2])
+			} else {
+				k.HitDie = hitDie
+				found["hit points"] = true
+			}
+			continue
+		}
+
+		if m := speedPattern.FindStringSubmatch(line); m != nil {
+			k.Speed, _ = strconv.Atoi(m[1])
+			found["speed"] = true
+			continue
+		}
+
+		if abilityLinePattern.MatchString(line) {
+			abilities.WriteString(line)
+			abilities.WriteByte(' ')
+			continue
+		}
+
+		if m := savingThrowsPattern.FindStringSubmatch(line); m != nil {
+			saves = m[1]
+			continue
+		}
+
+		if m := challengePattern.FindStringSubmatch(line); m != nil {
+			if cr, ok := ParseChallengeRating(m[1]); ok {
+				k.ChallengeRate = cr
+				found["challenge"] = true
+			}
+
+			if xp := xpPattern.FindStringSubmatch(line); xp != nil {
+				k.XP, _ = strconv.Atoi(strings.ReplaceAll(xp[1]+xp[2], ",", ""))
+			} else if xp, ok := XPForChallengeRate(k.ChallengeRate); ok {
+				k.XP = xp
+			}
+			continue
+		}
+
+		if sectionPattern.MatchString(line) || creatureTypePattern.MatchString(line) {
+			continue
+		}
+
+		if m := attackPattern.FindStringSubmatch(line); m != nil {
+			attack := Attack{Label: strings.TrimSpace(m[1])}
+			attack.Mod, _ = strconv.Atoi(m[2])
+
+			// Only the first alternative is used for versatile weapons, i.e.
+			// "Hit: 6 (1d8 + 2) slashing damage, or 7 (1d10 + 2) slashing
+			// damage if used with two hands".
+			attack.Damage = parseDamage(alternativeDamageSplit.Split(m[3], 2)[0])
+			if len(attack.Damage) == 0 {
+				warn("no damage found for attack %s", attack.Label)
+			}
+
+			k.Attacks = append(k.Attacks, attack)
+			continue
+		}
+
+		warn("unrecognized: %s", line)
+	}
+
+	labels := abilityLabelPattern.FindAllString(abilities.String(), -1)
+	scores := abilityScorePattern.FindAllStringSubmatch(abilities.String(), -1)
+	if len(labels) == 6 && len(scores) == 6 {
+		for i, label := range labels {
+			mod, _ := strconv.Atoi(scores[i][2])
+			*savingThrow(&k.SavingThrows, label) = mod
+		}
+		found["ability scores"] = true
+	}
+
+	for _, m := range savingThrowPattern.FindAllStringSubmatch(saves, -1) {
+		*savingThrow(&k.SavingThrows, m[1]), _ = strconv.Atoi(m[2])
+	}
+
+	for _, field := range []string{"armor class", "hit points", "speed", "ability scores", "challenge"} {
+		if !found[field] {
+			warn("missing %s", field)
+		}
+	}
+
+	return k, warnings
+}
+
+// savingThrow returns a pointer to the saving throw of the ability given by
+// its three letter abbreviation.
+func savingThrow(s *SavingThrows, ability string) *int {
+	switch strings.ToLower(ability) {
+	case "str":
+		return &s.Str
+	case "dex":
+		return &s.Dex
+	case "con":
+		return &s.Con
+	case "int":
+		return &s.Int
+	case "wis":
+		return &s.Wis
+	default:
+		return &s.Cha
+	}
+}
+
+// statBlockLines splits text into logical lines. Dashes are normalized and
+// lines wrapped when copying from multi column layouts are joined with the
+// line they continue.
+func statBlockLines(text string) []string {
+	text = strings.NewReplacer("−", "-", "–", "-", "—", "-", "\r", "").Replace(text)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+
+		if n := len(lines); n > 0 && continuesLine(lines[n-1], line) {
+			lines[n-1] += " " + line
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// continuesLine reports whether line continues the wrapped line prev. Lines
+// starting with a lower case letter are always continuations as are all
+// lines following an unfinished attack description.
+func continuesLine(prev, line string) bool {
+	if unicode.IsLower([]rune(line)[0]) {
+		return true
+	}
+
+	if strings.HasSuffix(prev, ".") {
+		return false
+	}
+
+	return strings.Contains(strings.ToLower(prev), "attack")
+}
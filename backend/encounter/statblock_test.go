@@ -0,0 +1,215 @@
+package encounter
+
+import (
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestParseStatBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		kind     Kind
+		warnings []string
+	}{
+		{
+			name: "goblin with wrapped lines",
+			text: `Goblin
+Small humanoid (goblinoid), neutral evil
+
+Armor Class 15 (leather armor, shield)
+Hit Points 7 (2d6)
+Speed 30 ft.
+
+STR DEX CON INT WIS CHA
+8 (-1) 14 (+2) 10 (+0) 10 (+0) 8 (-1) 8 (-1)
+
+Skills Stealth +6
+Senses darkvision 60 ft., passive Perception 9
+Languages Common, Goblin
+Challenge 1/4 (50 XP)
+
+Nimble Escape. The goblin can take the Disengage or Hide action as a bonus action on each of its
+turns.
+
+Actions
+Scimitar. Melee Weapon Attack: +4 to hit, reach 5 ft., one
+target. Hit: 5 (1d6 + 2) slashing damage.
+Shortbow. Ranged Weapon Attack: +4 to hit, range 80/320 ft., one target. Hit: 5 (1d6 + 2) piercing damage.`,
+			kind: Kind{
+				Label:         "Goblin",
+				Speed:         30,
+				AC:            15,
+				ChallengeRate: 0.25,
+				XP:            50,
+				HitDie:        "2d6",
+				SavingThrows:  SavingThrows{Str: -1, Dex: 2, Con: 0, Int: 0, Wis: -1, Cha: -1},
+				Attacks: []Attack{
+					{Label: "Scimitar", Mod: 4, Damage: []Damage{{Label: "slashing", Damage: "1d6+2"}}},
+					{Label: "Shortbow", Mod: 4, Damage: []Damage{{Label: "piercing", Damage: "1d6+2"}}},
+				},
+			},
+			warnings: []string{
+				"unrecognized: Skills Stealth +6",
+				"unrecognized: Senses darkvision 60 ft., passive Perception 9",
+				"unrecognized: Languages Common, Goblin",
+				"unrecognized: Nimble Escape. The goblin can take the Disengage or Hide action as a bonus action on each of its turns.",
+			},
+		},
+		{
+			name: "orc with one ability per line",
+			text: `Orc
+Medium humanoid (orc), chaotic evil
+Armor Class 13 (hide armor)
+Hit Points 15 (2d8 + 6)
+Speed 30 ft.
+STR
+16 (+3)
+DEX
+12 (+1)
+CON
+16 (+3)
+INT
+7 (−2)
+WIS
+11 (+0)
+CHA
+10 (+0)
+Challenge 1/2 (100 XP)
+Actions
+Greataxe. Melee Weapon Attack: +5 to hit, reach 5 ft., one target. Hit: 9 (1d12 + 3) slashing damage.
+Javelin. Melee or Ranged Weapon Attack: +5 to hit, reach 5 ft. or range 30/120 ft., one target. Hit: 6 (1d6 + 3) piercing damage.`,
+			kind: Kind{
+				Label:         "Orc",
+				Speed:         30,
+				AC:            13,
+				ChallengeRate: 0.5,
+				XP:            100,
+				HitDie:        "2d8+6",
+				SavingThrows:  SavingThrows{Str: 3, Dex: 1, Con: 3, Int: -2, Wis: 0, Cha: 0},
+				Attacks: []Attack{
+					{Label: "Greataxe", Mod: 5, Damage: []Damage{{Label: "slashing", Damage: "1d12+3"}}},
+					{Label: "Javelin", Mod: 5, Damage: []Damage{{Label: "piercing", Damage: "1d6+3"}}},
+				},
+			},
+		},
+		{
+			name: "bandit captain with saving throws",
+			text: `Bandit Captain
+Medium humanoid (any race), any non-lawful alignment
+Armor Class 15 (studded leather)
+Hit Points 65 (10d8 + 20)
+Speed 30 ft.
+STR 15 (+2) DEX 16 (+3) CON 14 (+2) INT 14 (+2) WIS 11 (+0) CHA 14 (+2)
+Saving Throws Str +4, Dex +5, Wis +2
+Challenge 2 (450 XP)
+Actions
+Multiattack. The captain makes three melee attacks: two with its scimitar and one with its dagger. Or the captain makes two ranged attacks with its daggers.
+Scimitar. Melee Weapon Attack: +5 to hit, reach 5 ft., one target. Hit: 6 (1d6 + 3) slashing damage.
+Dagger. Melee or Ranged Weapon Attack: +5 to hit, reach 5 ft. or range 20/60 ft., one target. Hit: 5 (1d4 + 3) piercing damage.
+Reactions
+Parry. The captain adds 2 to its AC against one melee attack that would hit it. To do so, the captain must see the attacker and be wielding a melee weapon.`,
+			kind: Kind{
+				Label:         "Bandit Captain",
+				Speed:         30,
+				AC:            15,
+				ChallengeRate: 2,
+				XP:            450,
+				HitDie:        "10d8+20",
+				SavingThrows:  SavingThrows{Str: 4, Dex: 5, Con: 2, Int: 2, Wis: 2, Cha: 2},
+				Attacks: []Attack{
+					{Label: "Scimitar", Mod: 5, Damage: []Damage{{Label: "slashing", Damage: "1d6+3"}}},
+					{Label: "Dagger", Mod: 5, Damage: []Damage{{Label: "piercing", Damage: "1d4+3"}}},
+				},
+			},
+			warnings: []string{
+				"unrecognized: Multiattack. The captain makes three melee attacks: two with its scimitar and one with its dagger. Or the captain makes two ranged attacks with its daggers.",
+				"unrecognized: Parry. The captain adds 2 to its AC against one melee attack that would hit it. To do so, the captain must see the attacker and be wielding a melee weapon.",
+			},
+		},
+		{
+			name: "veteran with versatile weapon and extra damage",
+			text: `Veteran
+Medium humanoid (any race), any alignment
+Armor Class 17 (splint)
+Hit Points 58 (9d8 + 18)
+Speed 30 ft.
+STR DEX CON INT WIS CHA
+16 (+3) 13 (+1) 14 (+2) 10 (+0) 11 (+0) 10 (+0)
+Challenge 3 (700 XP)
+Actions
+Longsword. Melee Weapon Attack: +5 to hit, reach 5 ft., one target. Hit: 7 (1d8 + 3) slashing damage, or 8 (1d10 + 3) slashing damage if used with two hands.
+Poisoned Blade. Melee Weapon Attack: +5 to hit, reach 5 ft., one target. Hit: 5 (1d4 + 3) piercing damage plus 7 (2d6) poison damage.`,
+			kind: Kind{
+				Label:         "Veteran",
+				Speed:         30,
+				AC:            17,
+				ChallengeRate: 3,
+				XP:            700,
+				HitDie:        "9d8+18",
+				SavingThrows:  SavingThrows{Str: 3, Dex: 1, Con: 2},
+				Attacks: []Attack{
+					{Label: "Longsword", Mod: 5, Damage: []Damage{{Label: "slashing", Damage: "1d8+3"}}},
+					{Label: "Poisoned Blade", Mod: 5, Damage: []Damage{{Label: "piercing", Damage: "1d4+3"}, {Label: "poison", Damage: "2d6"}}},
+				},
+			},
+		},
+		{
+			name: "2024 layout",
+			text: `Goblin Warrior
+Small Fey (Goblinoid), Chaotic Neutral
+AC 15 Initiative +2 (12)
+HP 10 (3d6)
+Speed 30 ft.
+CR 1/4 (XP 50; PB +2)
+Actions
+Scimitar. Melee Attack Roll: +4, reach 5 ft. Hit: 5 (1d6 + 2) Slashing damage.`,
+			kind: Kind{
+				Label:         "Goblin Warrior",
+				Speed:         30,
+				AC:            15,
+				ChallengeRate: 0.25,
+				XP:            50,
+				HitDie:        "3d6",
+				Attacks: []Attack{
+					{Label: "Scimitar", Mod: 4, Damage: []Damage{{Label: "slashing", Damage: "1d6+2"}}},
+				},
+			},
+			warnings: []string{"missing ability scores"},
+		},
+		{
+			name: "no stat block",
+			text: "Some notes\n\nabout the session",
+			kind: Kind{
+				Label:         "Some notes about the session",
+				ChallengeRate: DefaultChallengeRate,
+				XP:            DefaultXP,
+			},
+			warnings: []string{
+				"missing armor class",
+				"missing hit points",
+				"missing speed",
+				"missing ability scores",
+				"missing challenge",
+			},
+		},
+		{
+			name:     "empty",
+			text:     " \n ",
+			kind:     Kind{ChallengeRate: DefaultChallengeRate, XP: DefaultXP},
+			warnings: []string{"missing name"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			k, warnings := ParseStatBlock(test.text)
+			expect.That(t,
+				is.DeepEqualTo(k, test.kind),
+				is.DeepEqualTo(warnings, test.warnings),
+			)
+		})
+	}
+}
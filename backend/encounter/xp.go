@@ -0,0 +1,47 @@
+package encounter
+
+// challengeRateXP maps challenge ratings to the experience points awarded
+// for defeating a creature of that rating.
+var challengeRateXP = map[float64]int{
+	0:     10,
+	0.125: 25,
+	0.25:  50,
+	0.5:   100,
+	1:     200,
+	2:     450,
+	3:     700,
+	4:     1100,
+	5:     1800,
+	6:     2300,
+	7:     2900,
+	8:     3900,
+	9:     5000,
+	10:    5900,
+	11:    7200,
+	12:    8400,
+	13:    10000,
+	14:    11500,
+	15:    13000,
+	16:    15000,
+	17:    18000,
+	18:    20000,
+	19:    22000,
+	20:    25000,
+	21:    33000,
+	22:    41000,
+	23:    50000,
+	24:    62000,
+	25:    75000,
+	26:    90000,
+	27:    105000,
+	28:    120000,
+	29:    135000,
+	30:    155000,
+}
+
+// XPForChallengeRate returns the experience points of a creature with
+// challenge rate cr. ok is false if cr is not a valid challenge rate.
+func XPForChallengeRate(cr float64) (xp int, ok bool) {
+	xp, ok = challengeRateXP[cr]
+	return
+}
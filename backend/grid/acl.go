@@ -0,0 +1,155 @@
+package grid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/halimath/d20-tools/auth"
+)
+
+// Role defines the access a principal has been granted for a grid.
+type Role string
+
+const (
+	// RoleViewer allows a principal to load and subscribe to a grid.
+	RoleViewer Role = "viewer"
+	// RoleEditor allows a principal to modify a grid in addition to viewing it.
+	RoleEditor Role = "editor"
+	// RoleOwner is implicitly held by the principal who created a grid. It
+	// cannot be granted.
+	RoleOwner Role = "owner"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleOwner:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Allows reports whether r grants at least the access of required.
+func (r Role) Allows(required Role) bool {
+	return r.rank() > 0 && r.rank() >= required.rank()
+}
+
+// Collaborator is a principal who has been granted a role for a grid.
+type Collaborator struct {
+	PrincipalID string
+	Role        Role
+}
+
+// roleOf returns the role principalID has for grid. It returns the empty role
+// if principalID has not been granted any access.
+func (svc *GridService) roleOf(grid Grid, principalID string) (Role, error) {
+	if grid.ownerID == principalID {
+		return RoleOwner, nil
+	}
+
+	acl, err := svc.repo.LoadACL(grid.ownerID, grid.id)
+	if err != nil {
+		return "", err
+	}
+
+	return acl[principalID], nil
+}
+
+// ListCollaborators lists all principals who have been granted access to the
+// grid identified by id ordered by their principal id. Only the owner may list
+// collaborators.
+func (svc *GridService) ListCollaborators(ctx context.Context, id string) ([]Collaborator, error) {
+	grid, err := svc.loadAuthorized(ctx, id, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	acl, err := svc.repo.LoadACL(grid.ownerID, grid.id)
+	if err != nil {
+		return nil, err
+	}
+
+	collaborators := make([]Collaborator, 0, len(acl))
+	for principalID, role := range acl {
+		collaborators = append(collaborators, Collaborator{PrincipalID: principalID, Role: role})
+	}
+
+	slices.SortFunc(collaborators, func(a, b Collaborator) int {
+		return strings.Compare(a.PrincipalID, b.PrincipalID)
+	})
+
+	return collaborators, nil
+}
+
+// Grant grants role to principalID for the grid identified by id replacing any
+// role granted before. Only the owner may grant roles.
+func (svc *GridService) Grant(ctx context.Context, id, principalID string, role Role) error {
+	return svc.grant(ctx, auth.FromContext(ctx), id, principalID, role)
+}
+
+// grant grants role to principalID on behalf of owner.
+func (svc *GridService) grant(ctx context.Context, owner *auth.Principal, id, principalID string, role Role) error {
+	if role != RoleViewer && role != RoleEditor {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	grid, _, err := svc.authorizeAs(ctx, owner, id, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	if principalID == grid.ownerID {
+		return fmt.Errorf("%w: cannot grant a role to the owner", ErrInvalidRole)
+	}
+
+	acl, err := svc.repo.LoadACL(grid.ownerID, grid.id)
+	if err != nil {
+		return err
+	}
+
+	acl[principalID] = role
+
+	return svc.repo.SaveACL(grid.ownerID, grid.id, acl)
+}
+
+// Revoke revokes any role granted to principalID for the grid identified by
+// id. Only the owner may revoke roles.
+func (svc *GridService) Revoke(ctx context.Context, id, principalID string) error {
+	return svc.revoke(ctx, auth.FromContext(ctx), id, principalID)
+}
+
+// revoke revokes any role granted to principalID on behalf of owner.
+func (svc *GridService) revoke(ctx context.Context, owner *auth.Principal, id, principalID string) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	grid, _, err := svc.authorizeAs(ctx, owner, id, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	acl, err := svc.repo.LoadACL(grid.ownerID, grid.id)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := acl[principalID]; !ok {
+		return ErrNotFound
+	}
+
+	delete(acl, principalID)
+
+	return svc.repo.SaveACL(grid.ownerID, grid.id, acl)
+}
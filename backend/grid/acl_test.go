@@ -0,0 +1,168 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/auth"
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestRole_Allows(t *testing.T) {
+	tests := []struct {
+		role, required Role
+		want           bool
+	}{
+		{RoleOwner, RoleOwner, true},
+		{RoleOwner, RoleEditor, true},
+		{RoleOwner, RoleViewer, true},
+		{RoleEditor, RoleOwner, false},
+		{RoleEditor, RoleEditor, true},
+		{RoleEditor, RoleViewer, true},
+		{RoleViewer, RoleEditor, false},
+		{RoleViewer, RoleViewer, true},
+		{"", RoleViewer, false},
+		{"admin", RoleViewer, false},
+	}
+
+	for _, test := range tests {
+		expect.That(t, is.EqualTo(test.role.Allows(test.required), test.want))
+	}
+}
+
+func TestGridService_LoadForEditing(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+	svc := NewService(repo)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Fog:          Fog(nil).Hide(Cell{Col: 0, Row: 0}),
+		Values:       Values{Label: "test", Descriptor: "1x1:-1:kr1:-2"},
+	}
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.Create(g))),
+		expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "gm", Role: RoleEditor, Created: time.Now()}))),
+		expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "player", Role: RoleViewer, Created: time.Now()}))),
+	)
+
+	loaded, err := svc.LoadForEditing(ContextWithShareToken(context.Background(), "gm"), "owner:grid")
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(loaded.Descriptor, g.Descriptor),
+	)
+
+	_, err = svc.LoadForEditing(ContextWithShareToken(context.Background(), "player"), "owner:grid")
+	expect.That(t, is.Error(err, ErrForbidden))
+}
+
+func TestGridService_authorizeAs(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+	svc := NewService(repo)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "1x1:-1:-1"},
+	}
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.Create(g))),
+		expect.FailNow(is.NoError(repo.SaveACL("owner", "grid", map[string]Role{"editor": RoleEditor, "viewer": RoleViewer}))),
+		expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "gm", Role: RoleEditor, Created: time.Now()}))),
+	)
+
+	tests := []struct {
+		principal *auth.Principal
+		token     string
+		required  Role
+		want      error
+	}{
+		{&auth.Principal{ID: "owner"}, "", RoleOwner, nil},
+		{&auth.Principal{ID: "editor"}, "", RoleEditor, nil},
+		{&auth.Principal{ID: "editor"}, "", RoleOwner, ErrForbidden},
+		{&auth.Principal{ID: "viewer"}, "", RoleViewer, nil},
+		{&auth.Principal{ID: "viewer"}, "", RoleEditor, ErrForbidden},
+		{&auth.Principal{ID: "stranger"}, "", RoleViewer, ErrForbidden},
+		// A share grants access beyond the role of the principal but never
+		// owner access.
+		{&auth.Principal{ID: "viewer"}, "gm", RoleEditor, nil},
+		{nil, "gm", RoleEditor, nil},
+		{nil, "gm", RoleOwner, ErrForbidden},
+		{nil, "", RoleViewer, ErrForbidden},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.token != "" {
+			ctx = ContextWithShareToken(ctx, test.token)
+		}
+
+		_, _, err := svc.authorizeAs(ctx, test.principal, "owner:grid", test.required)
+		expect.That(t, is.Error(err, test.want))
+	}
+}
+
+func TestGridService_grant_revoke(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+	svc := NewService(repo)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "1x1:-1:-1"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	ctx := context.Background()
+	owner := &auth.Principal{ID: "owner"}
+	editor := &auth.Principal{ID: "editor"}
+	viewer := &auth.Principal{ID: "viewer"}
+
+	expect.That(t,
+		is.NoError(svc.grant(ctx, owner, "owner:grid", "editor", RoleEditor)),
+		is.NoError(svc.grant(ctx, owner, "owner:grid", "viewer", RoleViewer)),
+		is.Error(svc.grant(ctx, owner, "owner:grid", "other", RoleOwner), ErrInvalidRole),
+		is.Error(svc.grant(ctx, owner, "owner:grid", "owner", RoleEditor), ErrInvalidRole),
+		// Only the owner manages roles.
+		is.Error(svc.grant(ctx, editor, "owner:grid", "other", RoleViewer), ErrForbidden),
+		is.Error(svc.grant(ctx, viewer, "owner:grid", "other", RoleViewer), ErrForbidden),
+		is.Error(svc.revoke(ctx, editor, "owner:grid", "viewer"), ErrForbidden),
+	)
+
+	_, _, err := svc.authorizeAs(ctx, editor, "owner:grid", RoleEditor)
+	expect.That(t, is.NoError(err))
+	_, _, err = svc.authorizeAs(ctx, viewer, "owner:grid", RoleEditor)
+	expect.That(t, is.Error(err, ErrForbidden))
+
+	expect.That(t,
+		is.NoError(svc.revoke(ctx, owner, "owner:grid", "editor")),
+		is.Error(svc.revoke(ctx, owner, "owner:grid", "editor"), ErrNotFound),
+	)
+
+	_, _, err = svc.authorizeAs(ctx, editor, "owner:grid", RoleViewer)
+	expect.That(t, is.Error(err, ErrForbidden))
+
+	acl, err := repo.LoadACL("owner", "grid")
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(acl, map[string]Role{"viewer": RoleViewer}),
+	)
+}
@@ -1,15 +1,22 @@
 package grid
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/halimath/d20-tools/auth"
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/grid/geometry"
+	"github.com/halimath/d20-tools/infra/jsonbody"
 	"github.com/halimath/httputils/response"
 	"github.com/halimath/kvlog"
 )
@@ -24,11 +31,233 @@ type (
 		WriteDTO
 		ID           string `json:"id"`
 		LastModified string `json:"lastModified"`
+		Version      int    `json:"version"`
+		// Fog lists the hidden cells. It is only sent to owner and editors.
+		Fog []CellDTO `json:"fog,omitempty"`
+	}
+
+	CellDTO struct {
+		Col int `json:"col"`
+		Row int `json:"row"`
+	}
+
+	AreaDTO struct {
+		Col  int `json:"col"`
+		Row  int `json:"row"`
+		Cols int `json:"cols"`
+		Rows int `json:"rows"`
+	}
+
+	SettingsDTO struct {
+		Diagonal geometry.DiagonalRule `json:"diagonal"`
+		Scale    float64               `json:"scale"`
+		Unit     string                `json:"unit"`
+	}
+
+	MeasurementDTO struct {
+		Cells    float64 `json:"cells"`
+		Distance float64 `json:"distance"`
+		Unit     string  `json:"unit"`
+	}
+
+	LineOfSightDTO struct {
+		Visible bool `json:"visible"`
+	}
+
+	RouteDTO struct {
+		Found bool      `json:"found"`
+		Cells []CellDTO `json:"cells"`
+		Cost  float64   `json:"cost"`
+		Unit  string    `json:"unit"`
+		// WithinSpeed is only set if a speed has been given.
+		WithinSpeed *bool `json:"withinSpeed,omitempty"`
+	}
+
+	CoverageDTO struct {
+		Cells []CellDTO `json:"cells"`
+		End   CellDTO   `json:"end"`
+	}
+
+	CombatantDTO struct {
+		ID         string          `json:"id,omitempty"`
+		Name       string          `json:"name"`
+		Initiative int             `json:"initiative"`
+		Modifier   int             `json:"modifier,omitempty"`
+		Player     bool            `json:"player,omitempty"`
+		Status     CombatantStatus `json:"status,omitempty"`
+		Trigger    string          `json:"trigger,omitempty"`
+		Conditions []ConditionDTO  `json:"conditions,omitempty"`
+	}
+
+	CombatDTO struct {
+		Combatants []CombatantDTO        `json:"combatants"`
+		Round      int                   `json:"round"`
+		Turn       int                   `json:"turn"`
+		Tokens     []TokenConditionDTO   `json:"tokens,omitempty"`
+		Expired    []ExpiredConditionDTO `json:"expired,omitempty"`
+	}
+
+	ConditionDTO struct {
+		ID               string `json:"id,omitempty"`
+		Name             string `json:"name"`
+		Rounds           int    `json:"rounds,omitempty"`
+		Anchor           string `json:"anchor,omitempty"`
+		UntilEndOfTurnOf string `json:"untilEndOfTurnOf,omitempty"`
+	}
+
+	TokenConditionDTO struct {
+		Cell      CellDTO      `json:"cell"`
+		Condition ConditionDTO `json:"condition"`
+	}
+
+	ExpiredConditionDTO struct {
+		Combatant string       `json:"combatant,omitempty"`
+		Cell      *CellDTO     `json:"cell,omitempty"`
+		Condition ConditionDTO `json:"condition"`
+	}
+
+	ReadyDTO struct {
+		Trigger string `json:"trigger"`
+	}
+
+	RollRequestDTO struct {
+		Expression string `json:"expression"`
+		Private    bool   `json:"private,omitempty"`
+		Nonce      string `json:"nonce,omitempty"`
+	}
+
+	RollDTO struct {
+		dice.ResultDTO
+		Number  int    `json:"number"`
+		Created string `json:"created"`
+		Roller  string `json:"roller"`
+		Private bool   `json:"private,omitempty"`
+		Session string `json:"session,omitempty"`
+		Nonce   string `json:"nonce,omitempty"`
+	}
+
+	FairSessionDTO struct {
+		Commitment string `json:"commitment"`
+		Seed       string `json:"seed,omitempty"`
+		Started    string `json:"started"`
+		Revealed   string `json:"revealed,omitempty"`
+	}
+
+	RollVerificationDTO struct {
+		Number int  `json:"number"`
+		Valid  bool `json:"valid"`
+	}
+
+	VerificationDTO struct {
+		Session   FairSessionDTO        `json:"session"`
+		Committed bool                  `json:"committed"`
+		Valid     bool                  `json:"valid"`
+		Rolls     []RollVerificationDTO `json:"rolls"`
+	}
+
+	RollPageDTO struct {
+		Rolls []RollDTO `json:"rolls"`
+		// Next is the value of the before parameter used to request the next
+		// page. It is omitted on the last page.
+		Next int `json:"next,omitempty"`
+	}
+
+	FogDTO struct {
+		Hide   []AreaDTO `json:"hide,omitempty"`
+		Reveal []AreaDTO `json:"reveal,omitempty"`
+	}
+
+	OperationDTO struct {
+		Type     OperationType `json:"op"`
+		Col      int           `json:"col"`
+		Row      int           `json:"row"`
+		ToCol    int           `json:"toCol,omitempty"`
+		ToRow    int           `json:"toRow,omitempty"`
+		Symbol   TokenSymbol   `json:"symbol,omitempty"`
+		Color    Color         `json:"color,omitempty"`
+		Position WallPosition  `json:"position,omitempty"`
+		Kind     WallSymbol    `json:"kind,omitempty"`
+		Cols     int           `json:"cols,omitempty"`
+		Rows     int           `json:"rows,omitempty"`
+		Label    string        `json:"label,omitempty"`
+	}
+
+	PatchDTO struct {
+		Version    int            `json:"version"`
+		Operations []OperationDTO `json:"operations"`
+	}
+
+	CollaboratorDTO struct {
+		PrincipalID string `json:"principalId"`
+		Role        Role   `json:"role"`
+	}
+
+	GrantDTO struct {
+		Role Role `json:"role"`
+	}
+
+	CreateShareDTO struct {
+		Role    Role   `json:"role"`
+		Expires string `json:"expires,omitempty"`
+		MaxUses int    `json:"maxUses,omitempty"`
+	}
+
+	ShareDTO struct {
+		Token   string `json:"token"`
+		Role    Role   `json:"role"`
+		Created string `json:"created"`
+		Expires string `json:"expires,omitempty"`
+		MaxUses int    `json:"maxUses,omitempty"`
+		Uses    int    `json:"uses"`
+	}
+
+	RevisionDTO struct {
+		WriteDTO
+		Number  int    `json:"number"`
+		Created string `json:"created"`
+	}
+
+	TokenValueDTO struct {
+		Symbol TokenSymbol `json:"symbol"`
+		Color  Color       `json:"color"`
+	}
+
+	WallValueDTO struct {
+		Kind  WallSymbol `json:"kind"`
+		Color Color      `json:"color"`
+	}
+
+	CellStateDTO struct {
+		Background Color          `json:"background,omitempty"`
+		Token      *TokenValueDTO `json:"token,omitempty"`
+		LeftWall   *WallValueDTO  `json:"leftWall,omitempty"`
+		TopWall    *WallValueDTO  `json:"topWall,omitempty"`
+	}
+
+	CellChangeDTO struct {
+		Col    int          `json:"col"`
+		Row    int          `json:"row"`
+		Before CellStateDTO `json:"before"`
+		After  CellStateDTO `json:"after"`
+	}
+
+	DiffSideDTO struct {
+		Number int    `json:"number"`
+		Label  string `json:"label"`
+		Cols   int    `json:"cols"`
+		Rows   int    `json:"rows"`
+	}
+
+	DiffDTO struct {
+		From  DiffSideDTO     `json:"from"`
+		To    DiffSideDTO     `json:"to"`
+		Cells []CellChangeDTO `json:"cells"`
 	}
 )
 
 func Handler(srv *GridService) http.Handler {
 	mux := http.NewServeMux()
+	cache := newRenderCache(renderCacheSize)
 
 	mux.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
 		if auth.FromRequest(r) == nil {
@@ -38,7 +267,7 @@ func Handler(srv *GridService) http.Handler {
 
 		logger := kvlog.FromContext(r.Context())
 
-		dto, err := readJSONBody[WriteDTO](w, r)
+		vals, err := readValues(w, r)
 		if err != nil {
 			// Error has already been handled
 			return
@@ -46,7 +275,7 @@ func Handler(srv *GridService) http.Handler {
 
 		logger.Logs("creating grid")
 
-		grid, err := srv.Create(r.Context(), Values(dto))
+		grid, err := srv.Create(r.Context(), vals)
 
 		if err != nil {
 			if errors.Is(err, ErrAlreadyExists) {
@@ -54,6 +283,11 @@ func Handler(srv *GridService) http.Handler {
 				return
 			}
 
+			if errors.Is(err, ErrInvalidDescriptor) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
 			logger.Logs("error creating grid", kvlog.WithErr(err))
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
@@ -88,17 +322,30 @@ func Handler(srv *GridService) http.Handler {
 	mux.HandleFunc("GET /{id}", func(w http.ResponseWriter, r *http.Request) {
 		logger := kvlog.FromContext(r.Context())
 		id := r.PathValue("id")
+
+		if ext := path.Ext(id); ext != "" {
+			if format, ok := renderFormats[ext]; ok {
+				serveRendering(w, r, srv, cache, strings.TrimSuffix(id, ext), format)
+				return
+			}
+		}
+
 		logger.Logs("loading grid", kvlog.WithKV("id", id))
 
+		// The representation is negotiated using the Accept header.
+		w.Header().Set("Vary", "Accept")
+
 		g, err := srv.Load(r.Context(), id)
 		if err != nil {
-			if errors.Is(err, ErrNotFound) {
-				http.Error(w, "not found", http.StatusNotFound)
-				return
-			}
+			handleServiceError(w, r, err, "failed to load grid")
+			return
+		}
 
-			logger.Logs("failed to load grid", kvlog.WithKV("id", id), kvlog.WithErr(err))
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+		if acceptsStructured(r) {
+			if err := writeStructured(w, g); err != nil {
+				logger.Logs("failed to write structured grid", kvlog.WithKV("id", id), kvlog.WithErr(err))
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
 			return
 		}
 
@@ -115,7 +362,7 @@ func Handler(srv *GridService) http.Handler {
 
 		id := r.PathValue("id")
 
-		dto, err := readJSONBody[WriteDTO](w, r)
+		vals, err := readValues(w, r)
 		if err != nil {
 			// Error has already been handled
 			return
@@ -123,7 +370,7 @@ func Handler(srv *GridService) http.Handler {
 
 		logger.Logs("updating grid", kvlog.WithKV("id", id))
 
-		err = srv.Update(r.Context(), id, Values(dto))
+		err = srv.Update(r.Context(), id, vals)
 
 		if err != nil {
 			if errors.Is(err, ErrNotFound) {
@@ -136,6 +383,11 @@ func Handler(srv *GridService) http.Handler {
 				return
 			}
 
+			if errors.Is(err, ErrInvalidDescriptor) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
 			logger.Logs("error updating grid", kvlog.WithKV("id", id), kvlog.WithErr(err))
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
@@ -144,6 +396,78 @@ func Handler(srv *GridService) http.Handler {
 		response.NoContent(w, r)
 	})
 
+	mux.HandleFunc("PATCH /{id}", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		dtos, err := jsonbody.Read[[]OperationDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return
+		}
+
+		ops := make([]Operation, len(dtos))
+		for i, dto := range dtos {
+			ops[i] = Operation(dto)
+		}
+
+		logger.Logs("patching grid", kvlog.WithKV("id", id), kvlog.WithKV("operations", len(ops)))
+
+		g, err := srv.Patch(r.Context(), id, ops)
+		if err != nil {
+			if errors.Is(err, ErrInvalidOperation) || errors.Is(err, ErrInvalidDescriptor) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if errors.Is(err, ErrConflict) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+
+			handleServiceError(w, r, err, "error patching grid")
+			return
+		}
+
+		response.JSON(w, r, toDTO(g))
+	})
+
+	mux.HandleFunc("POST /{id}/fog", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		dto, err := jsonbody.Read[FogDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return
+		}
+
+		logger.Logs("updating grid fog", kvlog.WithKV("id", id), kvlog.WithKV("hide", len(dto.Hide)), kvlog.WithKV("reveal", len(dto.Reveal)))
+
+		g, err := srv.UpdateFog(r.Context(), id, toAreas(dto.Hide), toAreas(dto.Reveal))
+		if err != nil {
+			if errors.Is(err, ErrInvalidOperation) || errors.Is(err, ErrInvalidDescriptor) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			handleServiceError(w, r, err, "error updating grid fog")
+			return
+		}
+
+		response.JSON(w, r, toDTO(g))
+	})
+
 	mux.HandleFunc("DELETE /{id}", func(w http.ResponseWriter, r *http.Request) {
 		if auth.FromRequest(r) == nil {
 			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
@@ -181,70 +505,1352 @@ func Handler(srv *GridService) http.Handler {
 
 		sup, err := srv.Subscribe(r.Context(), id)
 		if err != nil {
-			logger.Logs("failed to subscribe to grid", kvlog.WithKV("id", id), kvlog.WithErr(err))
-			if errors.Is(err, ErrNotFound) {
-				http.Error(w, "not found", http.StatusNotFound)
-				return
-			}
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			handleServiceError(w, r, err, "failed to subscribe to grid")
 			return
 		}
 
+		// Clients understanding patches opt in to receive patch events instead
+		// of the complete grids resulting from them.
+		patches, _ := strconv.ParseBool(r.URL.Query().Get("patches"))
+
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 
-		for g := range sup.C() {
-			lastGridUpdateBytes, err := json.Marshal(toDTO(g))
+		for evt := range sup.C() {
+			// Complete grids are sent as unnamed events to keep existing
+			// clients working. All other events are named.
+			var eventName string
+			var payload any
+
+			switch evt.Type {
+			case EventUpdated:
+				payload = toDTO(evt.Grid)
+			case EventPatched:
+				if !patches {
+					payload = toDTO(evt.Grid)
+					break
+				}
+				eventName = "patch"
+				payload = toPatchDTO(evt.Patch)
+			case EventCombat:
+				eventName = "combat"
+				if evt.Combat != nil {
+					payload = toCombatDTO(*evt.Combat)
+				}
+			case EventRolled:
+				eventName = "roll"
+				payload = toRollDTO(evt.Roll)
+			case EventConditionsExpired:
+				eventName = "expired"
+				payload = toExpiredConditionDTOs(evt.Expired)
+			}
+
+			data, err := json.Marshal(payload)
 			if err != nil {
-				logger.Logs("failed to marshal grid", kvlog.WithKV("id", id), kvlog.WithErr(err))
+				logger.Logs("failed to marshal grid event", kvlog.WithKV("id", id), kvlog.WithErr(err))
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 				return
 			}
 
-			fmt.Fprintf(w, "data: %s\n\n", string(lastGridUpdateBytes))
+			if eventName != "" {
+				fmt.Fprintf(w, "event: %s\n", eventName)
+			}
+			fmt.Fprintf(w, "data: %s\n\n", string(data))
 			w.(http.Flusher).Flush()
 		}
 	})
 
-	return mux
-}
+	mux.HandleFunc("GET /{id}/overlay.png", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("streaming grid overlay", kvlog.WithKV("id", id))
 
-var errNoJSON = errors.New("not a JSON response")
+		params, err := parseImageParams(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-func readJSONBody[T any](w http.ResponseWriter, r *http.Request) (t T, err error) {
-	logger := kvlog.FromContext(r.Context())
-	contentType := r.Header.Get("Content-Type")
-	if !strings.HasPrefix(contentType, "application/json") {
-		logger.Logs("unsupported media type", kvlog.WithKV("contentType", contentType))
-		http.Error(w, "not a JSON response", http.StatusUnsupportedMediaType)
-		return t, errNoJSON
-	}
+		sup, err := srv.Subscribe(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to subscribe to grid")
+			return
+		}
 
-	var data []byte
-	data, err = io.ReadAll(r.Body)
-	if err != nil {
-		logger.Logs("i/o error reading request body", kvlog.WithErr(err))
-		return
-	}
+		mw := multipart.NewWriter(w)
 
-	err = json.Unmarshal(data, &t)
-	if err != nil {
-		logger.Logs("json unmarshalling error", kvlog.WithErr(err))
-		http.Error(w, "invalid JSON bodz", http.StatusBadRequest)
-		return
-	}
-	return
-}
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
 
-func toDTO(g Grid) ReadDTO {
-	return ReadDTO{
-		WriteDTO: WriteDTO{
-			Label:      g.Label,
-			Descriptor: g.Descriptor,
-		},
-		ID:           g.ID(),
-		LastModified: g.LastModified.Format(time.RFC3339),
-	}
+		// stop ends the subscription and discards pending events, so the
+		// subscription never blocks on sending to this handler.
+		stop := func() {
+			sup.Cancel()
+			for range sup.C() {
+			}
+		}
+
+		for evt := range sup.C() {
+			// Only changes of the grid produce a new frame.
+			if evt.Type != EventUpdated && evt.Type != EventPatched {
+				continue
+			}
+
+			key := renderCacheKey(evt.Grid, "image/png", params.cacheKey())
+			data, ok := cache.get(key)
+			if !ok {
+				l, err := ParseLayout(evt.Grid.Descriptor)
+				if err == nil {
+					data, err = renderPNG(l, params)
+				}
+				if err != nil {
+					logger.Logs("failed to render grid overlay frame", kvlog.WithKV("id", id), kvlog.WithErr(err))
+					stop()
+					return
+				}
+				cache.put(key, data)
+			}
+
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":   {"image/png"},
+				"Content-Length": {strconv.Itoa(len(data))},
+			})
+			if err != nil {
+				stop()
+				return
+			}
+			part.Write(data)
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	mux.HandleFunc("GET /{id}/settings", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("loading grid settings", kvlog.WithKV("id", id))
+
+		settings, err := srv.Settings(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to load grid settings")
+			return
+		}
+
+		response.JSON(w, r, SettingsDTO(settings))
+	})
+
+	mux.HandleFunc("PUT /{id}/settings", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		dto, err := jsonbody.Read[SettingsDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return
+		}
+
+		logger.Logs("updating grid settings", kvlog.WithKV("id", id))
+
+		if err := srv.UpdateSettings(r.Context(), id, Settings(dto)); err != nil {
+			if errors.Is(err, ErrInvalidSettings) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			handleServiceError(w, r, err, "failed to update grid settings")
+			return
+		}
+
+		response.NoContent(w, r)
+	})
+
+	mux.HandleFunc("GET /{id}/distance", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		from, ok := cellQueryValue(w, r, "from")
+		if !ok {
+			return
+		}
+		to, ok := cellQueryValue(w, r, "to")
+		if !ok {
+			return
+		}
+
+		m, err := srv.Distance(r.Context(), id, from, to)
+		if err != nil {
+			handleGeometryError(w, r, err, "failed to measure distance")
+			return
+		}
+
+		response.JSON(w, r, MeasurementDTO(m))
+	})
+
+	mux.HandleFunc("GET /{id}/los", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		from, ok := cellQueryValue(w, r, "from")
+		if !ok {
+			return
+		}
+		to, ok := cellQueryValue(w, r, "to")
+		if !ok {
+			return
+		}
+
+		visible, err := srv.LineOfSight(r.Context(), id, from, to, sightOptions(r))
+		if err != nil {
+			handleGeometryError(w, r, err, "failed to compute line of sight")
+			return
+		}
+
+		response.JSON(w, r, LineOfSightDTO{Visible: visible})
+	})
+
+	mux.HandleFunc("GET /{id}/template", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		q := r.URL.Query()
+
+		origin, ok := cellQueryValue(w, r, "origin")
+		if !ok {
+			return
+		}
+
+		t := geometry.Template{
+			Shape:  geometry.Shape(q.Get("shape")),
+			Origin: origin,
+		}
+
+		if q.Has("toward") {
+			if t.Toward, ok = cellQueryValue(w, r, "toward"); !ok {
+				return
+			}
+		}
+
+		size, err := strconv.ParseFloat(q.Get("size"), 64)
+		if err != nil {
+			http.Error(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+		t.Size = size
+
+		coverage, err := srv.Cover(r.Context(), id, t, sightOptions(r))
+		if err != nil {
+			handleGeometryError(w, r, err, "failed to apply template")
+			return
+		}
+
+		dto := CoverageDTO{
+			Cells: make([]CellDTO, len(coverage.Cells)),
+			End:   CellDTO(coverage.End),
+		}
+		for i, c := range coverage.Cells {
+			dto.Cells[i] = CellDTO(c)
+		}
+
+		response.JSON(w, r, dto)
+	})
+
+	mux.HandleFunc("GET /{id}/path", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		q := r.URL.Query()
+
+		from, ok := cellQueryValue(w, r, "from")
+		if !ok {
+			return
+		}
+		to, ok := cellQueryValue(w, r, "to")
+		if !ok {
+			return
+		}
+
+		// A negative speed means no speed has been given.
+		speed := -1.0
+		if q.Has("speed") {
+			var err error
+			speed, err = strconv.ParseFloat(q.Get("speed"), 64)
+			if err != nil || speed < 0 {
+				http.Error(w, "invalid speed", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var difficult DifficultTerrain
+		if v := q.Get("difficult"); v != "" {
+			if all, err := strconv.ParseBool(v); err == nil {
+				difficult.All = all
+			} else {
+				for c := range strings.SplitSeq(v, ",") {
+					if !IsValidColor(Color(c)) {
+						http.Error(w, "invalid difficult", http.StatusBadRequest)
+						return
+					}
+					difficult.Colors = append(difficult.Colors, Color(c))
+				}
+			}
+		}
+
+		route, err := srv.FindPath(r.Context(), id, from, to, difficult)
+		if err != nil {
+			handleGeometryError(w, r, err, "failed to find path")
+			return
+		}
+
+		dto := RouteDTO{
+			Found: route.Found,
+			Cells: make([]CellDTO, len(route.Cells)),
+			Cost:  route.Cost,
+			Unit:  route.Unit,
+		}
+		for i, c := range route.Cells {
+			dto.Cells[i] = CellDTO(c)
+		}
+
+		if speed >= 0 {
+			withinSpeed := route.Found && route.Cost <= speed
+			dto.WithinSpeed = &withinSpeed
+		}
+
+		response.JSON(w, r, dto)
+	})
+
+	mux.HandleFunc("GET /{id}/combat", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("loading grid combat", kvlog.WithKV("id", id))
+
+		c, err := srv.Combat(r.Context(), id)
+		if err != nil {
+			handleCombatError(w, r, err, "failed to load combat")
+			return
+		}
+
+		response.JSON(w, r, toCombatDTO(c))
+	})
+
+	mux.HandleFunc("POST /{id}/combat", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		dtos, err := jsonbody.Read[[]CombatantDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return
+		}
+
+		combatants := make([]Combatant, len(dtos))
+		for i, dto := range dtos {
+			combatants[i] = fromCombatantDTO(dto)
+		}
+
+		logger.Logs("starting grid combat", kvlog.WithKV("id", id), kvlog.WithKV("combatants", len(combatants)))
+
+		c, err := srv.StartCombat(r.Context(), id, combatants)
+		if err != nil {
+			handleCombatError(w, r, err, "failed to start combat")
+			return
+		}
+
+		response.JSON(w, r, toCombatDTO(c), response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("DELETE /{id}/combat", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("ending grid combat", kvlog.WithKV("id", id))
+
+		if err := srv.EndCombat(r.Context(), id); err != nil {
+			handleCombatError(w, r, err, "failed to end combat")
+			return
+		}
+
+		response.NoContent(w, r)
+	})
+
+	// updateCombat creates a handler applying the update returned from
+	// prepare to a grid's combat. prepare may read the request and returns
+	// false if it has already sent an error response.
+	updateCombat := func(msg string, prepare func(w http.ResponseWriter, r *http.Request) (func(*Combat) error, bool)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if auth.FromRequest(r) == nil {
+				response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+				return
+			}
+
+			logger := kvlog.FromContext(r.Context())
+			id := r.PathValue("id")
+
+			update, ok := prepare(w, r)
+			if !ok {
+				return
+			}
+
+			logger.Logs(msg, kvlog.WithKV("id", id), kvlog.WithKV("combatant", r.PathValue("combatantID")))
+
+			c, err := srv.UpdateCombat(r.Context(), id, update)
+			if err != nil {
+				handleCombatError(w, r, err, "failed to update combat")
+				return
+			}
+
+			response.JSON(w, r, toCombatDTO(c))
+		}
+	}
+
+	mux.HandleFunc("POST /{id}/combat/next", updateCombat("passing turn", func(w http.ResponseWriter, r *http.Request) (func(*Combat) error, bool) {
+		return func(c *Combat) error {
+			c.Next()
+			return nil
+		}, true
+	}))
+
+	mux.HandleFunc("POST /{id}/combat/previous", updateCombat("reverting turn", func(w http.ResponseWriter, r *http.Request) (func(*Combat) error, bool) {
+		return func(c *Combat) error {
+			c.Previous()
+			return nil
+		}, true
+	}))
+
+	mux.HandleFunc("POST /{id}/combat/combatants", updateCombat("adding combatant", func(w http.ResponseWriter, r *http.Request) (func(*Combat) error, bool) {
+		dto, err := jsonbody.Read[CombatantDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return nil, false
+		}
+
+		return func(c *Combat) error {
+			return c.Add(fromCombatantDTO(dto))
+		}, true
+	}))
+
+	mux.HandleFunc("DELETE /{id}/combat/combatants/{combatantID}", updateCombat("removing combatant", func(w http.ResponseWriter, r *http.Request) (func(*Combat) error, bool) {
+		return func(c *Combat) error {
+			return c.Remove(r.PathValue("combatantID"))
+		}, true
+	}))
+
+	mux.HandleFunc("POST /{id}/combat/combatants/{combatantID}/delay", updateCombat("delaying turn", func(w http.ResponseWriter, r *http.Request) (func(*Combat) error, bool) {
+		return func(c *Combat) error {
+			return c.Delay(r.PathValue("combatantID"))
+		}, true
+	}))
+
+	mux.HandleFunc("POST /{id}/combat/combatants/{combatantID}/ready", updateCombat("readying action", func(w http.ResponseWriter, r *http.Request) (func(*Combat) error, bool) {
+		dto, err := jsonbody.Read[ReadyDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return nil, false
+		}
+
+		return func(c *Combat) error {
+			return c.Ready(r.PathValue("combatantID"), dto.Trigger)
+		}, true
+	}))
+
+	mux.HandleFunc("POST /{id}/combat/combatants/{combatantID}/act", updateCombat("acting", func(w http.ResponseWriter, r *http.Request) (func(*Combat) error, bool) {
+		return func(c *Combat) error {
+			return c.Act(r.PathValue("combatantID"))
+		}, true
+	}))
+
+	mux.HandleFunc("POST /{id}/combat/combatants/{combatantID}/conditions", updateCombat("adding condition", func(w http.ResponseWriter, r *http.Request) (func(*Combat) error, bool) {
+		dto, err := jsonbody.Read[ConditionDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return nil, false
+		}
+
+		return func(c *Combat) error {
+			_, err := c.AddCondition(r.PathValue("combatantID"), fromConditionDTO(dto))
+			return err
+		}, true
+	}))
+
+	mux.HandleFunc("DELETE /{id}/combat/conditions/{conditionID}", updateCombat("removing condition", func(w http.ResponseWriter, r *http.Request) (func(*Combat) error, bool) {
+		return func(c *Combat) error {
+			return c.RemoveCondition(r.PathValue("conditionID"))
+		}, true
+	}))
+
+	mux.HandleFunc("POST /{id}/combat/tokens/conditions", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		dto, err := jsonbody.Read[TokenConditionDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return
+		}
+
+		logger.Logs("adding token condition", kvlog.WithKV("id", id), kvlog.WithKV("col", dto.Cell.Col), kvlog.WithKV("row", dto.Cell.Row))
+
+		c, err := srv.AddTokenCondition(r.Context(), id, Cell(dto.Cell), fromConditionDTO(dto.Condition))
+		if err != nil {
+			handleCombatError(w, r, err, "failed to add token condition")
+			return
+		}
+
+		response.JSON(w, r, toCombatDTO(c))
+	})
+
+	mux.HandleFunc("POST /{id}/rolls", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		dto, err := jsonbody.Read[RollRequestDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return
+		}
+
+		expr, err := dice.Parse(dto.Expression)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(dto.Nonce) > maxNonceLength {
+			http.Error(w, fmt.Sprintf("nonce must not exceed %d bytes", maxNonceLength), http.StatusBadRequest)
+			return
+		}
+
+		logger.Logs("rolling dice", kvlog.WithKV("id", id), kvlog.WithKV("expression", expr.String()), kvlog.WithKV("private", dto.Private))
+
+		roll, err := srv.Roll(r.Context(), id, expr, RollOptions{Private: dto.Private, Nonce: dto.Nonce})
+		if err != nil {
+			handleServiceError(w, r, err, "failed to roll dice")
+			return
+		}
+
+		response.JSON(w, r, toRollDTO(roll), response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("GET /{id}/rolls", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		before, ok := intQueryValue(w, r, "before", 0)
+		if !ok {
+			return
+		}
+
+		limit, ok := intQueryValue(w, r, "limit", DefaultRollPageSize)
+		if !ok {
+			return
+		}
+
+		logger.Logs("listing grid rolls", kvlog.WithKV("id", id), kvlog.WithKV("before", before), kvlog.WithKV("limit", limit))
+
+		rolls, next, err := srv.ListRolls(r.Context(), id, before, limit)
+		if err != nil {
+			if errors.Is(err, ErrInvalidRollQuery) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			handleServiceError(w, r, err, "failed to list grid rolls")
+			return
+		}
+
+		dto := RollPageDTO{
+			Rolls: make([]RollDTO, len(rolls)),
+			Next:  next,
+		}
+		for i, roll := range rolls {
+			dto.Rolls[i] = toRollDTO(roll)
+		}
+
+		response.JSON(w, r, dto)
+	})
+
+	mux.HandleFunc("GET /{id}/fairness", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("listing fair sessions", kvlog.WithKV("id", id))
+
+		sessions, err := srv.ListFairSessions(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to list fair sessions")
+			return
+		}
+
+		dtos := make([]FairSessionDTO, len(sessions))
+		for i, s := range sessions {
+			dtos[i] = toFairSessionDTO(s)
+		}
+
+		response.JSON(w, r, dtos)
+	})
+
+	mux.HandleFunc("POST /{id}/fairness", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("starting fair session", kvlog.WithKV("id", id))
+
+		s, err := srv.StartFairSession(r.Context(), id)
+		if err != nil {
+			handleFairnessError(w, r, err, "failed to start fair session")
+			return
+		}
+
+		response.JSON(w, r, toFairSessionDTO(s), response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("POST /{id}/fairness/reveal", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("revealing fair session", kvlog.WithKV("id", id))
+
+		s, err := srv.RevealFairSession(r.Context(), id)
+		if err != nil {
+			handleFairnessError(w, r, err, "failed to reveal fair session")
+			return
+		}
+
+		response.JSON(w, r, toFairSessionDTO(s))
+	})
+
+	mux.HandleFunc("GET /{id}/fairness/{commitment}/verify", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		commitment := r.PathValue("commitment")
+		logger.Logs("verifying fair session", kvlog.WithKV("id", id), kvlog.WithKV("commitment", commitment))
+
+		v, err := srv.VerifyFairSession(r.Context(), id, commitment)
+		if err != nil {
+			handleFairnessError(w, r, err, "failed to verify fair session")
+			return
+		}
+
+		dto := VerificationDTO{
+			Session:   toFairSessionDTO(v.Session),
+			Committed: v.Committed,
+			Valid:     v.Valid(),
+			Rolls:     make([]RollVerificationDTO, len(v.Rolls)),
+		}
+		for i, rv := range v.Rolls {
+			dto.Rolls[i] = RollVerificationDTO{Number: rv.Roll.Number, Valid: rv.Valid}
+		}
+
+		response.JSON(w, r, dto)
+	})
+
+	mux.HandleFunc("GET /{id}/revisions", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("listing grid revisions", kvlog.WithKV("id", id))
+
+		revisions, err := srv.ListRevisions(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to list grid revisions")
+			return
+		}
+
+		dtos := make([]RevisionDTO, len(revisions))
+		for i, rev := range revisions {
+			dtos[i] = toRevisionDTO(rev)
+		}
+
+		response.JSON(w, r, dtos)
+	})
+
+	mux.HandleFunc("GET /{id}/revisions/{n}", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		n, ok := intPathValue(w, r, "n")
+		if !ok {
+			return
+		}
+
+		logger.Logs("loading grid revision", kvlog.WithKV("id", id), kvlog.WithKV("revision", n))
+
+		rev, err := srv.LoadRevision(r.Context(), id, n)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to load grid revision")
+			return
+		}
+
+		response.JSON(w, r, toRevisionDTO(rev))
+	})
+
+	mux.HandleFunc("GET /{id}/revisions/{n}/diff/{m}", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		from, ok := intPathValue(w, r, "n")
+		if !ok {
+			return
+		}
+
+		to, ok := intPathValue(w, r, "m")
+		if !ok {
+			return
+		}
+
+		logger.Logs("diffing grid revisions", kvlog.WithKV("id", id), kvlog.WithKV("from", from), kvlog.WithKV("to", to))
+
+		diff, err := srv.DiffRevisions(r.Context(), id, from, to)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to diff grid revisions")
+			return
+		}
+
+		response.JSON(w, r, toDiffDTO(diff))
+	})
+
+	mux.HandleFunc("POST /{id}/revisions/{n}/restore", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		n, ok := intPathValue(w, r, "n")
+		if !ok {
+			return
+		}
+
+		logger.Logs("restoring grid revision", kvlog.WithKV("id", id), kvlog.WithKV("revision", n))
+
+		if err := srv.RestoreRevision(r.Context(), id, n); err != nil {
+			handleServiceError(w, r, err, "failed to restore grid revision")
+			return
+		}
+
+		response.NoContent(w, r)
+	})
+
+	mux.HandleFunc("GET /{id}/collaborators", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("listing grid collaborators", kvlog.WithKV("id", id))
+
+		collaborators, err := srv.ListCollaborators(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to list grid collaborators")
+			return
+		}
+
+		dtos := make([]CollaboratorDTO, len(collaborators))
+		for i, c := range collaborators {
+			dtos[i] = CollaboratorDTO(c)
+		}
+
+		response.JSON(w, r, dtos)
+	})
+
+	mux.HandleFunc("PUT /{id}/collaborators/{principalID}", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		principalID := r.PathValue("principalID")
+
+		dto, err := jsonbody.Read[GrantDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return
+		}
+
+		logger.Logs("granting grid role", kvlog.WithKV("id", id), kvlog.WithKV("principalID", principalID), kvlog.WithKV("role", dto.Role))
+
+		if err := srv.Grant(r.Context(), id, principalID, dto.Role); err != nil {
+			if errors.Is(err, ErrInvalidRole) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			handleServiceError(w, r, err, "failed to grant grid role")
+			return
+		}
+
+		response.NoContent(w, r)
+	})
+
+	mux.HandleFunc("DELETE /{id}/collaborators/{principalID}", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		principalID := r.PathValue("principalID")
+
+		logger.Logs("revoking grid role", kvlog.WithKV("id", id), kvlog.WithKV("principalID", principalID))
+
+		if err := srv.Revoke(r.Context(), id, principalID); err != nil {
+			handleServiceError(w, r, err, "failed to revoke grid role")
+			return
+		}
+
+		response.NoContent(w, r)
+	})
+
+	mux.HandleFunc("POST /{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		dto, err := jsonbody.Read[CreateShareDTO](w, r)
+		if err != nil {
+			// Error has already been handled
+			return
+		}
+
+		var expires time.Time
+		if dto.Expires != "" {
+			expires, err = time.Parse(time.RFC3339, dto.Expires)
+			if err != nil {
+				http.Error(w, "invalid expires", http.StatusBadRequest)
+				return
+			}
+		}
+
+		logger.Logs("creating grid share", kvlog.WithKV("id", id), kvlog.WithKV("role", dto.Role))
+
+		share, err := srv.CreateShare(r.Context(), id, dto.Role, expires, dto.MaxUses)
+		if err != nil {
+			if errors.Is(err, ErrInvalidRole) || errors.Is(err, ErrInvalidShare) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			handleServiceError(w, r, err, "failed to create grid share")
+			return
+		}
+
+		response.JSON(w, r, toShareDTO(share), response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("GET /{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("listing grid shares", kvlog.WithKV("id", id))
+
+		shares, err := srv.ListShares(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to list grid shares")
+			return
+		}
+
+		dtos := make([]ShareDTO, len(shares))
+		for i, share := range shares {
+			dtos[i] = toShareDTO(share)
+		}
+
+		response.JSON(w, r, dtos)
+	})
+
+	mux.HandleFunc("DELETE /{id}/shares/{token}", func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("revoking grid share", kvlog.WithKV("id", id))
+
+		if err := srv.RevokeShare(r.Context(), id, r.PathValue("token")); err != nil {
+			handleServiceError(w, r, err, "failed to revoke grid share")
+			return
+		}
+
+		response.NoContent(w, r)
+	})
+
+	// Pass the share token given as a query parameter to the service.
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("share"); token != "" {
+			r = r.WithContext(ContextWithShareToken(r.Context(), token))
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// renderCacheSize is the number of rendered images kept in memory.
+const renderCacheSize = 128
+
+// anonymousRenderID is the id used to render the grid descriptor given as the
+// descriptor query parameter instead of a stored grid.
+const anonymousRenderID = "render"
+
+// maxNonceLength is the maximum length of nonces mixed into fair rolls.
+const maxNonceLength = 256
+
+// serveRendering renders the grid identified by id using format. Renderings
+// of stored grids are cached by grid version.
+func serveRendering(w http.ResponseWriter, r *http.Request, srv *GridService, cache *renderCache, id string, format renderFormat) {
+	logger := kvlog.FromContext(r.Context())
+
+	params, render, err := format.prepare(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var g Grid
+	if id == anonymousRenderID {
+		g.Descriptor = r.URL.Query().Get("descriptor")
+	} else {
+		logger.Logs("rendering grid", kvlog.WithKV("id", id), kvlog.WithKV("contentType", format.contentType))
+
+		g, err = srv.Load(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to load grid")
+			return
+		}
+	}
+
+	key := renderCacheKey(g, format.contentType, params)
+	data, ok := cache.get(key)
+	if !ok || id == anonymousRenderID {
+		l, err := ParseLayout(g.Descriptor)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		data, err = render(g.Label, l)
+		if err != nil {
+			if errors.Is(err, ErrInvalidRenderParameter) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			logger.Logs("failed to render grid", kvlog.WithKV("id", id), kvlog.WithErr(err))
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if id != anonymousRenderID {
+			cache.put(key, data)
+		}
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// handleServiceError sends the HTTP response matching err returned from a
+// GridService operation. Unexpected errors are logged using msg.
+func handleServiceError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, ErrForbidden):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, ErrInvalidID):
+		http.Error(w, "invalid id", http.StatusBadRequest)
+	default:
+		kvlog.FromContext(r.Context()).Logs(msg, kvlog.WithKV("id", r.PathValue("id")), kvlog.WithErr(err))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// intPathValue returns the path value name parsed as an int. If the value is
+// not a valid int a bad request response is sent and ok is false.
+func intPathValue(w http.ResponseWriter, r *http.Request, name string) (v int, ok bool) {
+	v, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid %s", name), http.StatusBadRequest)
+		return 0, false
+	}
+	return v, true
+}
+
+// intQueryValue returns the query parameter name parsed as an int or def if
+// the parameter is not given. If the value is not a valid int a bad request
+// response is sent and ok is false.
+func intQueryValue(w http.ResponseWriter, r *http.Request, name string, def int) (v int, ok bool) {
+	q := r.URL.Query()
+	if !q.Has(name) {
+		return def, true
+	}
+
+	v, err := strconv.Atoi(q.Get(name))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid %s", name), http.StatusBadRequest)
+		return 0, false
+	}
+
+	return v, true
+}
+
+// handleCombatError sends a 404 if no combat is running and a 400 for invalid
+// combat updates. All other errors are delegated to handleServiceError.
+func handleCombatError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	if errors.Is(err, ErrNoCombat) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, ErrInvalidCombat) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	handleServiceError(w, r, err, msg)
+}
+
+// handleFairnessError sends a 409 for operations conflicting with the state
+// of a fair session. All other errors are delegated to handleServiceError.
+func handleFairnessError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	if errors.Is(err, ErrFairSessionActive) || errors.Is(err, ErrFairSessionNotRevealed) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	handleServiceError(w, r, err, msg)
+}
+
+// cellQueryValue parses the query parameter name as a cell given as
+// "<col>,<row>".
+func cellQueryValue(w http.ResponseWriter, r *http.Request, name string) (c geometry.Cell, ok bool) {
+	c, err := geometry.ParseCell(r.URL.Query().Get(name))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid %s", name), http.StatusBadRequest)
+		return c, false
+	}
+	return c, true
+}
+
+// sightOptions parses the query parameter openDoors.
+func sightOptions(r *http.Request) geometry.SightOptions {
+	openDoors, _ := strconv.ParseBool(r.URL.Query().Get("openDoors"))
+	return geometry.SightOptions{OpenDoors: openDoors}
+}
+
+// handleGeometryError sends a 400 for invalid geometry requests and delegates
+// to handleServiceError otherwise.
+func handleGeometryError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	if errors.Is(err, geometry.ErrInvalidCell) || errors.Is(err, geometry.ErrInvalidTemplate) || errors.Is(err, ErrInvalidDescriptor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	handleServiceError(w, r, err, msg)
+}
+
+// readValues reads the grid values from r's body. The body is either a
+// WriteDTO or - when sent using StructuredMediaType - a StructuredWriteDTO.
+func readValues(w http.ResponseWriter, r *http.Request) (Values, error) {
+	if !isStructured(r) {
+		dto, err := jsonbody.Read[WriteDTO](w, r)
+		return Values(dto), err
+	}
+
+	dto, err := jsonbody.Read[StructuredWriteDTO](w, r, StructuredMediaType)
+	if err != nil {
+		return Values{}, err
+	}
+
+	vals, err := dto.Values()
+	if err != nil {
+		kvlog.FromContext(r.Context()).Logs("invalid structured grid", kvlog.WithErr(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return Values{}, err
+	}
+
+	return vals, nil
+}
+
+func toDTO(g Grid) ReadDTO {
+	return ReadDTO{
+		WriteDTO: WriteDTO{
+			Label:      g.Label,
+			Descriptor: g.Descriptor,
+		},
+		ID:           g.ID(),
+		LastModified: g.LastModified.Format(time.RFC3339),
+		Version:      g.Version,
+		Fog:          toCellDTOs(g.Fog),
+	}
+}
+
+func toCellDTOs(cells []Cell) []CellDTO {
+	if len(cells) == 0 {
+		return nil
+	}
+
+	dtos := make([]CellDTO, len(cells))
+	for i, c := range cells {
+		dtos[i] = CellDTO(c)
+	}
+	return dtos
+}
+
+func toAreas(dtos []AreaDTO) []Area {
+	areas := make([]Area, len(dtos))
+	for i, dto := range dtos {
+		areas[i] = Area(dto)
+	}
+	return areas
+}
+
+func toRollDTO(roll Roll) RollDTO {
+	return RollDTO{
+		ResultDTO: dice.ToResultDTO(roll.Result),
+		Number:    roll.Number,
+		Created:   roll.Created.Format(time.RFC3339),
+		Roller:    roll.Roller,
+		Private:   roll.Private,
+		Session:   roll.Session,
+		Nonce:     roll.Nonce,
+	}
+}
+
+func toFairSessionDTO(s FairSession) FairSessionDTO {
+	dto := FairSessionDTO{
+		Commitment: s.Commitment,
+		Seed:       hex.EncodeToString(s.Seed),
+		Started:    s.Started.Format(time.RFC3339),
+	}
+	if s.IsRevealed() {
+		dto.Revealed = s.Revealed.Format(time.RFC3339)
+	}
+	return dto
+}
+
+func toCombatDTO(c Combat) CombatDTO {
+	dto := CombatDTO{
+		Combatants: make([]CombatantDTO, len(c.Combatants)),
+		Round:      c.Round,
+		Turn:       c.Turn,
+		Expired:    toExpiredConditionDTOs(c.Expired),
+	}
+	for i, cb := range c.Combatants {
+		dto.Combatants[i] = CombatantDTO{
+			ID:         cb.ID,
+			Name:       cb.Name,
+			Initiative: cb.Initiative,
+			Modifier:   cb.Modifier,
+			Player:     cb.Player,
+			Status:     cb.Status,
+			Trigger:    cb.Trigger,
+		}
+		for _, cond := range cb.Conditions {
+			dto.Combatants[i].Conditions = append(dto.Combatants[i].Conditions, toConditionDTO(cond))
+		}
+	}
+	for _, tc := range c.Tokens {
+		dto.Tokens = append(dto.Tokens, TokenConditionDTO{
+			Cell:      CellDTO(tc.Cell),
+			Condition: toConditionDTO(tc.Condition),
+		})
+	}
+	return dto
+}
+
+func fromCombatantDTO(dto CombatantDTO) Combatant {
+	return Combatant{
+		ID:         dto.ID,
+		Name:       dto.Name,
+		Initiative: dto.Initiative,
+		Modifier:   dto.Modifier,
+		Player:     dto.Player,
+		Status:     dto.Status,
+		Trigger:    dto.Trigger,
+	}
+}
+
+func toConditionDTO(c Condition) ConditionDTO {
+	return ConditionDTO{
+		ID:               c.ID,
+		Name:             c.Name,
+		Rounds:           c.Rounds,
+		Anchor:           c.Anchor,
+		UntilEndOfTurnOf: c.UntilEndOfTurnOf,
+	}
+}
+
+func fromConditionDTO(dto ConditionDTO) Condition {
+	return Condition{
+		Name:             dto.Name,
+		Rounds:           dto.Rounds,
+		Anchor:           dto.Anchor,
+		UntilEndOfTurnOf: dto.UntilEndOfTurnOf,
+	}
+}
+
+func toExpiredConditionDTOs(expired []ExpiredCondition) []ExpiredConditionDTO {
+	if len(expired) == 0 {
+		return nil
+	}
+
+	dtos := make([]ExpiredConditionDTO, len(expired))
+	for i, e := range expired {
+		dtos[i] = ExpiredConditionDTO{
+			Combatant: e.Combatant,
+			Condition: toConditionDTO(e.Condition),
+		}
+		if e.Cell != nil {
+			cell := CellDTO(*e.Cell)
+			dtos[i].Cell = &cell
+		}
+	}
+	return dtos
+}
+
+func toPatchDTO(p Patch) PatchDTO {
+	dto := PatchDTO{
+		Version:    p.Version,
+		Operations: make([]OperationDTO, len(p.Operations)),
+	}
+
+	for i, op := range p.Operations {
+		dto.Operations[i] = OperationDTO(op)
+	}
+
+	return dto
+}
+
+func toShareDTO(s Share) ShareDTO {
+	dto := ShareDTO{
+		Token:   s.Token,
+		Role:    s.Role,
+		Created: s.Created.Format(time.RFC3339),
+		MaxUses: s.MaxUses,
+		Uses:    s.Uses,
+	}
+
+	if !s.Expires.IsZero() {
+		dto.Expires = s.Expires.Format(time.RFC3339)
+	}
+
+	return dto
+}
+
+func toRevisionDTO(rev Revision) RevisionDTO {
+	return RevisionDTO{
+		WriteDTO: WriteDTO{
+			Label:      rev.Label,
+			Descriptor: rev.Descriptor,
+		},
+		Number:  rev.Number,
+		Created: rev.Created.Format(time.RFC3339),
+	}
+}
+
+func toDiffDTO(d Diff) DiffDTO {
+	dto := DiffDTO{
+		From: DiffSideDTO{
+			Number: d.From.Number,
+			Label:  d.From.Label,
+			Cols:   d.FromLayout.Cols,
+			Rows:   d.FromLayout.Rows,
+		},
+		To: DiffSideDTO{
+			Number: d.To.Number,
+			Label:  d.To.Label,
+			Cols:   d.ToLayout.Cols,
+			Rows:   d.ToLayout.Rows,
+		},
+		Cells: make([]CellChangeDTO, len(d.Cells)),
+	}
+
+	for i, c := range d.Cells {
+		dto.Cells[i] = CellChangeDTO{
+			Col:    c.Col,
+			Row:    c.Row,
+			Before: toCellStateDTO(c.Before),
+			After:  toCellStateDTO(c.After),
+		}
+	}
+
+	return dto
+}
+
+func toCellStateDTO(s CellState) CellStateDTO {
+	dto := CellStateDTO{
+		Background: s.Background,
+	}
+
+	if s.Token != nil {
+		dto.Token = &TokenValueDTO{Symbol: s.Token.Symbol, Color: s.Token.Color}
+	}
+
+	if s.LeftWall != nil {
+		dto.LeftWall = &WallValueDTO{Kind: s.LeftWall.Symbol, Color: s.LeftWall.Color}
+	}
+
+	if s.TopWall != nil {
+		dto.TopWall = &WallValueDTO{Kind: s.TopWall.Symbol, Color: s.TopWall.Color}
+	}
+
+	return dto
 }
@@ -0,0 +1,216 @@
+package grid
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"image/color"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+// newOverlayTest stores a grid described by descriptor which viewers access
+// using the share token "token" and serves the grid handler.
+func newOverlayTest(t *testing.T, descriptor string, fog Fog) (*Repository, Grid, *httptest.Server) {
+	s := shelf.Open(nil)
+	t.Cleanup(func() { s.Close() })
+
+	repo := NewRepository(s)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Fog:          fog,
+		Values:       Values{Label: "test", Descriptor: descriptor},
+	}
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.Create(g))),
+		expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "token", Role: RoleViewer, Created: time.Now()}))),
+	)
+
+	srv := httptest.NewServer(Handler(NewService(repo)))
+	t.Cleanup(srv.Close)
+
+	return repo, g, srv
+}
+
+// getOverlay requests the overlay of the test grid and returns the response
+// along with a reader for its frames.
+func getOverlay(t *testing.T, ctx context.Context, srv *httptest.Server, query string) (*http.Response, *multipart.Reader) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/owner:grid/overlay.png?share=token&"+query, nil)
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	res, err := http.DefaultClient.Do(req)
+	expect.That(t, expect.FailNow(is.NoError(err)))
+	t.Cleanup(func() { res.Body.Close() })
+
+	_, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	return res, multipart.NewReader(res.Body, params["boundary"])
+}
+
+func TestHandler_overlay_viewer(t *testing.T) {
+	repo, g, srv := newOverlayTest(t, "2x1:-2:br2:-4", Fog(nil).Hide(Cell{Col: 1, Row: 0}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res, frames := getOverlay(t, ctx, srv, "cell=20")
+	expect.That(t, is.EqualTo(res.StatusCode, http.StatusOK))
+
+	readFrame := func() {
+		part, err := frames.NextPart()
+		expect.That(t, expect.FailNow(is.NoError(err)))
+
+		// Frames are streamed, so the part only ends once the next frame is
+		// sent. Content-Length tells the size of the current one.
+		size, err := strconv.Atoi(part.Header.Get("Content-Length"))
+		expect.That(t, expect.FailNow(is.NoError(err)))
+
+		data := make([]byte, size)
+		_, err = io.ReadFull(part, data)
+		expect.That(t, expect.FailNow(is.NoError(err)))
+
+		img, err := png.Decode(bytes.NewReader(data))
+		expect.That(t,
+			expect.FailNow(is.NoError(err)),
+			is.EqualTo(color.RGBAModel.Convert(img.At(10, 10)).(color.RGBA), tokenFillColor(ColorRed)),
+			// The token hidden by fog is not shown to viewers.
+			is.EqualTo(color.RGBAModel.Convert(img.At(30, 10)).(color.RGBA), canvasColor),
+		)
+	}
+
+	readFrame()
+
+	g.Version++
+	g.Label = "changed"
+	expect.That(t, expect.FailNow(is.NoError(repo.Update(g))))
+
+	readFrame()
+}
+
+func TestHandler_overlay_renderError(t *testing.T) {
+	// The grid is too large to be rendered with 200 pixels per cell.
+	repo, g, srv := newOverlayTest(t, "100x1:-100:-100:-200", nil)
+
+	res, frames := getOverlay(t, context.Background(), srv, "cell=200")
+	_, err := frames.NextPart()
+	expect.That(t,
+		is.EqualTo(res.StatusCode, http.StatusOK),
+		is.Error(err, io.EOF),
+	)
+
+	// The ended subscription must not block changing the grid.
+	done := make(chan error)
+	go func() {
+		for range 20 {
+			g.Version++
+			if err := repo.Update(g); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		expect.That(t, is.NoError(err))
+	case <-time.After(5 * time.Second):
+		t.Fatal("updating the grid blocked")
+	}
+}
+
+func TestHandler_subscribe_patches(t *testing.T) {
+	repo, g, srv := newOverlayTest(t, "1x1:-1:-1:-2", nil)
+	expect.That(t, expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "gm", Role: RoleEditor, Created: time.Now()}))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscribe := func(query string) *bufio.Scanner {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/owner:grid/subscribe?share=gm"+query, nil)
+		expect.That(t, expect.FailNow(is.NoError(err)))
+
+		res, err := http.DefaultClient.Do(req)
+		expect.That(t, expect.FailNow(is.NoError(err)))
+		t.Cleanup(func() { res.Body.Close() })
+
+		return bufio.NewScanner(res.Body)
+	}
+
+	// readEvent returns the name of the next event received.
+	readEvent := func(events *bufio.Scanner) string {
+		var name string
+		for events.Scan() {
+			line := events.Text()
+			if line == "" {
+				return name
+			}
+			if n, ok := strings.CutPrefix(line, "event: "); ok {
+				name = n
+			}
+		}
+		t.Fatal("subscription ended")
+		return ""
+	}
+
+	patches := subscribe("&patches=true")
+	grids := subscribe("")
+	expect.That(t,
+		is.EqualTo(readEvent(patches), ""),
+		is.EqualTo(readEvent(grids), ""),
+	)
+
+	g.Version++
+	g.Descriptor = "1x1:-1:xy1:-2"
+	expect.That(t, expect.FailNow(is.NoError(repo.Patch(g, []Operation{{Type: OpPlaceToken, Symbol: SymbolStar, Color: ColorYellow}}))))
+
+	g.Version++
+	g.Label = "renamed"
+	expect.That(t, expect.FailNow(is.NoError(repo.Update(g))))
+
+	// Each change is delivered exactly once.
+	expect.That(t,
+		is.EqualTo(readEvent(patches), "patch"),
+		is.EqualTo(readEvent(patches), ""),
+		is.EqualTo(readEvent(grids), ""),
+		is.EqualTo(readEvent(grids), ""),
+	)
+}
+
+func TestHandler_get_vary(t *testing.T) {
+	_, _, srv := newOverlayTest(t, "1x1:-1:-1:-2", nil)
+
+	for _, accept := range []string{"", StructuredMediaType} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/owner:grid?share=token", nil)
+		expect.That(t, expect.FailNow(is.NoError(err)))
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		expect.That(t, expect.FailNow(is.NoError(err)))
+		res.Body.Close()
+
+		expect.That(t,
+			is.EqualTo(res.StatusCode, http.StatusOK),
+			is.EqualTo(res.Header.Get("Vary"), "Accept"),
+		)
+	}
+}
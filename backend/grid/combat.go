@@ -0,0 +1,411 @@
+package grid
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/halimath/d20-tools/infra/random"
+)
+
+// CombatantStatus defines whether a combatant takes its turn as usual.
+type CombatantStatus string
+
+const (
+	// StatusActive combatants take their turns in initiative order.
+	StatusActive CombatantStatus = ""
+	// StatusDelayed combatants have delayed their turn. They are skipped until
+	// they act.
+	StatusDelayed CombatantStatus = "delayed"
+	// StatusReady combatants have readied an action for a trigger. The readied
+	// action expires when their next turn starts.
+	StatusReady CombatantStatus = "ready"
+)
+
+// Combatant is a single participant of a combat.
+type Combatant struct {
+	ID         string
+	Name       string
+	Initiative int
+	// Modifier is the initiative modifier used to break ties.
+	Modifier int
+	// Player marks player characters, which act before non player characters
+	// with the same initiative and modifier.
+	Player bool
+	Status CombatantStatus
+	// Trigger describes the trigger of a readied action.
+	Trigger string
+	// Conditions lists the conditions affecting the combatant.
+	Conditions []Condition
+}
+
+// compareInitiative orders combatants by initiative, breaking ties by
+// modifier, players before non players, name and finally id.
+func compareInitiative(a, b Combatant) int {
+	if c := cmp.Compare(b.Initiative, a.Initiative); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(b.Modifier, a.Modifier); c != 0 {
+		return c
+	}
+	if a.Player != b.Player {
+		if a.Player {
+			return -1
+		}
+		return 1
+	}
+	if c := strings.Compare(a.Name, b.Name); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// Combat tracks initiative order, rounds and turns of a combat taking place on
+// a grid.
+type Combat struct {
+	// Combatants contains all combatants in turn order.
+	Combatants []Combatant
+	// Round counts the rounds starting with 1.
+	Round int
+	// Turn is the index of the combatant whose turn it is.
+	Turn int
+	// Tokens lists the conditions affecting tokens on the grid.
+	Tokens []TokenCondition
+	// Expired lists the conditions which ended when the turn passed last.
+	Expired []ExpiredCondition
+}
+
+var (
+	ErrInvalidCombat = errors.New("invalid combat")
+
+	// ErrNoCombat is returned when modifying a grid's combat while no combat
+	// is running.
+	ErrNoCombat = errors.New("no combat")
+)
+
+// NewCombat starts a new combat with combatants in initiative order. The first
+// round starts with the first combatant's turn.
+func NewCombat(combatants []Combatant) (Combat, error) {
+	c := Combat{Round: 1}
+
+	for _, cb := range combatants {
+		if err := c.Add(cb); err != nil {
+			return Combat{}, err
+		}
+	}
+
+	c.Turn = 0
+	return c, nil
+}
+
+// Current returns the combatant whose turn it is.
+func (c *Combat) Current() (Combatant, bool) {
+	if c.Turn < 0 || c.Turn >= len(c.Combatants) {
+		return Combatant{}, false
+	}
+	return c.Combatants[c.Turn], true
+}
+
+func (c *Combat) indexOf(id string) int {
+	return slices.IndexFunc(c.Combatants, func(cb Combatant) bool { return cb.ID == id })
+}
+
+// Add adds cb in initiative order. If cb has no id, one is generated. The
+// turn stays with the current combatant.
+func (c *Combat) Add(cb Combatant) error {
+	if strings.TrimSpace(cb.Name) == "" {
+		return fmt.Errorf("%w: missing name", ErrInvalidCombat)
+	}
+
+	if cb.ID == "" {
+		cb.ID = random.ID(8)
+	} else if c.indexOf(cb.ID) >= 0 {
+		return fmt.Errorf("%w: duplicate combatant %q", ErrInvalidCombat, cb.ID)
+	}
+
+	cb.Status = StatusActive
+	cb.Trigger = ""
+	cb.Conditions = nil
+
+	idx, _ := slices.BinarySearchFunc(c.Combatants, cb, compareInitiative)
+	c.Combatants = slices.Insert(c.Combatants, idx, cb)
+
+	if idx <= c.Turn && len(c.Combatants) > 1 {
+		c.Turn++
+	}
+
+	return nil
+}
+
+// Remove removes the combatant identified by id. If it is the removed
+// combatant's turn, the turn passes to the next combatant not delaying its
+// turn and conditions are counted down like Next does. Conditions lasting
+// until the end of the removed combatant's turn expire.
+func (c *Combat) Remove(id string) error {
+	idx := c.indexOf(id)
+	if idx < 0 {
+		return ErrNotFound
+	}
+
+	c.Combatants = slices.Delete(c.Combatants, idx, idx+1)
+
+	c.expireConditions(func(cond *Condition) bool {
+		return cond.UntilEndOfTurnOf == id
+	})
+
+	if len(c.Combatants) == 0 {
+		c.Turn = 0
+		return nil
+	}
+
+	switch {
+	case idx < c.Turn:
+		c.Turn--
+	case idx == c.Turn:
+		// Pass the turn on like Next does, skipping delayed combatants.
+		round := c.Round
+		c.Turn--
+		c.advance()
+
+		started, _ := c.Current()
+		c.tickConditions(id, started.ID, c.Round > round)
+	}
+
+	return nil
+}
+
+// Next passes the turn to the next combatant not delaying its turn, starting a
+// new round after the last one. A readied action expires when the turn passes
+// to the combatant who readied it. Conditions are counted down and those
+// ending are recorded in Expired.
+func (c *Combat) Next() {
+	c.Expired = nil
+
+	if len(c.Combatants) == 0 {
+		return
+	}
+
+	ended, _ := c.Current()
+	round := c.Round
+
+	c.advance()
+
+	started, _ := c.Current()
+	c.tickConditions(ended.ID, started.ID, c.Round > round)
+}
+
+func (c *Combat) advance() {
+	for range c.Combatants {
+		c.Turn++
+		if c.Turn >= len(c.Combatants) {
+			c.Turn = 0
+			c.Round++
+		}
+
+		cb := &c.Combatants[c.Turn]
+		if cb.Status == StatusReady {
+			cb.Status = StatusActive
+			cb.Trigger = ""
+		}
+		if cb.Status != StatusDelayed {
+			return
+		}
+	}
+}
+
+// Previous passes the turn back to the previous combatant not delaying its
+// turn. It never goes back beyond the first turn of the first round.
+func (c *Combat) Previous() {
+	if len(c.Combatants) == 0 {
+		return
+	}
+
+	for range c.Combatants {
+		if c.Turn == 0 && c.Round <= 1 {
+			return
+		}
+
+		c.Turn--
+		if c.Turn < 0 {
+			c.Turn = len(c.Combatants) - 1
+			c.Round--
+		}
+
+		if c.Combatants[c.Turn].Status != StatusDelayed {
+			return
+		}
+	}
+}
+
+// Delay delays the turn of the current combatant identified by id. The turn
+// passes to the next combatant.
+func (c *Combat) Delay(id string) error {
+	if err := c.checkCurrent(id); err != nil {
+		return err
+	}
+
+	c.Combatants[c.Turn].Status = StatusDelayed
+	c.Next()
+	return nil
+}
+
+// Ready readies an action of the current combatant identified by id for the
+// given trigger. The turn passes to the next combatant.
+func (c *Combat) Ready(id, trigger string) error {
+	if err := c.checkCurrent(id); err != nil {
+		return err
+	}
+
+	c.Combatants[c.Turn].Status = StatusReady
+	c.Combatants[c.Turn].Trigger = trigger
+	c.Next()
+	return nil
+}
+
+// Act lets a delayed or ready combatant identified by id act now. The
+// combatant takes the current combatant's initiative and modifier and is moved
+// right after the current combatant. A delayed combatant takes the turn, while
+// a ready combatant uses its readied action and the turn stays with the
+// current combatant.
+func (c *Combat) Act(id string) error {
+	idx := c.indexOf(id)
+	if idx < 0 {
+		return ErrNotFound
+	}
+
+	cb := c.Combatants[idx]
+	if cb.Status == StatusActive {
+		return fmt.Errorf("%w: combatant %q is neither delaying nor ready", ErrInvalidCombat, id)
+	}
+
+	current, _ := c.Current()
+
+	c.Combatants = slices.Delete(c.Combatants, idx, idx+1)
+
+	delayed := cb.Status == StatusDelayed
+	cb.Status = StatusActive
+	cb.Trigger = ""
+	cb.Initiative = current.Initiative
+	cb.Modifier = current.Modifier
+
+	// Ties are not broken by compareInitiative, as the combatant must neither
+	// act before the current combatant nor skip anyone.
+	if i := c.indexOf(current.ID); i >= 0 {
+		idx = i + 1
+	}
+	c.Combatants = slices.Insert(c.Combatants, idx, cb)
+
+	if delayed {
+		// The turn passes from the current combatant to the acting one.
+		c.Turn = idx
+		c.tickConditions(current.ID, cb.ID, false)
+	} else {
+		// Keep the turn with the current combatant.
+		c.Turn = c.indexOf(current.ID)
+	}
+
+	return nil
+}
+
+func (c *Combat) checkCurrent(id string) error {
+	if c.indexOf(id) < 0 {
+		return ErrNotFound
+	}
+
+	if current, ok := c.Current(); !ok || current.ID != id {
+		return fmt.Errorf("%w: it is not the turn of combatant %q", ErrInvalidCombat, id)
+	}
+
+	return nil
+}
+
+// Combat loads the combat running on the grid identified by id. It returns
+// ErrNoCombat if no combat is running. Viewers don't see the conditions of
+// tokens placed on hidden cells.
+func (svc *GridService) Combat(ctx context.Context, id string) (Combat, error) {
+	grid, share, err := svc.authorize(ctx, id, RoleViewer)
+	if err != nil {
+		return Combat{}, err
+	}
+
+	c, err := svc.repo.LoadCombat(grid.ownerID, grid.id)
+	if err != nil {
+		return Combat{}, err
+	}
+
+	if !svc.seesFog(ctx, grid, share) {
+		c = c.PlayerView(grid.Fog)
+	}
+
+	return c, nil
+}
+
+// StartCombat starts a new combat on the grid identified by id replacing any
+// running combat. Only owner and editors may manage combats.
+func (svc *GridService) StartCombat(ctx context.Context, id string, combatants []Combatant) (Combat, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return Combat{}, err
+	}
+
+	c, err := NewCombat(combatants)
+	if err != nil {
+		return Combat{}, err
+	}
+
+	return c, svc.repo.SaveCombat(grid.ownerID, grid.id, c)
+}
+
+// EndCombat ends the combat running on the grid identified by id.
+func (svc *GridService) EndCombat(ctx context.Context, id string) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	if _, err := svc.repo.LoadCombat(grid.ownerID, grid.id); err != nil {
+		return err
+	}
+
+	return svc.repo.DeleteCombat(grid.ownerID, grid.id)
+}
+
+// UpdateCombat applies update to the combat running on the grid identified by
+// id and stores the result which is broadcasted to all subscribers of the
+// grid.
+func (svc *GridService) UpdateCombat(ctx context.Context, id string, update func(*Combat) error) (Combat, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return Combat{}, err
+	}
+
+	return svc.updateCombat(grid, update)
+}
+
+func (svc *GridService) updateCombat(grid Grid, update func(*Combat) error) (Combat, error) {
+	c, err := svc.repo.LoadCombat(grid.ownerID, grid.id)
+	if err != nil {
+		return Combat{}, err
+	}
+
+	// Expired conditions are only reported for the update ending them.
+	c.Expired = nil
+
+	if err := update(&c); err != nil {
+		return Combat{}, err
+	}
+
+	return c, svc.repo.SaveCombat(grid.ownerID, grid.id, c)
+}
@@ -0,0 +1,276 @@
+package grid
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func newTestCombat(t *testing.T) Combat {
+	c, err := NewCombat([]Combatant{
+		{ID: "a", Name: "Goblin", Initiative: 15, Modifier: 2},
+		{ID: "b", Name: "Fighter", Initiative: 15, Modifier: 2, Player: true},
+		{ID: "c", Name: "Rogue", Initiative: 15, Modifier: 3, Player: true},
+		{ID: "d", Name: "Orc", Initiative: 10},
+	})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+	return c
+}
+
+func combatantIDs(c Combat) []string {
+	ids := make([]string, len(c.Combatants))
+	for i, cb := range c.Combatants {
+		ids[i] = cb.ID
+	}
+	return ids
+}
+
+func TestNewCombat(t *testing.T) {
+	c := newTestCombat(t)
+
+	expect.That(t,
+		is.DeepEqualTo(combatantIDs(c), []string{"c", "b", "a", "d"}),
+		is.EqualTo(c.Round, 1),
+		is.EqualTo(c.Turn, 0),
+	)
+
+	_, err := NewCombat([]Combatant{{ID: "a"}})
+	expect.That(t, is.Error(err, ErrInvalidCombat))
+
+	_, err = NewCombat([]Combatant{{ID: "a", Name: "A"}, {ID: "a", Name: "B"}})
+	expect.That(t, is.Error(err, ErrInvalidCombat))
+}
+
+func TestCombat_NextPrevious(t *testing.T) {
+	c := newTestCombat(t)
+
+	c.Previous()
+	expect.That(t, is.EqualTo(c.Round, 1), is.EqualTo(c.Turn, 0))
+
+	for range 4 {
+		c.Next()
+	}
+	expect.That(t, is.EqualTo(c.Round, 2), is.EqualTo(c.Turn, 0))
+
+	c.Previous()
+	expect.That(t, is.EqualTo(c.Round, 1), is.EqualTo(c.Turn, 3))
+}
+
+func TestCombat_Add(t *testing.T) {
+	c := newTestCombat(t)
+	c.Next()
+
+	expect.That(t, expect.FailNow(is.NoError(c.Add(Combatant{Name: "Wizard", Initiative: 20}))))
+
+	current, _ := c.Current()
+	expect.That(t,
+		is.EqualTo(len(c.Combatants[0].ID), 8),
+		is.EqualTo(current.ID, "b"),
+	)
+}
+
+func TestCombat_Remove(t *testing.T) {
+	c := newTestCombat(t)
+	for range 3 {
+		c.Next()
+	}
+
+	expect.That(t,
+		is.Error(c.Remove("x"), ErrNotFound),
+		is.NoError(c.Remove("d")),
+		is.DeepEqualTo(combatantIDs(c), []string{"c", "b", "a"}),
+		is.EqualTo(c.Round, 2),
+		is.EqualTo(c.Turn, 0),
+	)
+}
+
+func TestCombat_Remove_current(t *testing.T) {
+	c := newTestCombat(t)
+	expect.That(t, expect.FailNow(is.NoError(c.Delay("c"))))
+	c.Next()
+	c.Next()
+
+	// The turn passes on to the orc and skips the delayed rogue when
+	// wrapping around.
+	expect.That(t,
+		expect.FailNow(is.NoError(c.Remove("d"))),
+		is.EqualTo(c.Combatants[c.Turn].ID, "b"),
+		is.EqualTo(c.Round, 2),
+	)
+
+	c = newTestCombat(t)
+	expect.That(t, expect.FailNow(is.NoError(c.Delay("c"))))
+	expect.That(t, expect.FailNow(is.NoError(c.Delay("b"))))
+
+	expect.That(t,
+		expect.FailNow(is.NoError(c.Remove("a"))),
+		is.DeepEqualTo(combatantIDs(c), []string{"c", "b", "d"}),
+		is.EqualTo(c.Combatants[c.Turn].ID, "d"),
+		is.EqualTo(c.Round, 1),
+	)
+}
+
+func TestCombat_Act_order(t *testing.T) {
+	c, err := NewCombat([]Combatant{
+		{ID: "a", Name: "Wizard", Initiative: 18, Modifier: 4},
+		{ID: "b", Name: "Goblin", Initiative: 12, Modifier: 2},
+		{ID: "c", Name: "Orc", Initiative: 12, Modifier: 0},
+		{ID: "d", Name: "Troll", Initiative: 5},
+	})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	expect.That(t, expect.FailNow(is.NoError(c.Delay("a"))))
+	c.Next()
+	expect.That(t, expect.FailNow(is.NoError(c.Act("a"))))
+
+	current, _ := c.Current()
+	expect.That(t,
+		is.DeepEqualTo(combatantIDs(c), []string{"b", "c", "a", "d"}),
+		is.EqualTo(current.ID, "a"),
+		is.EqualTo(current.Initiative, 12),
+		is.EqualTo(current.Modifier, 0),
+		is.EqualTo(slices.IsSortedFunc(c.Combatants, compareInitiative), true),
+	)
+
+	// Combatants added later are still placed in initiative order.
+	expect.That(t, expect.FailNow(is.NoError(c.Add(Combatant{ID: "e", Name: "Bard", Initiative: 12, Modifier: 1}))))
+	expect.That(t,
+		is.DeepEqualTo(combatantIDs(c), []string{"b", "e", "c", "a", "d"}),
+		is.EqualTo(c.Combatants[c.Turn].ID, "a"),
+	)
+
+	// The combatant acts after the current one even if it sorts before it by
+	// name.
+	c, err = NewCombat([]Combatant{
+		{ID: "a", Name: "Aaron", Initiative: 15},
+		{ID: "z", Name: "Zed", Initiative: 10},
+		{ID: "o", Name: "Orc", Initiative: 5},
+	})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	expect.That(t, expect.FailNow(is.NoError(c.Delay("a"))))
+	expect.That(t, expect.FailNow(is.NoError(c.Act("a"))))
+	c.Next()
+
+	current, _ = c.Current()
+	expect.That(t,
+		is.DeepEqualTo(combatantIDs(c), []string{"z", "a", "o"}),
+		is.EqualTo(current.ID, "o"),
+		is.EqualTo(c.Round, 1),
+	)
+}
+
+func TestCombat_Delay(t *testing.T) {
+	c := newTestCombat(t)
+
+	expect.That(t,
+		is.Error(c.Delay("a"), ErrInvalidCombat),
+		is.NoError(c.Delay("c")),
+	)
+
+	current, _ := c.Current()
+	expect.That(t, is.EqualTo(current.ID, "b"))
+
+	c.Next()
+	expect.That(t, expect.FailNow(is.NoError(c.Act("c"))))
+
+	current, _ = c.Current()
+	expect.That(t,
+		is.DeepEqualTo(combatantIDs(c), []string{"b", "a", "c", "d"}),
+		is.EqualTo(current.ID, "c"),
+		is.EqualTo(current.Status, StatusActive),
+		is.Error(c.Act("c"), ErrInvalidCombat),
+	)
+
+	// Delayed combatants are skipped.
+	expect.That(t, expect.FailNow(is.NoError(c.Delay("c"))))
+	for range 3 {
+		c.Next()
+	}
+	current, _ = c.Current()
+	expect.That(t, is.EqualTo(current.ID, "d"), is.EqualTo(c.Round, 2))
+}
+
+func TestCombat_Ready(t *testing.T) {
+	c := newTestCombat(t)
+
+	expect.That(t, expect.FailNow(is.NoError(c.Ready("c", "the orc moves"))))
+	c.Next()
+	expect.That(t, expect.FailNow(is.NoError(c.Act("c"))))
+
+	current, _ := c.Current()
+	expect.That(t,
+		is.DeepEqualTo(combatantIDs(c), []string{"b", "a", "c", "d"}),
+		is.EqualTo(current.ID, "a"),
+		is.EqualTo(c.Combatants[2].Status, StatusActive),
+	)
+
+	// Readied actions expire at the start of the owner's next turn.
+	c = newTestCombat(t)
+	expect.That(t, expect.FailNow(is.NoError(c.Ready("c", "the orc moves"))))
+	expect.That(t,
+		is.EqualTo(c.Combatants[0].Status, StatusReady),
+		is.EqualTo(c.Combatants[0].Trigger, "the orc moves"),
+	)
+
+	for range 3 {
+		c.Next()
+	}
+	expect.That(t,
+		is.EqualTo(c.Round, 2),
+		is.EqualTo(c.Combatants[0].Status, StatusActive),
+		is.EqualTo(c.Combatants[0].Trigger, ""),
+	)
+}
+
+func TestRepository_Combat(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "2x1:-2:-2:-4"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	_, err := repo.LoadCombat("owner", "grid")
+	expect.That(t, is.Error(err, ErrNoCombat))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sup := repo.Subscribe(ctx, "owner", "grid", nil, playerViewFilter)
+
+	c := newTestCombat(t)
+	c.Next()
+	expect.That(t, expect.FailNow(is.NoError(repo.SaveCombat("owner", "grid", c))))
+
+	started := <-sup.C()
+
+	loaded, err := repo.LoadCombat("owner", "grid")
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(loaded, c),
+	)
+
+	expect.That(t, expect.FailNow(is.NoError(repo.DeleteCombat("owner", "grid"))))
+
+	ended := <-sup.C()
+
+	expect.That(t,
+		is.EqualTo(started.Type, EventCombat),
+		is.DeepEqualTo(started.Combat, &c),
+		is.EqualTo(ended.Type, EventCombat),
+		is.EqualTo(ended.Combat == nil, true),
+	)
+}
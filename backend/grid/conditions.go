@@ -0,0 +1,305 @@
+package grid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/halimath/d20-tools/infra/random"
+)
+
+// Condition is a condition or effect, such as prone, stunned or concentrating,
+// affecting a combatant or a token. A condition lasts until it is removed
+// unless it has a duration in rounds or ends with a combatant's turn.
+type Condition struct {
+	ID   string
+	Name string
+	// Rounds is the number of rounds the condition lasts. It is counted down
+	// whenever the turn of the combatant identified by Anchor starts. Zero
+	// means the condition has no duration in rounds.
+	Rounds int
+	// Anchor identifies the combatant whose turns count down Rounds. It
+	// defaults to the combatant whose turn it is when the condition is added.
+	// If the anchor leaves the combat, Rounds are counted down at the start of
+	// every round.
+	Anchor string
+	// UntilEndOfTurnOf identifies the combatant at the end of whose next turn
+	// the condition ends.
+	UntilEndOfTurnOf string
+
+	// turnStarted records that the next turn of UntilEndOfTurnOf has started.
+	turnStarted bool
+}
+
+// TokenCondition is a condition affecting the token placed on a cell.
+type TokenCondition struct {
+	Cell      Cell
+	Condition Condition
+}
+
+// ExpiredCondition is a condition which ended as the turn passed.
+type ExpiredCondition struct {
+	Condition Condition
+	// Combatant is the id of the combatant affected by the condition. It is
+	// empty for token conditions.
+	Combatant string
+	// Cell is the cell of the token affected by the condition. It is nil for
+	// combatant conditions.
+	Cell *Cell
+}
+
+// prepareCondition validates cond and fills in its id and default anchor.
+func (c *Combat) prepareCondition(cond Condition) (Condition, error) {
+	cond.Name = strings.TrimSpace(cond.Name)
+	if cond.Name == "" {
+		return Condition{}, fmt.Errorf("%w: missing condition name", ErrInvalidCombat)
+	}
+	if cond.Rounds < 0 {
+		return Condition{}, fmt.Errorf("%w: negative duration", ErrInvalidCombat)
+	}
+	if cond.Rounds > 0 && cond.UntilEndOfTurnOf != "" {
+		return Condition{}, fmt.Errorf("%w: condition must not last both rounds and until the end of a turn", ErrInvalidCombat)
+	}
+	if cond.UntilEndOfTurnOf != "" && c.indexOf(cond.UntilEndOfTurnOf) < 0 {
+		return Condition{}, fmt.Errorf("%w: unknown combatant %q", ErrInvalidCombat, cond.UntilEndOfTurnOf)
+	}
+
+	if cond.Rounds > 0 {
+		if cond.Anchor == "" {
+			if current, ok := c.Current(); ok {
+				cond.Anchor = current.ID
+			}
+		} else if c.indexOf(cond.Anchor) < 0 {
+			return Condition{}, fmt.Errorf("%w: unknown combatant %q", ErrInvalidCombat, cond.Anchor)
+		}
+	} else {
+		cond.Anchor = ""
+	}
+
+	cond.ID = random.ID(8)
+	cond.turnStarted = false
+
+	return cond, nil
+}
+
+// AddCondition adds cond to the combatant identified by combatantID and
+// returns the added condition.
+func (c *Combat) AddCondition(combatantID string, cond Condition) (Condition, error) {
+	idx := c.indexOf(combatantID)
+	if idx < 0 {
+		return Condition{}, ErrNotFound
+	}
+
+	cond, err := c.prepareCondition(cond)
+	if err != nil {
+		return Condition{}, err
+	}
+
+	c.Combatants[idx].Conditions = append(c.Combatants[idx].Conditions, cond)
+	return cond, nil
+}
+
+// AddTokenCondition adds cond to the token placed on cell and returns the
+// added condition. The caller is responsible for checking that a token is
+// placed on cell.
+func (c *Combat) AddTokenCondition(cell Cell, cond Condition) (Condition, error) {
+	cond, err := c.prepareCondition(cond)
+	if err != nil {
+		return Condition{}, err
+	}
+
+	c.Tokens = append(c.Tokens, TokenCondition{Cell: cell, Condition: cond})
+	return cond, nil
+}
+
+// RemoveCondition removes the condition identified by id from either a
+// combatant or a token.
+func (c *Combat) RemoveCondition(id string) error {
+	for i := range c.Combatants {
+		cb := &c.Combatants[i]
+		if idx := slices.IndexFunc(cb.Conditions, func(cond Condition) bool { return cond.ID == id }); idx >= 0 {
+			cb.Conditions = slices.Delete(cb.Conditions, idx, idx+1)
+			return nil
+		}
+	}
+
+	if idx := slices.IndexFunc(c.Tokens, func(tc TokenCondition) bool { return tc.Condition.ID == id }); idx >= 0 {
+		c.Tokens = slices.Delete(c.Tokens, idx, idx+1)
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+// tickConditions counts down the conditions of all combatants and tokens as
+// the turn passes from the combatant identified by ended to the one
+// identified by started. newRound reports whether a new round has started.
+// Conditions which end are removed and recorded in c.Expired.
+func (c *Combat) tickConditions(ended, started string, newRound bool) {
+	expires := func(cond *Condition) bool {
+		if cond.UntilEndOfTurnOf != "" {
+			if cond.UntilEndOfTurnOf == ended && cond.turnStarted {
+				return true
+			}
+			if cond.UntilEndOfTurnOf == started {
+				cond.turnStarted = true
+			}
+		}
+
+		if cond.Rounds > 0 && (cond.Anchor == started || (newRound && c.indexOf(cond.Anchor) < 0)) {
+			cond.Rounds--
+			return cond.Rounds == 0
+		}
+
+		return false
+	}
+
+	c.expireConditions(expires)
+}
+
+// expireConditions removes the conditions of all combatants and tokens for
+// which expires returns true and records them in c.Expired. expires may update
+// the conditions passed to it.
+func (c *Combat) expireConditions(expires func(*Condition) bool) {
+	for i := range c.Combatants {
+		cb := &c.Combatants[i]
+		kept := cb.Conditions[:0]
+		for _, cond := range cb.Conditions {
+			if expires(&cond) {
+				c.Expired = append(c.Expired, ExpiredCondition{Condition: cond, Combatant: cb.ID})
+				continue
+			}
+			kept = append(kept, cond)
+		}
+		cb.Conditions = kept
+	}
+
+	kept := c.Tokens[:0]
+	for _, tc := range c.Tokens {
+		if expires(&tc.Condition) {
+			cell := tc.Cell
+			c.Expired = append(c.Expired, ExpiredCondition{Condition: tc.Condition, Cell: &cell})
+			continue
+		}
+		kept = append(kept, tc)
+	}
+	c.Tokens = kept
+}
+
+// followTokens moves token conditions along with the tokens moved by ops and
+// drops the conditions of tokens which have been removed or replaced. l is
+// the layout resulting from ops. followTokens reports whether any condition
+// has been changed.
+func (c *Combat) followTokens(ops []Operation, l Layout) bool {
+	if len(c.Tokens) == 0 {
+		return false
+	}
+
+	changed := false
+	drop := func(cell Cell) {
+		c.Tokens = slices.DeleteFunc(c.Tokens, func(tc TokenCondition) bool {
+			if tc.Cell == cell {
+				changed = true
+				return true
+			}
+			return false
+		})
+	}
+
+	for _, op := range ops {
+		switch op.Type {
+		case OpPlaceToken, OpRemoveToken:
+			drop(Cell{Col: op.Col, Row: op.Row})
+
+		case OpMoveToken:
+			from, to := Cell{Col: op.Col, Row: op.Row}, Cell{Col: op.ToCol, Row: op.ToRow}
+			if from == to {
+				continue
+			}
+			drop(to)
+			for i := range c.Tokens {
+				if c.Tokens[i].Cell == from {
+					c.Tokens[i].Cell = to
+					changed = true
+				}
+			}
+		}
+	}
+
+	c.Tokens = slices.DeleteFunc(c.Tokens, func(tc TokenCondition) bool {
+		if !l.Contains(tc.Cell.Col, tc.Cell.Row) || l.TokenAt(tc.Cell.Col, tc.Cell.Row) == nil {
+			changed = true
+			return true
+		}
+		return false
+	})
+
+	return changed
+}
+
+// followTokens updates the token conditions of the combat running on grid
+// after ops changed its layout to l. ops is nil if the grid's values have been
+// replaced as a whole, which keeps only the conditions of cells still holding
+// a token.
+func (svc *GridService) followTokens(grid Grid, ops []Operation, l Layout) error {
+	c, err := svc.repo.LoadCombat(grid.ownerID, grid.id)
+	if errors.Is(err, ErrNoCombat) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !c.followTokens(ops, l) {
+		return nil
+	}
+
+	c.Expired = nil
+	return svc.repo.SaveCombat(grid.ownerID, grid.id, c)
+}
+
+// AddTokenCondition adds cond to the token placed on cell of the grid
+// identified by id. A combat must be running on the grid.
+func (svc *GridService) AddTokenCondition(ctx context.Context, id string, cell Cell, cond Condition) (Combat, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return Combat{}, err
+	}
+
+	l, err := ParseLayout(grid.Descriptor)
+	if err != nil {
+		return Combat{}, err
+	}
+
+	if !l.Contains(cell.Col, cell.Row) || l.TokenAt(cell.Col, cell.Row) == nil {
+		return Combat{}, fmt.Errorf("%w: no token at %d/%d", ErrInvalidCombat, cell.Col, cell.Row)
+	}
+
+	return svc.updateCombat(grid, func(c *Combat) error {
+		_, err := c.AddTokenCondition(cell, cond)
+		return err
+	})
+}
+
+// PlayerView returns a copy of c without the conditions of tokens placed on
+// cells hidden by fog.
+func (c Combat) PlayerView(fog Fog) Combat {
+	c.Tokens = slices.DeleteFunc(slices.Clone(c.Tokens), func(tc TokenCondition) bool {
+		return fog.Hidden(tc.Cell.Col, tc.Cell.Row)
+	})
+	c.Expired = hideExpired(c.Expired, fog)
+	return c
+}
+
+// hideExpired returns the expired conditions not affecting tokens placed on
+// cells hidden by fog.
+func hideExpired(expired []ExpiredCondition, fog Fog) []ExpiredCondition {
+	return slices.DeleteFunc(slices.Clone(expired), func(e ExpiredCondition) bool {
+		return e.Cell != nil && fog.Hidden(e.Cell.Col, e.Cell.Row)
+	})
+}
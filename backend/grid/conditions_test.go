@@ -0,0 +1,381 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func conditionNames(cs []Condition) []string {
+	names := make([]string, len(cs))
+	for i, c := range cs {
+		names[i] = c.Name
+	}
+	return names
+}
+
+func TestCombat_AddCondition(t *testing.T) {
+	c := newTestCombat(t)
+
+	cond, err := c.AddCondition("a", Condition{Name: " prone "})
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(cond.Name, "prone"),
+		is.EqualTo(len(cond.ID), 8),
+		is.EqualTo(cond.Anchor, ""),
+		is.DeepEqualTo(c.Combatants[2].Conditions, []Condition{cond}),
+	)
+
+	cond, err = c.AddCondition("a", Condition{Name: "bless", Rounds: 10})
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(cond.Anchor, "c"),
+	)
+
+	_, err = c.AddCondition("x", Condition{Name: "prone"})
+	expect.That(t, is.Error(err, ErrNotFound))
+
+	for _, invalid := range []Condition{
+		{},
+		{Name: "bless", Rounds: -1},
+		{Name: "bless", Rounds: 1, UntilEndOfTurnOf: "a"},
+		{Name: "bless", Rounds: 1, Anchor: "x"},
+		{Name: "dodge", UntilEndOfTurnOf: "x"},
+	} {
+		_, err = c.AddCondition("a", invalid)
+		expect.That(t, is.Error(err, ErrInvalidCombat))
+	}
+
+	expect.That(t,
+		is.NoError(c.RemoveCondition(cond.ID)),
+		is.DeepEqualTo(conditionNames(c.Combatants[2].Conditions), []string{"prone"}),
+		is.Error(c.RemoveCondition(cond.ID), ErrNotFound),
+	)
+}
+
+func TestCombat_Next_rounds(t *testing.T) {
+	c := newTestCombat(t)
+	c.Next()
+
+	// Added during b's turn; lasts until the start of b's turn two rounds later.
+	cond, err := c.AddCondition("d", Condition{Name: "bless", Rounds: 2})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	for range 4 {
+		c.Next()
+		expect.That(t, is.DeepEqualTo(conditionNames(c.Combatants[3].Conditions), []string{"bless"}))
+	}
+
+	for range 3 {
+		c.Next()
+	}
+	expect.That(t,
+		is.EqualTo(c.Round, 3),
+		is.EqualTo(c.Turn, 0),
+		is.DeepEqualTo(conditionNames(c.Combatants[3].Conditions), []string{"bless"}),
+	)
+
+	c.Next()
+	expect.That(t,
+		is.EqualTo(len(c.Combatants[3].Conditions), 0),
+		is.DeepEqualTo(c.Expired, []ExpiredCondition{{Condition: Condition{ID: cond.ID, Name: "bless", Anchor: "b"}, Combatant: "d"}}),
+	)
+
+	c.Next()
+	expect.That(t, is.EqualTo(len(c.Expired), 0))
+}
+
+func TestCombat_Next_untilEndOfTurn(t *testing.T) {
+	c := newTestCombat(t)
+
+	// Added during c's own turn: lasts until the end of c's next turn.
+	_, err := c.AddCondition("c", Condition{Name: "dodge", UntilEndOfTurnOf: "c"})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	// Added during c's turn for b: ends with b's upcoming turn.
+	_, err = c.AddCondition("a", Condition{Name: "frightened", UntilEndOfTurnOf: "b"})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	c.Next()
+	expect.That(t, is.EqualTo(len(c.Expired), 0))
+
+	c.Next()
+	expect.That(t,
+		is.EqualTo(len(c.Expired), 1),
+		is.EqualTo(c.Expired[0].Condition.Name, "frightened"),
+		is.EqualTo(c.Expired[0].Combatant, "a"),
+	)
+
+	c.Next()
+	c.Next()
+	expect.That(t,
+		is.EqualTo(c.Round, 2),
+		is.DeepEqualTo(conditionNames(c.Combatants[0].Conditions), []string{"dodge"}),
+	)
+
+	c.Next()
+	expect.That(t,
+		is.EqualTo(len(c.Combatants[0].Conditions), 0),
+		is.EqualTo(len(c.Expired), 1),
+		is.EqualTo(c.Expired[0].Condition.Name, "dodge"),
+	)
+}
+
+func TestCombat_Next_removedAnchor(t *testing.T) {
+	c := newTestCombat(t)
+
+	_, err := c.AddCondition("a", Condition{Name: "hex", Rounds: 1, Anchor: "d"})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+	expect.That(t, expect.FailNow(is.NoError(c.Remove("d"))))
+
+	c.Next()
+	c.Next()
+	expect.That(t, is.EqualTo(len(c.Expired), 0))
+
+	c.Next()
+	expect.That(t,
+		is.EqualTo(c.Round, 2),
+		is.EqualTo(len(c.Expired), 1),
+	)
+}
+
+func TestCombat_followTokens(t *testing.T) {
+	l := NewLayout(3, 1)
+	for col := range 3 {
+		l.SetTokenAt(col, 0, &Token{Symbol: SymbolPawn, Color: ColorRed})
+	}
+
+	c := newTestCombat(t)
+	for col := range 3 {
+		_, err := c.AddTokenCondition(Cell{Col: col, Row: 0}, Condition{Name: "prone"})
+		expect.That(t, expect.FailNow(is.NoError(err)))
+	}
+	moved, removed := c.Tokens[0].Condition, c.Tokens[1].Condition
+
+	ops := []Operation{
+		{Type: OpRemoveToken, Col: 1, Row: 0},
+		{Type: OpMoveToken, Col: 0, Row: 0, ToCol: 1, ToRow: 0},
+		{Type: OpResize, Cols: 2, Rows: 1},
+	}
+
+	var err error
+	for _, op := range ops {
+		l, _, err = op.Apply(l, "")
+		expect.That(t, expect.FailNow(is.NoError(err)))
+	}
+
+	expect.That(t,
+		is.EqualTo(c.followTokens(ops, l), true),
+		is.DeepEqualTo(c.Tokens, []TokenCondition{{Cell: Cell{Col: 1, Row: 0}, Condition: moved}}),
+		is.EqualTo(c.RemoveCondition(removed.ID) != nil, true),
+		is.EqualTo(c.followTokens([]Operation{{Type: OpRename, Label: "x"}}, l), false),
+	)
+}
+
+func TestCombat_PlayerView(t *testing.T) {
+	c := newTestCombat(t)
+	for col := range 2 {
+		_, err := c.AddTokenCondition(Cell{Col: col, Row: 0}, Condition{Name: "prone", Rounds: 1})
+		expect.That(t, expect.FailNow(is.NoError(err)))
+	}
+	c.Next()
+	c.Next()
+	c.Next()
+	c.Next()
+
+	fog := Fog(nil).Hide(Cell{Col: 1, Row: 0})
+	v := c.PlayerView(fog)
+
+	expect.That(t,
+		is.EqualTo(len(c.Expired), 2),
+		is.EqualTo(len(v.Expired), 1),
+		is.DeepEqualTo(v.Expired[0].Cell, &Cell{Col: 0, Row: 0}),
+	)
+}
+
+func TestRepository_Combat_conditions(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Fog:          Fog(nil).Hide(Cell{Col: 1, Row: 0}),
+		Values:       Values{Label: "test", Descriptor: "2x1:-2:-2:-4"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sup := repo.Subscribe(ctx, "owner", "grid", nil, newPlayerViewFilter(g.Fog))
+
+	c := newTestCombat(t)
+	_, err := c.AddCondition("b", Condition{Name: "dodge", UntilEndOfTurnOf: "b"})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+	for col := range 2 {
+		_, err := c.AddTokenCondition(Cell{Col: col, Row: 0}, Condition{Name: "prone", Rounds: 1})
+		expect.That(t, expect.FailNow(is.NoError(err)))
+	}
+	c.Next()
+	expect.That(t, expect.FailNow(is.NoError(repo.SaveCombat("owner", "grid", c))))
+
+	loaded, err := repo.LoadCombat("owner", "grid")
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(loaded, c),
+	)
+
+	combat := <-sup.C()
+	expect.That(t,
+		is.EqualTo(combat.Type, EventCombat),
+		is.EqualTo(len(combat.Combat.Tokens), 1),
+	)
+
+	for range 3 {
+		c.Next()
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.SaveCombat("owner", "grid", c))))
+
+	<-sup.C()
+	expired := <-sup.C()
+	expect.That(t,
+		is.EqualTo(expired.Type, EventConditionsExpired),
+		is.DeepEqualTo(expired.Expired, []ExpiredCondition{{Condition: c.Expired[0].Condition, Cell: &Cell{Col: 0, Row: 0}}}),
+	)
+}
+
+func TestCombat_Remove_untilEndOfTurn(t *testing.T) {
+	c := newTestCombat(t)
+
+	cond, err := c.AddCondition("a", Condition{Name: "frightened", UntilEndOfTurnOf: "b"})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+	_, err = c.AddCondition("a", Condition{Name: "prone"})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	expect.That(t,
+		is.NoError(c.Remove("b")),
+		is.DeepEqualTo(conditionNames(c.Combatants[1].Conditions), []string{"prone"}),
+		is.DeepEqualTo(c.Expired, []ExpiredCondition{{Condition: cond, Combatant: "a"}}),
+	)
+}
+
+func TestCombat_Remove_current_conditions(t *testing.T) {
+	c, err := NewCombat([]Combatant{
+		{ID: "x", Name: "X", Initiative: 15},
+		{ID: "y", Name: "Y", Initiative: 10},
+		{ID: "z", Name: "Z", Initiative: 5},
+	})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	_, err = c.AddCondition("z", Condition{Name: "stunned", UntilEndOfTurnOf: "y"})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+	_, err = c.AddCondition("z", Condition{Name: "hex", Rounds: 2, Anchor: "y"})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	// Removing x starts y's turn.
+	expect.That(t, expect.FailNow(is.NoError(c.Remove("x"))))
+	expect.That(t, is.EqualTo(c.Combatants[1].Conditions[1].Rounds, 1))
+
+	c.Next()
+	expect.That(t,
+		is.DeepEqualTo(conditionNames(c.Combatants[1].Conditions), []string{"hex"}),
+		is.EqualTo(len(c.Expired), 1),
+		is.EqualTo(c.Expired[0].Condition.Name, "stunned"),
+	)
+}
+
+func TestCombat_Act_conditions(t *testing.T) {
+	c, err := NewCombat([]Combatant{
+		{ID: "x", Name: "X", Initiative: 15},
+		{ID: "y", Name: "Y", Initiative: 10},
+		{ID: "z", Name: "Z", Initiative: 5},
+	})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	expect.That(t, expect.FailNow(is.NoError(c.Delay("x"))))
+
+	_, err = c.AddCondition("z", Condition{Name: "stunned", UntilEndOfTurnOf: "x"})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+	_, err = c.AddCondition("z", Condition{Name: "hex", Rounds: 1, Anchor: "x"})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	// Acting starts x's turn.
+	expect.That(t, expect.FailNow(is.NoError(c.Act("x"))))
+	expect.That(t,
+		is.EqualTo(len(c.Expired), 1),
+		is.EqualTo(c.Expired[0].Condition.Name, "hex"),
+	)
+
+	c.Next()
+	expect.That(t,
+		is.SliceOfLen(c.Combatants[2].Conditions, 0),
+		is.EqualTo(len(c.Expired), 1),
+		is.EqualTo(c.Expired[0].Condition.Name, "stunned"),
+	)
+}
+
+func TestGridService_Update_tokenConditions(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+	svc := NewService(repo)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "2x1:-2:-2:-4"},
+	}
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.Create(g))),
+		expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "gm", Role: RoleEditor, Created: time.Now()}))),
+	)
+
+	ctx := ContextWithShareToken(context.Background(), "gm")
+	expect.That(t, expect.FailNow(is.NoError(svc.Update(ctx, "owner:grid", Values{Label: "test", Descriptor: "2x1:-2:kr2:-4"}))))
+
+	c := newTestCombat(t)
+	for col := range 2 {
+		_, err := c.AddTokenCondition(Cell{Col: col, Row: 0}, Condition{Name: "prone"})
+		expect.That(t, expect.FailNow(is.NoError(err)))
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.SaveCombat("owner", "grid", c))))
+
+	tokenCells := func() []Cell {
+		c, err := repo.LoadCombat("owner", "grid")
+		expect.That(t, expect.FailNow(is.NoError(err)))
+
+		cells := make([]Cell, len(c.Tokens))
+		for i, tc := range c.Tokens {
+			cells[i] = tc.Cell
+		}
+		return cells
+	}
+
+	expect.That(t, expect.FailNow(is.NoError(svc.Update(ctx, "owner:grid", Values{Label: "test", Descriptor: "2x1:-2:kr1-1:-4"}))))
+	expect.That(t, is.DeepEqualTo(tokenCells(), []Cell{{Col: 0, Row: 0}}))
+
+	// Revision 1 holds no tokens at all.
+	expect.That(t, expect.FailNow(is.NoError(svc.RestoreRevision(ctx, "owner:grid", 1))))
+	expect.That(t, is.SliceOfLen(tokenCells(), 0))
+
+	// Invalid descriptors are rejected.
+	expect.That(t, is.Error(svc.Update(ctx, "owner:grid", Values{Label: "test", Descriptor: "2x1:r3::"}), ErrInvalidDescriptor))
+
+	loaded, err := repo.Load("owner", "grid")
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(loaded.Descriptor, "2x1:-2:-2:-4"),
+	)
+}
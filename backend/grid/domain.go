@@ -2,14 +2,15 @@ package grid
 
 import (
 	"context"
-	"crypto/rand"
 	"errors"
 	"fmt"
-	"math/big"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/halimath/d20-tools/auth"
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/infra/random"
 	"github.com/halimath/d20-tools/infra/shelf"
 )
 
@@ -22,8 +23,13 @@ type Grid struct {
 	id           string
 	ownerID      string
 	LastModified time.Time
-	// Version      int
+	Version      int
+	// Fog contains the cells hidden from viewers.
+	Fog Fog
 	Values
+
+	// playerView is set for grids converted with PlayerView.
+	playerView bool
 }
 
 func (g Grid) ID() string {
@@ -36,11 +42,18 @@ var ErrForbidden = errors.New("forbidden")
 
 type GridService struct {
 	repo *Repository
+	// mu serializes read-modify-write operations on grids.
+	mu sync.Mutex
+	// sharesMu serializes counting the uses of shares.
+	sharesMu sync.Mutex
+	// dice is the source used to roll dice.
+	dice dice.Source
 }
 
 func NewService(r *Repository) *GridService {
 	return &GridService{
 		repo: r,
+		dice: dice.CryptoSource,
 	}
 }
 
@@ -59,113 +72,208 @@ func (svc *GridService) Create(ctx context.Context, v Values) (Grid, error) {
 		return Grid{}, ErrForbidden
 	}
 
+	if _, err := ParseLayout(v.Descriptor); err != nil {
+		return Grid{}, err
+	}
+
 	grid := Grid{
 		id:           generateGridID(),
 		ownerID:      principal.ID,
 		LastModified: time.Now(),
+		Version:      1,
 		Values:       v,
 	}
 
 	return grid, svc.repo.Create(grid)
 }
 
+// Load loads the grid identified by id. Viewers receive the grid's
+// PlayerView.
 func (svc *GridService) Load(ctx context.Context, id string) (Grid, error) {
-	ownerID, gridID, err := parseID(id)
+	grid, share, err := svc.authorize(ctx, id, RoleViewer)
 	if err != nil {
 		return Grid{}, err
 	}
 
-	return svc.repo.Load(ownerID, gridID)
+	return svc.viewFor(ctx, grid, share)
+}
+
+// LoadForEditing loads the grid identified by id including hidden cells. It
+// returns ErrForbidden unless the requester found in ctx may edit the grid.
+func (svc *GridService) LoadForEditing(ctx context.Context, id string) (Grid, error) {
+	return svc.loadAuthorized(ctx, id, RoleEditor)
 }
 
 func (svc *GridService) Update(ctx context.Context, id string, vals Values) error {
-	principal := auth.FromContext(ctx)
-	if principal == nil {
-		return ErrForbidden
-	}
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
 
-	ownerID, gridID, err := parseID(id)
+	return svc.update(ctx, id, vals)
+}
+
+func (svc *GridService) update(ctx context.Context, id string, vals Values) error {
+	original, err := svc.loadAuthorized(ctx, id, RoleEditor)
 	if err != nil {
 		return err
 	}
 
-	if ownerID != principal.ID {
-		return ErrForbidden
-	}
-
-	original, err := svc.repo.Load(ownerID, gridID)
+	l, err := ParseLayout(vals.Descriptor)
 	if err != nil {
 		return err
 	}
 
-	if original.ownerID != principal.ID {
-		return ErrForbidden
-	}
-
 	grid := Grid{
-		id:           gridID,
-		ownerID:      principal.ID,
+		id:           original.id,
+		ownerID:      original.ownerID,
 		LastModified: time.Now(),
+		Version:      original.Version + 1,
+		Fog:          original.Fog.clipTo(vals.Descriptor),
 		Values:       vals,
 	}
 
-	return svc.repo.Update(grid)
+	if err := svc.repo.Update(grid); err != nil {
+		return err
+	}
+
+	return svc.followTokens(grid, nil, l)
 }
 
-func (svc *GridService) Delete(ctx context.Context, id string) error {
-	// TODO: Need a real shelf transaction here
-	principal := auth.FromContext(ctx)
-	if principal == nil {
-		return ErrForbidden
-	}
+// loadAuthorized loads the grid identified by id and makes sure the
+// principal found in ctx has been granted at least the required role. It
+// returns ErrForbidden otherwise.
+func (svc *GridService) loadAuthorized(ctx context.Context, id string, required Role) (Grid, error) {
+	grid, _, err := svc.authorize(ctx, id, required)
+	return grid, err
+}
+
+// authorize loads the grid identified by id and makes sure that either the
+// principal found in ctx or the share token found in ctx grants at least the
+// required role. If access is granted by a share, the share is returned as
+// well. Owner access is never granted by a share.
+func (svc *GridService) authorize(ctx context.Context, id string, required Role) (Grid, *Share, error) {
+	return svc.authorizeAs(ctx, auth.FromContext(ctx), id, required)
+}
 
+// authorizeAs works like authorize but checks the roles granted to principal
+// instead of the one found in ctx. principal may be nil.
+func (svc *GridService) authorizeAs(ctx context.Context, principal *auth.Principal, id string, required Role) (Grid, *Share, error) {
 	ownerID, gridID, err := parseID(id)
 	if err != nil {
-		return err
+		return Grid{}, nil, err
 	}
 
-	if ownerID != principal.ID {
-		return ErrForbidden
+	grid, err := svc.repo.Load(ownerID, gridID)
+	if err != nil {
+		return Grid{}, nil, err
 	}
 
-	grid, err := svc.repo.Load(ownerID, gridID)
+	if principal != nil {
+		role, err := svc.roleOf(grid, principal.ID)
+		if err != nil {
+			return Grid{}, nil, err
+		}
+
+		if role.Allows(required) {
+			return grid, nil, nil
+		}
+	}
+
+	if required == RoleOwner {
+		return Grid{}, nil, ErrForbidden
+	}
+
+	share, err := svc.authorizeShare(ctx, grid, required)
 	if err != nil {
-		return err
+		return Grid{}, nil, err
 	}
 
-	if grid.ownerID != principal.ID {
-		return ErrForbidden
+	return grid, &share, nil
+}
+
+func (svc *GridService) Delete(ctx context.Context, id string) error {
+	// TODO: Need a real shelf transaction here
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	grid, err := svc.loadAuthorized(ctx, id, RoleOwner)
+	if err != nil {
+		return err
 	}
 
-	return svc.repo.Delete(ownerID, gridID)
+	return svc.repo.Delete(grid.ownerID, grid.id)
+}
+
+// EventType defines the type of an Event delivered to subscribers.
+type EventType int
+
+const (
+	// EventUpdated is sent with the complete grid whenever it changes.
+	EventUpdated EventType = iota
+	// EventPatched is sent instead of EventUpdated when a grid changes by
+	// applying a patch. It carries both the operations and the resulting grid.
+	EventPatched
+	// EventCombat is sent whenever the combat running on a grid changes.
+	EventCombat
+	// EventRolled is sent whenever dice have been rolled on a grid.
+	EventRolled
+	// EventConditionsExpired is sent whenever conditions end as the turn of
+	// the combat running on a grid passes.
+	EventConditionsExpired
+)
+
+// Event is a single notification delivered to the subscribers of a grid.
+type Event struct {
+	Type EventType
+	// Grid is set for EventUpdated and EventPatched.
+	Grid Grid
+	// Patch is set for EventPatched.
+	Patch Patch
+	// Combat is set for EventCombat. It is nil if the combat has ended.
+	Combat *Combat
+	// Roll is set for EventRolled.
+	Roll Roll
+	// Expired is set for EventConditionsExpired.
+	Expired []ExpiredCondition
 }
 
 type Subscription struct {
-	s *shelf.Subscription
-	c chan Grid
+	s          *shelf.Subscription
+	c          chan Event
+	cancelOnce sync.Once
 }
 
 func (s *Subscription) Cancel() {
-	s.s.Cancel()
+	s.cancelOnce.Do(s.s.Cancel)
 }
 
-func (s *Subscription) C() <-chan Grid {
+func (s *Subscription) C() <-chan Event {
 	return s.c
 }
 
+// Subscribe subscribes to changes of the grid identified by id. Viewers
+// receive the grid's PlayerView and no patch events. The subscription ends
+// when ctx is done. If access is granted by a share, the
+// subscription also ends when the share expires or is revoked.
 func (svc *GridService) Subscribe(ctx context.Context, id string) (*Subscription, error) {
-	ownerID, gridID, err := parseID(id)
+	grid, share, err := svc.authorize(ctx, id, RoleViewer)
 	if err != nil {
 		return nil, err
 	}
 
-	grid, err := svc.repo.Load(ownerID, gridID)
-	if err != nil {
-		return nil, err
+	var filter func(Event) (Event, bool)
+	if !svc.seesFog(ctx, grid, share) {
+		filter = newPlayerViewFilter(grid.Fog)
 	}
 
-	sup := svc.repo.Subscribe(ctx, ownerID, gridID)
-	sup.c <- grid
+	sup := svc.repo.Subscribe(ctx, grid.ownerID, grid.id, share, filter)
+
+	evt, ok := Event{Type: EventUpdated, Grid: grid}, true
+	if filter != nil {
+		evt, ok = filter(evt)
+	}
+	if ok {
+		sup.c <- evt
+	}
 
 	return sup, nil
 }
@@ -187,18 +295,5 @@ func assembleID(ownerID, gridID string) string {
 }
 
 func generateGridID() string {
-	const idChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	const length = 24
-
-	result := make([]byte, length)
-
-	for i := 0; i < length; i++ {
-		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(idChars))))
-		if err != nil {
-			panic(err)
-		}
-		result[i] = idChars[n.Int64()]
-	}
-
-	return string(result)
+	return random.ID(24)
 }
@@ -0,0 +1,236 @@
+package grid
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/halimath/d20-tools/dice"
+)
+
+// FairSession is a session of provably fair rolls. When a session is started,
+// a random seed is generated and only its commitment is published. All rolls
+// made during the session are derived from the seed and a nonce chosen by the
+// roller. Once the session is revealed, everyone can re-derive every roll
+// using the seed.
+type FairSession struct {
+	// Commitment is the commitment to Seed as returned by dice.Commit.
+	Commitment string
+	// Seed is only disclosed once the session has been revealed.
+	Seed     []byte
+	Started  time.Time
+	Revealed time.Time
+}
+
+// IsRevealed reports whether s's seed has been revealed.
+func (s FairSession) IsRevealed() bool {
+	return !s.Revealed.IsZero()
+}
+
+var (
+	// ErrFairSessionActive is returned when starting a fair session while
+	// another one has not been revealed yet.
+	ErrFairSessionActive = errors.New("fair session already active")
+
+	// ErrFairSessionNotRevealed is returned when verifying a fair session
+	// which has not been revealed yet.
+	ErrFairSessionNotRevealed = errors.New("fair session not revealed")
+)
+
+// rollMessage returns the message used to derive the dice of the roll
+// numbered number from a fair session's seed.
+func rollMessage(number int, nonce string) string {
+	return fmt.Sprintf("%d:%s", number, nonce)
+}
+
+// activeFairSession returns the fair session of a grid which has not been
+// revealed yet. ok is false if no such session exists.
+func (svc *GridService) activeFairSession(ownerID, gridID string) (s FairSession, ok bool, err error) {
+	sessions, err := svc.repo.ListFairSessions(ownerID, gridID)
+	if err != nil {
+		return FairSession{}, false, err
+	}
+
+	for _, s := range sessions {
+		if !s.IsRevealed() {
+			return s, true, nil
+		}
+	}
+
+	return FairSession{}, false, nil
+}
+
+// StartFairSession starts a new fair session for the grid identified by id.
+// All rolls made until the session is revealed are provably fair. Only owner
+// and editors may start sessions. The returned session does not contain the
+// seed.
+func (svc *GridService) StartFairSession(ctx context.Context, id string) (FairSession, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return FairSession{}, err
+	}
+
+	if _, ok, err := svc.activeFairSession(grid.ownerID, grid.id); err != nil {
+		return FairSession{}, err
+	} else if ok {
+		return FairSession{}, ErrFairSessionActive
+	}
+
+	seed := make([]byte, dice.SeedSize)
+	rand.Read(seed)
+
+	s := FairSession{
+		Commitment: dice.Commit(seed),
+		Seed:       seed,
+		Started:    time.Now(),
+	}
+
+	if err := svc.repo.SaveFairSession(grid.ownerID, grid.id, s); err != nil {
+		return FairSession{}, err
+	}
+
+	s.Seed = nil
+	return s, nil
+}
+
+// RevealFairSession ends the active fair session of the grid identified by id
+// and reveals its seed. It returns ErrNotFound if no session is active.
+func (svc *GridService) RevealFairSession(ctx context.Context, id string) (FairSession, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return FairSession{}, err
+	}
+
+	s, ok, err := svc.activeFairSession(grid.ownerID, grid.id)
+	if err != nil {
+		return FairSession{}, err
+	}
+	if !ok {
+		return FairSession{}, ErrNotFound
+	}
+
+	s.Revealed = time.Now()
+	return s, svc.repo.SaveFairSession(grid.ownerID, grid.id, s)
+}
+
+// ListFairSessions lists all fair sessions of the grid identified by id
+// ordered by start. Seeds are only contained for revealed sessions.
+func (svc *GridService) ListFairSessions(ctx context.Context, id string) ([]FairSession, error) {
+	grid, err := svc.loadAuthorized(ctx, id, RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := svc.repo.ListFairSessions(grid.ownerID, grid.id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		if !sessions[i].IsRevealed() {
+			sessions[i].Seed = nil
+		}
+	}
+
+	return sessions, nil
+}
+
+// RollVerification is the verification result of a single roll.
+type RollVerification struct {
+	Roll Roll
+	// Valid reports whether the roll matches the roll derived from the
+	// session's seed.
+	Valid bool
+}
+
+// Verification is the result of verifying all rolls of a fair session.
+type Verification struct {
+	Session FairSession
+	// Committed reports whether the session's seed matches its commitment.
+	Committed bool
+	Rolls     []RollVerification
+}
+
+// Valid reports whether the seed matches the commitment and all rolls are
+// valid.
+func (v Verification) Valid() bool {
+	return v.Committed && !slices.ContainsFunc(v.Rolls, func(r RollVerification) bool { return !r.Valid })
+}
+
+// VerifyFairSession verifies all rolls made during the revealed fair session
+// identified by commitment by re-deriving them from the session's seed.
+// Private rolls are only verified for owner and editors.
+func (svc *GridService) VerifyFairSession(ctx context.Context, id, commitment string) (Verification, error) {
+	grid, share, err := svc.authorize(ctx, id, RoleViewer)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	s, err := svc.repo.LoadFairSession(grid.ownerID, grid.id, commitment)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	if !s.IsRevealed() {
+		return Verification{}, ErrFairSessionNotRevealed
+	}
+
+	v := Verification{
+		Session:   s,
+		Committed: dice.Commit(s.Seed) == s.Commitment,
+	}
+
+	private := svc.seesFog(ctx, grid, share)
+
+	last, err := svc.repo.lastRollNumber(grid.ownerID, grid.id)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	for n := 1; n <= last; n++ {
+		roll, err := svc.repo.LoadRoll(grid.ownerID, grid.id, n)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return Verification{}, err
+		}
+
+		if roll.Session != s.Commitment || (roll.Private && !private) {
+			continue
+		}
+
+		derived := roll.Result.Expression.Roll(dice.NewSeededSource(s.Seed, rollMessage(roll.Number, roll.Nonce)))
+
+		v.Rolls = append(v.Rolls, RollVerification{
+			Roll:  roll,
+			Valid: equalResults(roll.Result, derived),
+		})
+	}
+
+	return v, nil
+}
+
+// equalResults reports whether a and b contain the same dice and values.
+func equalResults(a, b dice.Result) bool {
+	if a.Total != b.Total || len(a.Terms) != len(b.Terms) {
+		return false
+	}
+
+	for i := range a.Terms {
+		if a.Terms[i].Value != b.Terms[i].Value || !slices.Equal(a.Terms[i].Dice, b.Terms[i].Dice) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,103 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestGridService_fairSession(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+	svc := NewService(repo)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "1x1:-1:-1:-2"},
+	}
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.Create(g))),
+		expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "gm", Role: RoleEditor, Created: time.Now()}))),
+		expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "player", Role: RoleViewer, Created: time.Now()}))),
+	)
+
+	gm := ContextWithShareToken(context.Background(), "gm")
+	player := ContextWithShareToken(context.Background(), "player")
+
+	_, err := svc.StartFairSession(player, "owner:grid")
+	expect.That(t, is.Error(err, ErrForbidden))
+
+	session, err := svc.StartFairSession(gm, "owner:grid")
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		is.SliceOfLen(session.Seed, 0),
+		is.EqualTo(len(session.Commitment), 64),
+	)
+
+	_, err = svc.StartFairSession(gm, "owner:grid")
+	expect.That(t, is.Error(err, ErrFairSessionActive))
+
+	_, err = svc.VerifyFairSession(player, "owner:grid", session.Commitment)
+	expect.That(t, is.Error(err, ErrFairSessionNotRevealed))
+
+	// Rolls are made as the roll service does using the stored seed.
+	active, ok, err := svc.activeFairSession("owner", "grid")
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		expect.FailNow(is.EqualTo(ok, true)),
+	)
+
+	expr := dice.MustParse("4d6kh3+2")
+	for n, nonce := range []string{"a", "b", "c"} {
+		roll := Roll{
+			Number:  n + 1,
+			Created: time.Now(),
+			Session: session.Commitment,
+			Nonce:   nonce,
+			Result:  expr.Roll(dice.NewSeededSource(active.Seed, rollMessage(n+1, nonce))),
+		}
+		if n == 2 {
+			// Tamper with the last roll
+			roll.Result.Total++
+		}
+		expect.That(t, expect.FailNow(is.NoError(repo.AddRoll("owner", "grid", roll))))
+	}
+
+	sessions, err := svc.ListFairSessions(player, "owner:grid")
+	expect.That(t,
+		is.NoError(err),
+		is.SliceOfLen(sessions, 1),
+		is.SliceOfLen(sessions[0].Seed, 0),
+	)
+
+	revealed, err := svc.RevealFairSession(gm, "owner:grid")
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		is.EqualTo(revealed.IsRevealed(), true),
+		is.EqualTo(dice.Commit(revealed.Seed), session.Commitment),
+	)
+
+	_, err = svc.RevealFairSession(gm, "owner:grid")
+	expect.That(t, is.Error(err, ErrNotFound))
+
+	v, err := svc.VerifyFairSession(player, "owner:grid", session.Commitment)
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		is.EqualTo(v.Committed, true),
+		expect.FailNow(is.SliceOfLen(v.Rolls, 3)),
+		is.EqualTo(v.Rolls[0].Valid, true),
+		is.EqualTo(v.Rolls[1].Valid, true),
+		is.EqualTo(v.Rolls[2].Valid, false),
+		is.EqualTo(v.Valid(), false),
+	)
+}
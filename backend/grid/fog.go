@@ -0,0 +1,261 @@
+package grid
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/halimath/d20-tools/auth"
+)
+
+// Cell identifies a single cell of a grid.
+type Cell struct {
+	Col, Row int
+}
+
+// Fog is the set of hidden cells of a grid. Hidden cells are only visible to
+// the grid's owner and editors. A Fog is kept sorted by row and column and
+// contains every cell at most once.
+type Fog []Cell
+
+func compareCells(a, b Cell) int {
+	if c := cmp.Compare(a.Row, b.Row); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Col, b.Col)
+}
+
+// Hidden reports whether the cell at col and row is hidden.
+func (f Fog) Hidden(col, row int) bool {
+	_, found := slices.BinarySearchFunc(f, Cell{Col: col, Row: row}, compareCells)
+	return found
+}
+
+// Hide returns a new Fog with cells hidden in addition to the ones hidden by
+// f.
+func (f Fog) Hide(cells ...Cell) Fog {
+	result := slices.Concat(f, cells)
+	slices.SortFunc(result, compareCells)
+	return slices.Compact(result)
+}
+
+// Reveal returns a new Fog with cells no longer hidden.
+func (f Fog) Reveal(cells ...Cell) Fog {
+	reveal := Fog(nil).Hide(cells...)
+
+	return slices.DeleteFunc(slices.Clone(f), func(c Cell) bool {
+		return reveal.Hidden(c.Col, c.Row)
+	})
+}
+
+// clip returns f without the cells outside of a grid of the given size.
+func (f Fog) clip(cols, rows int) Fog {
+	return slices.DeleteFunc(slices.Clone(f), func(c Cell) bool {
+		return c.Col >= cols || c.Row >= rows
+	})
+}
+
+// clipTo returns f without the cells outside of the grid described by
+// descriptor. f is returned unchanged if descriptor is invalid.
+func (f Fog) clipTo(descriptor string) Fog {
+	l, err := ParseLayout(descriptor)
+	if err != nil {
+		return f
+	}
+	return f.clip(l.Cols, l.Rows)
+}
+
+// PlayerView returns the view of g shown to viewers: all backgrounds and
+// tokens of hidden cells are removed. A wall is removed if all cells adjacent
+// to it are hidden, so that walls and doors bordering the visible area remain
+// visible. The returned grid carries no fog.
+func (g Grid) PlayerView() (Grid, error) {
+	if len(g.Fog) == 0 {
+		g.playerView = true
+		return g, nil
+	}
+
+	l, err := ParseLayout(g.Descriptor)
+	if err != nil {
+		return Grid{}, err
+	}
+
+	hidden := func(col, row int) bool {
+		return !l.Contains(col, row) || g.Fog.Hidden(col, row)
+	}
+
+	for _, c := range g.Fog {
+		if !l.Contains(c.Col, c.Row) {
+			continue
+		}
+
+		l.SetBackgroundAt(c.Col, c.Row, "")
+		l.SetTokenAt(c.Col, c.Row, nil)
+
+		if hidden(c.Col-1, c.Row) {
+			l.SetWallAt(c.Col, c.Row, WallPositionLeft, nil)
+		}
+		if hidden(c.Col, c.Row-1) {
+			l.SetWallAt(c.Col, c.Row, WallPositionTop, nil)
+		}
+	}
+
+	g.Descriptor = l.Descriptor()
+	g.Fog = nil
+	g.playerView = true
+
+	return g, nil
+}
+
+// viewFor returns the view of grid shown to the requester found in ctx who
+// has been authorized either as a principal or by share. Only owner and
+// editors see hidden cells.
+func (svc *GridService) viewFor(ctx context.Context, grid Grid, share *Share) (Grid, error) {
+	if svc.seesFog(ctx, grid, share) {
+		return grid, nil
+	}
+	return grid.PlayerView()
+}
+
+// seesFog reports whether the requester found in ctx who has been authorized
+// either as a principal or by share may see hidden cells of grid.
+func (svc *GridService) seesFog(ctx context.Context, grid Grid, share *Share) bool {
+	if share != nil {
+		return share.Role.Allows(RoleEditor)
+	}
+
+	principal := auth.FromContext(ctx)
+	if principal == nil {
+		return false
+	}
+
+	role, err := svc.roleOf(grid, principal.ID)
+	return err == nil && role.Allows(RoleEditor)
+}
+
+// playerViewFilter converts events delivered to viewers. Patch events are
+// converted to update events as operations may affect hidden cells. Private
+// rolls are dropped.
+func playerViewFilter(evt Event) (Event, bool) {
+	switch evt.Type {
+	case EventPatched:
+		evt.Type = EventUpdated
+		evt.Patch = Patch{}
+	case EventRolled:
+		return evt, !evt.Roll.Private
+	case EventUpdated:
+	default:
+		return evt, true
+	}
+
+	g, err := evt.Grid.PlayerView()
+	if err != nil {
+		return evt, false
+	}
+	evt.Grid = g
+
+	return evt, true
+}
+
+// newPlayerViewFilter creates a filter which applies playerViewFilter and
+// additionally hides conditions of tokens placed on hidden cells. It tracks
+// the fog of the grid starting with fog.
+func newPlayerViewFilter(fog Fog) func(Event) (Event, bool) {
+	var mu sync.Mutex
+
+	return func(evt Event) (Event, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch evt.Type {
+		case EventUpdated, EventPatched:
+			fog = evt.Grid.Fog
+		case EventCombat:
+			if evt.Combat != nil {
+				c := evt.Combat.PlayerView(fog)
+				evt.Combat = &c
+			}
+		case EventConditionsExpired:
+			evt.Expired = hideExpired(evt.Expired, fog)
+			if len(evt.Expired) == 0 {
+				return evt, false
+			}
+		}
+
+		return playerViewFilter(evt)
+	}
+}
+
+// MaxFogCells is the maximum number of cells a fog may hide as well as the
+// maximum number of cells a single fog update may hide or reveal.
+const MaxFogCells = 10000
+
+// Area is a rectangular area of cells.
+type Area struct {
+	Col, Row   int
+	Cols, Rows int
+}
+
+// cells returns all cells contained in a.
+func (a Area) cells() []Cell {
+	cells := make([]Cell, 0, a.Cols*a.Rows)
+	for row := a.Row; row < a.Row+a.Rows; row++ {
+		for col := a.Col; col < a.Col+a.Cols; col++ {
+			cells = append(cells, Cell{Col: col, Row: row})
+		}
+	}
+	return cells
+}
+
+// UpdateFog hides and reveals areas of the grid identified by id. Areas are
+// hidden first and revealed afterwards. Only owner and editors may change the
+// fog. Subscribed viewers receive the newly visible content immediately.
+func (svc *GridService) UpdateFog(ctx context.Context, id string, hide, reveal []Area) (Grid, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	original, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return Grid{}, err
+	}
+
+	l, err := ParseLayout(original.Descriptor)
+	if err != nil {
+		return Grid{}, err
+	}
+
+	total := 0
+	for _, a := range slices.Concat(hide, reveal) {
+		if a.Cols < 1 || a.Rows < 1 || !l.Contains(a.Col, a.Row) || !l.Contains(a.Col+a.Cols-1, a.Row+a.Rows-1) {
+			return Grid{}, fmt.Errorf("%w: area %d/%d %dx%d out of range", ErrInvalidOperation, a.Col, a.Row, a.Cols, a.Rows)
+		}
+
+		total += a.Cols * a.Rows
+		if total > MaxFogCells {
+			return Grid{}, fmt.Errorf("%w: areas exceed %d cells", ErrInvalidOperation, MaxFogCells)
+		}
+	}
+
+	var hidden, revealed []Cell
+	for _, a := range hide {
+		hidden = append(hidden, a.cells()...)
+	}
+	for _, a := range reveal {
+		revealed = append(revealed, a.cells()...)
+	}
+
+	fog := original.Fog.Hide(hidden...).Reveal(revealed...)
+	if len(fog) > MaxFogCells && len(fog) > len(original.Fog) {
+		return Grid{}, fmt.Errorf("%w: fog exceeds %d cells", ErrInvalidOperation, MaxFogCells)
+	}
+
+	grid := original
+	grid.LastModified = time.Now()
+	grid.Version = original.Version + 1
+	grid.Fog = fog
+
+	return grid, svc.repo.UpdateFog(grid)
+}
@@ -0,0 +1,145 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestFog(t *testing.T) {
+	f := Fog(nil).Hide(Cell{1, 1}, Cell{0, 1}, Cell{2, 0}, Cell{1, 1})
+
+	expect.That(t,
+		is.DeepEqualTo(f, Fog{{2, 0}, {0, 1}, {1, 1}}),
+		is.EqualTo(f.Hidden(0, 1), true),
+		is.EqualTo(f.Hidden(0, 0), false),
+		is.DeepEqualTo(f.Reveal(Cell{0, 1}, Cell{3, 3}), Fog{{2, 0}, {1, 1}}),
+		is.DeepEqualTo(f.clip(2, 2), Fog{{0, 1}, {1, 1}}),
+		is.DeepEqualTo(Area{Col: 1, Row: 2, Cols: 2, Rows: 1}.cells(), []Cell{{1, 2}, {2, 2}}),
+	)
+}
+
+func TestGrid_PlayerView(t *testing.T) {
+	l := NewLayout(3, 1)
+	for col := range 3 {
+		l.SetBackgroundAt(col, 0, ColorGreen)
+		l.SetTokenAt(col, 0, &Token{Symbol: SymbolPawn, Color: ColorRed})
+		l.SetWallAt(col, 0, WallPositionLeft, &Wall{Symbol: WallSymbolDoor, Color: ColorBrown})
+	}
+
+	g := Grid{
+		Fog:    Fog{{1, 0}, {2, 0}},
+		Values: Values{Descriptor: l.Descriptor()},
+	}
+
+	view, err := g.PlayerView()
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	vl, err := ParseLayout(view.Descriptor)
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	expect.That(t,
+		is.EqualTo(view.Fog == nil, true),
+		is.EqualTo(view.playerView, true),
+		is.EqualTo(vl.BackgroundAt(0, 0), ColorGreen),
+		is.EqualTo(vl.TokenAt(0, 0) != nil, true),
+		is.EqualTo(vl.BackgroundAt(1, 0), Color("")),
+		is.EqualTo(vl.TokenAt(1, 0) == nil, true),
+		is.EqualTo(vl.TokenAt(2, 0) == nil, true),
+		// The door between the visible and the hidden area remains visible
+		is.EqualTo(vl.WallAt(1, 0, WallPositionLeft) != nil, true),
+		is.EqualTo(vl.WallAt(2, 0, WallPositionLeft) == nil, true),
+	)
+}
+
+func TestRepository_UpdateFog(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "2x1:-2:py2:-4"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sup := repo.Subscribe(ctx, "owner", "grid", nil, playerViewFilter)
+
+	// Patch events must not be delivered to viewers.
+	g.Version = 2
+	g.Fog = Fog{{1, 0}}
+	expect.That(t, expect.FailNow(is.NoError(repo.Patch(g, []Operation{{Type: OpRename, Label: "test"}}))))
+
+	updated := <-sup.C()
+
+	g.Version = 3
+	g.Fog = nil
+	expect.That(t, expect.FailNow(is.NoError(repo.UpdateFog(g))))
+
+	revealed := <-sup.C()
+
+	loaded, err := repo.Load("owner", "grid")
+	expect.That(t, is.NoError(err))
+
+	revisions, err := repo.ListRevisions("owner", "grid")
+	expect.That(t, is.NoError(err))
+
+	expect.That(t,
+		is.EqualTo(updated.Type, EventUpdated),
+		is.EqualTo(updated.Grid.Descriptor, "2x1:-2:py1-1:-4"),
+		is.EqualTo(revealed.Type, EventUpdated),
+		is.EqualTo(revealed.Grid.Descriptor, "2x1:-2:py2:-4"),
+		is.EqualTo(loaded.Version, 3),
+		// Changing the fog does not record a revision
+		is.SliceOfLen(revisions, 2),
+	)
+}
+
+func TestGridService_UpdateFog_limits(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+	svc := NewService(repo)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "1000x1000:-1000000:-1000000:-2000000"},
+	}
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.Create(g))),
+		expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "gm", Role: RoleEditor, Created: time.Now()}))),
+	)
+
+	ctx := ContextWithShareToken(context.Background(), "gm")
+
+	_, err := svc.UpdateFog(ctx, "owner:grid", []Area{{Cols: 1000, Rows: 1000}}, nil)
+	expect.That(t, is.Error(err, ErrInvalidOperation))
+
+	// Revealing counts as well.
+	_, err = svc.UpdateFog(ctx, "owner:grid", []Area{{Cols: 100, Rows: 50}}, []Area{{Cols: 100, Rows: 51}})
+	expect.That(t, is.Error(err, ErrInvalidOperation))
+
+	updated, err := svc.UpdateFog(ctx, "owner:grid", []Area{{Cols: 100, Rows: 100}}, nil)
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		is.SliceOfLen(updated.Fog, MaxFogCells),
+	)
+
+	_, err = svc.UpdateFog(ctx, "owner:grid", []Area{{Row: 100, Cols: 1, Rows: 1}}, nil)
+	expect.That(t, is.Error(err, ErrInvalidOperation))
+}
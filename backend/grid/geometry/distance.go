@@ -0,0 +1,57 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+)
+
+// DiagonalRule defines how diagonal movement is counted when measuring
+// distances.
+type DiagonalRule string
+
+const (
+	// DiagonalUniform counts every diagonal step as one cell, i.e. the 5e
+	// default of 5ft per diagonal.
+	DiagonalUniform DiagonalRule = "uniform"
+	// DiagonalAlternating counts every second diagonal step as two cells, i.e.
+	// the 5/10/5 variant.
+	DiagonalAlternating DiagonalRule = "alternating"
+	// DiagonalEuclidean measures the euclidean distance between cell centers.
+	DiagonalEuclidean DiagonalRule = "euclidean"
+)
+
+// DiagonalRules contains all available diagonal rules.
+var DiagonalRules = []DiagonalRule{DiagonalUniform, DiagonalAlternating, DiagonalEuclidean}
+
+// ParseDiagonalRule parses s into a DiagonalRule.
+func ParseDiagonalRule(s string) (DiagonalRule, error) {
+	for _, r := range DiagonalRules {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("invalid diagonal rule: %q", s)
+}
+
+// Distance returns the distance between a and b in cells.
+func (r DiagonalRule) Distance(a, b Cell) float64 {
+	dx := abs(b.Col - a.Col)
+	dy := abs(b.Row - a.Row)
+
+	switch r {
+	case DiagonalAlternating:
+		diagonals := min(dx, dy)
+		return float64(max(dx, dy) + diagonals/2)
+	case DiagonalEuclidean:
+		return math.Hypot(float64(dx), float64(dy))
+	default:
+		return float64(max(dx, dy))
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,116 @@
+// Package geometry implements spatial computations on square grids: distances
+// under different diagonal rules, line of sight blocked by walls and the cells
+// covered by area of effect templates.
+// geometry has its own model of a grid, which only contains the barriers on
+// cell edges, so that it can be used independently from how grids are stored.
+package geometry
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cell identifies a single cell by column and row.
+type Cell struct {
+	Col, Row int
+}
+
+// ErrInvalidCell is returned when parsing a malformed cell.
+var ErrInvalidCell = errors.New("invalid cell")
+
+// ParseCell parses a cell given as "<col>,<row>".
+func ParseCell(s string) (Cell, error) {
+	col, row, ok := strings.Cut(s, ",")
+	if !ok {
+		return Cell{}, fmt.Errorf("%w: %q", ErrInvalidCell, s)
+	}
+
+	c, err := strconv.Atoi(strings.TrimSpace(col))
+	if err != nil {
+		return Cell{}, fmt.Errorf("%w: %q", ErrInvalidCell, s)
+	}
+
+	r, err := strconv.Atoi(strings.TrimSpace(row))
+	if err != nil {
+		return Cell{}, fmt.Errorf("%w: %q", ErrInvalidCell, s)
+	}
+
+	return Cell{Col: c, Row: r}, nil
+}
+
+func (c Cell) String() string {
+	return fmt.Sprintf("%d,%d", c.Col, c.Row)
+}
+
+// Barrier defines what is placed on the edge between two cells.
+type Barrier int
+
+const (
+	None Barrier = iota
+	Wall
+	Door
+	Window
+)
+
+// Side defines one of the two edges of a cell on which a barrier is stored.
+// The right and bottom edges of a cell are the left and top edges of its
+// neighbors.
+type Side int
+
+const (
+	Left Side = iota
+	Top
+)
+
+// Map is a grid of cols times rows cells with barriers on cell edges.
+type Map struct {
+	Cols, Rows int
+	barriers   []Barrier
+}
+
+// NewMap creates a new Map with the given size and no barriers.
+func NewMap(cols, rows int) *Map {
+	return &Map{
+		Cols:     cols,
+		Rows:     rows,
+		barriers: make([]Barrier, cols*rows*2),
+	}
+}
+
+// Contains reports whether c lies within m.
+func (m *Map) Contains(c Cell) bool {
+	return c.Col >= 0 && c.Col < m.Cols && c.Row >= 0 && c.Row < m.Rows
+}
+
+// SetBarrier places b on the given side of c.
+func (m *Map) SetBarrier(c Cell, side Side, b Barrier) {
+	if m.Contains(c) {
+		m.barriers[(c.Row*m.Cols+c.Col)*2+int(side)] = b
+	}
+}
+
+// Barrier returns the barrier placed on the given side of c. Edges outside of
+// the map carry no barrier.
+func (m *Map) Barrier(c Cell, side Side) Barrier {
+	if !m.Contains(c) {
+		return None
+	}
+	return m.barriers[(c.Row*m.Cols+c.Col)*2+int(side)]
+}
+
+// between returns the barrier between the adjacent cells a and b.
+func (m *Map) between(a, b Cell) Barrier {
+	switch {
+	case b.Col == a.Col+1 && b.Row == a.Row:
+		return m.Barrier(b, Left)
+	case b.Col == a.Col-1 && b.Row == a.Row:
+		return m.Barrier(a, Left)
+	case b.Row == a.Row+1 && b.Col == a.Col:
+		return m.Barrier(b, Top)
+	case b.Row == a.Row-1 && b.Col == a.Col:
+		return m.Barrier(a, Top)
+	}
+	return None
+}
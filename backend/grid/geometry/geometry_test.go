@@ -0,0 +1,155 @@
+package geometry
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestParseCell(t *testing.T) {
+	c, err := ParseCell("3, 4")
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(c, Cell{3, 4}),
+	)
+
+	for _, s := range []string{"", "3", "a,4", "3,b"} {
+		_, err := ParseCell(s)
+		expect.That(t, is.Error(err, ErrInvalidCell))
+	}
+}
+
+func TestDiagonalRule_Distance(t *testing.T) {
+	tests := map[DiagonalRule]map[Cell]float64{
+		DiagonalUniform:     {{0, 0}: 0, {3, 0}: 3, {3, 3}: 3, {4, 1}: 4},
+		DiagonalAlternating: {{0, 0}: 0, {3, 0}: 3, {1, 1}: 1, {2, 2}: 3, {3, 3}: 4, {4, 1}: 4, {4, 4}: 6},
+		DiagonalEuclidean:   {{3, 4}: 5},
+	}
+
+	for rule, cases := range tests {
+		for to, want := range cases {
+			expect.That(t, is.EqualTo(rule.Distance(Cell{0, 0}, to), want))
+		}
+	}
+}
+
+func TestMap_LineOfSight(t *testing.T) {
+	// 4x3 map with a wall between column 1 and 2 in row 0, a door in row 1
+	// and a window in row 2.
+	m := NewMap(4, 3)
+	m.SetBarrier(Cell{2, 0}, Left, Wall)
+	m.SetBarrier(Cell{2, 1}, Left, Door)
+	m.SetBarrier(Cell{2, 2}, Left, Window)
+
+	tests := []struct {
+		from, to Cell
+		opts     SightOptions
+		want     bool
+	}{
+		{Cell{0, 0}, Cell{3, 0}, SightOptions{}, false},
+		{Cell{3, 0}, Cell{0, 0}, SightOptions{}, false},
+		{Cell{0, 1}, Cell{3, 1}, SightOptions{}, false},
+		{Cell{0, 1}, Cell{3, 1}, SightOptions{OpenDoors: true}, true},
+		{Cell{0, 2}, Cell{3, 2}, SightOptions{}, true},
+		{Cell{1, 0}, Cell{1, 2}, SightOptions{}, true},
+		// Passes the door diagonally
+		{Cell{0, 2}, Cell{3, 0}, SightOptions{}, false},
+		// Passes through the corner next to the window
+		{Cell{0, 2}, Cell{3, 1}, SightOptions{}, true},
+		{Cell{1, 2}, Cell{2, 1}, SightOptions{}, true},
+		{Cell{0, 0}, Cell{5, 0}, SightOptions{}, false},
+	}
+
+	for _, test := range tests {
+		expect.That(t, is.EqualTo(m.LineOfSight(test.from, test.to, test.opts), test.want))
+	}
+}
+
+func TestMap_Cover(t *testing.T) {
+	m := NewMap(7, 7)
+
+	burst, err := m.Cover(Template{Shape: ShapeBurst, Origin: Cell{3, 3}, Size: 1}, DiagonalUniform, SightOptions{})
+	expect.That(t,
+		is.NoError(err),
+		is.SliceOfLen(burst.Cells, 9),
+	)
+
+	m.SetBarrier(Cell{4, 3}, Left, Wall)
+	burst, err = m.Cover(Template{Shape: ShapeBurst, Origin: Cell{3, 3}, Size: 1}, DiagonalUniform, SightOptions{})
+	expect.That(t,
+		is.NoError(err),
+		is.SliceOfLen(burst.Cells, 8),
+	)
+
+	line, err := m.Cover(Template{Shape: ShapeLine, Origin: Cell{0, 0}, Toward: Cell{0, 6}, Size: 4}, DiagonalUniform, SightOptions{})
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(line.Cells, []Cell{{0, 1}, {0, 2}, {0, 3}, {0, 4}}),
+		is.EqualTo(line.End, Cell{0, 4}),
+	)
+
+	cone, err := m.Cover(Template{Shape: ShapeCone, Origin: Cell{0, 3}, Toward: Cell{1, 3}, Size: 2}, DiagonalUniform, SightOptions{})
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(cone.Cells, []Cell{{2, 2}, {1, 3}, {2, 3}, {2, 4}}),
+		is.EqualTo(cone.End, Cell{2, 3}),
+	)
+
+	_, err = m.Cover(Template{Shape: ShapeCone, Origin: Cell{0, 3}, Toward: Cell{0, 3}, Size: 2}, DiagonalUniform, SightOptions{})
+	expect.That(t, is.Error(err, ErrInvalidTemplate))
+
+	_, err = m.Cover(Template{Shape: "square", Origin: Cell{0, 3}, Size: 2}, DiagonalUniform, SightOptions{})
+	expect.That(t, is.Error(err, ErrInvalidTemplate))
+
+	for _, size := range []float64{0, -1, 15, 1e6, math.Inf(1), math.NaN()} {
+		_, err = m.Cover(Template{Shape: ShapeBurst, Origin: Cell{3, 3}, Size: size}, DiagonalUniform, SightOptions{})
+		expect.That(t, is.Error(err, ErrInvalidTemplate))
+	}
+
+	burst, err = NewMap(7, 7).Cover(Template{Shape: ShapeBurst, Origin: Cell{0, 0}, Size: 14}, DiagonalUniform, SightOptions{})
+	expect.That(t,
+		is.NoError(err),
+		is.SliceOfLen(burst.Cells, 49),
+	)
+}
+
+func TestMap_FindPath(t *testing.T) {
+	// 5x3 map with a wall from top to bottom between column 1 and 2 which
+	// has a door in row 2.
+	m := NewMap(5, 3)
+	m.SetBarrier(Cell{2, 0}, Left, Wall)
+	m.SetBarrier(Cell{2, 1}, Left, Window)
+	m.SetBarrier(Cell{2, 2}, Left, Door)
+
+	path, ok := m.FindPath(Cell{0, 0}, Cell{4, 0}, PathOptions{Rule: DiagonalUniform})
+	expect.That(t,
+		expect.FailNow(is.EqualTo(ok, true)),
+		is.EqualTo(path.Cost, 5.0),
+		is.EqualTo(path.Cells[0], Cell{0, 0}),
+		is.EqualTo(path.Cells[len(path.Cells)-1], Cell{4, 0}),
+		is.EqualTo(slices.Contains(path.Cells, Cell{1, 2}), true),
+		is.EqualTo(slices.Contains(path.Cells, Cell{2, 2}), true),
+	)
+
+	path, ok = m.FindPath(Cell{2, 0}, Cell{4, 2}, PathOptions{Rule: DiagonalAlternating})
+	expect.That(t,
+		is.EqualTo(ok, true),
+		is.EqualTo(path.Cost, 3.0),
+	)
+
+	path, ok = m.FindPath(Cell{2, 0}, Cell{4, 2}, PathOptions{
+		Rule:      DiagonalUniform,
+		Difficult: func(c Cell) bool { return c.Col == 3 },
+	})
+	expect.That(t,
+		is.EqualTo(ok, true),
+		is.EqualTo(path.Cost, 3.0),
+	)
+
+	m.SetBarrier(Cell{2, 2}, Left, Wall)
+	_, ok = m.FindPath(Cell{0, 0}, Cell{4, 0}, PathOptions{Rule: DiagonalUniform})
+	expect.That(t, is.EqualTo(ok, false))
+}
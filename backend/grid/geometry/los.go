@@ -0,0 +1,106 @@
+package geometry
+
+import "math"
+
+// SightOptions controls which barriers block line of sight.
+type SightOptions struct {
+	// OpenDoors treats all doors as open. Grids do not store the state of a
+	// door, so doors are considered closed by default.
+	OpenDoors bool
+}
+
+// blocksSight reports whether b blocks line of sight.
+func (o SightOptions) blocksSight(b Barrier) bool {
+	switch b {
+	case Wall:
+		return true
+	case Door:
+		return !o.OpenDoors
+	default:
+		return false
+	}
+}
+
+// LineOfSight reports whether there is an unobstructed line between the
+// centers of a and b. Walls and closed doors block line of sight, windows do
+// not. A line passing exactly through a corner is blocked only if both ways
+// around the corner are blocked.
+func (m *Map) LineOfSight(a, b Cell, opts SightOptions) bool {
+	if !m.Contains(a) || !m.Contains(b) {
+		return false
+	}
+
+	blocked := func(from, to Cell) bool {
+		return opts.blocksSight(m.between(from, to))
+	}
+
+	dx, dy := b.Col-a.Col, b.Row-a.Row
+	stepX, stepY := sign(dx), sign(dy)
+
+	// Walk all cells the line passes through (Amanatides & Woo). The line
+	// starts at the center of a; tMax* is the parameter at which the line
+	// crosses the next vertical or horizontal cell edge and tDelta* the
+	// parameter distance between two of these edges.
+	tMaxX, tDeltaX := math.Inf(1), math.Inf(1)
+	if dx != 0 {
+		tDeltaX = 1 / math.Abs(float64(dx))
+		tMaxX = tDeltaX / 2
+	}
+	tMaxY, tDeltaY := math.Inf(1), math.Inf(1)
+	if dy != 0 {
+		tDeltaY = 1 / math.Abs(float64(dy))
+		tMaxY = tDeltaY / 2
+	}
+
+	const epsilon = 1e-9
+
+	c := a
+	for c != b {
+		switch {
+		case math.Abs(tMaxX-tMaxY) < epsilon:
+			// The line passes through a corner.
+			horizontal := Cell{c.Col + stepX, c.Row}
+			vertical := Cell{c.Col, c.Row + stepY}
+			next := Cell{c.Col + stepX, c.Row + stepY}
+
+			viaHorizontal := blocked(c, horizontal) || blocked(horizontal, next)
+			viaVertical := blocked(c, vertical) || blocked(vertical, next)
+			if viaHorizontal && viaVertical {
+				return false
+			}
+
+			c = next
+			tMaxX += tDeltaX
+			tMaxY += tDeltaY
+
+		case tMaxX < tMaxY:
+			next := Cell{c.Col + stepX, c.Row}
+			if blocked(c, next) {
+				return false
+			}
+			c = next
+			tMaxX += tDeltaX
+
+		default:
+			next := Cell{c.Col, c.Row + stepY}
+			if blocked(c, next) {
+				return false
+			}
+			c = next
+			tMaxY += tDeltaY
+		}
+	}
+
+	return true
+}
+
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,154 @@
+package geometry
+
+import (
+	"container/heap"
+	"math"
+	"slices"
+)
+
+// PathOptions controls how paths are searched.
+type PathOptions struct {
+	// Rule defines the cost of diagonal steps.
+	Rule DiagonalRule
+	// Difficult reports whether c is difficult terrain. Entering difficult
+	// terrain costs twice as much. If nil, no cell is difficult terrain.
+	Difficult func(c Cell) bool
+}
+
+// Path is a sequence of cells from start to goal including both.
+type Path struct {
+	Cells []Cell
+	// Cost is the movement cost of the path in cells.
+	Cost float64
+}
+
+// blocksMovement reports whether b may not be crossed by a moving token.
+// Doors are passable, walls and windows are not.
+func blocksMovement(b Barrier) bool {
+	return b == Wall || b == Window
+}
+
+// FindPath searches the cheapest path from start to goal using A*. Tokens
+// move orthogonally and diagonally but may neither cross walls or windows nor
+// cut the corner of a wall when moving diagonally. It returns false if goal
+// cannot be reached.
+func (m *Map) FindPath(start, goal Cell, opts PathOptions) (Path, bool) {
+	if !m.Contains(start) || !m.Contains(goal) {
+		return Path{}, false
+	}
+
+	// With the alternating rule the cost of a diagonal step depends on the
+	// number of diagonal steps taken before, so the search state includes
+	// the parity of that number.
+	type state struct {
+		cell   Cell
+		parity int
+	}
+
+	start0 := state{cell: start}
+	cost := map[state]float64{start0: 0}
+	previous := map[state]state{}
+
+	open := &pathQueue{}
+	heap.Push(open, &pathNode{state: start0, priority: opts.Rule.Distance(start, goal)})
+
+	for open.Len() > 0 {
+		node := heap.Pop(open).(*pathNode)
+		current := node.state.(state)
+
+		if node.cost > cost[current] {
+			// Outdated entry; a cheaper way to current has been found.
+			continue
+		}
+
+		if current.cell == goal {
+			var cells []Cell
+			for s := current; ; s = previous[s] {
+				cells = append(cells, s.cell)
+				if s == start0 {
+					break
+				}
+			}
+			slices.Reverse(cells)
+			return Path{Cells: cells, Cost: cost[current]}, true
+		}
+
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if dx == 0 && dy == 0 {
+					continue
+				}
+
+				next := Cell{Col: current.cell.Col + dx, Row: current.cell.Row + dy}
+				if !m.Contains(next) || !m.canStep(current.cell, next) {
+					continue
+				}
+
+				step, parity := 1.0, current.parity
+				if dx != 0 && dy != 0 {
+					switch opts.Rule {
+					case DiagonalAlternating:
+						step = float64(1 + parity)
+						parity = 1 - parity
+					case DiagonalEuclidean:
+						step = math.Sqrt2
+					}
+				}
+
+				if opts.Difficult != nil && opts.Difficult(next) {
+					step *= 2
+				}
+
+				ns := state{cell: next, parity: parity}
+				nc := cost[current] + step
+				if c, ok := cost[ns]; ok && c <= nc {
+					continue
+				}
+
+				cost[ns] = nc
+				previous[ns] = current
+				heap.Push(open, &pathNode{state: ns, cost: nc, priority: nc + opts.Rule.Distance(next, goal)})
+			}
+		}
+	}
+
+	return Path{}, false
+}
+
+// canStep reports whether a token may move from c to its neighbor n.
+func (m *Map) canStep(c, n Cell) bool {
+	if c.Col == n.Col || c.Row == n.Row {
+		return !blocksMovement(m.between(c, n))
+	}
+
+	// Diagonal steps require both ways around the corner to be free.
+	horizontal := Cell{Col: n.Col, Row: c.Row}
+	vertical := Cell{Col: c.Col, Row: n.Row}
+
+	return !blocksMovement(m.between(c, horizontal)) &&
+		!blocksMovement(m.between(horizontal, n)) &&
+		!blocksMovement(m.between(c, vertical)) &&
+		!blocksMovement(m.between(vertical, n))
+}
+
+type pathNode struct {
+	state    any
+	cost     float64
+	priority float64
+}
+
+// pathQueue implements heap.Interface as a min heap ordered by priority.
+type pathQueue []*pathNode
+
+func (q pathQueue) Len() int           { return len(q) }
+func (q pathQueue) Less(i, j int) bool { return q[i].priority < q[j].priority }
+func (q pathQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *pathQueue) Push(x any) { *q = append(*q, x.(*pathNode)) }
+
+func (q *pathQueue) Pop() any {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
@@ -0,0 +1,113 @@
+package geometry
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Shape defines the shape of an area of effect template.
+type Shape string
+
+const (
+	// ShapeBurst covers all cells within a radius around the origin.
+	ShapeBurst Shape = "burst"
+	// ShapeCone covers a cone starting at the origin whose width equals the
+	// distance from the origin.
+	ShapeCone Shape = "cone"
+	// ShapeLine covers a line one cell wide starting at the origin.
+	ShapeLine Shape = "line"
+)
+
+// ErrInvalidTemplate is returned for templates which cannot be applied.
+var ErrInvalidTemplate = errors.New("invalid template")
+
+// Template is an area of effect template placed on a map.
+type Template struct {
+	Shape Shape
+	// Origin is the cell the effect originates from.
+	Origin Cell
+	// Toward defines the direction of cones and lines. It is not used for
+	// bursts.
+	Toward Cell
+	// Size is the radius of a burst or the length of a cone or line in cells.
+	// It must not exceed the sum of the map's columns and rows.
+	Size float64
+}
+
+// Coverage is the result of applying a template to a map.
+type Coverage struct {
+	// Cells contains all covered cells ordered by row and column.
+	Cells []Cell
+	// End is the cell at which a cone or line ends. For bursts it equals the
+	// origin. End may lie outside of the map.
+	End Cell
+}
+
+// Cover computes the cells covered by t. Only cells within the map which
+// are in line of sight of the origin are covered, so walls and closed doors
+// stop an effect. Distances for bursts are measured using rule.
+func (m *Map) Cover(t Template, rule DiagonalRule, opts SightOptions) (Coverage, error) {
+	if !m.Contains(t.Origin) {
+		return Coverage{}, fmt.Errorf("%w: origin %s outside of map", ErrInvalidTemplate, t.Origin)
+	}
+	if math.IsNaN(t.Size) || t.Size <= 0 || t.Size > float64(m.Cols+m.Rows) {
+		return Coverage{}, fmt.Errorf("%w: size must be positive and must not exceed the map", ErrInvalidTemplate)
+	}
+
+	var covers func(c Cell) bool
+	end := t.Origin
+
+	switch t.Shape {
+	case ShapeBurst:
+		covers = func(c Cell) bool {
+			return rule.Distance(t.Origin, c) <= t.Size
+		}
+
+	case ShapeCone, ShapeLine:
+		dx, dy := float64(t.Toward.Col-t.Origin.Col), float64(t.Toward.Row-t.Origin.Row)
+		length := math.Hypot(dx, dy)
+		if length == 0 {
+			return Coverage{}, fmt.Errorf("%w: %s requires a direction", ErrInvalidTemplate, t.Shape)
+		}
+		ux, uy := dx/length, dy/length
+
+		end = Cell{
+			Col: t.Origin.Col + int(math.Round(ux*t.Size)),
+			Row: t.Origin.Row + int(math.Round(uy*t.Size)),
+		}
+
+		const epsilon = 1e-9
+		covers = func(c Cell) bool {
+			vx, vy := float64(c.Col-t.Origin.Col), float64(c.Row-t.Origin.Row)
+			along := vx*ux + vy*uy
+			across := math.Abs(vx*uy - vy*ux)
+
+			if along <= 0 || along > t.Size+epsilon {
+				return false
+			}
+
+			if t.Shape == ShapeCone {
+				return across <= along/2+epsilon
+			}
+			return across <= 0.5+epsilon
+		}
+
+	default:
+		return Coverage{}, fmt.Errorf("%w: unknown shape %q", ErrInvalidTemplate, t.Shape)
+	}
+
+	reach := int(math.Ceil(t.Size))
+	var cells []Cell
+
+	for row := max(t.Origin.Row-reach, 0); row <= min(t.Origin.Row+reach, m.Rows-1); row++ {
+		for col := max(t.Origin.Col-reach, 0); col <= min(t.Origin.Col+reach, m.Cols-1); col++ {
+			c := Cell{Col: col, Row: row}
+			if covers(c) && m.LineOfSight(t.Origin, c, opts) {
+				cells = append(cells, c)
+			}
+		}
+	}
+
+	return Coverage{Cells: cells, End: end}, nil
+}
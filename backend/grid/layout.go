@@ -0,0 +1,444 @@
+package grid
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Color defines the colors available for tokens, walls and backgrounds.
+type Color string
+
+const (
+	ColorGrey   Color = "grey"
+	ColorGreen  Color = "green"
+	ColorBlue   Color = "blue"
+	ColorRed    Color = "red"
+	ColorOrange Color = "orange"
+	ColorPurple Color = "purple"
+	ColorYellow Color = "yellow"
+	ColorBlack  Color = "black"
+	ColorBrown  Color = "brown"
+)
+
+// Colors contains all available colors in the same order used by the
+// frontend.
+var Colors = []Color{ColorGrey, ColorGreen, ColorBrown, ColorBlue, ColorRed, ColorOrange, ColorPurple, ColorYellow, ColorBlack}
+
+var colorChars = map[Color]byte{
+	ColorGrey:   'e',
+	ColorGreen:  'g',
+	ColorBlue:   'b',
+	ColorRed:    'r',
+	ColorOrange: 'o',
+	ColorPurple: 'p',
+	ColorYellow: 'y',
+	ColorBlack:  'k',
+	ColorBrown:  'w',
+}
+
+// TokenSymbol defines the symbol of a token. The values are the same
+// characters used by the frontend to display a token.
+type TokenSymbol string
+
+const (
+	SymbolPawn         TokenSymbol = "♙"
+	SymbolKing         TokenSymbol = "♔"
+	SymbolQueen        TokenSymbol = "♕"
+	SymbolRook         TokenSymbol = "♖"
+	SymbolBishop       TokenSymbol = "♗"
+	SymbolKnight       TokenSymbol = "♘"
+	SymbolStar         TokenSymbol = "✦"
+	SymbolCircle       TokenSymbol = "●"
+	SymbolTriangleUp   TokenSymbol = "▲"
+	SymbolTriangleDown TokenSymbol = "▼"
+	SymbolSquare       TokenSymbol = "■"
+	SymbolDiamond      TokenSymbol = "◆"
+)
+
+// TokenSymbols contains all available token symbols in the same order used by
+// the frontend.
+var TokenSymbols = []TokenSymbol{
+	SymbolPawn, SymbolKing, SymbolQueen, SymbolRook, SymbolBishop, SymbolKnight,
+	SymbolStar, SymbolCircle, SymbolTriangleUp, SymbolTriangleDown, SymbolSquare, SymbolDiamond,
+}
+
+// tokenSymbolChars maps token symbols to the characters used in a descriptor.
+// Note that the mapping is not bijective (king and knight as well as bishop
+// and square share a character). Decoding resolves these to the symbol listed
+// last in TokenSymbols, which is what the frontend does.
+var tokenSymbolChars = map[TokenSymbol]byte{
+	SymbolPawn:         'p',
+	SymbolKing:         'k',
+	SymbolQueen:        'q',
+	SymbolRook:         'c',
+	SymbolBishop:       'b',
+	SymbolKnight:       'k',
+	SymbolStar:         'x',
+	SymbolCircle:       'o',
+	SymbolTriangleUp:   'a',
+	SymbolTriangleDown: 'v',
+	SymbolSquare:       'b',
+	SymbolDiamond:      'z',
+}
+
+// WallSymbol defines the kind of a wall.
+type WallSymbol string
+
+const (
+	WallSymbolWall   WallSymbol = "wall"
+	WallSymbolDoor   WallSymbol = "door"
+	WallSymbolWindow WallSymbol = "window"
+)
+
+// WallSymbols contains all available wall symbols.
+var WallSymbols = []WallSymbol{WallSymbolWall, WallSymbolDoor, WallSymbolWindow}
+
+var wallSymbolChars = map[WallSymbol]byte{
+	WallSymbolWall:   'l',
+	WallSymbolDoor:   'd',
+	WallSymbolWindow: 'w',
+}
+
+// WallPosition defines the edge of a cell a wall is placed on.
+type WallPosition string
+
+const (
+	WallPositionLeft WallPosition = "left"
+	WallPositionTop  WallPosition = "top"
+)
+
+// WallPositions contains all available wall positions.
+var WallPositions = []WallPosition{WallPositionLeft, WallPositionTop}
+
+// Token is a marker occupying a single cell.
+type Token struct {
+	Symbol TokenSymbol
+	Color  Color
+}
+
+// Wall is placed on the left or top edge of a single cell.
+type Wall struct {
+	Symbol WallSymbol
+	Color  Color
+}
+
+// Layout is the decoded form of a grid descriptor. Cells are stored row by
+// row. Every cell carries two wall slots: the first one for the left edge and
+// the second one for the top edge.
+type Layout struct {
+	Cols, Rows int
+	Background []Color
+	Tokens     []*Token
+	Walls      []*Wall
+}
+
+// MaxLayoutSize is the maximum number of columns and rows of a layout.
+const MaxLayoutSize = 1000
+
+// IsValidLayoutSize reports whether cols and rows are valid dimensions of a
+// layout.
+func IsValidLayoutSize(cols, rows int) bool {
+	return cols >= 1 && rows >= 1 && cols <= MaxLayoutSize && rows <= MaxLayoutSize
+}
+
+// NewLayout creates an empty layout with the given dimensions. Callers must
+// make sure the dimensions are valid using IsValidLayoutSize.
+func NewLayout(cols, rows int) Layout {
+	return Layout{
+		Cols:       cols,
+		Rows:       rows,
+		Background: make([]Color, cols*rows),
+		Tokens:     make([]*Token, cols*rows),
+		Walls:      make([]*Wall, cols*rows*2),
+	}
+}
+
+// Contains reports whether col and row denote a cell of l.
+func (l Layout) Contains(col, row int) bool {
+	return col >= 0 && row >= 0 && col < l.Cols && row < l.Rows
+}
+
+func (l Layout) cellIndex(col, row int) int {
+	return row*l.Cols + col
+}
+
+func (l Layout) wallIndex(col, row int, pos WallPosition) int {
+	i := row*l.Cols*2 + col*2
+	if pos == WallPositionTop {
+		i++
+	}
+	return i
+}
+
+// BackgroundAt returns the background color of the given cell or the empty
+// string if none is set.
+func (l Layout) BackgroundAt(col, row int) Color {
+	return l.Background[l.cellIndex(col, row)]
+}
+
+// SetBackgroundAt sets the background color of the given cell. Passing an
+// empty color removes the background.
+func (l Layout) SetBackgroundAt(col, row int, c Color) {
+	l.Background[l.cellIndex(col, row)] = c
+}
+
+// TokenAt returns the token placed on the given cell or nil.
+func (l Layout) TokenAt(col, row int) *Token {
+	return l.Tokens[l.cellIndex(col, row)]
+}
+
+// SetTokenAt places t on the given cell. Passing nil removes the token.
+func (l Layout) SetTokenAt(col, row int, t *Token) {
+	l.Tokens[l.cellIndex(col, row)] = t
+}
+
+// WallAt returns the wall placed on the given edge of a cell or nil.
+func (l Layout) WallAt(col, row int, pos WallPosition) *Wall {
+	return l.Walls[l.wallIndex(col, row, pos)]
+}
+
+// SetWallAt places w on the given edge of a cell. Passing nil removes the
+// wall.
+func (l Layout) SetWallAt(col, row int, pos WallPosition, w *Wall) {
+	l.Walls[l.wallIndex(col, row, pos)] = w
+}
+
+// Clone returns a deep copy of l.
+func (l Layout) Clone() Layout {
+	c := NewLayout(l.Cols, l.Rows)
+	copy(c.Background, l.Background)
+	copy(c.Tokens, l.Tokens)
+	copy(c.Walls, l.Walls)
+	return c
+}
+
+// Resize returns a copy of l with the given dimensions. Content outside of the
+// new dimensions is dropped.
+func (l Layout) Resize(cols, rows int) Layout {
+	r := NewLayout(cols, rows)
+	for row := 0; row < min(l.Rows, rows); row++ {
+		for col := 0; col < min(l.Cols, cols); col++ {
+			r.SetBackgroundAt(col, row, l.BackgroundAt(col, row))
+			r.SetTokenAt(col, row, l.TokenAt(col, row))
+			for _, pos := range WallPositions {
+				r.SetWallAt(col, row, pos, l.WallAt(col, row, pos))
+			}
+		}
+	}
+	return r
+}
+
+// --
+
+var ErrInvalidDescriptor = errors.New("invalid descriptor")
+
+// ParseLayout parses a grid descriptor as produced by the frontend. A
+// descriptor has the form
+//
+//	<cols>x<rows>:<backgrounds>:<tokens>:<walls>
+//
+// where each of the three content parts is run length encoded: a run of empty
+// cells is written as "-<count>", a run of equal values as the value's
+// encoding followed by the count.
+func ParseLayout(descriptor string) (Layout, error) {
+	parts := strings.Split(descriptor, ":")
+	for len(parts) < 4 {
+		parts = append(parts, "")
+	}
+
+	colsString, rowsString, ok := strings.Cut(parts[0], "x")
+	if !ok {
+		return Layout{}, fmt.Errorf("%w: invalid size: %q", ErrInvalidDescriptor, parts[0])
+	}
+
+	cols, err := strconv.Atoi(colsString)
+	if err != nil || cols < 1 || cols > MaxLayoutSize {
+		return Layout{}, fmt.Errorf("%w: invalid number of columns: %q", ErrInvalidDescriptor, colsString)
+	}
+
+	rows, err := strconv.Atoi(rowsString)
+	if err != nil || rows < 1 || rows > MaxLayoutSize {
+		return Layout{}, fmt.Errorf("%w: invalid number of rows: %q", ErrInvalidDescriptor, rowsString)
+	}
+
+	l := NewLayout(cols, rows)
+
+	err = decodeRuns(parts[1], 1, len(l.Background), func(i int, value string) {
+		l.Background[i] = decodeColor(value[0])
+	})
+	if err != nil {
+		return Layout{}, fmt.Errorf("%w: backgrounds: %v", ErrInvalidDescriptor, err)
+	}
+
+	err = decodeRuns(parts[2], 2, len(l.Tokens), func(i int, value string) {
+		l.Tokens[i] = &Token{Symbol: decodeTokenSymbol(value[0]), Color: decodeColor(value[1])}
+	})
+	if err != nil {
+		return Layout{}, fmt.Errorf("%w: tokens: %v", ErrInvalidDescriptor, err)
+	}
+
+	err = decodeRuns(parts[3], 2, len(l.Walls), func(i int, value string) {
+		l.Walls[i] = &Wall{Symbol: decodeWallSymbol(value[0]), Color: decodeColor(value[1])}
+	})
+	if err != nil {
+		return Layout{}, fmt.Errorf("%w: walls: %v", ErrInvalidDescriptor, err)
+	}
+
+	return l, nil
+}
+
+// decodeRuns decodes the run length encoded string s where each value is
+// encoded using valueLen bytes. It invokes set for every non-empty slot.
+// Runs exceeding size are rejected.
+func decodeRuns(s string, valueLen, size int, set func(i int, value string)) error {
+	index := 0
+	for i := 0; i < len(s) && index < size; {
+		value := "-"
+		if s[i] != '-' {
+			if i+valueLen > len(s) {
+				return fmt.Errorf("truncated value at %d", i)
+			}
+			value = s[i : i+valueLen]
+			i += valueLen
+		} else {
+			i++
+		}
+
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		count, err := strconv.Atoi(s[start:i])
+		if err != nil {
+			return fmt.Errorf("missing count at %d", start)
+		}
+		if count > size-index {
+			return fmt.Errorf("run at %d exceeds size %d", start, size)
+		}
+
+		if value != "-" {
+			for j := index; j < index+count; j++ {
+				set(j, value)
+			}
+		}
+		index += count
+	}
+
+	return nil
+}
+
+func decodeColor(c byte) Color {
+	for _, color := range Colors {
+		if colorChars[color] == c {
+			return color
+		}
+	}
+	return Colors[0]
+}
+
+func decodeTokenSymbol(c byte) TokenSymbol {
+	symbol := TokenSymbols[0]
+	for _, s := range TokenSymbols {
+		if tokenSymbolChars[s] == c {
+			symbol = s
+		}
+	}
+	return symbol
+}
+
+func decodeWallSymbol(c byte) WallSymbol {
+	for _, s := range WallSymbols {
+		if wallSymbolChars[s] == c {
+			return s
+		}
+	}
+	return WallSymbolWall
+}
+
+// Descriptor encodes l in the descriptor format understood by the frontend.
+func (l Layout) Descriptor() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%dx%d:", l.Cols, l.Rows)
+
+	encodeRuns(&b, len(l.Background), func(i int) string {
+		if l.Background[i] == "" {
+			return ""
+		}
+		return string(colorChars[l.Background[i]])
+	})
+	b.WriteByte(':')
+
+	encodeRuns(&b, len(l.Tokens), func(i int) string {
+		t := l.Tokens[i]
+		if t == nil {
+			return ""
+		}
+		return string([]byte{tokenSymbolChars[t.Symbol], colorChars[t.Color]})
+	})
+	b.WriteByte(':')
+
+	encodeRuns(&b, len(l.Walls), func(i int) string {
+		w := l.Walls[i]
+		if w == nil {
+			return ""
+		}
+		return string([]byte{wallSymbolChars[w.Symbol], colorChars[w.Color]})
+	})
+
+	return b.String()
+}
+
+func encodeRuns(b *strings.Builder, size int, value func(i int) string) {
+	last := ""
+	count := 0
+
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		if last == "" {
+			b.WriteByte('-')
+		} else {
+			b.WriteString(last)
+		}
+		b.WriteString(strconv.Itoa(count))
+	}
+
+	for i := 0; i < size; i++ {
+		v := value(i)
+		if count > 0 && v == last {
+			count++
+			continue
+		}
+		flush()
+		last = v
+		count = 1
+	}
+	flush()
+}
+
+// IsValidColor reports whether c is one of the available colors.
+func IsValidColor(c Color) bool {
+	_, ok := colorChars[c]
+	return ok
+}
+
+// IsValidTokenSymbol reports whether s is one of the available token symbols.
+func IsValidTokenSymbol(s TokenSymbol) bool {
+	_, ok := tokenSymbolChars[s]
+	return ok
+}
+
+// IsValidWallSymbol reports whether s is one of the available wall symbols.
+func IsValidWallSymbol(s WallSymbol) bool {
+	_, ok := wallSymbolChars[s]
+	return ok
+}
+
+// IsValidWallPosition reports whether p is one of the available wall
+// positions.
+func IsValidWallPosition(p WallPosition) bool {
+	return p == WallPositionLeft || p == WallPositionTop
+}
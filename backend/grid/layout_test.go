@@ -0,0 +1,121 @@
+package grid
+
+import (
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestParseLayout(t *testing.T) {
+	l, err := ParseLayout("4x2:-1g2-5:-2pr1-1zb1-3:de1-15")
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	expect.That(t,
+		is.EqualTo(l.Cols, 4),
+		is.EqualTo(l.Rows, 2),
+		is.EqualTo(l.BackgroundAt(0, 0), Color("")),
+		is.EqualTo(l.BackgroundAt(1, 0), ColorGreen),
+		is.EqualTo(l.BackgroundAt(2, 0), ColorGreen),
+		is.DeepEqualTo(l.TokenAt(2, 0), &Token{Symbol: SymbolPawn, Color: ColorRed}),
+		is.DeepEqualTo(l.TokenAt(0, 1), &Token{Symbol: SymbolDiamond, Color: ColorBlue}),
+		is.DeepEqualTo(l.WallAt(0, 0, WallPositionLeft), &Wall{Symbol: WallSymbolDoor, Color: ColorGrey}),
+		is.EqualTo(l.WallAt(0, 0, WallPositionTop) == nil, true),
+	)
+}
+
+func TestParseLayout_ambiguousSymbols(t *testing.T) {
+	l, err := ParseLayout("2x1:-2:kr1br1:-4")
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	expect.That(t,
+		is.EqualTo(l.TokenAt(0, 0).Symbol, SymbolKnight),
+		is.EqualTo(l.TokenAt(1, 0).Symbol, SymbolSquare),
+	)
+}
+
+func TestParseLayout_invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"4:-4",
+		"ax2:-8",
+		"0x2:",
+		"1001x1:",
+		"1x1001:",
+		"3000000000x3000000000:",
+		"2x2:-4:p",
+		"2x2:-4:pr",
+		"2x1:r3",
+		"2x1:e1-9223372036854775807e5::",
+	}
+
+	for _, test := range tests {
+		_, err := ParseLayout(test)
+		expect.That(t, is.Error(err, ErrInvalidDescriptor))
+	}
+}
+
+func TestLayout_Descriptor(t *testing.T) {
+	tests := []string{
+		"4x2:-1g2-5:-2pr1-1zb1-3:de1-15",
+		"30x20:-600:-600:-1200",
+		"3x1:r3:ok3:lk2wg1dp1le1-1",
+	}
+
+	for _, test := range tests {
+		l, err := ParseLayout(test)
+		expect.That(t,
+			expect.FailNow(is.NoError(err)),
+			is.EqualTo(l.Descriptor(), test),
+		)
+	}
+}
+
+func TestLayout_Resize(t *testing.T) {
+	l := NewLayout(3, 3)
+	l.SetTokenAt(1, 1, &Token{Symbol: SymbolStar, Color: ColorYellow})
+	l.SetTokenAt(2, 2, &Token{Symbol: SymbolStar, Color: ColorYellow})
+	l.SetWallAt(1, 0, WallPositionTop, &Wall{Symbol: WallSymbolWindow, Color: ColorBlack})
+
+	r := l.Resize(2, 4)
+
+	expect.That(t,
+		is.EqualTo(r.Descriptor(), "2x4:-8:-3xy1-4:-3wk1-12"),
+	)
+}
+
+func TestStructuredWriteDTO_Values(t *testing.T) {
+	dto := StructuredWriteDTO{
+		Label: "test",
+		Cols:  2,
+		Rows:  2,
+		Backgrounds: []BackgroundDTO{
+			{Col: 1, Row: 1, Color: ColorBrown},
+		},
+		Tokens: []TokenDTO{
+			{Col: 0, Row: 1, Symbol: SymbolRook, Color: ColorPurple},
+		},
+		Walls: []WallDTO{
+			{Col: 1, Row: 0, Position: WallPositionLeft, Kind: WallSymbolWall, Color: ColorOrange},
+		},
+	}
+
+	vals, err := dto.Values()
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(vals, Values{Label: "test", Descriptor: "2x2:-3w1:-2cp1-1:-2lo1-5"}),
+	)
+
+	l, err := ParseLayout(vals.Descriptor)
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(layoutToStructuredDTO("test", l), dto),
+	)
+
+	dto.Tokens[0].Col = 2
+	_, err = dto.Values()
+	expect.That(t, is.Error(err, ErrInvalidDescriptor))
+
+	_, err = StructuredWriteDTO{Cols: 3000000000, Rows: 3000000000}.Values()
+	expect.That(t, is.Error(err, ErrInvalidDescriptor))
+}
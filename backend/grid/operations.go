@@ -0,0 +1,172 @@
+package grid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OperationType defines the kind of change an Operation applies to a grid.
+type OperationType string
+
+const (
+	OpPlaceToken    OperationType = "placeToken"
+	OpRemoveToken   OperationType = "removeToken"
+	OpMoveToken     OperationType = "moveToken"
+	OpSetBackground OperationType = "setBackground"
+	OpAddWall       OperationType = "addWall"
+	OpRemoveWall    OperationType = "removeWall"
+	OpResize        OperationType = "resize"
+	OpRename        OperationType = "rename"
+)
+
+// Operation is a single, typed change to a grid. Which fields are used depends
+// on Type:
+//
+//   - OpPlaceToken: Col, Row, Symbol, Color
+//   - OpRemoveToken: Col, Row
+//   - OpMoveToken: Col, Row, ToCol, ToRow
+//   - OpSetBackground: Col, Row, Color (an empty color removes the background)
+//   - OpAddWall: Col, Row, Position, Kind, Color
+//   - OpRemoveWall: Col, Row, Position
+//   - OpResize: Cols, Rows
+//   - OpRename: Label
+type Operation struct {
+	Type         OperationType
+	Col, Row     int
+	ToCol, ToRow int
+	Symbol       TokenSymbol
+	Color        Color
+	Position     WallPosition
+	Kind         WallSymbol
+	Cols, Rows   int
+	Label        string
+}
+
+// Patch is a list of operations applied atomically to a grid, producing the
+// given version.
+type Patch struct {
+	Version    int
+	Operations []Operation
+}
+
+var (
+	// ErrInvalidOperation is returned when an operation is malformed.
+	ErrInvalidOperation = errors.New("invalid operation")
+
+	// ErrConflict is returned when an operation cannot be applied to the
+	// current state of a grid, i.e. because the token to move has been moved
+	// by someone else.
+	ErrConflict = errors.New("conflict")
+)
+
+// Apply applies op to l and label and returns the resulting layout and
+// label. l is modified in place unless op resizes it.
+func (op Operation) Apply(l Layout, label string) (Layout, string, error) {
+	cellOp := op.Type != OpResize && op.Type != OpRename
+	if cellOp && !l.Contains(op.Col, op.Row) {
+		return l, label, fmt.Errorf("%w: %s: cell %d/%d out of range", ErrInvalidOperation, op.Type, op.Col, op.Row)
+	}
+
+	switch op.Type {
+	case OpPlaceToken:
+		if !IsValidTokenSymbol(op.Symbol) || !IsValidColor(op.Color) {
+			return l, label, fmt.Errorf("%w: %s: invalid token", ErrInvalidOperation, op.Type)
+		}
+		l.SetTokenAt(op.Col, op.Row, &Token{Symbol: op.Symbol, Color: op.Color})
+
+	case OpRemoveToken:
+		l.SetTokenAt(op.Col, op.Row, nil)
+
+	case OpMoveToken:
+		if !l.Contains(op.ToCol, op.ToRow) {
+			return l, label, fmt.Errorf("%w: %s: cell %d/%d out of range", ErrInvalidOperation, op.Type, op.ToCol, op.ToRow)
+		}
+		t := l.TokenAt(op.Col, op.Row)
+		if t == nil {
+			return l, label, fmt.Errorf("%w: no token at %d/%d", ErrConflict, op.Col, op.Row)
+		}
+		if (op.Col != op.ToCol || op.Row != op.ToRow) && l.TokenAt(op.ToCol, op.ToRow) != nil {
+			return l, label, fmt.Errorf("%w: cell %d/%d is occupied", ErrConflict, op.ToCol, op.ToRow)
+		}
+		l.SetTokenAt(op.Col, op.Row, nil)
+		l.SetTokenAt(op.ToCol, op.ToRow, t)
+
+	case OpSetBackground:
+		if op.Color != "" && !IsValidColor(op.Color) {
+			return l, label, fmt.Errorf("%w: %s: invalid color", ErrInvalidOperation, op.Type)
+		}
+		l.SetBackgroundAt(op.Col, op.Row, op.Color)
+
+	case OpAddWall:
+		if !IsValidWallPosition(op.Position) || !IsValidWallSymbol(op.Kind) || !IsValidColor(op.Color) {
+			return l, label, fmt.Errorf("%w: %s: invalid wall", ErrInvalidOperation, op.Type)
+		}
+		l.SetWallAt(op.Col, op.Row, op.Position, &Wall{Symbol: op.Kind, Color: op.Color})
+
+	case OpRemoveWall:
+		if !IsValidWallPosition(op.Position) {
+			return l, label, fmt.Errorf("%w: %s: invalid wall position", ErrInvalidOperation, op.Type)
+		}
+		l.SetWallAt(op.Col, op.Row, op.Position, nil)
+
+	case OpResize:
+		if !IsValidLayoutSize(op.Cols, op.Rows) {
+			return l, label, fmt.Errorf("%w: %s: invalid size %dx%d", ErrInvalidOperation, op.Type, op.Cols, op.Rows)
+		}
+		l = l.Resize(op.Cols, op.Rows)
+
+	case OpRename:
+		label = op.Label
+
+	default:
+		return l, label, fmt.Errorf("%w: unknown operation type %q", ErrInvalidOperation, op.Type)
+	}
+
+	return l, label, nil
+}
+
+// Patch applies ops atomically to the current state of the grid identified by
+// id. Either all operations are applied - producing a new version of the grid
+// - or none. The applied operations are broadcasted to all subscribers.
+func (svc *GridService) Patch(ctx context.Context, id string, ops []Operation) (Grid, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	original, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return Grid{}, err
+	}
+
+	l, err := ParseLayout(original.Descriptor)
+	if err != nil {
+		return Grid{}, err
+	}
+	label := original.Label
+
+	for _, op := range ops {
+		l, label, err = op.Apply(l, label)
+		if err != nil {
+			return Grid{}, err
+		}
+	}
+
+	grid := Grid{
+		id:           original.id,
+		ownerID:      original.ownerID,
+		LastModified: time.Now(),
+		Version:      original.Version + 1,
+		Fog:          original.Fog.clip(l.Cols, l.Rows),
+		Values: Values{
+			Label:      label,
+			Descriptor: l.Descriptor(),
+		},
+	}
+
+	if err := svc.repo.Patch(grid, ops); err != nil {
+		return Grid{}, err
+	}
+
+	return grid, svc.followTokens(grid, ops, l)
+}
@@ -0,0 +1,112 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestOperation_Apply(t *testing.T) {
+	l := NewLayout(3, 2)
+	label := "test"
+
+	ops := []Operation{
+		{Type: OpPlaceToken, Col: 0, Row: 0, Symbol: SymbolKing, Color: ColorRed},
+		{Type: OpMoveToken, Col: 0, Row: 0, ToCol: 2, ToRow: 1},
+		{Type: OpSetBackground, Col: 1, Row: 1, Color: ColorBlue},
+		{Type: OpAddWall, Col: 1, Row: 0, Position: WallPositionTop, Kind: WallSymbolDoor, Color: ColorBrown},
+		{Type: OpRename, Label: "renamed"},
+	}
+
+	var err error
+	for _, op := range ops {
+		l, label, err = op.Apply(l, label)
+		expect.That(t, expect.FailNow(is.NoError(err)))
+	}
+
+	expect.That(t,
+		is.EqualTo(label, "renamed"),
+		is.EqualTo(l.Descriptor(), "3x2:-4b1-1:-5kr1:-3dw1-8"),
+	)
+
+	l, _, err = Operation{Type: OpResize, Cols: 2, Rows: 2}.Apply(l, label)
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(l.Descriptor(), "2x2:-3b1:-4:-3dw1-4"),
+	)
+}
+
+func TestOperation_Apply_errors(t *testing.T) {
+	l := NewLayout(2, 2)
+	l.SetTokenAt(0, 0, &Token{Symbol: SymbolPawn, Color: ColorGreen})
+	l.SetTokenAt(1, 1, &Token{Symbol: SymbolPawn, Color: ColorGreen})
+
+	tests := map[string]struct {
+		op   Operation
+		want error
+	}{
+		"unknown":       {Operation{Type: "explode"}, ErrInvalidOperation},
+		"outOfRange":    {Operation{Type: OpRemoveToken, Col: 2}, ErrInvalidOperation},
+		"invalidSymbol": {Operation{Type: OpPlaceToken, Symbol: "x", Color: ColorRed}, ErrInvalidOperation},
+		"invalidColor":  {Operation{Type: OpSetBackground, Color: "pink"}, ErrInvalidOperation},
+		"invalidSize":   {Operation{Type: OpResize}, ErrInvalidOperation},
+		"oversized":     {Operation{Type: OpResize, Cols: MaxLayoutSize + 1, Rows: 1}, ErrInvalidOperation},
+		"noToken":       {Operation{Type: OpMoveToken, Col: 1, ToRow: 1}, ErrConflict},
+		"occupied":      {Operation{Type: OpMoveToken, Col: 1, Row: 1}, ErrConflict},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := test.op.Apply(l.Clone(), "")
+			expect.That(t, is.Error(err, test.want))
+		})
+	}
+}
+
+func TestRepository_Subscribe_patch(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "1x1:-1:-1:-2"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sup := repo.Subscribe(ctx, "owner", "grid", nil, nil)
+
+	op := Operation{Type: OpPlaceToken, Symbol: SymbolStar, Color: ColorYellow}
+	g.Version = 2
+	g.Descriptor = "1x1:-1:xy1:-2"
+	expect.That(t, expect.FailNow(is.NoError(repo.Patch(g, []Operation{op}))))
+
+	patched := <-sup.C()
+
+	g.Version = 3
+	g.Label = "renamed"
+	expect.That(t, expect.FailNow(is.NoError(repo.Update(g))))
+
+	// A patch is delivered as a single event.
+	updated := <-sup.C()
+
+	expect.That(t,
+		is.EqualTo(patched.Type, EventPatched),
+		is.DeepEqualTo(patched.Patch, Patch{Version: 2, Operations: []Operation{op}}),
+		is.EqualTo(patched.Grid.ID(), "owner:grid"),
+		is.EqualTo(patched.Grid.Descriptor, "1x1:-1:xy1:-2"),
+		is.EqualTo(updated.Type, EventUpdated),
+		is.EqualTo(updated.Grid.Label, "renamed"),
+	)
+}
@@ -1,19 +1,42 @@
 package grid
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/grid/geometry"
 	"github.com/halimath/d20-tools/infra/shelf"
 	"github.com/halimath/kvlog"
 )
 
+// DefaultRevisionLimit is the number of revisions kept per grid unless
+// configured otherwise using WithRevisionLimit.
+const DefaultRevisionLimit = 50
+
 type Repository struct {
-	s *shelf.Shelf
+	s             *shelf.Shelf
+	revisionLimit int
+}
+
+// RepositoryOption defines a functional option for configuring a Repository.
+type RepositoryOption func(*Repository)
+
+// WithRevisionLimit configures the number of revisions kept for every grid.
+// Older revisions are removed when a new revision is created. At least the
+// latest revision is always kept, so limits below 1 are treated as 1.
+func WithRevisionLimit(limit int) RepositoryOption {
+	return func(r *Repository) {
+		r.revisionLimit = max(limit, 1)
+	}
 }
 
 var (
@@ -22,36 +45,179 @@ var (
 )
 
 type gridDBO struct {
-	Label        string `json:"label"`
-	Descriptor   string `json:"descriptor"`
-	OwnerID      string `json:"owner_id"`
-	LastModified int64  `json:"last_modified"`
+	Label        string   `json:"label"`
+	Descriptor   string   `json:"descriptor"`
+	OwnerID      string   `json:"owner_id"`
+	LastModified int64    `json:"last_modified"`
+	Version      int      `json:"version,omitempty"`
+	Fog          [][2]int `json:"fog,omitempty"`
+}
+
+type shareDBO struct {
+	Role    Role  `json:"role"`
+	Created int64 `json:"created"`
+	Expires int64 `json:"expires,omitempty"`
+	MaxUses int   `json:"max_uses,omitempty"`
+	Uses    int   `json:"uses"`
+}
+
+type settingsDBO struct {
+	Diagonal string  `json:"diagonal"`
+	Scale    float64 `json:"scale"`
+	Unit     string  `json:"unit"`
+}
+
+type combatDBO struct {
+	Combatants []combatantDBO        `json:"combatants"`
+	Round      int                   `json:"round"`
+	Turn       int                   `json:"turn"`
+	Tokens     []tokenConditionDBO   `json:"tokens,omitempty"`
+	Expired    []expiredConditionDBO `json:"expired,omitempty"`
+}
+
+type conditionDBO struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	Rounds           int    `json:"rounds,omitempty"`
+	Anchor           string `json:"anchor,omitempty"`
+	UntilEndOfTurnOf string `json:"until_end_of_turn_of,omitempty"`
+	TurnStarted      bool   `json:"turn_started,omitempty"`
+}
+
+type tokenConditionDBO struct {
+	Cell      [2]int       `json:"cell"`
+	Condition conditionDBO `json:"condition"`
+}
+
+type expiredConditionDBO struct {
+	Combatant string       `json:"combatant,omitempty"`
+	Cell      *[2]int      `json:"cell,omitempty"`
+	Condition conditionDBO `json:"condition"`
+}
+
+type rollDBO struct {
+	Created  int64  `json:"created"`
+	RollerID string `json:"roller_id"`
+	Roller   string `json:"roller"`
+	Private  bool   `json:"private,omitempty"`
+	Session  string `json:"session,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+	dice.Record
+}
+
+type fairSessionDBO struct {
+	Seed     string `json:"seed"`
+	Started  int64  `json:"started"`
+	Revealed int64  `json:"revealed,omitempty"`
+}
+
+type combatantDBO struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Initiative int             `json:"initiative"`
+	Modifier   int             `json:"modifier,omitempty"`
+	Player     bool            `json:"player,omitempty"`
+	Status     CombatantStatus `json:"status,omitempty"`
+	Trigger    string          `json:"trigger,omitempty"`
+	Conditions []conditionDBO  `json:"conditions,omitempty"`
+}
+
+type revisionDBO struct {
+	Label      string         `json:"label"`
+	Descriptor string         `json:"descriptor"`
+	Created    int64          `json:"created"`
+	Operations []operationDBO `json:"operations,omitempty"`
+}
+
+type operationDBO struct {
+	Type     OperationType `json:"op"`
+	Col      int           `json:"col"`
+	Row      int           `json:"row"`
+	ToCol    int           `json:"toCol,omitempty"`
+	ToRow    int           `json:"toRow,omitempty"`
+	Symbol   TokenSymbol   `json:"symbol,omitempty"`
+	Color    Color         `json:"color,omitempty"`
+	Position WallPosition  `json:"position,omitempty"`
+	Kind     WallSymbol    `json:"kind,omitempty"`
+	Cols     int           `json:"cols,omitempty"`
+	Rows     int           `json:"rows,omitempty"`
+	Label    string        `json:"label,omitempty"`
 }
 
 func indexKey(ownerID string) []byte {
-	return []byte("user/" + ownerID)
+	return []byte("user/" + ownerID + "/grid/")
 }
 
 func gridKey(ownerID, gridID string) []byte {
 	return []byte("user/" + ownerID + "/grid/" + gridID)
 }
 
-func splitKey(key []byte) (ownerID, id string) {
-	parts := strings.Split(string(key), "/")
-	if len(parts) == 2 {
-		// only return ownerID
-		return parts[1], ""
-	}
+func aclKey(ownerID, gridID string) []byte {
+	return []byte("user/" + ownerID + "/grid/" + gridID + "/acl")
+}
 
-	if len(parts) == 4 {
-		return parts[1], parts[3]
-	}
+func sharesKey(ownerID, gridID string) []byte {
+	return []byte("user/" + ownerID + "/grid/" + gridID + "/shares/")
+}
+
+func shareKey(ownerID, gridID, token string) []byte {
+	return append(sharesKey(ownerID, gridID), token...)
+}
+
+func settingsKey(ownerID, gridID string) []byte {
+	return []byte("user/" + ownerID + "/grid/" + gridID + "/settings")
+}
+
+func combatKey(ownerID, gridID string) []byte {
+	return []byte("user/" + ownerID + "/grid/" + gridID + "/combat")
+}
+
+func rollsKey(ownerID, gridID string) []byte {
+	return []byte("user/" + ownerID + "/grid/" + gridID + "/rolls/")
+}
 
-	panic(fmt.Sprintf("invalid key: %q", string(key)))
+func rollKey(ownerID, gridID string, number int) []byte {
+	return fmt.Appendf(rollsKey(ownerID, gridID), "%d", number)
 }
 
-func NewRepository(s *shelf.Shelf) *Repository {
-	return &Repository{s: s}
+func lastRollKey(ownerID, gridID string) []byte {
+	return []byte("user/" + ownerID + "/grid/" + gridID + "/lastroll")
+}
+
+func fairSessionsKey(ownerID, gridID string) []byte {
+	return []byte("user/" + ownerID + "/grid/" + gridID + "/fairness/")
+}
+
+func fairSessionKey(ownerID, gridID, commitment string) []byte {
+	return append(fairSessionsKey(ownerID, gridID), commitment...)
+}
+
+func revisionsKey(ownerID, gridID string) []byte {
+	return []byte("user/" + ownerID + "/grid/" + gridID + "/revisions/")
+}
+
+func revisionKey(ownerID, gridID string, number int) []byte {
+	return fmt.Appendf(revisionsKey(ownerID, gridID), "%d", number)
+}
+
+// splitKey splits a key relative to the index key into its segments. Keys of
+// grids consist of a single segment - the grid's id - while keys of data
+// associated with a grid contain additional segments.
+func splitKey(key []byte) []string {
+	return strings.Split(string(key), "/")
+}
+
+func NewRepository(s *shelf.Shelf, opts ...RepositoryOption) *Repository {
+	r := &Repository{
+		s:             s,
+		revisionLimit: DefaultRevisionLimit,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
 }
 
 func (r *Repository) Create(grid Grid) error {
@@ -64,7 +230,11 @@ func (r *Repository) Create(grid Grid) error {
 	if err != nil && errors.Is(err, shelf.ErrConflict) {
 		return ErrAlreadyExists
 	}
-	return err
+	if err != nil {
+		return err
+	}
+
+	return r.addRevision(grid, nil)
 }
 
 func (r *Repository) Load(ownerID, id string) (Grid, error) {
@@ -77,9 +247,20 @@ func (r *Repository) Load(ownerID, id string) (Grid, error) {
 }
 
 func (r *Repository) List(ownerID string) ([]Grid, error) {
+	prefix := indexKey(ownerID)
+
+	var ids []string
+	for key := range r.s.Keys(prefix) {
+		segments := splitKey(key[len(prefix):])
+		if len(segments) != 1 {
+			// Not a grid but data associated with a grid.
+			continue
+		}
+		ids = append(ids, segments[0])
+	}
+
 	var grids []Grid
-	for key := range r.s.Keys(indexKey(ownerID)) {
-		_, id := splitKey(key)
+	for _, id := range ids {
 		g, err := r.Load(ownerID, id)
 		if err != nil {
 			return nil, err
@@ -91,6 +272,37 @@ func (r *Repository) List(ownerID string) ([]Grid, error) {
 }
 
 func (r *Repository) Update(grid Grid) error {
+	return r.save(grid, nil)
+}
+
+// Patch stores grid which resulted from applying ops. In contrast to Update
+// the operations are recorded with the revision and delivered to subscribers.
+func (r *Repository) Patch(grid Grid, ops []Operation) error {
+	return r.save(grid, ops)
+}
+
+// UpdateFog stores grid after changing its fog. As the fog is not part of a
+// grid's values, no revision is recorded.
+func (r *Repository) UpdateFog(grid Grid) error {
+	return r.write(grid)
+}
+
+func (r *Repository) save(grid Grid, ops []Operation) error {
+	// The revision is stored first, so subscribers receive the operations of
+	// a patch before the grid resulting from them.
+	if err := r.putRevision(grid, ops); err != nil {
+		return err
+	}
+
+	if err := r.write(grid); err != nil {
+		// Drop the revision of the failed write.
+		return errors.Join(err, r.s.Delete(revisionKey(grid.ownerID, grid.id, grid.Version)))
+	}
+
+	return r.pruneRevisions(grid)
+}
+
+func (r *Repository) write(grid Grid) error {
 	d, err := marshal(grid)
 	if err != nil {
 		return err
@@ -100,32 +312,418 @@ func (r *Repository) Update(grid Grid) error {
 	if err != nil && errors.Is(err, shelf.ErrNotFound) {
 		return ErrNotFound
 	}
+
 	return err
 }
 
 func (r *Repository) Delete(ownerID, id string) error {
+	if err := shelf.DeletePrefix(r.s, append(gridKey(ownerID, id), '/')); err != nil {
+		return err
+	}
+
 	return r.s.Delete([]byte(gridKey(ownerID, id)))
 }
 
-func (r *Repository) Subscribe(ctx context.Context, ownerID, gridID string) *Subscription {
+// LoadACL loads the roles granted for a grid keyed by principal id.
+func (r *Repository) LoadACL(ownerID, gridID string) (map[string]Role, error) {
+	acl := make(map[string]Role)
+	if _, err := shelf.GetJSON(r.s, aclKey(ownerID, gridID), &acl); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// SaveACL stores the roles granted for a grid.
+func (r *Repository) SaveACL(ownerID, gridID string, acl map[string]Role) error {
+	return shelf.PutJSON(r.s, aclKey(ownerID, gridID), acl)
+}
+
+// LoadSettings loads the settings of a grid. It returns DefaultSettings if
+// none have been stored.
+func (r *Repository) LoadSettings(ownerID, gridID string) (Settings, error) {
+	var d settingsDBO
+	ok, err := shelf.GetJSON(r.s, settingsKey(ownerID, gridID), &d)
+	if err != nil {
+		return Settings{}, err
+	}
+	if !ok {
+		return DefaultSettings, nil
+	}
+
+	return Settings{
+		Diagonal: geometry.DiagonalRule(d.Diagonal),
+		Scale:    d.Scale,
+		Unit:     d.Unit,
+	}, nil
+}
+
+// SaveSettings stores the settings of a grid.
+func (r *Repository) SaveSettings(ownerID, gridID string, s Settings) error {
+	return shelf.PutJSON(r.s, settingsKey(ownerID, gridID), settingsDBO{
+		Diagonal: string(s.Diagonal),
+		Scale:    s.Scale,
+		Unit:     s.Unit,
+	})
+}
+
+// LoadCombat loads the combat running on a grid. It returns ErrNoCombat if
+// no combat is running.
+func (r *Repository) LoadCombat(ownerID, gridID string) (Combat, error) {
+	d, ok := r.s.Get(combatKey(ownerID, gridID))
+	if !ok {
+		return Combat{}, ErrNoCombat
+	}
+
+	return unmarshalCombat(d)
+}
+
+// SaveCombat stores the combat running on a grid.
+func (r *Repository) SaveCombat(ownerID, gridID string, c Combat) error {
+	d := combatDBO{
+		Combatants: make([]combatantDBO, len(c.Combatants)),
+		Round:      c.Round,
+		Turn:       c.Turn,
+	}
+	for i, cb := range c.Combatants {
+		d.Combatants[i] = combatantDBO{
+			ID:         cb.ID,
+			Name:       cb.Name,
+			Initiative: cb.Initiative,
+			Modifier:   cb.Modifier,
+			Player:     cb.Player,
+			Status:     cb.Status,
+			Trigger:    cb.Trigger,
+			Conditions: marshalConditions(cb.Conditions),
+		}
+	}
+	for _, tc := range c.Tokens {
+		d.Tokens = append(d.Tokens, tokenConditionDBO{
+			Cell:      [2]int{tc.Cell.Col, tc.Cell.Row},
+			Condition: marshalCondition(tc.Condition),
+		})
+	}
+	for _, e := range c.Expired {
+		ed := expiredConditionDBO{
+			Combatant: e.Combatant,
+			Condition: marshalCondition(e.Condition),
+		}
+		if e.Cell != nil {
+			ed.Cell = &[2]int{e.Cell.Col, e.Cell.Row}
+		}
+		d.Expired = append(d.Expired, ed)
+	}
+
+	return shelf.PutJSON(r.s, combatKey(ownerID, gridID), d)
+}
+
+// DeleteCombat removes the combat running on a grid.
+func (r *Repository) DeleteCombat(ownerID, gridID string) error {
+	return r.s.Delete(combatKey(ownerID, gridID))
+}
+
+// AddRoll appends roll to the roll log of a grid and records its number as
+// the last one.
+func (r *Repository) AddRoll(ownerID, gridID string, roll Roll) error {
+	d := rollDBO{
+		Created:  roll.Created.Unix(),
+		RollerID: roll.RollerID,
+		Roller:   roll.Roller,
+		Private:  roll.Private,
+		Session:  roll.Session,
+		Nonce:    roll.Nonce,
+		Record:   dice.NewRecord(roll.Result),
+	}
+
+	if err := shelf.InsertJSON(r.s, rollKey(ownerID, gridID, roll.Number), d); err != nil {
+		return err
+	}
+
+	return shelf.PutJSON(r.s, lastRollKey(ownerID, gridID), roll.Number)
+}
+
+// lastRollNumber returns the number of the last roll added to the roll log of
+// a grid. It returns 0 if no roll has been added.
+func (r *Repository) lastRollNumber(ownerID, gridID string) (int, error) {
+	var number int
+	_, err := shelf.GetJSON(r.s, lastRollKey(ownerID, gridID), &number)
+	return number, err
+}
+
+// LoadRoll loads a single roll from the roll log of a grid.
+func (r *Repository) LoadRoll(ownerID, gridID string, number int) (Roll, error) {
+	d, ok := r.s.Get(rollKey(ownerID, gridID, number))
+	if !ok {
+		return Roll{}, ErrNotFound
+	}
+
+	return unmarshalRoll(number, d)
+}
+
+// SaveFairSession stores a fair session including its seed.
+func (r *Repository) SaveFairSession(ownerID, gridID string, s FairSession) error {
+	d := fairSessionDBO{
+		Seed:    hex.EncodeToString(s.Seed),
+		Started: s.Started.Unix(),
+	}
+	if s.IsRevealed() {
+		d.Revealed = s.Revealed.Unix()
+	}
+
+	return shelf.PutJSON(r.s, fairSessionKey(ownerID, gridID, s.Commitment), d)
+}
+
+// LoadFairSession loads the fair session identified by commitment.
+func (r *Repository) LoadFairSession(ownerID, gridID, commitment string) (FairSession, error) {
+	var d fairSessionDBO
+	ok, err := shelf.GetJSON(r.s, fairSessionKey(ownerID, gridID, commitment), &d)
+	if err != nil {
+		return FairSession{}, err
+	}
+	if !ok {
+		return FairSession{}, ErrNotFound
+	}
+
+	seed, err := hex.DecodeString(d.Seed)
+	if err != nil {
+		return FairSession{}, err
+	}
+
+	s := FairSession{
+		Commitment: commitment,
+		Seed:       seed,
+		Started:    time.Unix(d.Started, 0),
+	}
+	if d.Revealed != 0 {
+		s.Revealed = time.Unix(d.Revealed, 0)
+	}
+
+	return s, nil
+}
+
+// ListFairSessions lists all fair sessions of a grid ordered by start.
+func (r *Repository) ListFairSessions(ownerID, gridID string) ([]FairSession, error) {
+	commitments := shelf.KeySuffixes(r.s, fairSessionsKey(ownerID, gridID))
+
+	sessions := make([]FairSession, 0, len(commitments))
+	for _, c := range commitments {
+		s, err := r.LoadFairSession(ownerID, gridID, c)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	slices.SortFunc(sessions, func(a, b FairSession) int {
+		return a.Started.Compare(b.Started)
+	})
+
+	return sessions, nil
+}
+
+// LoadShare loads the share identified by token. It returns ErrNotFound if no
+// such share exists.
+func (r *Repository) LoadShare(ownerID, gridID, token string) (Share, error) {
+	var d shareDBO
+	ok, err := shelf.GetJSON(r.s, shareKey(ownerID, gridID, token), &d)
+	if err != nil {
+		return Share{}, err
+	}
+	if !ok {
+		return Share{}, ErrNotFound
+	}
+
+	share := Share{
+		Token:   token,
+		Role:    d.Role,
+		Created: time.Unix(d.Created, 0),
+		MaxUses: d.MaxUses,
+		Uses:    d.Uses,
+	}
+	if d.Expires != 0 {
+		share.Expires = time.Unix(d.Expires, 0)
+	}
+
+	return share, nil
+}
+
+// ListShares lists all shares of a grid.
+func (r *Repository) ListShares(ownerID, gridID string) ([]Share, error) {
+	tokens := shelf.KeySuffixes(r.s, sharesKey(ownerID, gridID))
+
+	shares := make([]Share, 0, len(tokens))
+	for _, token := range tokens {
+		share, err := r.LoadShare(ownerID, gridID, token)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, nil
+}
+
+// SaveShare stores share.
+func (r *Repository) SaveShare(ownerID, gridID string, share Share) error {
+	d := shareDBO{
+		Role:    share.Role,
+		Created: share.Created.Unix(),
+		MaxUses: share.MaxUses,
+		Uses:    share.Uses,
+	}
+	if !share.Expires.IsZero() {
+		d.Expires = share.Expires.Unix()
+	}
+
+	return shelf.PutJSON(r.s, shareKey(ownerID, gridID, share.Token), d)
+}
+
+// DeleteShare deletes the share identified by token.
+func (r *Repository) DeleteShare(ownerID, gridID, token string) error {
+	return r.s.Delete(shareKey(ownerID, gridID, token))
+}
+
+// addRevision stores grid's values as the revision numbered by grid's version
+// and removes revisions exceeding the revision limit.
+func (r *Repository) addRevision(grid Grid, ops []Operation) error {
+	if err := r.putRevision(grid, ops); err != nil {
+		return err
+	}
+
+	return r.pruneRevisions(grid)
+}
+
+// putRevision stores grid's values as the revision numbered by grid's version.
+func (r *Repository) putRevision(grid Grid, ops []Operation) error {
+	d := revisionDBO{
+		Label:      grid.Label,
+		Descriptor: grid.Descriptor,
+		Created:    grid.LastModified.Unix(),
+	}
+	for _, op := range ops {
+		d.Operations = append(d.Operations, operationDBO(op))
+	}
+
+	return shelf.PutJSON(r.s, revisionKey(grid.ownerID, grid.id, grid.Version), d)
+}
+
+// pruneRevisions removes the oldest revisions of grid exceeding the revision
+// limit. Revisions are counted rather than derived from grid's version, as
+// changing the fog increments the version without recording a revision.
+func (r *Repository) pruneRevisions(grid Grid) error {
+	numbers := r.revisionNumbers(grid.ownerID, grid.id)
+	for _, n := range numbers[:max(len(numbers)-r.revisionLimit, 0)] {
+		if err := r.s.Delete(revisionKey(grid.ownerID, grid.id, n)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revisionNumbers returns the numbers of all revisions stored for a grid in
+// ascending order.
+func (r *Repository) revisionNumbers(ownerID, gridID string) []int {
+	return shelf.KeyNumbers(r.s, revisionsKey(ownerID, gridID))
+}
+
+// ListRevisions returns all revisions stored for a grid ordered by number.
+func (r *Repository) ListRevisions(ownerID, gridID string) ([]Revision, error) {
+	var revisions []Revision
+	for _, n := range r.revisionNumbers(ownerID, gridID) {
+		rev, err := r.LoadRevision(ownerID, gridID, n)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, nil
+}
+
+// LoadRevision loads a single revision of a grid.
+func (r *Repository) LoadRevision(ownerID, gridID string, number int) (Revision, error) {
+	var d revisionDBO
+	ok, err := shelf.GetJSON(r.s, revisionKey(ownerID, gridID, number), &d)
+	if err != nil {
+		return Revision{}, err
+	}
+	if !ok {
+		return Revision{}, ErrNotFound
+	}
+
+	return Revision{
+		Number:  number,
+		Created: time.Unix(d.Created, 0),
+		Values: Values{
+			Label:      d.Label,
+			Descriptor: d.Descriptor,
+		},
+	}, nil
+}
+
+// Subscribe subscribes to changes of a grid. If share is not nil, the
+// subscription ends when share expires or gets deleted. If filter is not nil,
+// it is applied to every event; events for which filter returns false are
+// dropped.
+func (r *Repository) Subscribe(ctx context.Context, ownerID, gridID string, share *Share, filter func(Event) (Event, bool)) *Subscription {
 	logger := kvlog.FromContext(ctx)
 
-	shelfSup := r.s.Subscribe([]byte(gridKey(ownerID, gridID)))
+	key := gridKey(ownerID, gridID)
+	revisionsPrefix := revisionsKey(ownerID, gridID)
+	combat := combatKey(ownerID, gridID)
+	rollsPrefix := rollsKey(ownerID, gridID)
+	shelfSup := r.s.Subscribe(key)
 
 	sup := &Subscription{
 		s: shelfSup,
-		c: make(chan Grid, 4),
+		c: make(chan Event, 4),
+	}
+
+	var revokedKey []byte
+	var expiryTimer *time.Timer
+	var expired <-chan time.Time
+	if share != nil {
+		revokedKey = shareKey(ownerID, gridID, share.Token)
+		if !share.Expires.IsZero() {
+			expiryTimer = time.NewTimer(time.Until(share.Expires))
+			expired = expiryTimer.C
+		}
+	}
+
+	send := func(evt Event) {
+		if filter != nil {
+			var ok bool
+			if evt, ok = filter(evt); !ok {
+				return
+			}
+		}
+		select {
+		case sup.c <- evt:
+		case <-ctx.Done():
+			// The subscriber has gone; the loop below ends the subscription.
+		}
 	}
 
 	go func() {
 		defer close(sup.c)
+		if expiryTimer != nil {
+			defer expiryTimer.Stop()
+		}
+
+		// pending holds the patch whose resulting grid has not been received
+		// yet.
+		var pending *Patch
 
 		for {
 			select {
 			case <-ctx.Done():
 				// Context has been cancelled; cancel the upstream subscription
 				// and return
-				shelfSup.Cancel()
+				sup.Cancel()
+				return
+			case <-expired:
+				// The share authorizing this subscription has expired.
+				sup.Cancel()
 				return
 			case evt, ok := <-shelfSup.C():
 				if !ok {
@@ -134,7 +732,89 @@ func (r *Repository) Subscribe(ctx context.Context, ownerID, gridID string) *Sub
 					return
 				}
 
-				g, err := unmarshal(string(evt.Key), evt.Data)
+				if revokedKey != nil && evt.Type == shelf.Deleted && bytes.Equal(evt.Key, revokedKey) {
+					// The share authorizing this subscription has been
+					// revoked.
+					sup.Cancel()
+					return
+				}
+
+				if bytes.HasPrefix(evt.Key, revisionsPrefix) {
+					if evt.Type != shelf.Inserted {
+						continue
+					}
+
+					patch, err := unmarshalPatch(evt.Key[len(revisionsPrefix):], evt.Data)
+					if err != nil {
+						logger.Logs("invalid revision data received from subscription",
+							kvlog.WithKV("ownerID", ownerID),
+							kvlog.WithKV("gridID", gridID),
+							kvlog.WithErr(err),
+						)
+						continue
+					}
+
+					// The grid resulting from the patch follows and is
+					// delivered along with the operations.
+					if len(patch.Operations) > 0 {
+						pending = &patch
+					}
+					continue
+				}
+
+				if bytes.HasPrefix(evt.Key, rollsPrefix) {
+					if evt.Type != shelf.Inserted {
+						continue
+					}
+
+					number, err := strconv.Atoi(string(evt.Key[len(rollsPrefix):]))
+					if err != nil {
+						continue
+					}
+
+					roll, err := unmarshalRoll(number, evt.Data)
+					if err != nil {
+						logger.Logs("invalid roll data received from subscription",
+							kvlog.WithKV("ownerID", ownerID),
+							kvlog.WithKV("gridID", gridID),
+							kvlog.WithErr(err),
+						)
+						continue
+					}
+
+					send(Event{Type: EventRolled, Roll: roll})
+					continue
+				}
+
+				if bytes.Equal(evt.Key, combat) {
+					if evt.Type == shelf.Deleted {
+						send(Event{Type: EventCombat})
+						continue
+					}
+
+					c, err := unmarshalCombat(evt.Data)
+					if err != nil {
+						logger.Logs("invalid combat data received from subscription",
+							kvlog.WithKV("ownerID", ownerID),
+							kvlog.WithKV("gridID", gridID),
+							kvlog.WithErr(err),
+						)
+						continue
+					}
+
+					send(Event{Type: EventCombat, Combat: &c})
+					if len(c.Expired) > 0 {
+						send(Event{Type: EventConditionsExpired, Expired: c.Expired})
+					}
+					continue
+				}
+
+				if !bytes.Equal(evt.Key, key) {
+					// Change of other data associated with the grid.
+					continue
+				}
+
+				g, err := unmarshal(gridID, evt.Data)
 				if err != nil {
 					logger.Logs("invalid grid data received from subscription",
 						kvlog.WithKV("ownerID", ownerID),
@@ -143,7 +823,13 @@ func (r *Repository) Subscribe(ctx context.Context, ownerID, gridID string) *Sub
 					)
 					continue
 				}
-				sup.c <- g
+
+				if pending != nil && pending.Version == g.Version {
+					send(Event{Type: EventPatched, Grid: g, Patch: *pending})
+				} else {
+					send(Event{Type: EventUpdated, Grid: g})
+				}
+				pending = nil
 			}
 		}
 	}()
@@ -157,6 +843,8 @@ func marshal(grid Grid) ([]byte, error) {
 		Descriptor:   grid.Descriptor,
 		OwnerID:      grid.ownerID,
 		LastModified: grid.LastModified.Unix(),
+		Version:      grid.Version,
+		Fog:          marshalFog(grid.Fog),
 	})
 }
 
@@ -171,6 +859,8 @@ func unmarshal(id string, data []byte) (g Grid, err error) {
 		id:           id,
 		ownerID:      d.OwnerID,
 		LastModified: time.Unix(d.LastModified, 0),
+		Version:      d.Version,
+		Fog:          unmarshalFog(d.Fog),
 
 		Values: Values{
 			Label:      d.Label,
@@ -178,3 +868,158 @@ func unmarshal(id string, data []byte) (g Grid, err error) {
 		},
 	}, nil
 }
+
+func marshalFog(f Fog) [][2]int {
+	if len(f) == 0 {
+		return nil
+	}
+
+	d := make([][2]int, len(f))
+	for i, c := range f {
+		d[i] = [2]int{c.Col, c.Row}
+	}
+	return d
+}
+
+func unmarshalFog(d [][2]int) Fog {
+	if len(d) == 0 {
+		return nil
+	}
+
+	cells := make([]Cell, len(d))
+	for i, c := range d {
+		cells[i] = Cell{Col: c[0], Row: c[1]}
+	}
+	return Fog(nil).Hide(cells...)
+}
+
+func unmarshalCombat(data []byte) (Combat, error) {
+	var d combatDBO
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Combat{}, err
+	}
+
+	c := Combat{
+		Combatants: make([]Combatant, len(d.Combatants)),
+		Round:      d.Round,
+		Turn:       d.Turn,
+	}
+	for i, cb := range d.Combatants {
+		c.Combatants[i] = Combatant{
+			ID:         cb.ID,
+			Name:       cb.Name,
+			Initiative: cb.Initiative,
+			Modifier:   cb.Modifier,
+			Player:     cb.Player,
+			Status:     cb.Status,
+			Trigger:    cb.Trigger,
+			Conditions: unmarshalConditions(cb.Conditions),
+		}
+	}
+	for _, tc := range d.Tokens {
+		c.Tokens = append(c.Tokens, TokenCondition{
+			Cell:      Cell{Col: tc.Cell[0], Row: tc.Cell[1]},
+			Condition: unmarshalCondition(tc.Condition),
+		})
+	}
+	for _, ed := range d.Expired {
+		e := ExpiredCondition{
+			Combatant: ed.Combatant,
+			Condition: unmarshalCondition(ed.Condition),
+		}
+		if ed.Cell != nil {
+			e.Cell = &Cell{Col: ed.Cell[0], Row: ed.Cell[1]}
+		}
+		c.Expired = append(c.Expired, e)
+	}
+
+	return c, nil
+}
+
+func marshalCondition(c Condition) conditionDBO {
+	return conditionDBO{
+		ID:               c.ID,
+		Name:             c.Name,
+		Rounds:           c.Rounds,
+		Anchor:           c.Anchor,
+		UntilEndOfTurnOf: c.UntilEndOfTurnOf,
+		TurnStarted:      c.turnStarted,
+	}
+}
+
+func unmarshalCondition(d conditionDBO) Condition {
+	return Condition{
+		ID:               d.ID,
+		Name:             d.Name,
+		Rounds:           d.Rounds,
+		Anchor:           d.Anchor,
+		UntilEndOfTurnOf: d.UntilEndOfTurnOf,
+		turnStarted:      d.TurnStarted,
+	}
+}
+
+func marshalConditions(cs []Condition) []conditionDBO {
+	if len(cs) == 0 {
+		return nil
+	}
+
+	d := make([]conditionDBO, len(cs))
+	for i, c := range cs {
+		d[i] = marshalCondition(c)
+	}
+	return d
+}
+
+func unmarshalConditions(d []conditionDBO) []Condition {
+	if len(d) == 0 {
+		return nil
+	}
+
+	cs := make([]Condition, len(d))
+	for i, c := range d {
+		cs[i] = unmarshalCondition(c)
+	}
+	return cs
+}
+
+func unmarshalRoll(number int, data []byte) (Roll, error) {
+	var d rollDBO
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Roll{}, err
+	}
+
+	res, err := d.Result()
+	if err != nil {
+		return Roll{}, fmt.Errorf("roll %d: %w", number, err)
+	}
+
+	return Roll{
+		Number:   number,
+		Created:  time.Unix(d.Created, 0),
+		RollerID: d.RollerID,
+		Roller:   d.Roller,
+		Private:  d.Private,
+		Session:  d.Session,
+		Nonce:    d.Nonce,
+		Result:   res,
+	}, nil
+}
+
+func unmarshalPatch(number, data []byte) (Patch, error) {
+	version, err := strconv.Atoi(string(number))
+	if err != nil {
+		return Patch{}, err
+	}
+
+	var d revisionDBO
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Patch{}, err
+	}
+
+	p := Patch{Version: version}
+	for _, op := range d.Operations {
+		p.Operations = append(p.Operations, Operation(op))
+	}
+
+	return p, nil
+}
@@ -0,0 +1,186 @@
+package grid
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestRepository_revisions(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s, WithRevisionLimit(2))
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "v1", Descriptor: "1x1:-1:-1:-2"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	for v := 2; v <= 3; v++ {
+		g.Version = v
+		g.Label = "v" + strconv.Itoa(v)
+		expect.That(t, expect.FailNow(is.NoError(repo.Update(g))))
+	}
+
+	revisions, err := repo.ListRevisions("owner", "grid")
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		expect.FailNow(is.SliceOfLen(revisions, 2)),
+		is.EqualTo(revisions[0].Number, 2),
+		is.EqualTo(revisions[0].Label, "v2"),
+		is.EqualTo(revisions[1].Number, 3),
+		is.EqualTo(revisions[1].Label, "v3"),
+	)
+
+	_, err = repo.LoadRevision("owner", "grid", 1)
+	expect.That(t, is.Error(err, ErrNotFound))
+
+	grids, err := repo.List("owner")
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		expect.FailNow(is.SliceOfLen(grids, 1)),
+		is.EqualTo(grids[0].ID(), "owner:grid"),
+		is.EqualTo(grids[0].Version, 3),
+	)
+
+	err = repo.SaveACL("owner", "grid", map[string]Role{"someone": RoleEditor})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	acl, err := repo.LoadACL("owner", "grid")
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(acl, map[string]Role{"someone": RoleEditor}),
+	)
+
+	expect.That(t, expect.FailNow(is.NoError(repo.Delete("owner", "grid"))))
+
+	var keys []string
+	for k := range s.Keys(nil) {
+		keys = append(keys, string(k))
+	}
+	expect.That(t, is.SliceOfLen(keys, 0))
+}
+
+func TestRepository_revisions_fog(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s, WithRevisionLimit(2))
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "v1", Descriptor: "1x1:-1:-1:-2"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	// Changing the fog increments the version without recording revisions.
+	for v := 2; v <= 5; v++ {
+		g.Version = v
+		expect.That(t, expect.FailNow(is.NoError(repo.UpdateFog(g))))
+	}
+
+	g.Version = 6
+	expect.That(t, expect.FailNow(is.NoError(repo.Update(g))))
+
+	revisions, err := repo.ListRevisions("owner", "grid")
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		expect.FailNow(is.SliceOfLen(revisions, 2)),
+		is.EqualTo(revisions[0].Number, 1),
+		is.EqualTo(revisions[1].Number, 6),
+	)
+}
+
+func TestRepository_revisions_invalidLimit(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s, WithRevisionLimit(0))
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "v1", Descriptor: "1x1:-1:-1:-2"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	g.Version = 2
+	expect.That(t, expect.FailNow(is.NoError(repo.Update(g))))
+
+	revisions, err := repo.ListRevisions("owner", "grid")
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		expect.FailNow(is.SliceOfLen(revisions, 1)),
+		is.EqualTo(revisions[0].Number, 2),
+	)
+}
+
+func TestRepository_Subscribe_abandoned(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "1x1:-1:-1:-2"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	repo.Subscribe(ctx, "owner", "grid", nil, nil)
+
+	update := func(n int) error {
+		for range n {
+			g.Version++
+			if err := repo.Update(g); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Fill the subscription's buffer without ever reading from it.
+	expect.That(t, expect.FailNow(is.NoError(update(5))))
+	cancel()
+
+	done := make(chan error)
+	go func() { done <- update(20) }()
+
+	select {
+	case err := <-done:
+		expect.That(t, is.NoError(err))
+	case <-time.After(5 * time.Second):
+		t.Fatal("updating the grid blocked")
+	}
+}
+
+func TestDiffLayouts(t *testing.T) {
+	from, err := ParseLayout("2x2:-4:pr1-3:-8")
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	to, err := ParseLayout("3x2:-1g1-4:pr1-5:-2le1-9")
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	expect.That(t, is.DeepEqualTo(DiffLayouts(from, to), []CellChange{
+		{Col: 1, Row: 0, After: CellState{Background: ColorGreen, LeftWall: &Wall{Symbol: WallSymbolWall, Color: ColorGrey}}},
+	}))
+}
@@ -0,0 +1,417 @@
+package grid
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// All rendering is done in cell units: every cell is cellUnits wide and high.
+// This is the same coordinate system the frontend uses to draw the grid which
+// makes it easy to keep both renderings in sync.
+const cellUnits = 10
+
+// point is a position measured in cell units.
+type point struct {
+	X, Y float64
+}
+
+// polygon is a closed outline measured in cell units relative to a cell's
+// top left corner.
+type polygon []point
+
+func rect(x0, y0, x1, y1 float64) polygon {
+	return polygon{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+}
+
+func circle(cx, cy, r float64) polygon {
+	const segments = 24
+	p := make(polygon, segments)
+	for i := range p {
+		a := 2 * math.Pi * float64(i) / segments
+		p[i] = point{cx + r*math.Cos(a), cy + r*math.Sin(a)}
+	}
+	return p
+}
+
+// translate returns a copy of p moved by dx and dy.
+func (p polygon) translate(dx, dy float64) polygon {
+	t := make(polygon, len(p))
+	for i, pt := range p {
+		t[i] = point{pt.X + dx, pt.Y + dy}
+	}
+	return t
+}
+
+// pieceBase is the common foot of all chess piece symbols.
+var pieceBase = rect(2.8, 7.4, 7.2, 8.5)
+
+// symbolShapes defines the outlines of every token symbol within a single
+// cell. Polygons are drawn in order, later ones on top of earlier ones.
+var symbolShapes = map[TokenSymbol][]polygon{
+	SymbolPawn: {
+		polygon{{4.2, 4.5}, {5.8, 4.5}, {6.6, 7.4}, {3.4, 7.4}},
+		circle(5, 3.4, 1.4),
+		pieceBase,
+	},
+	SymbolKing: {
+		rect(4.6, 0.8, 5.4, 3.6),
+		rect(3.8, 1.6, 6.2, 2.4),
+		polygon{{3.6, 3.6}, {6.4, 3.6}, {6.9, 7.4}, {3.1, 7.4}},
+		pieceBase,
+	},
+	SymbolQueen: {
+		polygon{{2.8, 2.5}, {3.9, 4.2}, {5, 2}, {6.1, 4.2}, {7.2, 2.5}, {6.6, 7.4}, {3.4, 7.4}},
+		circle(2.8, 2.3, 0.5),
+		circle(5, 1.8, 0.5),
+		circle(7.2, 2.3, 0.5),
+		pieceBase,
+	},
+	SymbolRook: {
+		polygon{{3, 1.8}, {3.9, 1.8}, {3.9, 2.6}, {4.55, 2.6}, {4.55, 1.8}, {5.45, 1.8}, {5.45, 2.6}, {6.1, 2.6}, {6.1, 1.8}, {7, 1.8}, {7, 3.6}, {3, 3.6}},
+		rect(3.6, 3.6, 6.4, 7.4),
+		pieceBase,
+	},
+	SymbolBishop: {
+		circle(5, 1.3, 0.5),
+		polygon{{4.2, 5}, {5.8, 5}, {6.4, 7.4}, {3.6, 7.4}},
+		polygon{{5, 1.6}, {6.3, 3.2}, {5.9, 5}, {4.1, 5}, {3.7, 3.2}},
+		pieceBase,
+	},
+	SymbolKnight: {
+		polygon{{3.2, 7.4}, {3.6, 5.6}, {4.6, 4.6}, {3.2, 5}, {2.6, 4.2}, {4.2, 2.4}, {5, 1.6}, {5.4, 2.2}, {6.6, 2.8}, {7.2, 4.6}, {6.9, 7.4}},
+		pieceBase,
+	},
+	SymbolStar: {
+		polygon{{5, 1.5}, {6, 4}, {8.5, 5}, {6, 6}, {5, 8.5}, {4, 6}, {1.5, 5}, {4, 4}},
+	},
+	SymbolCircle: {
+		circle(5, 5, 3),
+	},
+	SymbolTriangleUp: {
+		polygon{{5, 1.8}, {8.5, 8}, {1.5, 8}},
+	},
+	SymbolTriangleDown: {
+		polygon{{1.5, 2}, {8.5, 2}, {5, 8.2}},
+	},
+	SymbolSquare: {
+		rect(2, 2, 8, 8),
+	},
+	SymbolDiamond: {
+		polygon{{5, 1.5}, {8.5, 5}, {5, 8.5}, {1.5, 5}},
+	},
+}
+
+// wallSegments defines the segments drawn for every wall symbol as pairs of
+// offsets along the cell's edge.
+var wallSegments = map[WallSymbol][][2]float64{
+	WallSymbolWall:   {{0, 10}},
+	WallSymbolDoor:   {{0, 2}, {8, 10}},
+	WallSymbolWindow: {{0, 1}, {3, 4}, {6, 7}, {9, 10}},
+}
+
+const (
+	wallWidth      = 1.5
+	tokenLineWidth = 0.3
+	gridLineWidth  = 0.1
+)
+
+var (
+	canvasColor   = color.RGBA{0xf8, 0xf8, 0xf8, 0xff}
+	gridLineColor = color.RGBA{0, 0, 0, 0xff}
+)
+
+// tokenColors defines the colors used to draw tokens and walls. The values
+// match the ones used by the frontend.
+var tokenColors = map[Color]color.RGBA{
+	ColorGrey:   hexColor(0xaaaaaa),
+	ColorGreen:  hexColor(0x02551d),
+	ColorBlue:   hexColor(0x001f75),
+	ColorRed:    hexColor(0x900018),
+	ColorOrange: hexColor(0xc54f00),
+	ColorPurple: hexColor(0x750075),
+	ColorYellow: hexColor(0xb8a500),
+	ColorBlack:  hexColor(0x222222),
+	ColorBrown:  hexColor(0x5d2a00),
+}
+
+// backgroundColors defines the colors used to draw cell backgrounds. The
+// values match the ones used by the frontend.
+var backgroundColors = map[Color]color.RGBA{
+	ColorGrey:   hexColor(0xb1b1b1),
+	ColorGreen:  hexColor(0x739f81),
+	ColorBlue:   hexColor(0x7091ec),
+	ColorRed:    hexColor(0xc88c96),
+	ColorOrange: hexColor(0xeea366),
+	ColorPurple: hexColor(0xcd7ecd),
+	ColorYellow: hexColor(0xe6e0a5),
+	ColorBlack:  hexColor(0xc5c5c5),
+	ColorBrown:  hexColor(0xb07d5b),
+}
+
+func hexColor(v uint32) color.RGBA {
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}
+}
+
+// lighten adds percent of the full channel range to every channel of c.
+func lighten(c color.RGBA, percent float64) color.RGBA {
+	add := func(v uint8) uint8 {
+		return uint8(min(255, math.Round(float64(v)+percent*255)))
+	}
+	return color.RGBA{add(c.R), add(c.G), add(c.B), c.A}
+}
+
+func tokenFillColor(c Color) color.RGBA      { return lighten(tokenColors[c], 0.15) }
+func backgroundFillColor(c Color) color.RGBA { return lighten(backgroundColors[c], 0.1) }
+
+// canvas is implemented by all output formats which draw a layout using
+// primitives only.
+type canvas interface {
+	// FillPolygon fills the closed polygon p given in absolute cell units.
+	FillPolygon(p polygon, c color.RGBA)
+	// StrokeLine draws a line from a to b given in absolute cell units.
+	StrokeLine(a, b point, width float64, c color.RGBA)
+}
+
+// renderOptions controls how a layout is drawn.
+type renderOptions struct {
+	// Transparent omits the canvas background color.
+	Transparent bool
+}
+
+// drawLayout draws l onto c in the same order the frontend does: canvas,
+// backgrounds, tokens, walls and grid lines.
+func drawLayout(c canvas, l Layout, opts renderOptions) {
+	drawArea(c, l, opts, Area{Cols: l.Cols, Rows: l.Rows})
+}
+
+// drawArea works like drawLayout but only draws the cells of l contained in a.
+func drawArea(c canvas, l Layout, opts renderOptions, a Area) {
+	x0, y0 := float64(a.Col*cellUnits), float64(a.Row*cellUnits)
+	x1, y1 := float64((a.Col+a.Cols)*cellUnits), float64((a.Row+a.Rows)*cellUnits)
+
+	if !opts.Transparent {
+		c.FillPolygon(rect(x0, y0, x1, y1), canvasColor)
+	}
+
+	for row := a.Row; row < a.Row+a.Rows; row++ {
+		for col := a.Col; col < a.Col+a.Cols; col++ {
+			if bg := l.BackgroundAt(col, row); bg != "" {
+				x, y := float64(col*cellUnits), float64(row*cellUnits)
+				c.FillPolygon(rect(x, y, x+cellUnits, y+cellUnits), backgroundFillColor(bg))
+			}
+		}
+	}
+
+	for row := a.Row; row < a.Row+a.Rows; row++ {
+		for col := a.Col; col < a.Col+a.Cols; col++ {
+			if t := l.TokenAt(col, row); t != nil {
+				drawToken(c, float64(col*cellUnits), float64(row*cellUnits), *t)
+			}
+		}
+	}
+
+	for row := a.Row; row < a.Row+a.Rows; row++ {
+		for col := a.Col; col < a.Col+a.Cols; col++ {
+			for _, pos := range WallPositions {
+				if w := l.WallAt(col, row, pos); w != nil {
+					drawWall(c, col, row, pos, *w)
+				}
+			}
+		}
+	}
+
+	for col := max(a.Col, 1); col <= min(a.Col+a.Cols, l.Cols-1); col++ {
+		x := float64(col * cellUnits)
+		c.StrokeLine(point{x, y0}, point{x, y1}, gridLineWidth, gridLineColor)
+	}
+	for row := max(a.Row, 1); row <= min(a.Row+a.Rows, l.Rows-1); row++ {
+		y := float64(row * cellUnits)
+		c.StrokeLine(point{x0, y}, point{x1, y}, gridLineWidth, gridLineColor)
+	}
+}
+
+func drawToken(c canvas, x, y float64, t Token) {
+	for _, shape := range symbolShapes[t.Symbol] {
+		p := shape.translate(x, y)
+		c.FillPolygon(p, tokenFillColor(t.Color))
+		for i := range p {
+			c.StrokeLine(p[i], p[(i+1)%len(p)], tokenLineWidth, tokenColors[t.Color])
+		}
+	}
+}
+
+func drawWall(c canvas, col, row int, pos WallPosition, w Wall) {
+	x, y := float64(col*cellUnits), float64(row*cellUnits)
+	for _, seg := range wallSegments[w.Symbol] {
+		a, b := point{x + seg[0], y}, point{x + seg[1], y}
+		if pos == WallPositionLeft {
+			a, b = point{x, y + seg[0]}, point{x, y + seg[1]}
+		}
+		c.StrokeLine(a, b, wallWidth, tokenColors[w.Color])
+	}
+}
+
+var ErrInvalidRenderParameter = errors.New("invalid render parameter")
+
+const (
+	defaultCellSize = 40
+	minCellSize     = 4
+	maxCellSize     = 200
+	maxImageSize    = 8192
+)
+
+// imageParams defines the parameters used for rendering raster images.
+type imageParams struct {
+	// CellSize is the size of a single cell in pixels before scaling.
+	CellSize int
+	// Scale is applied to CellSize.
+	Scale float64
+	// Transparent omits the canvas background color.
+	Transparent bool
+}
+
+// parseImageParams parses the query parameters cell, scale and transparent.
+func parseImageParams(q url.Values) (imageParams, error) {
+	p := imageParams{
+		CellSize: defaultCellSize,
+		Scale:    1,
+	}
+
+	if v := q.Get("cell"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < minCellSize || size > maxCellSize {
+			return p, fmt.Errorf("%w: cell must be between %d and %d", ErrInvalidRenderParameter, minCellSize, maxCellSize)
+		}
+		p.CellSize = size
+	}
+
+	if v := q.Get("scale"); v != "" {
+		scale, err := strconv.ParseFloat(v, 64)
+		if err != nil || scale < 0.1 || scale > 10 {
+			return p, fmt.Errorf("%w: scale must be between 0.1 and 10", ErrInvalidRenderParameter)
+		}
+		p.Scale = scale
+	}
+
+	if v := q.Get("transparent"); v != "" {
+		transparent, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, fmt.Errorf("%w: transparent must be a boolean", ErrInvalidRenderParameter)
+		}
+		p.Transparent = transparent
+	}
+
+	return p, nil
+}
+
+// pixelsPerCell returns the effective size of a cell in pixels.
+func (p imageParams) pixelsPerCell() float64 {
+	return float64(p.CellSize) * p.Scale
+}
+
+// cacheKey returns a string uniquely identifying p.
+func (p imageParams) cacheKey() string {
+	return fmt.Sprintf("cell=%d&scale=%g&transparent=%t", p.CellSize, p.Scale, p.Transparent)
+}
+
+// renderFunc renders a grid with the given label and layout.
+type renderFunc func(label string, l Layout) ([]byte, error)
+
+// renderFormat defines an output format available for rendering grids.
+type renderFormat struct {
+	contentType string
+	// prepare parses the query parameters q. It returns a string uniquely
+	// identifying the parameters to use as part of a cache key and the
+	// function to render a grid with these parameters.
+	prepare func(q url.Values) (string, renderFunc, error)
+}
+
+// renderFormats contains all available render formats keyed by the file
+// extension used to request them.
+var renderFormats = map[string]renderFormat{
+	".png": {
+		contentType: "image/png",
+		prepare: func(q url.Values) (string, renderFunc, error) {
+			params, err := parseImageParams(q)
+			return params.cacheKey(), func(_ string, l Layout) ([]byte, error) {
+				return renderPNG(l, params)
+			}, err
+		},
+	},
+	".svg": {
+		contentType: "image/svg+xml",
+		prepare: func(q url.Values) (string, renderFunc, error) {
+			params, err := parseImageParams(q)
+			return params.cacheKey(), func(label string, l Layout) ([]byte, error) {
+				return renderSVG(label, l, params), nil
+			}, err
+		},
+	},
+	".pdf": {
+		contentType: "application/pdf",
+		prepare: func(q url.Values) (string, renderFunc, error) {
+			params, err := parsePDFParams(q)
+			return params.cacheKey(), func(label string, l Layout) ([]byte, error) {
+				return renderPDF(label, l, params)
+			}, err
+		},
+	},
+}
+
+// renderCache caches rendered images keyed by grid id, grid version and the
+// render parameters. When the cache is full, the oldest entry is evicted.
+type renderCache struct {
+	lock    sync.Mutex
+	size    int
+	entries map[string][]byte
+	keys    []string
+}
+
+func newRenderCache(size int) *renderCache {
+	return &renderCache{
+		size:    size,
+		entries: make(map[string][]byte, size),
+	}
+}
+
+// renderCacheKey returns the key to cache a rendering of g. The last
+// modification time is included as grids created before versioning was
+// introduced all have version 0. Renderings of a grid's PlayerView are cached
+// separately.
+func renderCacheKey(g Grid, contentType string, params string) string {
+	view := "full"
+	if g.playerView {
+		view = "player"
+	}
+	return fmt.Sprintf("%s@%d/%d/%s %s?%s", g.ID(), g.Version, g.LastModified.Unix(), view, contentType, params)
+}
+
+func (c *renderCache) get(key string) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	data, ok := c.entries[key]
+	return data, ok
+}
+
+func (c *renderCache) put(key string, data []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+
+	if len(c.keys) >= c.size {
+		delete(c.entries, c.keys[0])
+		c.keys = c.keys[1:]
+	}
+
+	c.entries[key] = data
+	c.keys = append(c.keys, key)
+}
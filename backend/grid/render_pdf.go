@@ -0,0 +1,225 @@
+package grid
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"net/url"
+
+	"github.com/halimath/d20-tools/infra/pdf"
+)
+
+const (
+	// pointsPerCell is the size of a single cell in a PDF: 1 inch.
+	pointsPerCell = 72
+
+	// pageMargin is the unprinted margin of every page in points.
+	pageMargin = 36
+
+	// pageOverlap is the width of the area printed on two adjacent pages in
+	// points. It is used to glue pages together.
+	pageOverlap = 18
+
+	// maxPDFPages limits the number of pages a single PDF may contain.
+	maxPDFPages = 200
+)
+
+// paperSizes contains the paper sizes available for rendering PDFs in points.
+var paperSizes = map[string][2]float64{
+	"a4":     {pdf.A4Width, pdf.A4Height},
+	"letter": {pdf.LetterWidth, pdf.LetterHeight},
+}
+
+// pdfParams defines the parameters used for rendering PDFs.
+type pdfParams struct {
+	Paper string
+}
+
+// parsePDFParams parses the query parameter paper.
+func parsePDFParams(q url.Values) (pdfParams, error) {
+	p := pdfParams{Paper: "a4"}
+
+	if v := q.Get("paper"); v != "" {
+		if _, ok := paperSizes[v]; !ok {
+			return p, fmt.Errorf("%w: paper must be one of a4 or letter", ErrInvalidRenderParameter)
+		}
+		p.Paper = v
+	}
+
+	return p, nil
+}
+
+// cacheKey returns a string uniquely identifying p.
+func (p pdfParams) cacheKey() string {
+	return "paper=" + p.Paper
+}
+
+// pdfCanvas implements canvas by appending path operators to a PDF page.
+type pdfCanvas struct {
+	page *pdf.Page
+}
+
+func (c pdfCanvas) FillPolygon(p polygon, col color.RGBA) {
+	if len(p) < 3 {
+		return
+	}
+
+	c.page.SetFillColor(pdf.Color{R: col.R, G: col.G, B: col.B})
+	c.page.MoveTo(p[0].X, p[0].Y)
+	for _, pt := range p[1:] {
+		c.page.LineTo(pt.X, pt.Y)
+	}
+	c.page.ClosePath()
+	c.page.Fill()
+}
+
+func (c pdfCanvas) StrokeLine(a, b point, width float64, col color.RGBA) {
+	c.page.SetStrokeColor(pdf.Color{R: col.R, G: col.G, B: col.B})
+	c.page.SetLineWidth(width)
+	c.page.MoveTo(a.X, a.Y)
+	c.page.LineTo(b.X, b.Y)
+	c.page.Stroke()
+}
+
+// tileCount returns the number of pages needed to print size points on pages
+// providing printable points each.
+func tileCount(size, printable float64) int {
+	if size <= printable {
+		return 1
+	}
+	return 1 + int(math.Ceil((size-printable)/(printable-pageOverlap)))
+}
+
+// tileArea returns the cells of l shown on a tile of the given size in points
+// starting at offsetX and offsetY. The area includes one more cell on every
+// side, so strokes crossing the tile's border are drawn as well.
+func tileArea(l Layout, offsetX, offsetY, width, height float64) Area {
+	col0 := max(int(offsetX/pointsPerCell)-1, 0)
+	row0 := max(int(offsetY/pointsPerCell)-1, 0)
+	col1 := min(int(math.Ceil((offsetX+width)/pointsPerCell))+1, l.Cols)
+	row1 := min(int(math.Ceil((offsetY+height)/pointsPerCell))+1, l.Rows)
+
+	return Area{Col: col0, Row: row0, Cols: col1 - col0, Rows: row1 - row0}
+}
+
+// renderPDF renders l at a scale of 1 inch per cell. The grid is tiled across
+// as many pages as needed. Adjacent pages overlap by pageOverlap; the overlap
+// is marked with dashed lines. Every page carries alignment marks in its
+// corners and a label naming the grid and the page's position.
+func renderPDF(label string, l Layout, params pdfParams) ([]byte, error) {
+	size := paperSizes[params.Paper]
+	pageWidth, pageHeight := size[0], size[1]
+	printableWidth := pageWidth - 2*pageMargin
+	printableHeight := pageHeight - 2*pageMargin
+
+	gridWidth := float64(l.Cols * pointsPerCell)
+	gridHeight := float64(l.Rows * pointsPerCell)
+
+	tilesX := tileCount(gridWidth, printableWidth)
+	tilesY := tileCount(gridHeight, printableHeight)
+
+	if tilesX*tilesY > maxPDFPages {
+		return nil, fmt.Errorf("%w: grid requires %d pages which exceeds the maximum of %d", ErrInvalidRenderParameter, tilesX*tilesY, maxPDFPages)
+	}
+
+	if label == "" {
+		label = "Grid"
+	}
+
+	const scale = float64(pointsPerCell) / cellUnits
+
+	doc := pdf.New()
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			page := doc.AddPage(pageWidth, pageHeight)
+			offsetX := float64(tx) * (printableWidth - pageOverlap)
+			offsetY := float64(ty) * (printableHeight - pageOverlap)
+
+			page.SaveState()
+			page.Rect(pageMargin, pageMargin, printableWidth, printableHeight)
+			page.Clip()
+			// Map cell units to points with the origin in the top left corner
+			// of this tile.
+			page.Transform(scale, 0, 0, -scale, pageMargin-offsetX, pageHeight-pageMargin+offsetY)
+			page.SetRoundCaps()
+			drawArea(pdfCanvas{page}, l, renderOptions{Transparent: true}, tileArea(l, offsetX, offsetY, printableWidth, printableHeight))
+			page.RestoreState()
+
+			drawOverlapMarks(page, tx > 0, tx < tilesX-1, ty > 0, ty < tilesY-1)
+			drawAlignmentMarks(page)
+
+			page.SetFillColor(pdf.Color{})
+			page.Text(pageMargin, pageMargin/2, 8, fmt.Sprintf("%s - page %d of %d (row %d, column %d)",
+				label, ty*tilesX+tx+1, tilesX*tilesY, ty+1, tx+1))
+		}
+	}
+
+	return doc.Bytes(), nil
+}
+
+// drawOverlapMarks draws dashed lines marking the areas also printed on the
+// adjacent pages.
+func drawOverlapMarks(page *pdf.Page, left, right, top, bottom bool) {
+	if !left && !right && !top && !bottom {
+		return
+	}
+
+	x0, y0 := float64(pageMargin), float64(pageMargin)
+	x1, y1 := page.Width()-pageMargin, page.Height()-pageMargin
+
+	page.SaveState()
+	page.SetStrokeColor(pdf.Color{R: 0x80, G: 0x80, B: 0x80})
+	page.SetLineWidth(0.5)
+	page.SetDash(4, 2)
+
+	if left {
+		page.MoveTo(x0+pageOverlap, y0)
+		page.LineTo(x0+pageOverlap, y1)
+	}
+	if right {
+		page.MoveTo(x1-pageOverlap, y0)
+		page.LineTo(x1-pageOverlap, y1)
+	}
+	if top {
+		page.MoveTo(x0, y1-pageOverlap)
+		page.LineTo(x1, y1-pageOverlap)
+	}
+	if bottom {
+		page.MoveTo(x0, y0+pageOverlap)
+		page.LineTo(x1, y0+pageOverlap)
+	}
+
+	page.Stroke()
+	page.RestoreState()
+}
+
+// drawAlignmentMarks draws crop marks at the corners of the printable area.
+func drawAlignmentMarks(page *pdf.Page) {
+	const length float64 = pageMargin / 2
+
+	x0, y0 := float64(pageMargin), float64(pageMargin)
+	x1, y1 := page.Width()-pageMargin, page.Height()-pageMargin
+
+	page.SaveState()
+	page.SetStrokeColor(pdf.Color{})
+	page.SetLineWidth(0.5)
+
+	for _, c := range [][2]float64{{x0, y0}, {x1, y0}, {x0, y1}, {x1, y1}} {
+		dx, dy := -length, -length
+		if c[0] == x1 {
+			dx = length
+		}
+		if c[1] == y1 {
+			dy = length
+		}
+
+		page.MoveTo(c[0], c[1])
+		page.LineTo(c[0]+dx, c[1])
+		page.MoveTo(c[0], c[1])
+		page.LineTo(c[0], c[1]+dy)
+	}
+
+	page.Stroke()
+	page.RestoreState()
+}
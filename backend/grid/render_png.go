@@ -0,0 +1,168 @@
+package grid
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"slices"
+)
+
+// rasterCanvas implements canvas by rasterizing all primitives onto an RGBA
+// image. Polygons are filled using a scanline algorithm with vertical super
+// sampling and exact horizontal coverage which gives reasonably anti-aliased
+// edges.
+type rasterCanvas struct {
+	img   *image.RGBA
+	scale float64
+	cov   []float64
+}
+
+// subScanlines is the number of samples taken per pixel row.
+const subScanlines = 4
+
+func newRasterCanvas(width, height int, scale float64) *rasterCanvas {
+	return &rasterCanvas{
+		img:   image.NewRGBA(image.Rect(0, 0, width, height)),
+		scale: scale,
+		cov:   make([]float64, width+1),
+	}
+}
+
+func (c *rasterCanvas) FillPolygon(p polygon, col color.RGBA) {
+	if len(p) < 3 {
+		return
+	}
+
+	pts := make([]point, len(p))
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i, pt := range p {
+		pts[i] = point{pt.X * c.scale, pt.Y * c.scale}
+		minX, maxX = min(minX, pts[i].X), max(maxX, pts[i].X)
+		minY, maxY = min(minY, pts[i].Y), max(maxY, pts[i].Y)
+	}
+
+	bounds := c.img.Bounds()
+	x0 := max(bounds.Min.X, int(math.Floor(minX)))
+	x1 := min(bounds.Max.X, int(math.Ceil(maxX)))
+	y0 := max(bounds.Min.Y, int(math.Floor(minY)))
+	y1 := min(bounds.Max.Y, int(math.Ceil(maxY)))
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+
+	crossings := make([]float64, 0, 8)
+
+	for py := y0; py < y1; py++ {
+		clear(c.cov[x0 : x1+1])
+
+		for s := 0; s < subScanlines; s++ {
+			y := float64(py) + (float64(s)+0.5)/subScanlines
+
+			crossings = crossings[:0]
+			for i := range pts {
+				a, b := pts[i], pts[(i+1)%len(pts)]
+				if (a.Y <= y && y < b.Y) || (b.Y <= y && y < a.Y) {
+					crossings = append(crossings, a.X+(y-a.Y)*(b.X-a.X)/(b.Y-a.Y))
+				}
+			}
+			slices.Sort(crossings)
+
+			for i := 0; i+1 < len(crossings); i += 2 {
+				c.addSpan(crossings[i], crossings[i+1], x0, x1)
+			}
+		}
+
+		for px := x0; px < x1; px++ {
+			if c.cov[px] > 0 {
+				c.blend(px, py, col, min(1, c.cov[px]))
+			}
+		}
+	}
+}
+
+// addSpan adds the coverage of a single sub scanline spanning from sx0 to sx1
+// to the coverage buffer.
+func (c *rasterCanvas) addSpan(sx0, sx1 float64, x0, x1 int) {
+	sx0 = max(sx0, float64(x0))
+	sx1 = min(sx1, float64(x1))
+
+	for px := int(math.Floor(sx0)); float64(px) < sx1; px++ {
+		overlap := min(sx1, float64(px+1)) - max(sx0, float64(px))
+		if overlap > 0 {
+			c.cov[px] += overlap / subScanlines
+		}
+	}
+}
+
+// blend composes col with the given coverage over the pixel at x and y.
+func (c *rasterCanvas) blend(x, y int, col color.RGBA, coverage float64) {
+	i := c.img.PixOffset(x, y)
+	pix := c.img.Pix[i : i+4 : i+4]
+
+	a := float64(col.A) / 255 * coverage
+	for ch, v := range []uint8{col.R, col.G, col.B} {
+		pix[ch] = uint8(math.Round(float64(v)*a + float64(pix[ch])*(1-a)))
+	}
+	pix[3] = uint8(math.Round(255*a + float64(pix[3])*(1-a)))
+}
+
+func (c *rasterCanvas) StrokeLine(a, b point, width float64, col color.RGBA) {
+	c.FillPolygon(lineOutline(a, b, width), col)
+}
+
+// lineOutline returns the outline of a line from a to b with the given width.
+// The line is extended by half its width at both ends to join neighboring
+// lines.
+func lineOutline(a, b point, width float64) polygon {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return nil
+	}
+
+	h := width / 2
+	ux, uy := dx/length*h, dy/length*h
+	nx, ny := -uy, ux
+
+	return polygon{
+		{a.X - ux + nx, a.Y - uy + ny},
+		{b.X + ux + nx, b.Y + uy + ny},
+		{b.X + ux - nx, b.Y + uy - ny},
+		{a.X - ux - nx, a.Y - uy - ny},
+	}
+}
+
+// renderImage renders l to an RGBA image.
+func renderImage(l Layout, params imageParams) (*image.RGBA, error) {
+	scale := params.pixelsPerCell() / cellUnits
+	width := int(math.Ceil(float64(l.Cols) * params.pixelsPerCell()))
+	height := int(math.Ceil(float64(l.Rows) * params.pixelsPerCell()))
+
+	if width > maxImageSize || height > maxImageSize {
+		return nil, fmt.Errorf("%w: image of %dx%d pixels exceeds the maximum size of %d pixels", ErrInvalidRenderParameter, width, height, maxImageSize)
+	}
+
+	c := newRasterCanvas(width, height, scale)
+	drawLayout(c, l, renderOptions{Transparent: params.Transparent})
+
+	return c.img, nil
+}
+
+// renderPNG renders l as a PNG image.
+func renderPNG(l Layout, params imageParams) ([]byte, error) {
+	img, err := renderImage(l, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,196 @@
+package grid
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// tokenSymbolIDs defines the ids of the SVG symbols used to draw tokens.
+var tokenSymbolIDs = map[TokenSymbol]string{
+	SymbolPawn:         "token-pawn",
+	SymbolKing:         "token-king",
+	SymbolQueen:        "token-queen",
+	SymbolRook:         "token-rook",
+	SymbolBishop:       "token-bishop",
+	SymbolKnight:       "token-knight",
+	SymbolStar:         "token-star",
+	SymbolCircle:       "token-circle",
+	SymbolTriangleUp:   "token-triangle-up",
+	SymbolTriangleDown: "token-triangle-down",
+	SymbolSquare:       "token-square",
+	SymbolDiamond:      "token-diamond",
+}
+
+// wallSymbolID returns the id of the SVG symbol used to draw walls of kind s.
+// The ids follow the scheme used by the frontend (i.e. wall-top-wall). Left
+// walls reuse the symbols for top walls rotated by 90 degrees.
+func wallSymbolID(s WallSymbol) string {
+	return "wall-top-" + string(s)
+}
+
+// backgroundSymbolID is the id of the SVG symbol used to draw cell
+// backgrounds.
+const backgroundSymbolID = "background"
+
+// renderSVG renders l as a vector SVG image. The document contains one group
+// per layer (background, tokens, walls and grid lines) and uses CSS classes
+// named after the colors, so that the result can easily be restyled.
+func renderSVG(label string, l Layout, params imageParams) []byte {
+	var buf bytes.Buffer
+
+	width := float64(l.Cols) * params.pixelsPerCell()
+	height := float64(l.Rows) * params.pixelsPerCell()
+
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%s" height="%s" viewBox="0 0 %d %d">`+"\n",
+		svgNumber(width), svgNumber(height), l.Cols*cellUnits, l.Rows*cellUnits)
+
+	if label != "" {
+		buf.WriteString("<title>")
+		xml.EscapeText(&buf, []byte(label))
+		buf.WriteString("</title>\n")
+	}
+
+	writeSVGStyle(&buf)
+	writeSVGDefs(&buf)
+
+	if !params.Transparent {
+		fmt.Fprintf(&buf, `<rect class="canvas" width="%d" height="%d"/>`+"\n", l.Cols*cellUnits, l.Rows*cellUnits)
+	}
+
+	buf.WriteString(`<g id="layer-background">` + "\n")
+	for row := 0; row < l.Rows; row++ {
+		for col := 0; col < l.Cols; col++ {
+			if bg := l.BackgroundAt(col, row); bg != "" {
+				fmt.Fprintf(&buf, `<use href="#%s" xlink:href="#%s" x="%d" y="%d" class="background %s"/>`+"\n",
+					backgroundSymbolID, backgroundSymbolID, col*cellUnits, row*cellUnits, bg)
+			}
+		}
+	}
+	buf.WriteString("</g>\n")
+
+	buf.WriteString(`<g id="layer-tokens">` + "\n")
+	for row := 0; row < l.Rows; row++ {
+		for col := 0; col < l.Cols; col++ {
+			if t := l.TokenAt(col, row); t != nil {
+				id := tokenSymbolIDs[t.Symbol]
+				fmt.Fprintf(&buf, `<use href="#%s" xlink:href="#%s" x="%d" y="%d" class="token %s"/>`+"\n",
+					id, id, col*cellUnits, row*cellUnits, t.Color)
+			}
+		}
+	}
+	buf.WriteString("</g>\n")
+
+	buf.WriteString(`<g id="layer-walls">` + "\n")
+	for row := 0; row < l.Rows; row++ {
+		for col := 0; col < l.Cols; col++ {
+			for _, pos := range WallPositions {
+				w := l.WallAt(col, row, pos)
+				if w == nil {
+					continue
+				}
+
+				id := wallSymbolID(w.Symbol)
+				transform := fmt.Sprintf("translate(%d %d)", col*cellUnits, row*cellUnits)
+				if pos == WallPositionLeft {
+					transform += " rotate(90)"
+				}
+				fmt.Fprintf(&buf, `<use href="#%s" xlink:href="#%s" transform="%s" class="wall %s %s"/>`+"\n",
+					id, id, transform, w.Symbol, w.Color)
+			}
+		}
+	}
+	buf.WriteString("</g>\n")
+
+	buf.WriteString(`<g id="layer-grid" class="grid-line">` + "\n")
+	for col := 1; col < l.Cols; col++ {
+		fmt.Fprintf(&buf, `<line x1="%d" y1="0" x2="%d" y2="%d"/>`+"\n", col*cellUnits, col*cellUnits, l.Rows*cellUnits)
+	}
+	for row := 1; row < l.Rows; row++ {
+		fmt.Fprintf(&buf, `<line x1="0" y1="%d" x2="%d" y2="%d"/>`+"\n", row*cellUnits, l.Cols*cellUnits, row*cellUnits)
+	}
+	buf.WriteString("</g>\n")
+
+	buf.WriteString("</svg>\n")
+
+	return buf.Bytes()
+}
+
+// writeSVGStyle writes the style sheet defining the classes used by
+// renderSVG. Class names match the ones used by the frontend.
+func writeSVGStyle(buf *bytes.Buffer) {
+	buf.WriteString("<style>\n")
+	fmt.Fprintf(buf, ".canvas { fill: %s; }\n", cssColor(canvasColor))
+	fmt.Fprintf(buf, ".grid-line { stroke: %s; stroke-width: %s; }\n", cssColor(gridLineColor), svgNumber(gridLineWidth))
+	fmt.Fprintf(buf, ".token { stroke-width: %s; stroke-linejoin: round; }\n", svgNumber(tokenLineWidth))
+	fmt.Fprintf(buf, ".wall { fill: none; stroke-width: %s; stroke-linecap: round; }\n", svgNumber(wallWidth))
+
+	for _, c := range Colors {
+		fmt.Fprintf(buf, ".background.%s { fill: %s; }\n", c, cssColor(backgroundFillColor(c)))
+	}
+	for _, c := range Colors {
+		fmt.Fprintf(buf, ".token.%s { fill: %s; stroke: %s; }\n", c, cssColor(tokenFillColor(c)), cssColor(tokenColors[c]))
+	}
+	for _, c := range Colors {
+		fmt.Fprintf(buf, ".wall.%s { stroke: %s; }\n", c, cssColor(tokenColors[c]))
+	}
+
+	buf.WriteString("</style>\n")
+}
+
+// writeSVGDefs writes the symbols used to draw backgrounds, tokens and walls.
+func writeSVGDefs(buf *bytes.Buffer) {
+	buf.WriteString("<defs>\n")
+
+	fmt.Fprintf(buf, `<symbol id="%s" overflow="visible"><rect width="%d" height="%d"/></symbol>`+"\n", backgroundSymbolID, cellUnits, cellUnits)
+
+	for _, s := range TokenSymbols {
+		fmt.Fprintf(buf, `<symbol id="%s" overflow="visible">`, tokenSymbolIDs[s])
+		for _, p := range symbolShapes[s] {
+			fmt.Fprintf(buf, `<path d="%s"/>`, svgPath(p))
+		}
+		buf.WriteString("</symbol>\n")
+	}
+
+	for _, s := range WallSymbols {
+		var d strings.Builder
+		for _, seg := range wallSegments[s] {
+			fmt.Fprintf(&d, "M %s 0 L %s 0 ", svgNumber(seg[0]), svgNumber(seg[1]))
+		}
+		fmt.Fprintf(buf, `<symbol id="%s" overflow="visible"><path d="%s"/></symbol>`+"\n", wallSymbolID(s), strings.TrimSpace(d.String()))
+	}
+
+	buf.WriteString("</defs>\n")
+}
+
+// svgPath converts p to the path data of a closed path.
+func svgPath(p polygon) string {
+	var d strings.Builder
+	for i, pt := range p {
+		if i == 0 {
+			d.WriteString("M ")
+		} else {
+			d.WriteString(" L ")
+		}
+		d.WriteString(svgNumber(pt.X))
+		d.WriteByte(' ')
+		d.WriteString(svgNumber(pt.Y))
+	}
+	d.WriteString(" Z")
+	return d.String()
+}
+
+// svgNumber formats v using at most three decimal places.
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// cssColor formats c as a CSS hex color.
+func cssColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,212 @@
+package grid
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"image/png"
+	"net/url"
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestParseImageParams(t *testing.T) {
+	p, err := parseImageParams(url.Values{})
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(p, imageParams{CellSize: defaultCellSize, Scale: 1}),
+	)
+
+	p, err = parseImageParams(url.Values{"cell": {"20"}, "scale": {"1.5"}, "transparent": {"true"}})
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(p, imageParams{CellSize: 20, Scale: 1.5, Transparent: true}),
+		is.EqualTo(p.pixelsPerCell(), 30.0),
+	)
+
+	invalid := []url.Values{
+		{"cell": {"x"}},
+		{"cell": {"2"}},
+		{"cell": {"1000"}},
+		{"scale": {"0"}},
+		{"scale": {"11"}},
+		{"transparent": {"maybe"}},
+	}
+
+	for _, q := range invalid {
+		_, err := parseImageParams(q)
+		expect.That(t, is.Error(err, ErrInvalidRenderParameter))
+	}
+}
+
+func TestRenderPNG(t *testing.T) {
+	l, err := ParseLayout("3x2:r1-5:-4bb1:-12")
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	data, err := renderPNG(l, imageParams{CellSize: 20, Scale: 1})
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	img, err := png.Decode(bytes.NewReader(data))
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	expect.That(t,
+		is.EqualTo(img.Bounds().Dx(), 60),
+		is.EqualTo(img.Bounds().Dy(), 40),
+		// Center of the red background cell
+		is.EqualTo(color.RGBAModel.Convert(img.At(5, 5)).(color.RGBA), backgroundFillColor(ColorRed)),
+		// Empty cell shows the canvas color
+		is.EqualTo(color.RGBAModel.Convert(img.At(25, 5)).(color.RGBA), canvasColor),
+		// Center of the blue square token
+		is.EqualTo(color.RGBAModel.Convert(img.At(30, 30)).(color.RGBA), tokenFillColor(ColorBlue)),
+	)
+}
+
+func TestRenderPNG_transparent(t *testing.T) {
+	l := NewLayout(1, 1)
+
+	img, err := renderImage(l, imageParams{CellSize: 10, Scale: 1, Transparent: true})
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		is.EqualTo(img.RGBAAt(5, 5).A, uint8(0)),
+	)
+}
+
+func TestRenderPNG_tooLarge(t *testing.T) {
+	_, err := renderPNG(NewLayout(100, 1), imageParams{CellSize: 200, Scale: 1})
+	expect.That(t, is.Error(err, ErrInvalidRenderParameter))
+}
+
+func TestRenderCache(t *testing.T) {
+	c := newRenderCache(2)
+
+	c.put("a", []byte("a"))
+	c.put("b", []byte("b"))
+	c.put("c", []byte("c"))
+
+	_, okA := c.get("a")
+	b, okB := c.get("b")
+	_, okC := c.get("c")
+
+	expect.That(t,
+		is.EqualTo(okA, false),
+		is.EqualTo(okB, true),
+		is.DeepEqualTo(b, []byte("b")),
+		is.EqualTo(okC, true),
+	)
+}
+
+func TestRenderSVG(t *testing.T) {
+	l, err := ParseLayout("2x1:r1-1:-1po1:le1-3")
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	data := renderSVG("a <map>", l, imageParams{CellSize: 20, Scale: 1})
+
+	var doc struct {
+		Width  string `xml:"width,attr"`
+		Height string `xml:"height,attr"`
+		Title  string `xml:"title"`
+		Groups []struct {
+			ID   string `xml:"id,attr"`
+			Uses []struct {
+				Href  string `xml:"href,attr"`
+				Class string `xml:"class,attr"`
+			} `xml:"use"`
+		} `xml:"g"`
+	}
+	expect.That(t, expect.FailNow(is.NoError(xml.Unmarshal(data, &doc))))
+
+	expect.That(t,
+		is.EqualTo(doc.Width, "40"),
+		is.EqualTo(doc.Height, "20"),
+		is.EqualTo(doc.Title, "a <map>"),
+		expect.FailNow(is.SliceOfLen(doc.Groups, 4)),
+		is.EqualTo(doc.Groups[0].ID, "layer-background"),
+		is.EqualTo(doc.Groups[0].Uses[0].Href, "#background"),
+		is.EqualTo(doc.Groups[0].Uses[0].Class, "background red"),
+		is.EqualTo(doc.Groups[1].ID, "layer-tokens"),
+		is.EqualTo(doc.Groups[1].Uses[0].Href, "#token-pawn"),
+		is.EqualTo(doc.Groups[1].Uses[0].Class, "token orange"),
+		is.EqualTo(doc.Groups[2].ID, "layer-walls"),
+		is.EqualTo(doc.Groups[2].Uses[0].Href, "#wall-top-wall"),
+		is.EqualTo(doc.Groups[2].Uses[0].Class, "wall wall grey"),
+	)
+}
+
+func TestParsePDFParams(t *testing.T) {
+	p, err := parsePDFParams(url.Values{})
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(p.Paper, "a4"),
+	)
+
+	p, err = parsePDFParams(url.Values{"paper": {"letter"}})
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(p.Paper, "letter"),
+	)
+
+	_, err = parsePDFParams(url.Values{"paper": {"a3"}})
+	expect.That(t, is.Error(err, ErrInvalidRenderParameter))
+}
+
+func TestRenderPDF(t *testing.T) {
+	tests := map[string]struct {
+		cols, rows int
+		paper      string
+		pages      int
+	}{
+		"single":       {7, 10, "a4", 1},
+		"a4":           {16, 20, "a4", 6},
+		"letter":       {16, 20, "letter", 9},
+		"tooManyPages": {200, 200, "a4", 0},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := renderPDF("test", NewLayout(test.cols, test.rows), pdfParams{Paper: test.paper})
+			if test.pages == 0 {
+				expect.That(t, is.Error(err, ErrInvalidRenderParameter))
+				return
+			}
+
+			expect.That(t,
+				expect.FailNow(is.NoError(err)),
+				is.EqualTo(bytes.Contains(data, []byte(fmt.Sprintf("/Count %d", test.pages))), true),
+				is.EqualTo(bytes.Contains(data, []byte(fmt.Sprintf("(test - page %d of %d", test.pages, test.pages))), true),
+			)
+		})
+	}
+}
+
+// countingCanvas counts the primitives drawn onto it.
+type countingCanvas struct {
+	fills, strokes int
+}
+
+func (c *countingCanvas) FillPolygon(polygon, color.RGBA)                { c.fills++ }
+func (c *countingCanvas) StrokeLine(_, _ point, _ float64, _ color.RGBA) { c.strokes++ }
+
+func TestDrawArea(t *testing.T) {
+	l, err := ParseLayout("4x4:r16:-16:-32")
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	var c countingCanvas
+	drawArea(&c, l, renderOptions{Transparent: true}, Area{Col: 1, Row: 1, Cols: 2, Rows: 2})
+	expect.That(t,
+		is.EqualTo(c.fills, 4),
+		is.EqualTo(c.strokes, 6),
+	)
+}
+
+func TestTileArea(t *testing.T) {
+	l := NewLayout(20, 20)
+
+	expect.That(t,
+		is.EqualTo(tileArea(l, 0, 0, 500, 700), Area{Cols: 8, Rows: 11}),
+		is.EqualTo(tileArea(l, 482, 682, 500, 700), Area{Col: 5, Row: 8, Cols: 10, Rows: 12}),
+		is.EqualTo(tileArea(l, 1400, 1400, 500, 700), Area{Col: 18, Row: 18, Cols: 2, Rows: 2}),
+	)
+}
@@ -0,0 +1,158 @@
+package grid
+
+import (
+	"context"
+	"time"
+)
+
+// Revision is a snapshot of a grid's values taken every time the grid is
+// saved. Revisions are numbered using the grid's version.
+type Revision struct {
+	Number  int
+	Created time.Time
+	Values
+}
+
+// CellState describes the content of a single cell.
+type CellState struct {
+	Background Color
+	Token      *Token
+	LeftWall   *Wall
+	TopWall    *Wall
+}
+
+func (s CellState) equal(o CellState) bool {
+	return s.Background == o.Background &&
+		equalPtr(s.Token, o.Token) &&
+		equalPtr(s.LeftWall, o.LeftWall) &&
+		equalPtr(s.TopWall, o.TopWall)
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// CellAt returns the state of the given cell. Cells outside of l are reported
+// as empty.
+func (l Layout) CellAt(col, row int) CellState {
+	if !l.Contains(col, row) {
+		return CellState{}
+	}
+
+	return CellState{
+		Background: l.BackgroundAt(col, row),
+		Token:      l.TokenAt(col, row),
+		LeftWall:   l.WallAt(col, row, WallPositionLeft),
+		TopWall:    l.WallAt(col, row, WallPositionTop),
+	}
+}
+
+// CellChange describes the change of a single cell between two layouts.
+type CellChange struct {
+	Col, Row      int
+	Before, After CellState
+}
+
+// Diff describes the changes between two revisions.
+type Diff struct {
+	From, To             Revision
+	FromLayout, ToLayout Layout
+	Cells                []CellChange
+}
+
+// DiffLayouts returns the changes of all cells that differ between from and
+// to. Cells only present in one of both layouts (due to resizing) are
+// compared to an empty cell.
+func DiffLayouts(from, to Layout) []CellChange {
+	var changes []CellChange
+
+	for row := 0; row < max(from.Rows, to.Rows); row++ {
+		for col := 0; col < max(from.Cols, to.Cols); col++ {
+			before := from.CellAt(col, row)
+			after := to.CellAt(col, row)
+			if !before.equal(after) {
+				changes = append(changes, CellChange{Col: col, Row: row, Before: before, After: after})
+			}
+		}
+	}
+
+	return changes
+}
+
+// ListRevisions lists all revisions kept for the grid identified by id.
+func (svc *GridService) ListRevisions(ctx context.Context, id string) ([]Revision, error) {
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.repo.ListRevisions(grid.ownerID, grid.id)
+}
+
+// LoadRevision loads a single revision of the grid identified by id.
+func (svc *GridService) LoadRevision(ctx context.Context, id string, number int) (Revision, error) {
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return svc.repo.LoadRevision(grid.ownerID, grid.id, number)
+}
+
+// DiffRevisions computes the changes between the revisions from and to of the
+// grid identified by id.
+func (svc *GridService) DiffRevisions(ctx context.Context, id string, from, to int) (Diff, error) {
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return Diff{}, err
+	}
+
+	d := Diff{}
+
+	d.From, err = svc.repo.LoadRevision(grid.ownerID, grid.id, from)
+	if err != nil {
+		return Diff{}, err
+	}
+
+	d.To, err = svc.repo.LoadRevision(grid.ownerID, grid.id, to)
+	if err != nil {
+		return Diff{}, err
+	}
+
+	d.FromLayout, err = ParseLayout(d.From.Descriptor)
+	if err != nil {
+		return Diff{}, err
+	}
+
+	d.ToLayout, err = ParseLayout(d.To.Descriptor)
+	if err != nil {
+		return Diff{}, err
+	}
+
+	d.Cells = DiffLayouts(d.FromLayout, d.ToLayout)
+
+	return d, nil
+}
+
+// RestoreRevision restores the values of a revision of the grid identified by
+// id. Restoring creates a new revision; the restored revision and all
+// revisions following it are kept.
+func (svc *GridService) RestoreRevision(ctx context.Context, id string, number int) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	rev, err := svc.repo.LoadRevision(grid.ownerID, grid.id, number)
+	if err != nil {
+		return err
+	}
+
+	return svc.update(ctx, id, rev.Values)
+}
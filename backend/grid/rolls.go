@@ -0,0 +1,162 @@
+package grid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/halimath/d20-tools/auth"
+	"github.com/halimath/d20-tools/dice"
+)
+
+// Roll is a roll of dice recorded in a grid's roll log. Rolls are numbered in
+// the order they have been made.
+type Roll struct {
+	Number   int
+	Created  time.Time
+	RollerID string
+	Roller   string
+	// Private rolls are only visible to the grid's owner and editors, who act
+	// as game masters.
+	Private bool
+	// Session is the commitment of the fair session the roll has been made
+	// in. It is empty for rolls made outside of fair sessions.
+	Session string
+	// Nonce is the nonce chosen by the roller for rolls made in a fair
+	// session.
+	Nonce  string
+	Result dice.Result
+}
+
+// RollOptions defines the options of a roll.
+type RollOptions struct {
+	// Private rolls are only visible to owner and editors.
+	Private bool
+	// Nonce is mixed into rolls made during a fair session.
+	Nonce string
+}
+
+// ErrInvalidRollQuery is returned when listing rolls with invalid
+// pagination parameters.
+var ErrInvalidRollQuery = errors.New("invalid roll query")
+
+const (
+	// DefaultRollPageSize is the number of rolls returned by ListRolls unless
+	// requested otherwise.
+	DefaultRollPageSize = 50
+
+	// MaxRollPageSize is the maximum number of rolls returned by ListRolls.
+	MaxRollPageSize = 200
+)
+
+// Roll rolls expr on behalf of the principal found in ctx and appends the roll
+// to the roll log of the grid identified by id. The roll is delivered to all
+// subscribers of the grid. Private rolls may only be made by owner and
+// editors. While a fair session is active, the dice are derived from the
+// session's seed and the nonce given in opts.
+func (svc *GridService) Roll(ctx context.Context, id string, expr dice.Expression, opts RollOptions) (Roll, error) {
+	principal := auth.FromContext(ctx)
+	if principal == nil {
+		return Roll{}, ErrForbidden
+	}
+
+	return svc.roll(ctx, *principal, id, expr, opts)
+}
+
+// roll rolls expr on behalf of principal. Access to the grid is authorized
+// using ctx.
+func (svc *GridService) roll(ctx context.Context, principal auth.Principal, id string, expr dice.Expression, opts RollOptions) (Roll, error) {
+	grid, share, err := svc.authorize(ctx, id, RoleViewer)
+	if err != nil {
+		return Roll{}, err
+	}
+
+	if opts.Private && !svc.seesFog(ctx, grid, share) {
+		return Roll{}, ErrForbidden
+	}
+
+	roller := principal.Name
+	if roller == "" {
+		roller = principal.ID
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	last, err := svc.repo.lastRollNumber(grid.ownerID, grid.id)
+	if err != nil {
+		return Roll{}, err
+	}
+
+	roll := Roll{
+		Number:   last + 1,
+		Created:  time.Now(),
+		RollerID: principal.ID,
+		Roller:   roller,
+		Private:  opts.Private,
+	}
+
+	session, fair, err := svc.activeFairSession(grid.ownerID, grid.id)
+	if err != nil {
+		return Roll{}, err
+	}
+
+	if fair {
+		roll.Session = session.Commitment
+		roll.Nonce = opts.Nonce
+		roll.Result = expr.Roll(dice.NewSeededSource(session.Seed, rollMessage(roll.Number, roll.Nonce)))
+	} else {
+		roll.Result = expr.Roll(svc.dice)
+	}
+
+	return roll, svc.repo.AddRoll(grid.ownerID, grid.id, roll)
+}
+
+// ListRolls lists the rolls of the grid identified by id starting with the
+// most recent one. If before is positive, only rolls numbered lower than
+// before are returned. At most limit rolls are returned. Private rolls are
+// only listed for owner and editors. If older rolls are left, next is the
+// value of before listing them; it is 0 otherwise.
+func (svc *GridService) ListRolls(ctx context.Context, id string, before, limit int) (rolls []Roll, next int, err error) {
+	if limit < 1 || limit > MaxRollPageSize {
+		return nil, 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidRollQuery, MaxRollPageSize)
+	}
+
+	grid, share, err := svc.authorize(ctx, id, RoleViewer)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	private := svc.seesFog(ctx, grid, share)
+
+	n, err := svc.repo.lastRollNumber(grid.ownerID, grid.id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if before > 0 {
+		n = min(n, before-1)
+	}
+
+	rolls = make([]Roll, 0, limit)
+	for ; n > 0; n-- {
+		roll, err := svc.repo.LoadRoll(grid.ownerID, grid.id, n)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if roll.Private && !private {
+			continue
+		}
+
+		if len(rolls) == limit {
+			return rolls, rolls[limit-1].Number, nil
+		}
+		rolls = append(rolls, roll)
+	}
+
+	return rolls, 0, nil
+}
@@ -0,0 +1,170 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/auth"
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+// fixedSource is a dice.Source always returning the highest value.
+type fixedSource struct{}
+
+func (fixedSource) Intn(n int) int { return n - 1 }
+
+func TestRepository_rolls(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "2x1:-2:-2:-4"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gm := repo.Subscribe(ctx, "owner", "grid", nil, nil)
+	player := repo.Subscribe(ctx, "owner", "grid", nil, playerViewFilter)
+
+	private := Roll{
+		Number:   1,
+		Created:  time.Unix(1700000000, 0),
+		RollerID: "owner",
+		Roller:   "GM",
+		Private:  true,
+		Result:   dice.MustParse("1d20+5").Roll(fixedSource{}),
+	}
+	public := Roll{
+		Number:   2,
+		Created:  time.Unix(1700000010, 0),
+		RollerID: "player",
+		Roller:   "Player",
+		Result:   dice.MustParse("4d6kh3r1-1").Roll(fixedSource{}),
+	}
+
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.AddRoll("owner", "grid", private))),
+		expect.FailNow(is.NoError(repo.AddRoll("owner", "grid", public))),
+		is.Error(repo.AddRoll("owner", "grid", public), shelf.ErrConflict),
+	)
+
+	gmFirst := <-gm.C()
+	gmSecond := <-gm.C()
+	playerFirst := <-player.C()
+
+	loaded, err := repo.LoadRoll("owner", "grid", 2)
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(loaded, public),
+	)
+
+	last, err := repo.lastRollNumber("owner", "grid")
+
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(last, 2),
+		is.EqualTo(gmFirst.Type, EventRolled),
+		is.EqualTo(gmFirst.Roll.Result.Total, 25),
+		is.EqualTo(gmSecond.Roll.Number, 2),
+		// Private rolls are not delivered to players.
+		is.EqualTo(playerFirst.Type, EventRolled),
+		is.EqualTo(playerFirst.Roll.Number, 2),
+	)
+
+	_, err = repo.LoadRoll("owner", "grid", 3)
+	expect.That(t, is.Error(err, ErrNotFound))
+}
+
+func TestGridService_rolls(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+	svc := NewService(repo)
+	svc.dice = fixedSource{}
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "1x1:-1:-1:-2"},
+	}
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.Create(g))),
+		expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "gm", Role: RoleEditor, Created: time.Now()}))),
+		expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", Share{Token: "player", Role: RoleViewer, Created: time.Now()}))),
+	)
+
+	gm := ContextWithShareToken(context.Background(), "gm")
+	player := ContextWithShareToken(context.Background(), "player")
+	expr := dice.MustParse("1d20")
+
+	_, err := svc.roll(player, auth.Principal{ID: "player"}, "owner:grid", expr, RollOptions{Private: true})
+	expect.That(t, is.Error(err, ErrForbidden))
+
+	// Rolls 2 and 4 are private.
+	for n := 1; n <= 5; n++ {
+		var roll Roll
+		if n%2 == 0 {
+			roll, err = svc.roll(gm, auth.Principal{ID: "gm"}, "owner:grid", expr, RollOptions{Private: true})
+		} else {
+			roll, err = svc.roll(player, auth.Principal{ID: "player", Name: "Player"}, "owner:grid", expr, RollOptions{})
+		}
+		expect.That(t,
+			expect.FailNow(is.NoError(err)),
+			is.EqualTo(roll.Number, n),
+			is.EqualTo(roll.Result.Total, 20),
+		)
+	}
+
+	numbers := func(rolls []Roll) []int {
+		n := make([]int, len(rolls))
+		for i, r := range rolls {
+			n[i] = r.Number
+		}
+		return n
+	}
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		before, limit int
+		want          []int
+		next          int
+	}{
+		{"gm", gm, 0, 2, []int{5, 4}, 4},
+		{"gm before", gm, 4, 2, []int{3, 2}, 2},
+		{"gm last page", gm, 2, 2, []int{1}, 0},
+		{"gm all", gm, 0, 5, []int{5, 4, 3, 2, 1}, 0},
+		{"player", player, 0, 2, []int{5, 3}, 3},
+		{"player last page", player, 4, 2, []int{3, 1}, 0},
+		{"player beyond last", player, 100, 1, []int{5}, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rolls, next, err := svc.ListRolls(test.ctx, "owner:grid", test.before, test.limit)
+			expect.That(t,
+				is.NoError(err),
+				is.DeepEqualTo(numbers(rolls), test.want),
+				is.EqualTo(next, test.next),
+			)
+		})
+	}
+
+	_, _, err = svc.ListRolls(gm, "owner:grid", 0, MaxRollPageSize+1)
+	expect.That(t, is.Error(err, ErrInvalidRollQuery))
+}
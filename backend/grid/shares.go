@@ -0,0 +1,160 @@
+package grid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/random"
+)
+
+// Share is a secret token granting access to a single grid without being a
+// collaborator. Shares are created by the grid's owner and are passed as part
+// of the URL.
+type Share struct {
+	Token   string
+	Role    Role
+	Created time.Time
+	// Expires is the point in time after which the share is no longer valid.
+	// A zero value means the share never expires.
+	Expires time.Time
+	// MaxUses limits the number of requests authorized by this share. Zero
+	// means unlimited.
+	MaxUses int
+	// Uses counts the requests authorized by this share so far.
+	Uses int
+}
+
+// valid reports whether s may authorize another request at now.
+func (s Share) valid(now time.Time) bool {
+	if !s.Expires.IsZero() && !now.Before(s.Expires) {
+		return false
+	}
+
+	return s.MaxUses == 0 || s.Uses < s.MaxUses
+}
+
+var ErrInvalidShare = errors.New("invalid share")
+
+type shareTokenContextKey struct{}
+
+// ContextWithShareToken returns a context derived from ctx carrying token to
+// be used for authorizing access to grids.
+func ContextWithShareToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, shareTokenContextKey{}, token)
+}
+
+func shareTokenFromContext(ctx context.Context) string {
+	t, _ := ctx.Value(shareTokenContextKey{}).(string)
+	return t
+}
+
+// authorizeShare checks whether the share token found in ctx grants the
+// required role for grid. If so, the use is counted and the share is
+// returned. It returns ErrForbidden otherwise.
+func (svc *GridService) authorizeShare(ctx context.Context, grid Grid, required Role) (Share, error) {
+	token := shareTokenFromContext(ctx)
+	if token == "" {
+		return Share{}, ErrForbidden
+	}
+
+	svc.sharesMu.Lock()
+	defer svc.sharesMu.Unlock()
+
+	share, err := svc.repo.LoadShare(grid.ownerID, grid.id, token)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Share{}, ErrForbidden
+		}
+		return Share{}, err
+	}
+
+	if !share.valid(time.Now()) || !share.Role.Allows(required) {
+		return Share{}, ErrForbidden
+	}
+
+	share.Uses++
+	if err := svc.repo.SaveShare(grid.ownerID, grid.id, share); err != nil {
+		return Share{}, err
+	}
+
+	return share, nil
+}
+
+// CreateShare creates a new share for the grid identified by id. Only the
+// owner may create shares.
+func (svc *GridService) CreateShare(ctx context.Context, id string, role Role, expires time.Time, maxUses int) (Share, error) {
+	if role != RoleViewer && role != RoleEditor {
+		return Share{}, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	if maxUses < 0 {
+		return Share{}, fmt.Errorf("%w: negative use limit", ErrInvalidShare)
+	}
+
+	now := time.Now()
+	if !expires.IsZero() && !expires.After(now) {
+		return Share{}, fmt.Errorf("%w: expiry is in the past", ErrInvalidShare)
+	}
+
+	grid, err := svc.loadAuthorized(ctx, id, RoleOwner)
+	if err != nil {
+		return Share{}, err
+	}
+
+	share := Share{
+		Token:   generateShareToken(),
+		Role:    role,
+		Created: now,
+		Expires: expires,
+		MaxUses: maxUses,
+	}
+
+	return share, svc.repo.SaveShare(grid.ownerID, grid.id, share)
+}
+
+// ListShares lists all shares of the grid identified by id ordered by
+// creation. Only the owner may list shares.
+func (svc *GridService) ListShares(ctx context.Context, id string) ([]Share, error) {
+	grid, err := svc.loadAuthorized(ctx, id, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := svc.repo.ListShares(grid.ownerID, grid.id)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(shares, func(a, b Share) int {
+		return a.Created.Compare(b.Created)
+	})
+
+	return shares, nil
+}
+
+// RevokeShare deletes the share identified by token. All subscriptions
+// authorized by this share are closed. Only the owner may revoke shares.
+func (svc *GridService) RevokeShare(ctx context.Context, id, token string) error {
+	grid, err := svc.loadAuthorized(ctx, id, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	svc.sharesMu.Lock()
+	defer svc.sharesMu.Unlock()
+
+	if _, err := svc.repo.LoadShare(grid.ownerID, grid.id, token); err != nil {
+		return err
+	}
+
+	return svc.repo.DeleteShare(grid.ownerID, grid.id, token)
+}
+
+// generateShareToken returns a URL-safe, cryptographically secure random
+// token.
+func generateShareToken() string {
+	return random.Token(32)
+}
@@ -0,0 +1,86 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestShare_valid(t *testing.T) {
+	now := time.Now()
+
+	tests := map[string]struct {
+		share Share
+		want  bool
+	}{
+		"unlimited":      {Share{}, true},
+		"notExpired":     {Share{Expires: now.Add(time.Minute)}, true},
+		"expired":        {Share{Expires: now}, false},
+		"usesLeft":       {Share{MaxUses: 2, Uses: 1}, true},
+		"usesExhausted":  {Share{MaxUses: 2, Uses: 2}, false},
+		"expiredAndUses": {Share{Expires: now.Add(-time.Minute), MaxUses: 2}, false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			expect.That(t, is.EqualTo(test.share.valid(now), test.want))
+		})
+	}
+}
+
+func TestRepository_Subscribe_revokedShare(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	g := Grid{
+		id:           "grid",
+		ownerID:      "owner",
+		LastModified: time.Now(),
+		Version:      1,
+		Values:       Values{Label: "test", Descriptor: "1x1:-1:-1:-2"},
+	}
+	expect.That(t, expect.FailNow(is.NoError(repo.Create(g))))
+
+	share := Share{Token: "token", Role: RoleViewer, Created: time.Now()}
+	expect.That(t, expect.FailNow(is.NoError(repo.SaveShare("owner", "grid", share))))
+
+	loaded, err := repo.LoadShare("owner", "grid", "token")
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		is.EqualTo(loaded.Role, RoleViewer),
+	)
+
+	sup := repo.Subscribe(context.Background(), "owner", "grid", &share, nil)
+
+	expect.That(t, expect.FailNow(is.NoError(repo.DeleteShare("owner", "grid", "token"))))
+
+	select {
+	case _, ok := <-sup.C():
+		expect.That(t, is.EqualTo(ok, false))
+	case <-time.After(time.Second):
+		t.Fatal("subscription has not been closed")
+	}
+}
+
+func TestRepository_Subscribe_expiredShare(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	share := Share{Token: "token", Role: RoleViewer, Expires: time.Now().Add(10 * time.Millisecond)}
+	sup := repo.Subscribe(context.Background(), "owner", "grid", &share, nil)
+
+	select {
+	case _, ok := <-sup.C():
+		expect.That(t, is.EqualTo(ok, false))
+	case <-time.After(time.Second):
+		t.Fatal("subscription has not been closed")
+	}
+}
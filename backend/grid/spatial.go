@@ -0,0 +1,256 @@
+package grid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/halimath/d20-tools/grid/geometry"
+)
+
+// Settings contains per grid settings used when measuring on a grid.
+type Settings struct {
+	// Diagonal defines how diagonal steps are counted.
+	Diagonal geometry.DiagonalRule
+	// Scale is the length of a single cell measured in Unit.
+	Scale float64
+	// Unit is the unit of length, i.e. "ft" or "m".
+	Unit string
+}
+
+// DefaultSettings are used for grids without explicit settings.
+var DefaultSettings = Settings{
+	Diagonal: geometry.DiagonalUniform,
+	Scale:    5,
+	Unit:     "ft",
+}
+
+var ErrInvalidSettings = errors.New("invalid settings")
+
+func (s Settings) validate() error {
+	if _, err := geometry.ParseDiagonalRule(string(s.Diagonal)); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSettings, err)
+	}
+	if s.Scale <= 0 || math.IsInf(s.Scale, 0) || math.IsNaN(s.Scale) {
+		return fmt.Errorf("%w: scale must be positive", ErrInvalidSettings)
+	}
+	if s.Unit == "" {
+		return fmt.Errorf("%w: missing unit", ErrInvalidSettings)
+	}
+	return nil
+}
+
+// Settings loads the settings of the grid identified by id.
+func (svc *GridService) Settings(ctx context.Context, id string) (Settings, error) {
+	grid, err := svc.loadAuthorized(ctx, id, RoleViewer)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	return svc.repo.LoadSettings(grid.ownerID, grid.id)
+}
+
+// UpdateSettings stores the settings of the grid identified by id. Only owner
+// and editors may change settings.
+func (svc *GridService) UpdateSettings(ctx context.Context, id string, s Settings) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	grid, err := svc.loadAuthorized(ctx, id, RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	return svc.repo.SaveSettings(grid.ownerID, grid.id, s)
+}
+
+// Measurement is the distance between two cells.
+type Measurement struct {
+	// Cells is the distance counted in cells.
+	Cells float64
+	// Distance is the distance measured in Unit.
+	Distance float64
+	Unit     string
+}
+
+// Distance measures the distance between the cells from and to of the grid
+// identified by id using the grid's settings.
+func (svc *GridService) Distance(ctx context.Context, id string, from, to geometry.Cell) (Measurement, error) {
+	m, settings, err := svc.spatialMap(ctx, id)
+	if err != nil {
+		return Measurement{}, err
+	}
+
+	if err := checkCells(m, from, to); err != nil {
+		return Measurement{}, err
+	}
+
+	cells := settings.Diagonal.Distance(from, to)
+
+	return Measurement{
+		Cells:    cells,
+		Distance: cells * settings.Scale,
+		Unit:     settings.Unit,
+	}, nil
+}
+
+// LineOfSight reports whether the cell to can be seen from the cell from on
+// the grid identified by id.
+func (svc *GridService) LineOfSight(ctx context.Context, id string, from, to geometry.Cell, opts geometry.SightOptions) (bool, error) {
+	m, _, err := svc.spatialMap(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	if err := checkCells(m, from, to); err != nil {
+		return false, err
+	}
+
+	return m.LineOfSight(from, to, opts), nil
+}
+
+// Cover computes the cells covered by an area of effect template placed on
+// the grid identified by id. In contrast to geometry.Template, size is given
+// in the grid's unit of length.
+func (svc *GridService) Cover(ctx context.Context, id string, t geometry.Template, opts geometry.SightOptions) (geometry.Coverage, error) {
+	m, settings, err := svc.spatialMap(ctx, id)
+	if err != nil {
+		return geometry.Coverage{}, err
+	}
+
+	t.Size /= settings.Scale
+
+	return m.Cover(t, settings.Diagonal, opts)
+}
+
+// DifficultTerrain selects the cells treated as difficult terrain by their
+// background color.
+type DifficultTerrain struct {
+	// All treats every cell with a background color as difficult terrain.
+	All bool
+	// Colors lists the background colors of difficult terrain.
+	Colors []Color
+}
+
+// applies reports whether a cell with background bg is difficult terrain.
+func (d DifficultTerrain) applies(bg Color) bool {
+	if bg == "" {
+		return false
+	}
+	return d.All || slices.Contains(d.Colors, bg)
+}
+
+// Route is the result of searching a path.
+type Route struct {
+	// Found is false if no path exists.
+	Found bool
+	Cells []geometry.Cell
+	// Cost is the movement cost measured in Unit.
+	Cost float64
+	Unit string
+}
+
+// FindPath searches the cheapest path a token may move from the cell from to
+// the cell to on the grid identified by id. Walls and windows block movement
+// while doors are passable. The grid's diagonal rule is used to count
+// diagonal steps; entering difficult terrain costs twice as much.
+func (svc *GridService) FindPath(ctx context.Context, id string, from, to geometry.Cell, difficult DifficultTerrain) (Route, error) {
+	l, settings, err := svc.spatialLayout(ctx, id)
+	if err != nil {
+		return Route{}, err
+	}
+
+	m := toGeometryMap(l)
+	if err := checkCells(m, from, to); err != nil {
+		return Route{}, err
+	}
+
+	opts := geometry.PathOptions{Rule: settings.Diagonal}
+	if difficult.All || len(difficult.Colors) > 0 {
+		opts.Difficult = func(c geometry.Cell) bool {
+			return difficult.applies(l.BackgroundAt(c.Col, c.Row))
+		}
+	}
+
+	path, ok := m.FindPath(from, to, opts)
+
+	return Route{
+		Found: ok,
+		Cells: path.Cells,
+		Cost:  path.Cost * settings.Scale,
+		Unit:  settings.Unit,
+	}, nil
+}
+
+// spatialMap loads the grid identified by id and converts it into a
+// geometry.Map. Viewers receive the map of the grid's PlayerView, so that
+// hidden walls do not leak.
+func (svc *GridService) spatialMap(ctx context.Context, id string) (*geometry.Map, Settings, error) {
+	l, settings, err := svc.spatialLayout(ctx, id)
+	if err != nil {
+		return nil, Settings{}, err
+	}
+
+	return toGeometryMap(l), settings, nil
+}
+
+// spatialLayout loads the layout and settings of the grid identified by id.
+// Viewers receive the layout of the grid's PlayerView.
+func (svc *GridService) spatialLayout(ctx context.Context, id string) (Layout, Settings, error) {
+	grid, err := svc.Load(ctx, id)
+	if err != nil {
+		return Layout{}, Settings{}, err
+	}
+
+	l, err := ParseLayout(grid.Descriptor)
+	if err != nil {
+		return Layout{}, Settings{}, err
+	}
+
+	settings, err := svc.repo.LoadSettings(grid.ownerID, grid.id)
+	if err != nil {
+		return Layout{}, Settings{}, err
+	}
+
+	return l, settings, nil
+}
+
+var geometryBarriers = map[WallSymbol]geometry.Barrier{
+	WallSymbolWall:   geometry.Wall,
+	WallSymbolDoor:   geometry.Door,
+	WallSymbolWindow: geometry.Window,
+}
+
+var geometrySides = map[WallPosition]geometry.Side{
+	WallPositionLeft: geometry.Left,
+	WallPositionTop:  geometry.Top,
+}
+
+// toGeometryMap converts the walls of l into a geometry.Map.
+func toGeometryMap(l Layout) *geometry.Map {
+	m := geometry.NewMap(l.Cols, l.Rows)
+
+	for row := 0; row < l.Rows; row++ {
+		for col := 0; col < l.Cols; col++ {
+			for _, pos := range WallPositions {
+				if w := l.WallAt(col, row, pos); w != nil {
+					m.SetBarrier(geometry.Cell{Col: col, Row: row}, geometrySides[pos], geometryBarriers[w.Symbol])
+				}
+			}
+		}
+	}
+
+	return m
+}
+
+func checkCells(m *geometry.Map, cells ...geometry.Cell) error {
+	for _, c := range cells {
+		if !m.Contains(c) {
+			return fmt.Errorf("%w: %s outside of grid", geometry.ErrInvalidCell, c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package grid
+
+import (
+	"testing"
+
+	"github.com/halimath/d20-tools/grid/geometry"
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestToGeometryMap(t *testing.T) {
+	l := NewLayout(2, 2)
+	l.SetWallAt(1, 0, WallPositionLeft, &Wall{Symbol: WallSymbolDoor, Color: ColorBrown})
+	l.SetWallAt(0, 1, WallPositionTop, &Wall{Symbol: WallSymbolWindow, Color: ColorBlue})
+
+	m := toGeometryMap(l)
+
+	expect.That(t,
+		is.EqualTo(m.Barrier(geometry.Cell{Col: 1, Row: 0}, geometry.Left), geometry.Door),
+		is.EqualTo(m.Barrier(geometry.Cell{Col: 0, Row: 1}, geometry.Top), geometry.Window),
+		is.EqualTo(m.Barrier(geometry.Cell{Col: 1, Row: 1}, geometry.Top), geometry.None),
+	)
+}
+
+func TestRepository_Settings(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	settings, err := repo.LoadSettings("owner", "grid")
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(settings, DefaultSettings),
+	)
+
+	want := Settings{Diagonal: geometry.DiagonalAlternating, Scale: 1.5, Unit: "m"}
+	expect.That(t, expect.FailNow(is.NoError(repo.SaveSettings("owner", "grid", want))))
+
+	settings, err = repo.LoadSettings("owner", "grid")
+	expect.That(t,
+		is.NoError(err),
+		is.EqualTo(settings, want),
+		is.Error(Settings{Diagonal: "diagonal", Scale: 1, Unit: "m"}.validate(), ErrInvalidSettings),
+		is.Error(Settings{Diagonal: geometry.DiagonalUniform, Unit: "m"}.validate(), ErrInvalidSettings),
+	)
+}
+
+func TestDifficultTerrain_applies(t *testing.T) {
+	expect.That(t,
+		is.EqualTo(DifficultTerrain{All: true}.applies(ColorGreen), true),
+		is.EqualTo(DifficultTerrain{All: true}.applies(""), false),
+		is.EqualTo(DifficultTerrain{Colors: []Color{ColorBrown}}.applies(ColorBrown), true),
+		is.EqualTo(DifficultTerrain{Colors: []Color{ColorBrown}}.applies(ColorGreen), false),
+		is.EqualTo(DifficultTerrain{}.applies(ColorGreen), false),
+	)
+}
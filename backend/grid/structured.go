@@ -0,0 +1,166 @@
+package grid
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StructuredMediaType is the media type used to negotiate the structured JSON
+// representation of a grid. The structured representation contains typed
+// values instead of the run length encoded descriptor and is meant to be used
+// by external tools.
+const StructuredMediaType = "application/vnd.d20-grid+json"
+
+type (
+	BackgroundDTO struct {
+		Col   int   `json:"col"`
+		Row   int   `json:"row"`
+		Color Color `json:"color"`
+	}
+
+	TokenDTO struct {
+		Col    int         `json:"col"`
+		Row    int         `json:"row"`
+		Symbol TokenSymbol `json:"symbol"`
+		Color  Color       `json:"color"`
+	}
+
+	WallDTO struct {
+		Col      int          `json:"col"`
+		Row      int          `json:"row"`
+		Position WallPosition `json:"position"`
+		Kind     WallSymbol   `json:"kind"`
+		Color    Color        `json:"color"`
+	}
+
+	StructuredWriteDTO struct {
+		Label       string          `json:"label"`
+		Cols        int             `json:"cols"`
+		Rows        int             `json:"rows"`
+		Backgrounds []BackgroundDTO `json:"backgrounds"`
+		Tokens      []TokenDTO      `json:"tokens"`
+		Walls       []WallDTO       `json:"walls"`
+	}
+
+	StructuredReadDTO struct {
+		StructuredWriteDTO
+		ID           string `json:"id"`
+		LastModified string `json:"lastModified"`
+	}
+)
+
+// toStructuredDTO converts g into its structured representation.
+func toStructuredDTO(g Grid) (StructuredReadDTO, error) {
+	l, err := ParseLayout(g.Descriptor)
+	if err != nil {
+		return StructuredReadDTO{}, err
+	}
+
+	return StructuredReadDTO{
+		StructuredWriteDTO: layoutToStructuredDTO(g.Label, l),
+		ID:                 g.ID(),
+		LastModified:       g.LastModified.Format(time.RFC3339),
+	}, nil
+}
+
+func layoutToStructuredDTO(label string, l Layout) StructuredWriteDTO {
+	dto := StructuredWriteDTO{
+		Label:       label,
+		Cols:        l.Cols,
+		Rows:        l.Rows,
+		Backgrounds: []BackgroundDTO{},
+		Tokens:      []TokenDTO{},
+		Walls:       []WallDTO{},
+	}
+
+	for row := 0; row < l.Rows; row++ {
+		for col := 0; col < l.Cols; col++ {
+			if c := l.BackgroundAt(col, row); c != "" {
+				dto.Backgrounds = append(dto.Backgrounds, BackgroundDTO{Col: col, Row: row, Color: c})
+			}
+
+			if t := l.TokenAt(col, row); t != nil {
+				dto.Tokens = append(dto.Tokens, TokenDTO{Col: col, Row: row, Symbol: t.Symbol, Color: t.Color})
+			}
+
+			for _, pos := range WallPositions {
+				if w := l.WallAt(col, row, pos); w != nil {
+					dto.Walls = append(dto.Walls, WallDTO{Col: col, Row: row, Position: pos, Kind: w.Symbol, Color: w.Color})
+				}
+			}
+		}
+	}
+
+	return dto
+}
+
+// Values converts dto into the values stored for a grid. It returns an error
+// wrapping ErrInvalidDescriptor if dto contains values out of range.
+func (dto StructuredWriteDTO) Values() (Values, error) {
+	if !IsValidLayoutSize(dto.Cols, dto.Rows) {
+		return Values{}, fmt.Errorf("%w: invalid size %dx%d", ErrInvalidDescriptor, dto.Cols, dto.Rows)
+	}
+
+	l := NewLayout(dto.Cols, dto.Rows)
+
+	for _, b := range dto.Backgrounds {
+		if !l.Contains(b.Col, b.Row) || !IsValidColor(b.Color) {
+			return Values{}, fmt.Errorf("%w: invalid background at %d/%d", ErrInvalidDescriptor, b.Col, b.Row)
+		}
+		l.SetBackgroundAt(b.Col, b.Row, b.Color)
+	}
+
+	for _, t := range dto.Tokens {
+		if !l.Contains(t.Col, t.Row) || !IsValidColor(t.Color) || !IsValidTokenSymbol(t.Symbol) {
+			return Values{}, fmt.Errorf("%w: invalid token at %d/%d", ErrInvalidDescriptor, t.Col, t.Row)
+		}
+		l.SetTokenAt(t.Col, t.Row, &Token{Symbol: t.Symbol, Color: t.Color})
+	}
+
+	for _, w := range dto.Walls {
+		if !l.Contains(w.Col, w.Row) || !IsValidColor(w.Color) || !IsValidWallSymbol(w.Kind) || !IsValidWallPosition(w.Position) {
+			return Values{}, fmt.Errorf("%w: invalid wall at %d/%d", ErrInvalidDescriptor, w.Col, w.Row)
+		}
+		l.SetWallAt(w.Col, w.Row, w.Position, &Wall{Symbol: w.Kind, Color: w.Color})
+	}
+
+	return Values{
+		Label:      dto.Label,
+		Descriptor: l.Descriptor(),
+	}, nil
+}
+
+// acceptsStructured reports whether r lists StructuredMediaType in its Accept
+// header.
+func acceptsStructured(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mediaType == StructuredMediaType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isStructured reports whether r's body is sent using StructuredMediaType.
+func isStructured(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == StructuredMediaType
+}
+
+// writeStructured writes g in its structured representation to w.
+func writeStructured(w http.ResponseWriter, g Grid) error {
+	dto, err := toStructuredDTO(g)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", StructuredMediaType)
+	return json.NewEncoder(w).Encode(dto)
+}
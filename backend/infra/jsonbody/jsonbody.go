@@ -0,0 +1,38 @@
+// Package jsonbody reads JSON encoded request bodies.
+package jsonbody
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"slices"
+
+	"github.com/halimath/kvlog"
+)
+
+// ErrUnsupportedMediaType is returned by Read for requests not sending JSON.
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Read reads a JSON value of type T from r's body. The request's content type
+// must be application/json or one of mediaTypes. If the body cannot be read,
+// an error response has been sent to w when Read returns the error.
+func Read[T any](w http.ResponseWriter, r *http.Request, mediaTypes ...string) (t T, err error) {
+	logger := kvlog.FromContext(r.Context())
+
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "application/json" && !slices.Contains(mediaTypes, mediaType)) {
+		logger.Logs("unsupported media type", kvlog.WithKV("contentType", contentType))
+		http.Error(w, "not a JSON request", http.StatusUnsupportedMediaType)
+		return t, ErrUnsupportedMediaType
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&t); err != nil {
+		logger.Logs("json unmarshalling error", kvlog.WithErr(err))
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return t, err
+	}
+
+	return t, nil
+}
@@ -0,0 +1,47 @@
+package jsonbody
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+type payload struct {
+	Name string `json:"name"`
+}
+
+func TestRead(t *testing.T) {
+	tests := map[string]struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		"json":        {"application/json; charset=utf-8", `{"name":"a"}`, http.StatusOK},
+		"custom":      {"application/vnd.test+json", `{"name":"a"}`, http.StatusOK},
+		"unsupported": {"text/plain", `{"name":"a"}`, http.StatusUnsupportedMediaType},
+		"missing":     {"", `{"name":"a"}`, http.StatusUnsupportedMediaType},
+		"invalid":     {"application/json", `{"name":`, http.StatusBadRequest},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			r.Header.Set("Content-Type", test.contentType)
+			w := httptest.NewRecorder()
+
+			p, err := Read[payload](w, r, "application/vnd.test+json")
+
+			expect.That(t,
+				is.EqualTo(err == nil, test.status == http.StatusOK),
+				is.EqualTo(w.Code, test.status),
+			)
+			if err == nil {
+				expect.That(t, is.EqualTo(p.Name, "a"))
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+// Package pdf is a minimal writer for PDF documents consisting of vector
+// graphics and single line texts.
+// pdf supports just enough of the PDF 1.4 specification to produce printable
+// documents: pages of arbitrary size, paths filled or stroked in RGB colors,
+// clipping, and text set in the standard Helvetica font.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Standard page sizes in points (1/72 inch).
+const (
+	A4Width      = 595
+	A4Height     = 842
+	LetterWidth  = 612
+	LetterHeight = 792
+)
+
+// Color is an RGB color with channels ranging from 0 to 255.
+type Color struct {
+	R, G, B uint8
+}
+
+// Document is a PDF document under construction.
+type Document struct {
+	pages []*Page
+}
+
+// New creates a new, empty document.
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage adds a new page of the given size in points and returns it.
+func (d *Document) AddPage(width, height float64) *Page {
+	p := &Page{width: width, height: height}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Page is a single page of a document. All drawing methods append operators
+// to the page's content stream. Coordinates are given in points with the
+// origin in the lower left corner of the page.
+type Page struct {
+	width, height float64
+	content       bytes.Buffer
+}
+
+// Width returns the page's width in points.
+func (p *Page) Width() float64 { return p.width }
+
+// Height returns the page's height in points.
+func (p *Page) Height() float64 { return p.height }
+
+func (p *Page) op(operator string, operands ...float64) {
+	for _, o := range operands {
+		p.content.WriteString(formatNumber(o))
+		p.content.WriteByte(' ')
+	}
+	p.content.WriteString(operator)
+	p.content.WriteByte('\n')
+}
+
+// SaveState pushes the current graphics state.
+func (p *Page) SaveState() { p.op("q") }
+
+// RestoreState pops the graphics state saved with the last call to SaveState.
+func (p *Page) RestoreState() { p.op("Q") }
+
+// Transform concatenates the given matrix to the current transformation
+// matrix.
+func (p *Page) Transform(a, b, c, d, e, f float64) { p.op("cm", a, b, c, d, e, f) }
+
+// SetFillColor sets the color used to fill paths and text.
+func (p *Page) SetFillColor(c Color) {
+	p.op("rg", float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+}
+
+// SetStrokeColor sets the color used to stroke paths.
+func (p *Page) SetStrokeColor(c Color) {
+	p.op("RG", float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+}
+
+// SetLineWidth sets the width used to stroke paths.
+func (p *Page) SetLineWidth(w float64) { p.op("w", w) }
+
+// SetRoundCaps makes stroked lines end with round caps and joins.
+func (p *Page) SetRoundCaps() {
+	p.op("J", 1)
+	p.op("j", 1)
+}
+
+// SetDash sets the dash pattern used to stroke paths. Calling SetDash without
+// arguments resets to solid lines.
+func (p *Page) SetDash(pattern ...float64) {
+	parts := make([]string, len(pattern))
+	for i, v := range pattern {
+		parts[i] = formatNumber(v)
+	}
+	fmt.Fprintf(&p.content, "[%s] 0 d\n", strings.Join(parts, " "))
+}
+
+// MoveTo begins a new subpath at x, y.
+func (p *Page) MoveTo(x, y float64) { p.op("m", x, y) }
+
+// LineTo appends a straight line to x, y to the current subpath.
+func (p *Page) LineTo(x, y float64) { p.op("l", x, y) }
+
+// Rect appends a rectangle as a complete subpath.
+func (p *Page) Rect(x, y, w, h float64) { p.op("re", x, y, w, h) }
+
+// ClosePath closes the current subpath.
+func (p *Page) ClosePath() { p.op("h") }
+
+// Fill fills the current path using the nonzero winding rule.
+func (p *Page) Fill() { p.op("f") }
+
+// Stroke strokes the current path.
+func (p *Page) Stroke() { p.op("S") }
+
+// Clip intersects the clipping area with the current path and ends the path.
+func (p *Page) Clip() {
+	p.op("W")
+	p.op("n")
+}
+
+// Text draws s using Helvetica of the given size with the baseline starting
+// at x, y. Characters not available in the WinAnsi encoding are replaced with
+// a question mark.
+func (p *Page) Text(x, y, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F1 %s Tf %s %s Td (%s) Tj ET\n", formatNumber(size), formatNumber(x), formatNumber(y), escapeText(s))
+}
+
+// WriteTo writes the document to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	var offsets []int
+
+	beginObject := func() int {
+		offsets = append(offsets, buf.Len())
+		n := len(offsets)
+		fmt.Fprintf(&buf, "%d 0 obj\n", n)
+		return n
+	}
+	endObject := func() {
+		buf.WriteString("endobj\n")
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Object numbers are assigned in order: catalog, page tree, font and then
+	// a pair of page and content stream for every page.
+	const (
+		catalogObj = 1
+		pagesObj   = 2
+		fontObj    = 3
+	)
+	pageObj := func(i int) int { return fontObj + 1 + 2*i }
+
+	beginObject()
+	fmt.Fprintf(&buf, "<< /Type /Catalog /Pages %d 0 R >>\n", pagesObj)
+	endObject()
+
+	beginObject()
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pageObj(i))
+	}
+	fmt.Fprintf(&buf, "<< /Type /Pages /Kids [%s] /Count %d >>\n", strings.Join(kids, " "), len(d.pages))
+	endObject()
+
+	beginObject()
+	buf.WriteString("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>\n")
+	endObject()
+
+	for i, p := range d.pages {
+		beginObject()
+		fmt.Fprintf(&buf, "<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>\n",
+			pagesObj, formatNumber(p.width), formatNumber(p.height), fontObj, pageObj(i)+1)
+		endObject()
+
+		beginObject()
+		fmt.Fprintf(&buf, "<< /Length %d >>\nstream\n", p.content.Len())
+		buf.Write(p.content.Bytes())
+		buf.WriteString("\nendstream\n")
+		endObject()
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, catalogObj, xref)
+
+	return buf.WriteTo(w)
+}
+
+// Bytes returns the encoded document.
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	d.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// formatNumber formats v as a PDF number using at most three decimal places.
+func formatNumber(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 3, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" || s == "" {
+		return "0"
+	}
+	return s
+}
+
+// escapeText encodes s as the content of a PDF literal string using the
+// WinAnsi encoding.
+func escapeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
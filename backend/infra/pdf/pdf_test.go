@@ -0,0 +1,69 @@
+package pdf
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestDocument(t *testing.T) {
+	doc := New()
+
+	p := doc.AddPage(A4Width, A4Height)
+	p.SetFillColor(Color{255, 0, 0})
+	p.Rect(10, 10, 100, 50)
+	p.Fill()
+	p.Text(10, 800, 12, "Grid (1/2) – ä")
+
+	doc.AddPage(LetterWidth, LetterHeight)
+
+	data := doc.Bytes()
+
+	expect.That(t,
+		is.EqualTo(bytes.HasPrefix(data, []byte("%PDF-1.4\n")), true),
+		is.EqualTo(bytes.HasSuffix(data, []byte("%%EOF\n")), true),
+		is.EqualTo(bytes.Contains(data, []byte("/Count 2")), true),
+		is.EqualTo(bytes.Contains(data, []byte("/MediaBox [0 0 595 842]")), true),
+		is.EqualTo(bytes.Contains(data, []byte("/MediaBox [0 0 612 792]")), true),
+		is.EqualTo(bytes.Contains(data, []byte("1 0 0 rg\n10 10 100 50 re\nf\n")), true),
+		is.EqualTo(bytes.Contains(data, []byte(`(Grid \(1/2\) ? \344) Tj`)), true),
+	)
+
+	// Verify that every xref entry points to the start of its object.
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	expect.That(t, expect.FailNow(is.SliceOfLen(startxref, 2)))
+
+	xref, err := strconv.Atoi(string(startxref[1]))
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		expect.FailNow(is.EqualTo(string(data[xref:xref+4]), "xref")),
+	)
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	expect.That(t, is.SliceOfLen(entries, 7))
+
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		want := strconv.Itoa(i+1) + " 0 obj\n"
+		expect.That(t, is.EqualTo(string(data[offset:offset+len(want)]), want))
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := map[float64]string{
+		0:       "0",
+		1:       "1",
+		-0.0001: "0",
+		1.5:     "1.5",
+		7.2:     "7.2",
+		1.23456: "1.235",
+	}
+
+	for in, want := range tests {
+		expect.That(t, is.EqualTo(formatNumber(in), want))
+	}
+}
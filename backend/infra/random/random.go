@@ -0,0 +1,35 @@
+// Package random generates random identifiers.
+package random
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
+)
+
+const idChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// ID generates a random alphanumeric id of the given length.
+func ID(length int) string {
+	result := make([]byte, length)
+
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(idChars))))
+		if err != nil {
+			panic(err)
+		}
+		result[i] = idChars[n.Int64()]
+	}
+
+	return string(result)
+}
+
+// Token returns a URL-safe token encoding size cryptographically secure random
+// bytes.
+func Token(size int) string {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
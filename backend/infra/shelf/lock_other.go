@@ -0,0 +1,10 @@
+//go:build !unix
+
+package shelf
+
+import "os"
+
+// lockFile is a no-op on platforms without flock.
+func lockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package shelf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile acquires an exclusive lock on f which is released when f is
+// closed. It fails with ErrLocked if f is locked already.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+	if err != nil {
+		return fmt.Errorf("%w: failed to lock database: %v", ErrShelfOperationFailed, err)
+	}
+	return nil
+}
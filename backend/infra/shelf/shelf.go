@@ -12,6 +12,7 @@ import (
 	"io"
 	"os"
 	"slices"
+	"strconv"
 	"sync"
 
 	"github.com/google/uuid"
@@ -28,6 +29,10 @@ var (
 
 	// Sentinel error value used to report updates on non existing keys.
 	ErrNotFound = errors.New("not found")
+
+	// Sentinel error value used to report that a database file is already in
+	// use by another shelf.
+	ErrLocked = errors.New("shelf: database is in use")
 )
 
 // Reader defines a common interface for reading operations.
@@ -51,11 +56,21 @@ type Writer interface {
 	// exist.
 	Update(key, value []byte) error
 
+	// Put sets the data stored for key to data regardless of whether key
+	// exists or not.
+	Put(key, data []byte) error
+
 	// Delete deletes the value associated with key. If no such key exists nil
 	// is returned.
 	Delete(key []byte) error
 }
 
+// ReadWriter combines Reader and Writer.
+type ReadWriter interface {
+	Reader
+	Writer
+}
+
 type record struct {
 	data []byte
 }
@@ -70,7 +85,9 @@ type Shelf struct {
 
 // OpenFile opens a new shelf using filename to persistently store data. If the
 // file named filename already exists it is read to prefill the shelf. If
-// the file named filename does not exist, this operation creates it.
+// the file named filename does not exist, this operation creates it. The file
+// is locked until the shelf is closed; opening a file in use by another shelf
+// fails with ErrLocked.
 func OpenFile(filename string) (*Shelf, error) {
 	exists := false
 	_, err := os.Stat(filename)
@@ -85,6 +102,10 @@ func OpenFile(filename string) (*Shelf, error) {
 		if err != nil {
 			return nil, fmt.Errorf("%w: failed to create database: %v", ErrShelfOperationFailed, err)
 		}
+		if err := lockFile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
 		return Open(f), nil
 	}
 
@@ -92,6 +113,10 @@ func OpenFile(filename string) (*Shelf, error) {
 	if err != nil {
 		return nil, fmt.Errorf("%w: failed to open database: %v", ErrShelfOperationFailed, err)
 	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
 	s := Open(f)
 	err = s.populate(f)
 
@@ -221,6 +246,32 @@ func (s *Shelf) Update(key, data []byte) error {
 	return nil
 }
 
+// Put sets key in s to value. In contrast to Insert and Update it does not
+// care whether key exists or not.
+func (s *Shelf) Put(key, data []byte) error {
+	s.lock.Lock()
+	_, exists := trie.Get(s.entries, key)
+	err := set(key, data, s.entries, s.writer)
+	s.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	evtType := Inserted
+	if exists {
+		evtType = Updated
+	}
+
+	s.notify(&ChangeEvent{
+		Type: evtType,
+		Key:  key,
+		Data: data,
+	})
+
+	return nil
+}
+
 // Delete deletes the value associated with key.
 func (s *Shelf) Delete(key []byte) error {
 	s.lock.Lock()
@@ -240,13 +291,19 @@ func (s *Shelf) Delete(key []byte) error {
 }
 
 func (s *Shelf) notify(evt *ChangeEvent) {
-	trie.Walk(s.subscriptions, evt.Key, func(subs *[]*Subscription) error {
-		for _, sub := range *subs {
-			sub.c <- evt
-		}
-
+	// Collect the subscriptions first, so a subscriber cancelling its
+	// subscription does not wait for the notification to complete.
+	var subs []*Subscription
+	s.lock.RLock()
+	trie.Walk(s.subscriptions, evt.Key, func(found *[]*Subscription) error {
+		subs = append(subs, *found...)
 		return nil
 	})
+	s.lock.RUnlock()
+
+	for _, sub := range subs {
+		sub.send(evt)
+	}
 }
 
 // --
@@ -392,10 +449,31 @@ type Subscription struct {
 	s                         *Shelf
 	keyPrefix, subscriptionID []byte
 	c                         chan *ChangeEvent
+	// cancelled is closed to release notifications blocked on c when the
+	// subscription is cancelled.
+	cancelled chan struct{}
+	// mu guards closing c while notifications are sent.
+	mu     sync.RWMutex
+	closed bool
 }
 
 func (s *Subscription) C() <-chan *ChangeEvent { return s.c }
 
+// send sends evt to the subscriber unless the subscription has been cancelled.
+func (s *Subscription) send(evt *ChangeEvent) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.c <- evt:
+	case <-s.cancelled:
+	}
+}
+
 func (s *Subscription) Cancel() {
 	s.s.lock.Lock()
 	defer s.s.lock.Unlock()
@@ -413,7 +491,12 @@ func (s *Subscription) Cancel() {
 	}
 
 	trie.Put(s.s.subscriptions, s.keyPrefix, subs)
+
+	close(s.cancelled)
+	s.mu.Lock()
+	s.closed = true
 	close(s.c)
+	s.mu.Unlock()
 }
 
 func (s *Shelf) Subscribe(keyPrefix []byte) *Subscription {
@@ -423,6 +506,7 @@ func (s *Shelf) Subscribe(keyPrefix []byte) *Subscription {
 		keyPrefix:      make([]byte, len(keyPrefix)),
 		subscriptionID: id[:],
 		c:              make(chan *ChangeEvent, 4), // TODO: Make buffer size configurable
+		cancelled:      make(chan struct{}),
 	}
 	copy(sub.keyPrefix, keyPrefix)
 
@@ -490,6 +574,55 @@ func UpdateJSON(w Writer, key []byte, v any) error {
 	return w.Update(key, data)
 }
 
+// PutJSON is a convenience function to set the value in w for key to the JSON
+// marshalled data from v regardless of whether key exists or not. It returns
+// either an error from marshalling, setting or nil.
+func PutJSON(w Writer, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return w.Put(key, data)
+}
+
+// KeySuffixes returns the remainder following keyPrefix of all keys in r that
+// share keyPrefix. Other than iterating Keys - which holds a read lock while
+// iterating - the caller may access r while processing the result.
+func KeySuffixes(r Reader, keyPrefix []byte) []string {
+	var suffixes []string
+	for key := range r.Keys(keyPrefix) {
+		suffixes = append(suffixes, string(key[len(keyPrefix):]))
+	}
+	return suffixes
+}
+
+// KeyNumbers returns the suffixes of all keys in r sharing keyPrefix which are
+// decimal numbers in ascending order. Other suffixes are skipped.
+func KeyNumbers(r Reader, keyPrefix []byte) []int {
+	var numbers []int
+	for _, suffix := range KeySuffixes(r, keyPrefix) {
+		n, err := strconv.Atoi(suffix)
+		if err != nil {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+
+	slices.Sort(numbers)
+	return numbers
+}
+
+// DeletePrefix deletes all keys in rw sharing keyPrefix.
+func DeletePrefix(rw ReadWriter, keyPrefix []byte) error {
+	for _, suffix := range KeySuffixes(rw, keyPrefix) {
+		if err := rw.Delete(append(slices.Clip(keyPrefix), suffix...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ---
 
 type opCode byte
@@ -73,6 +73,22 @@ func TestShelf(t *testing.T) {
 	)
 }
 
+func TestOpenFile_locked(t *testing.T) {
+	filename := t.TempDir() + "/shelf.db"
+
+	shelf, err := OpenFile(filename)
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	_, err = OpenFile(filename)
+	expect.That(t, is.Error(err, ErrLocked))
+
+	expect.That(t, expect.FailNow(is.NoError(shelf.Close())))
+
+	shelf, err = OpenFile(filename)
+	expect.That(t, expect.FailNow(is.NoError(err)))
+	expect.That(t, is.NoError(shelf.Close()))
+}
+
 func TestShelf_Keys(t *testing.T) {
 	shelf := Open(nil)
 	defer shelf.Close()
@@ -137,6 +153,45 @@ func TestGetJSON(t *testing.T) {
 	)
 }
 
+func TestKeyNumbers_DeletePrefix(t *testing.T) {
+	shelf := Open(nil)
+	defer shelf.Close()
+
+	for _, key := range []string{"a/10", "a/2", "a/x", "b/1"} {
+		expect.That(t, expect.FailNow(is.NoError(shelf.Put([]byte(key), []byte("v")))))
+	}
+
+	expect.That(t,
+		is.DeepEqualTo(KeyNumbers(shelf, []byte("a/")), []int{2, 10}),
+		is.NoError(DeletePrefix(shelf, []byte("a/"))),
+		is.SliceOfLen(KeySuffixes(shelf, []byte("a/")), 0),
+		is.DeepEqualTo(KeySuffixes(shelf, []byte("b/")), []string{"1"}),
+	)
+}
+
+func TestShelf_Put(t *testing.T) {
+	shelf := Open(nil)
+	defer shelf.Close()
+
+	key := []byte("key")
+	sub := shelf.Subscribe(key)
+	defer sub.Cancel()
+
+	err := shelf.Put(key, []byte("foo"))
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	err = shelf.Put(key, []byte("bar"))
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	data, ok := shelf.Get(key)
+	expect.That(t,
+		is.EqualTo(ok, true),
+		is.DeepEqualTo(data, []byte("bar")),
+		is.EqualTo((<-sub.C()).Type, Inserted),
+		is.EqualTo((<-sub.C()).Type, Updated),
+	)
+}
+
 func TestShelf_concurrency(t *testing.T) {
 	const (
 		concurrencyLevel = 200
@@ -218,6 +273,31 @@ func TestShelf_Subscribe(t *testing.T) {
 	)
 }
 
+func TestSubscription_Cancel_pending(t *testing.T) {
+	shelf := Open(nil)
+	defer shelf.Close()
+
+	s := shelf.Subscribe([]byte("a"))
+
+	// Nobody reads from s, so the fifth put waits for the subscriber.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 5 {
+			shelf.Put([]byte("a"), nil)
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	s.Cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("put blocked after cancelling the subscription")
+	}
+}
+
 func TestReadEntry(t *testing.T) {
 	id := []byte("key")
 
@@ -0,0 +1,253 @@
+package macro
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/halimath/d20-tools/auth"
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/infra/jsonbody"
+	"github.com/halimath/httputils/response"
+	"github.com/halimath/kvlog"
+)
+
+type (
+	PartDTO struct {
+		Label      string   `json:"label"`
+		Kind       PartKind `json:"kind,omitempty"`
+		Expression string   `json:"expression"`
+	}
+
+	MacroDTO struct {
+		ID              string            `json:"id,omitempty"`
+		Name            string            `json:"name"`
+		Parts           []PartDTO         `json:"parts"`
+		Variables       map[string]string `json:"variables,omitempty"`
+		CritRange       int               `json:"critRange,omitempty"`
+		CritDoublesDice bool              `json:"critDoublesDice,omitempty"`
+	}
+
+	RollDTO struct {
+		Variables map[string]string `json:"variables,omitempty"`
+	}
+
+	PartResultDTO struct {
+		dice.ResultDTO
+		Label string   `json:"label"`
+		Kind  PartKind `json:"kind,omitempty"`
+	}
+
+	ExecutionDTO struct {
+		Number    int               `json:"number"`
+		Created   string            `json:"created"`
+		Name      string            `json:"name"`
+		Variables map[string]string `json:"variables,omitempty"`
+		Critical  bool              `json:"critical,omitempty"`
+		Parts     []PartResultDTO   `json:"parts"`
+	}
+)
+
+// Handler creates a http.Handler serving the macros of the authenticated
+// principal.
+func Handler(srv *MacroService) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		logger.Logs("listing macros for user")
+
+		macros, err := srv.List(r.Context())
+		if err != nil {
+			handleServiceError(w, r, err, "failed to list macros")
+			return
+		}
+
+		dtos := make([]MacroDTO, len(macros))
+		for i, m := range macros {
+			dtos[i] = toDTO(m)
+		}
+
+		response.JSON(w, r, dtos)
+	})
+
+	mux.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+
+		dto, err := jsonbody.Read[MacroDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		logger.Logs("creating macro", kvlog.WithKV("name", dto.Name))
+
+		m, err := srv.Create(r.Context(), fromDTO(dto))
+		if err != nil {
+			handleServiceError(w, r, err, "failed to create macro")
+			return
+		}
+
+		response.JSON(w, r, toDTO(m), response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("GET /{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("loading macro", kvlog.WithKV("id", id))
+
+		m, err := srv.Load(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to load macro")
+			return
+		}
+
+		response.JSON(w, r, toDTO(m))
+	})
+
+	mux.HandleFunc("PUT /{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		dto, err := jsonbody.Read[MacroDTO](w, r)
+		if err != nil {
+			return
+		}
+
+		logger.Logs("updating macro", kvlog.WithKV("id", id))
+
+		m, err := srv.Update(r.Context(), id, fromDTO(dto))
+		if err != nil {
+			handleServiceError(w, r, err, "failed to update macro")
+			return
+		}
+
+		response.JSON(w, r, toDTO(m))
+	})
+
+	mux.HandleFunc("DELETE /{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("deleting macro", kvlog.WithKV("id", id))
+
+		if err := srv.Delete(r.Context(), id); err != nil {
+			handleServiceError(w, r, err, "failed to delete macro")
+			return
+		}
+
+		response.NoContent(w, r)
+	})
+
+	mux.HandleFunc("POST /{id}/roll", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+
+		// The body is optional as all variables have default values.
+		var dto RollDTO
+		if r.ContentLength != 0 {
+			var err error
+			if dto, err = jsonbody.Read[RollDTO](w, r); err != nil {
+				return
+			}
+		}
+
+		logger.Logs("rolling macro", kvlog.WithKV("id", id))
+
+		x, err := srv.Roll(r.Context(), id, dto.Variables)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to roll macro")
+			return
+		}
+
+		response.JSON(w, r, toExecutionDTO(x), response.StatusCode(http.StatusCreated))
+	})
+
+	mux.HandleFunc("GET /{id}/executions", func(w http.ResponseWriter, r *http.Request) {
+		logger := kvlog.FromContext(r.Context())
+		id := r.PathValue("id")
+		logger.Logs("listing macro executions", kvlog.WithKV("id", id))
+
+		executions, err := srv.ListExecutions(r.Context(), id)
+		if err != nil {
+			handleServiceError(w, r, err, "failed to list macro executions")
+			return
+		}
+
+		dtos := make([]ExecutionDTO, len(executions))
+		for i, x := range executions {
+			dtos[i] = toExecutionDTO(x)
+		}
+
+		response.JSON(w, r, dtos)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.FromRequest(r) == nil {
+			response.PlainText(w, r, "unauthorized", response.StatusCode(http.StatusUnauthorized))
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func handleServiceError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, ErrForbidden):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	case errors.Is(err, ErrInvalidMacro):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		kvlog.FromContext(r.Context()).Logs(msg, kvlog.WithKV("id", r.PathValue("id")), kvlog.WithErr(err))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func toDTO(m Macro) MacroDTO {
+	dto := MacroDTO{
+		ID:              m.ID(),
+		Name:            m.Name,
+		Parts:           make([]PartDTO, len(m.Parts)),
+		Variables:       m.Variables,
+		CritRange:       m.CritRange,
+		CritDoublesDice: m.CritDoublesDice,
+	}
+	for i, p := range m.Parts {
+		dto.Parts[i] = PartDTO(p)
+	}
+	return dto
+}
+
+func fromDTO(dto MacroDTO) Macro {
+	m := Macro{
+		Name:            dto.Name,
+		Parts:           make([]Part, len(dto.Parts)),
+		Variables:       dto.Variables,
+		CritRange:       dto.CritRange,
+		CritDoublesDice: dto.CritDoublesDice,
+	}
+	for i, p := range dto.Parts {
+		m.Parts[i] = Part(p)
+	}
+	return m
+}
+
+func toExecutionDTO(x Execution) ExecutionDTO {
+	dto := ExecutionDTO{
+		Number:    x.Number,
+		Created:   x.Created.Format(time.RFC3339),
+		Name:      x.Name,
+		Variables: x.Variables,
+		Critical:  x.Critical,
+		Parts:     make([]PartResultDTO, len(x.Parts)),
+	}
+	for i, p := range x.Parts {
+		dto.Parts[i] = PartResultDTO{
+			ResultDTO: dice.ToResultDTO(p.Result),
+			Label:     p.Part.Label,
+			Kind:      p.Part.Kind,
+		}
+	}
+	return dto
+}
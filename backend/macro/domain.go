@@ -0,0 +1,417 @@
+// Package macro implements named roll macros saved per user. A macro consists
+// of several labeled dice expressions which are rolled together, such as an
+// attack roll and its damage. Expressions may contain variables which are
+// replaced with values given when rolling the macro.
+package macro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/halimath/d20-tools/auth"
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/infra/random"
+)
+
+// PartKind defines the role of a part when rolling a macro.
+type PartKind string
+
+const (
+	// PartOther parts are rolled as they are.
+	PartOther PartKind = ""
+	// PartAttack parts determine whether a macro rolled a critical hit.
+	PartAttack PartKind = "attack"
+	// PartDamage parts roll twice the dice on a critical hit if the macro's
+	// CritDoublesDice is set.
+	PartDamage PartKind = "damage"
+)
+
+// Part is a single labeled expression of a macro.
+type Part struct {
+	Label string
+	Kind  PartKind
+	// Expression is a dice expression which may contain variables written
+	// as {name}.
+	Expression string
+}
+
+// Macro is a named set of expressions rolled together.
+type Macro struct {
+	id      string
+	ownerID string
+
+	Name  string
+	Parts []Part
+	// Variables defines all variables used by the parts along with their
+	// default values.
+	Variables map[string]string
+	// CritRange is the lowest natural value of an attack's first die scoring
+	// a critical hit. Zero means the die's maximum.
+	CritRange int
+	// CritDoublesDice doubles the dice of damage parts on a critical hit.
+	CritDoublesDice bool
+}
+
+func (m Macro) ID() string { return m.id }
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrForbidden    = errors.New("forbidden")
+	ErrInvalidMacro = errors.New("invalid macro")
+)
+
+const (
+	maxParts          = 10
+	maxVariableLength = 32
+)
+
+var (
+	variablePattern      = regexp.MustCompile(`\{([a-zA-Z][a-zA-Z0-9_]*)\}`)
+	variableValuePattern = regexp.MustCompile(`^[a-zA-Z0-9%!+\- ]*$`)
+)
+
+// expand replaces all variables in expr with their values from vars.
+func expand(expr string, vars map[string]string) (dice.Expression, error) {
+	var err error
+	s := variablePattern.ReplaceAllStringFunc(expr, func(v string) string {
+		name := v[1 : len(v)-1]
+		value, ok := vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("%w: undefined variable %q", ErrInvalidMacro, name)
+		}
+		return value
+	})
+	if err != nil {
+		return dice.Expression{}, err
+	}
+
+	e, err := dice.Parse(s)
+	if err != nil {
+		return dice.Expression{}, fmt.Errorf("%w: %w", ErrInvalidMacro, err)
+	}
+	return e, nil
+}
+
+// checkVariables makes sure all values of vars are valid variable values.
+func checkVariables(vars map[string]string) error {
+	for name, value := range vars {
+		if len(value) > maxVariableLength || !variableValuePattern.MatchString(value) {
+			return fmt.Errorf("%w: invalid value for variable %q", ErrInvalidMacro, name)
+		}
+	}
+	return nil
+}
+
+// validate makes sure m is well defined and all of its parts expand to valid
+// expressions using the default values.
+func (m Macro) validate() error {
+	if strings.TrimSpace(m.Name) == "" {
+		return fmt.Errorf("%w: missing name", ErrInvalidMacro)
+	}
+
+	if len(m.Parts) == 0 || len(m.Parts) > maxParts {
+		return fmt.Errorf("%w: a macro must contain between 1 and %d parts", ErrInvalidMacro, maxParts)
+	}
+
+	for name := range m.Variables {
+		if !variablePattern.MatchString("{" + name + "}") {
+			return fmt.Errorf("%w: invalid variable name %q", ErrInvalidMacro, name)
+		}
+	}
+
+	if err := checkVariables(m.Variables); err != nil {
+		return err
+	}
+
+	for _, p := range m.Parts {
+		switch p.Kind {
+		case PartOther, PartAttack, PartDamage:
+		default:
+			return fmt.Errorf("%w: invalid part kind %q", ErrInvalidMacro, p.Kind)
+		}
+
+		e, err := expand(p.Expression, m.Variables)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Label, err)
+		}
+
+		if p.Kind == PartDamage && m.CritDoublesDice {
+			if _, err := doubleDice(e); err != nil {
+				return fmt.Errorf("%s: %w", p.Label, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PartResult is the result of rolling a single part.
+type PartResult struct {
+	Part   Part
+	Result dice.Result
+}
+
+// Execution is the recorded result of rolling a macro.
+type Execution struct {
+	Number    int
+	Created   time.Time
+	Name      string
+	Variables map[string]string
+	// Critical is set if an attack part scored a critical hit.
+	Critical bool
+	Parts    []PartResult
+}
+
+// Roll rolls all parts of m using src. vars override the default values of
+// m's variables. Attack parts are rolled first. If any of them scores a
+// critical hit and CritDoublesDice is set, the dice of all damage parts are
+// doubled.
+func (m Macro) Roll(src dice.Source, vars map[string]string) (Execution, error) {
+	for name := range vars {
+		if _, ok := m.Variables[name]; !ok {
+			return Execution{}, fmt.Errorf("%w: undefined variable %q", ErrInvalidMacro, name)
+		}
+	}
+	if err := checkVariables(vars); err != nil {
+		return Execution{}, err
+	}
+
+	values := maps.Clone(m.Variables)
+	if values == nil {
+		values = make(map[string]string)
+	}
+	maps.Copy(values, vars)
+
+	exprs := make([]dice.Expression, len(m.Parts))
+	for i, p := range m.Parts {
+		e, err := expand(p.Expression, values)
+		if err != nil {
+			return Execution{}, fmt.Errorf("%s: %w", p.Label, err)
+		}
+		exprs[i] = e
+	}
+
+	// Doubled damage dice are prepared up front, so a critical hit cannot
+	// fail after some parts have been rolled.
+	doubled := make([]dice.Expression, len(m.Parts))
+	if m.CritDoublesDice {
+		for i, p := range m.Parts {
+			if p.Kind != PartDamage {
+				continue
+			}
+			e, err := doubleDice(exprs[i])
+			if err != nil {
+				return Execution{}, fmt.Errorf("%s: %w", p.Label, err)
+			}
+			doubled[i] = e
+		}
+	}
+
+	x := Execution{
+		Name:      m.Name,
+		Variables: values,
+		Parts:     make([]PartResult, len(m.Parts)),
+	}
+
+	// Roll attacks first to find out about critical hits.
+	for _, kind := range []PartKind{PartAttack, PartOther, PartDamage} {
+		for i, p := range m.Parts {
+			if p.Kind != kind {
+				continue
+			}
+
+			e := exprs[i]
+			if kind == PartDamage && x.Critical && m.CritDoublesDice {
+				e = doubled[i]
+			}
+
+			r := e.Roll(src)
+			// Record the expression which has actually been rolled.
+			p.Expression = r.Expression.String()
+			x.Parts[i] = PartResult{Part: p, Result: r}
+
+			if kind == PartAttack && m.isCritical(r) {
+				x.Critical = true
+			}
+		}
+	}
+
+	return x, nil
+}
+
+// isCritical reports whether a kept die of r's first dice term shows a
+// natural value of at least m's crit range.
+func (m Macro) isCritical(r dice.Result) bool {
+	i := slices.IndexFunc(r.Terms, func(t dice.TermResult) bool { return !t.Term.IsConstant() })
+	if i < 0 {
+		return false
+	}
+
+	t := r.Terms[i]
+	threshold := m.CritRange
+	if threshold == 0 {
+		threshold = t.Term.Max()
+	}
+
+	return slices.ContainsFunc(t.Dice, func(d dice.Die) bool { return d.Kept && d.Value >= threshold })
+}
+
+// doubleDice returns e with twice the number of dice for every term. It
+// returns an error wrapping ErrInvalidMacro if the doubled expression is no
+// valid expression, i.e. because it rolls too many dice.
+func doubleDice(e dice.Expression) (dice.Expression, error) {
+	terms := slices.Clone(e.Terms)
+	for i := range terms {
+		if terms[i].IsConstant() {
+			continue
+		}
+		terms[i].Count *= 2
+		if terms[i].Select.Mode != dice.SelectAll {
+			terms[i].Select.N *= 2
+		}
+	}
+
+	doubled := dice.Expression{Terms: terms}
+	if _, err := dice.Parse(doubled.String()); err != nil {
+		return dice.Expression{}, fmt.Errorf("%w: cannot double dice of %s: %w", ErrInvalidMacro, e, err)
+	}
+	return doubled, nil
+}
+
+// --
+
+type MacroService struct {
+	repo *Repository
+	dice dice.Source
+	// mu serializes numbering executions.
+	mu sync.Mutex
+}
+
+func NewService(r *Repository) *MacroService {
+	return &MacroService{
+		repo: r,
+		dice: dice.CryptoSource,
+	}
+}
+
+func ownerFromContext(ctx context.Context) (string, error) {
+	principal := auth.FromContext(ctx)
+	if principal == nil {
+		return "", ErrForbidden
+	}
+	return principal.ID, nil
+}
+
+// List lists all macros of the principal found in ctx ordered by name.
+func (svc *MacroService) List(ctx context.Context) ([]Macro, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	macros, err := svc.repo.List(ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(macros, func(a, b Macro) int { return strings.Compare(a.Name, b.Name) })
+	return macros, nil
+}
+
+// Load loads the macro identified by id.
+func (svc *MacroService) Load(ctx context.Context, id string) (Macro, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return Macro{}, err
+	}
+
+	return svc.repo.Load(ownerID, id)
+}
+
+// Create creates a new macro owned by the principal found in ctx.
+func (svc *MacroService) Create(ctx context.Context, m Macro) (Macro, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return Macro{}, err
+	}
+
+	if err := m.validate(); err != nil {
+		return Macro{}, err
+	}
+
+	m.ownerID = ownerID
+	m.id = random.ID(16)
+
+	return m, svc.repo.Create(m)
+}
+
+// Update replaces the macro identified by id with m.
+func (svc *MacroService) Update(ctx context.Context, id string, m Macro) (Macro, error) {
+	original, err := svc.Load(ctx, id)
+	if err != nil {
+		return Macro{}, err
+	}
+
+	if err := m.validate(); err != nil {
+		return Macro{}, err
+	}
+
+	m.ownerID = original.ownerID
+	m.id = original.id
+
+	return m, svc.repo.Update(m)
+}
+
+// Delete deletes the macro identified by id including its executions.
+func (svc *MacroService) Delete(ctx context.Context, id string) error {
+	m, err := svc.Load(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return svc.repo.Delete(m.ownerID, m.id)
+}
+
+// Roll rolls the macro identified by id using vars and records the
+// execution.
+func (svc *MacroService) Roll(ctx context.Context, id string, vars map[string]string) (Execution, error) {
+	m, err := svc.Load(ctx, id)
+	if err != nil {
+		return Execution{}, err
+	}
+
+	x, err := m.Roll(svc.dice, vars)
+	if err != nil {
+		return Execution{}, err
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	numbers := svc.repo.executionNumbers(m.ownerID, m.id)
+	x.Number = 1
+	if len(numbers) > 0 {
+		x.Number = numbers[len(numbers)-1] + 1
+	}
+	x.Created = time.Now()
+
+	return x, svc.repo.AddExecution(m.ownerID, m.id, x)
+}
+
+// ListExecutions lists the recorded executions of the macro identified by id
+// starting with the most recent one.
+func (svc *MacroService) ListExecutions(ctx context.Context, id string) ([]Execution, error) {
+	m, err := svc.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.repo.ListExecutions(m.ownerID, m.id)
+}
@@ -0,0 +1,102 @@
+package macro
+
+import (
+	"testing"
+
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+// constSource is a dice.Source always returning the same value clamped to the
+// given bound.
+type constSource int
+
+func (s constSource) Intn(n int) int { return min(int(s), n-1) }
+
+func longsword() Macro {
+	return Macro{
+		Name: "Longsword",
+		Parts: []Part{
+			{Label: "slashing", Kind: PartDamage, Expression: "1d8+3+{extra}"},
+			{Label: "to hit", Kind: PartAttack, Expression: "1d20{adv}+5"},
+		},
+		Variables:       map[string]string{"adv": "", "extra": "0"},
+		CritDoublesDice: true,
+	}
+}
+
+func TestMacro_validate(t *testing.T) {
+	expect.That(t, is.NoError(longsword().validate()))
+
+	tests := map[string]func(m *Macro){
+		"missing name":       func(m *Macro) { m.Name = " " },
+		"no parts":           func(m *Macro) { m.Parts = nil },
+		"undefined variable": func(m *Macro) { m.Variables = nil },
+		"invalid expression": func(m *Macro) { m.Parts[0].Expression = "1d8+" },
+		"invalid kind":       func(m *Macro) { m.Parts[0].Kind = "heal" },
+		"invalid name":       func(m *Macro) { m.Variables["1x"] = "" },
+		"invalid value":      func(m *Macro) { m.Variables["adv"] = "}" },
+		"too many crit dice": func(m *Macro) { m.Parts[0].Expression = "60d6" },
+	}
+
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := longsword()
+			modify(&m)
+			expect.That(t, is.Error(m.validate(), ErrInvalidMacro))
+		})
+	}
+}
+
+func TestMacro_Roll(t *testing.T) {
+	x, err := longsword().Roll(constSource(0), nil)
+
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		is.EqualTo(x.Critical, false),
+		is.EqualTo(x.Parts[0].Part.Expression, "1d8+3+0"),
+		is.EqualTo(x.Parts[0].Result.Total, 4),
+		is.EqualTo(x.Parts[1].Part.Label, "to hit"),
+		is.EqualTo(x.Parts[1].Result.Total, 6),
+		is.DeepEqualTo(x.Variables, map[string]string{"adv": "", "extra": "0"}),
+	)
+}
+
+func TestMacro_Roll_critical(t *testing.T) {
+	x, err := longsword().Roll(constSource(100), map[string]string{"adv": "adv", "extra": "1d6"})
+
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		is.EqualTo(x.Critical, true),
+		is.EqualTo(x.Parts[1].Part.Expression, "2d20kh1+5"),
+		is.EqualTo(x.Parts[1].Result.Total, 25),
+		// Damage dice are doubled
+		is.EqualTo(x.Parts[0].Part.Expression, "2d8+3+2d6"),
+		is.EqualTo(x.Parts[0].Result.Total, 31),
+	)
+
+	m := longsword()
+	m.CritRange = 19
+	m.CritDoublesDice = false
+	x, err = m.Roll(constSource(18), nil)
+
+	expect.That(t,
+		expect.FailNow(is.NoError(err)),
+		is.EqualTo(x.Critical, true),
+		is.EqualTo(x.Parts[0].Part.Expression, "1d8+3+0"),
+	)
+}
+
+func TestMacro_Roll_invalidVariables(t *testing.T) {
+	for name, vars := range map[string]map[string]string{
+		"undefined":  {"bonus": "1"},
+		"invalid":    {"extra": "{adv}"},
+		"expression": {"extra": "1d"},
+		"critDice":   {"extra": "60d6"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := longsword().Roll(constSource(0), vars)
+			expect.That(t, is.Error(err, ErrInvalidMacro))
+		})
+	}
+}
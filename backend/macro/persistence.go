@@ -0,0 +1,255 @@
+package macro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/infra/shelf"
+)
+
+// ExecutionLimit is the number of executions kept per macro. Older
+// executions are removed when a new one is recorded.
+const ExecutionLimit = 100
+
+var ErrAlreadyExists = errors.New("already exists")
+
+type Repository struct {
+	s *shelf.Shelf
+}
+
+func NewRepository(s *shelf.Shelf) *Repository {
+	return &Repository{s: s}
+}
+
+type macroDBO struct {
+	Name            string            `json:"name"`
+	Parts           []partDBO         `json:"parts"`
+	Variables       map[string]string `json:"variables,omitempty"`
+	CritRange       int               `json:"crit_range,omitempty"`
+	CritDoublesDice bool              `json:"crit_doubles_dice,omitempty"`
+}
+
+type partDBO struct {
+	Label      string   `json:"label"`
+	Kind       PartKind `json:"kind,omitempty"`
+	Expression string   `json:"expression"`
+}
+
+type executionDBO struct {
+	Created   int64             `json:"created"`
+	Name      string            `json:"name"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Critical  bool              `json:"critical,omitempty"`
+	Parts     []partResultDBO   `json:"parts"`
+}
+
+type partResultDBO struct {
+	Label string   `json:"label"`
+	Kind  PartKind `json:"kind,omitempty"`
+	dice.Record
+}
+
+func indexKey(ownerID string) []byte {
+	return []byte("user/" + ownerID + "/macro/")
+}
+
+func macroKey(ownerID, id string) []byte {
+	return append(indexKey(ownerID), id...)
+}
+
+func executionsKey(ownerID, id string) []byte {
+	return append(macroKey(ownerID, id), "/executions/"...)
+}
+
+func executionKey(ownerID, id string, number int) []byte {
+	return fmt.Appendf(executionsKey(ownerID, id), "%d", number)
+}
+
+func (r *Repository) Create(m Macro) error {
+	err := shelf.InsertJSON(r.s, macroKey(m.ownerID, m.id), marshal(m))
+	if errors.Is(err, shelf.ErrConflict) {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+func (r *Repository) Update(m Macro) error {
+	err := shelf.UpdateJSON(r.s, macroKey(m.ownerID, m.id), marshal(m))
+	if errors.Is(err, shelf.ErrNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *Repository) Load(ownerID, id string) (Macro, error) {
+	var d macroDBO
+	ok, err := shelf.GetJSON(r.s, macroKey(ownerID, id), &d)
+	if err != nil {
+		return Macro{}, err
+	}
+	if !ok {
+		return Macro{}, ErrNotFound
+	}
+
+	m := Macro{
+		id:              id,
+		ownerID:         ownerID,
+		Name:            d.Name,
+		Parts:           make([]Part, len(d.Parts)),
+		Variables:       d.Variables,
+		CritRange:       d.CritRange,
+		CritDoublesDice: d.CritDoublesDice,
+	}
+	for i, p := range d.Parts {
+		m.Parts[i] = Part(p)
+	}
+
+	return m, nil
+}
+
+func (r *Repository) List(ownerID string) ([]Macro, error) {
+	prefix := indexKey(ownerID)
+
+	var ids []string
+	for key := range r.s.Keys(prefix) {
+		id := string(key[len(prefix):])
+		if strings.Contains(id, "/") {
+			// Not a macro but data associated with a macro.
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	var macros []Macro
+	for _, id := range ids {
+		m, err := r.Load(ownerID, id)
+		if err != nil {
+			return nil, err
+		}
+		macros = append(macros, m)
+	}
+
+	return macros, nil
+}
+
+// Delete deletes a macro and all of its executions.
+func (r *Repository) Delete(ownerID, id string) error {
+	if err := shelf.DeletePrefix(r.s, append(macroKey(ownerID, id), '/')); err != nil {
+		return err
+	}
+
+	return r.s.Delete(macroKey(ownerID, id))
+}
+
+// AddExecution records x for a macro and removes executions exceeding
+// ExecutionLimit.
+func (r *Repository) AddExecution(ownerID, id string, x Execution) error {
+	d := executionDBO{
+		Created:   x.Created.Unix(),
+		Name:      x.Name,
+		Variables: x.Variables,
+		Critical:  x.Critical,
+		Parts:     make([]partResultDBO, len(x.Parts)),
+	}
+	for i, p := range x.Parts {
+		d.Parts[i] = partResultDBO{
+			Label:  p.Part.Label,
+			Kind:   p.Part.Kind,
+			Record: dice.NewRecord(p.Result),
+		}
+	}
+
+	if err := shelf.InsertJSON(r.s, executionKey(ownerID, id, x.Number), d); err != nil {
+		return err
+	}
+
+	for _, n := range r.executionNumbers(ownerID, id) {
+		if n > x.Number-ExecutionLimit {
+			break
+		}
+
+		if err := r.s.Delete(executionKey(ownerID, id, n)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// executionNumbers returns the numbers of all executions recorded for a macro
+// in ascending order.
+func (r *Repository) executionNumbers(ownerID, id string) []int {
+	return shelf.KeyNumbers(r.s, executionsKey(ownerID, id))
+}
+
+// ListExecutions lists all executions recorded for a macro starting with the
+// most recent one.
+func (r *Repository) ListExecutions(ownerID, id string) ([]Execution, error) {
+	numbers := r.executionNumbers(ownerID, id)
+	slices.Reverse(numbers)
+
+	executions := make([]Execution, 0, len(numbers))
+	for _, n := range numbers {
+		data, ok := r.s.Get(executionKey(ownerID, id, n))
+		if !ok {
+			continue
+		}
+
+		x, err := unmarshalExecution(n, data)
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, x)
+	}
+
+	return executions, nil
+}
+
+func marshal(m Macro) macroDBO {
+	d := macroDBO{
+		Name:            m.Name,
+		Parts:           make([]partDBO, len(m.Parts)),
+		Variables:       m.Variables,
+		CritRange:       m.CritRange,
+		CritDoublesDice: m.CritDoublesDice,
+	}
+	for i, p := range m.Parts {
+		d.Parts[i] = partDBO(p)
+	}
+	return d
+}
+
+func unmarshalExecution(number int, data []byte) (Execution, error) {
+	var d executionDBO
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Execution{}, err
+	}
+
+	x := Execution{
+		Number:    number,
+		Created:   time.Unix(d.Created, 0),
+		Name:      d.Name,
+		Variables: d.Variables,
+		Critical:  d.Critical,
+		Parts:     make([]PartResult, len(d.Parts)),
+	}
+
+	for i, p := range d.Parts {
+		res, err := p.Result()
+		if err != nil {
+			return Execution{}, fmt.Errorf("execution %d: %w", number, err)
+		}
+
+		x.Parts[i] = PartResult{
+			Part:   Part{Label: p.Label, Kind: p.Kind, Expression: p.Expression},
+			Result: res,
+		}
+	}
+
+	return x, nil
+}
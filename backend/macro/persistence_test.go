@@ -0,0 +1,63 @@
+package macro
+
+import (
+	"testing"
+	"time"
+
+	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/expect"
+	"github.com/halimath/expect/is"
+)
+
+func TestRepository(t *testing.T) {
+	s := shelf.Open(nil)
+	defer s.Close()
+
+	repo := NewRepository(s)
+
+	m := longsword()
+	m.ownerID = "owner"
+	m.id = "sword"
+	expect.That(t,
+		expect.FailNow(is.NoError(repo.Create(m))),
+		is.Error(repo.Create(m), ErrAlreadyExists),
+	)
+
+	x, err := m.Roll(constSource(3), nil)
+	expect.That(t, expect.FailNow(is.NoError(err)))
+
+	for n := 1; n <= ExecutionLimit+2; n++ {
+		x.Number = n
+		x.Created = time.Unix(1700000000, 0)
+		expect.That(t, expect.FailNow(is.NoError(repo.AddExecution("owner", "sword", x))))
+	}
+
+	loaded, err := repo.Load("owner", "sword")
+	expect.That(t,
+		is.NoError(err),
+		is.DeepEqualTo(loaded, m),
+	)
+
+	macros, err := repo.List("owner")
+	expect.That(t,
+		is.NoError(err),
+		is.SliceOfLen(macros, 1),
+	)
+
+	executions, err := repo.ListExecutions("owner", "sword")
+	expect.That(t,
+		is.NoError(err),
+		expect.FailNow(is.SliceOfLen(executions, ExecutionLimit)),
+		is.EqualTo(executions[0].Number, ExecutionLimit+2),
+		is.DeepEqualTo(executions[0], x),
+	)
+
+	expect.That(t, expect.FailNow(is.NoError(repo.Delete("owner", "sword"))))
+
+	_, err = repo.Load("owner", "sword")
+	executions, _ = repo.ListExecutions("owner", "sword")
+	expect.That(t,
+		is.Error(err, ErrNotFound),
+		is.SliceOfLen(executions, 0),
+	)
+}
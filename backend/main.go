@@ -15,8 +15,11 @@ import (
 
 	"github.com/halimath/d20-tools/auth"
 	"github.com/halimath/d20-tools/config"
+	"github.com/halimath/d20-tools/dice"
+	"github.com/halimath/d20-tools/encounter"
 	"github.com/halimath/d20-tools/grid"
 	"github.com/halimath/d20-tools/infra/shelf"
+	"github.com/halimath/d20-tools/macro"
 	"github.com/halimath/httputils/response"
 	"github.com/halimath/httputils/securityheader"
 	"github.com/halimath/httputils/session"
@@ -31,6 +34,10 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import-bestiary" {
+		os.Exit(runImportBestiary(os.Args[2:]))
+	}
+
 	logger := kvlog.L
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -72,9 +79,12 @@ func runService(ctx context.Context) int {
 		os.Exit(3)
 	}
 
-	gridRepo := grid.NewRepository(shlf)
+	gridRepo := grid.NewRepository(shlf, grid.WithRevisionLimit(cfg.GridRevisionLimit))
 	gridSrv := grid.NewService(gridRepo)
 
+	macroSrv := macro.NewService(macro.NewRepository(shlf))
+	encounterSrv := encounter.NewService(encounter.NewRepository(shlf), encounter.WithGridService(gridSrv))
+
 	sessionStore := session.NewInMemoryStore(session.WithMaxTTL(time.Hour))
 
 	if cfg.DevMode {
@@ -93,6 +103,15 @@ func runService(ctx context.Context) int {
 	mux.Handle("/.well-known/version-info.json", createVersionInfoHandler())
 	mux.Handle("/", createFrontendHandler())
 	mux.Handle("/api/grid/", sessionMW(http.StripPrefix("/api/grid", grid.Handler(gridSrv))))
+	diceHandler := http.StripPrefix("/api", dice.Handler(dice.CryptoSource))
+	mux.Handle("/api/roll", diceHandler)
+	mux.Handle("/api/roll/", diceHandler)
+	mux.Handle("/api/macros/", sessionMW(http.StripPrefix("/api/macros", macro.Handler(macroSrv))))
+	encounterHandler := sessionMW(http.StripPrefix("/api", encounter.Handler(encounterSrv)))
+	mux.Handle("/api/kinds", encounterHandler)
+	mux.Handle("/api/kinds/", encounterHandler)
+	mux.Handle("/api/encounters", encounterHandler)
+	mux.Handle("/api/encounters/", encounterHandler)
 	mux.Handle("/auth/", sessionMW(http.StripPrefix("/auth", authHandler)))
 
 	handler := securityheader.Middleware(
@@ -52,8 +52,38 @@ export async function updateGrid(g: GameGrid): Promise<void> {
     }
 }
 
+/**
+ * Returns the query string to pass the share token found in the current
+ * location on to the API or an empty string if there is none.
+ */
+function shareQuery(): string {
+    const token = new URLSearchParams(document.location.search).get("share")
+    return token ? `?share=${encodeURIComponent(token)}` : ""
+}
+
+/**
+ * Creates a share token granting view access to the grid identified by id
+ * and returns the token.
+ */
+export async function createShare(id: string): Promise<string> {
+    const response = await fetch(`/api/grid/${id}/shares`, {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({ role: "viewer" }),
+    })
+
+    if (!response.ok) {
+        throw new Error(`Failed to share grid ${id}: ${response.statusText}`)
+    }
+
+    const dto = await response.json()
+    return dto.token
+}
+
 export async function loadGrid (id: string): Promise<GameGrid> {
-    const res = await fetch(`/api/grid/${id}`)
+    const res = await fetch(`/api/grid/${id}${shareQuery()}`)
     if (!res.ok) {
         throw new Error(`failed to load grid with id ${id}: ${res.statusText}`)
     }
@@ -73,7 +103,7 @@ export class Subsciption {
 
 export function subscribeForGrid(id: string, callback: GridUpdateCallback): Subsciption {
     console.log("Subscribing for grid", id)
-    const subEventSrc = new EventSource(`/api/grid/${id}/subscribe`)
+    const subEventSrc = new EventSource(`/api/grid/${id}/subscribe${shareQuery()}`)
 
     subEventSrc.onerror = (err) => {
         console.error("EventSource failed:", err)
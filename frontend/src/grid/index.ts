@@ -49,9 +49,9 @@ document.addEventListener("DOMContentLoaded", async () => {
             const id = route.substring("edit:".length)
             try {
                 const g = await loadGrid(id)
-                // Loading is allowed to anyone - grids can be viewed publicly.
-                // The next update request is to test if the user is authorized
-                // to edit this grid.
+                // Loading is allowed to the owner, collaborators and holders
+                // of a share token. The next update request is to test if the
+                // user is authorized to edit this grid.
                 try {
                     await updateGrid(g)
                     return new Editor(await loadGrid(id))
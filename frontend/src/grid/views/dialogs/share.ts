@@ -2,9 +2,10 @@ import * as wecco from "@weccoframework/core"
 import { modal } from "src/common/components/modal"
 import { m } from "../../../common/i18n"
 import { GameGrid } from "../../models/models"
+import { createShare } from "../../api/api"
 
-const ShareDialog = wecco.define("share-dialog", ({data}: wecco.RenderContext<{ grid: GameGrid }>) => {
-    const url = document.location.href.replace(/edit:.*$/, `view:${data.grid.id}`)
+const ShareDialog = wecco.define("share-dialog", ({data}: wecco.RenderContext<{ grid: GameGrid, token: string }>) => {
+    const url = document.location.href.replace(/edit:.*$/, `view:${data.grid.id}?share=${encodeURIComponent(data.token)}`)
     const onClick = () => {
         navigator.clipboard.writeText(url)        
     }
@@ -26,8 +27,14 @@ const ShareDialog = wecco.define("share-dialog", ({data}: wecco.RenderContext<{
         </div>`
 })
 
-export function showShareDialog(grid: GameGrid): void {
-    modal(ShareDialog({grid: grid}), {
+export async function showShareDialog(grid: GameGrid): Promise<void> {
+    if (!grid.id) {
+        return
+    }
+
+    const token = await createShare(grid.id)
+
+    modal(ShareDialog({grid: grid, token: token}), {
         show: true,
     })
 }
\ No newline at end of file